@@ -0,0 +1,371 @@
+// Package Batch watermarks whole directory trees: it walks an input root,
+// embeds a per-file or templated message in every matching image and writes
+// the results to a mirrored output tree, a bounded number at a time.
+package Batch
+
+import (
+	"InvisibleWaterMarkingSystem/ImageIO"
+	"InvisibleWaterMarkingSystem/Watermark"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config describes one batch run
+type Config struct {
+	InputDir  string
+	OutputDir string
+
+	// Include and Exclude are filepath.Match patterns. Patterns containing a
+	// slash match the path relative to InputDir, others the base name. With no
+	// Include patterns every file in a supported image format is taken.
+	Include   []string
+	Exclude   []string
+	Recursive bool
+
+	// Message is a template expanded per file by ExpandMessage. Messages holds
+	// per-file messages keyed by relative path, available as {message}; when
+	// it is set and Message is empty, the template defaults to "{message}".
+	Message  string
+	Messages map[string]string
+
+	// Format converts every output to this format (changing the extension);
+	// FormatUnknown keeps each file's own format
+	Format      ImageIO.Format
+	JPEGQuality int
+
+	Workers     int   // files processed concurrently; 0 means one per CPU
+	MemoryLimit int64 // bytes of estimated working memory in flight; 0 means unbounded
+	Overwrite   bool  // re-process files whose output is already newer than the input
+
+	Options  *Watermark.Options
+	Progress func(Result) // called once per file as it completes, from one goroutine at a time
+	Now      func() time.Time
+}
+
+// job is one file found by the walk
+type job struct {
+	index   int
+	rel     string // slash-separated, relative to InputDir
+	input   string
+	output  string
+	message string
+}
+
+// Run processes every matching file under cfg.InputDir. Failures of single
+// files are recorded in the summary; the returned error is reserved for bad
+// configuration, walk errors and cancellation.
+func Run(ctx context.Context, cfg Config) (*Summary, error) {
+	start := time.Now()
+	if cfg.InputDir == "" || cfg.OutputDir == "" {
+		return nil, errors.New("batch: input and output directories are required")
+	}
+	if cfg.Message == "" && cfg.Messages == nil {
+		return nil, errors.New("batch: a message template or per-file messages are required")
+	}
+	if cfg.Message == "" {
+		cfg.Message = "{message}"
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = runtime.NumCPU()
+	}
+	if cfg.Options == nil {
+		cfg.Options = Watermark.DefaultOptions()
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	for _, p := range append(append([]string(nil), cfg.Include...), cfg.Exclude...) {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("batch: bad pattern %q: %w", p, err)
+		}
+	}
+
+	jobs, err := collect(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, len(jobs))
+	budget := newMemoryBudget(cfg.MemoryLimit)
+	queue := make(chan *job)
+	var progressMu sync.Mutex
+	var wg sync.WaitGroup
+
+	for w := 0; w < cfg.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				r := process(ctx, cfg, budget, j)
+				results[j.index] = r
+				if cfg.Progress != nil {
+					progressMu.Lock()
+					cfg.Progress(r)
+					progressMu.Unlock()
+				}
+			}
+		}()
+	}
+
+feed:
+	for i := range jobs {
+		select {
+		case queue <- &jobs[i]:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	summary := &Summary{}
+	for _, r := range results {
+		if r.Status == "" {
+			// Never started because the run was cancelled
+			continue
+		}
+		summary.add(r)
+	}
+	summary.Duration = time.Since(start)
+	return summary, ctx.Err()
+}
+
+// collect walks the input tree and builds the job list in walk order. Two
+// inputs that would be written to the same output, such as a.jpg and a.png
+// converted by Format, are an error rather than one overwriting the other.
+func collect(cfg Config) ([]job, error) {
+	inputRoot, err := filepath.Abs(cfg.InputDir)
+	if err != nil {
+		return nil, err
+	}
+	outputRoot, err := filepath.Abs(cfg.OutputDir)
+	if err != nil {
+		return nil, err
+	}
+	now := cfg.Now()
+
+	var jobs []job
+	err = filepath.WalkDir(inputRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			// Never descend into our own output when it sits inside the input
+			if path == outputRoot || (path != inputRoot && !cfg.Recursive) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(inputRoot, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !selected(cfg, rel) {
+			return nil
+		}
+
+		perFile := cfg.Messages[rel]
+
+		output := filepath.Join(outputRoot, filepath.FromSlash(rel))
+		if cfg.Format != ImageIO.FormatUnknown {
+			output = strings.TrimSuffix(output, filepath.Ext(output)) + cfg.Format.Extension()
+		}
+
+		jobs = append(jobs, job{
+			index:   len(jobs),
+			rel:     rel,
+			input:   path,
+			output:  output,
+			message: ExpandMessage(cfg.Message, rel, len(jobs)+1, perFile, now),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("batch: walking %s: %w", cfg.InputDir, err)
+	}
+
+	inputs := make(map[string]string, len(jobs)) // output path to input
+	for _, j := range jobs {
+		if other, dup := inputs[j.output]; dup {
+			return nil, fmt.Errorf("batch: %s and %s would both be written to %s", other, j.rel, j.output)
+		}
+		inputs[j.output] = j.rel
+	}
+	return jobs, nil
+}
+
+// selected applies the include and exclude patterns to a relative path
+func selected(cfg Config, rel string) bool {
+	matches := func(patterns []string) bool {
+		for _, p := range patterns {
+			target := filepath.Base(rel)
+			if strings.Contains(p, "/") {
+				target = rel
+			}
+			if ok, _ := filepath.Match(p, target); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	if matches(cfg.Exclude) {
+		return false
+	}
+	if len(cfg.Include) == 0 {
+		return ImageIO.FormatFromPath(rel) != ImageIO.FormatUnknown
+	}
+	return matches(cfg.Include)
+}
+
+// upToDate reports whether output exists and is at least as new as input
+func upToDate(input, output string) bool {
+	in, err := os.Stat(input)
+	if err != nil {
+		return false
+	}
+	out, err := os.Stat(output)
+	if err != nil {
+		return false
+	}
+	return !out.ModTime().Before(in.ModTime())
+}
+
+// estimateMemory sizes a file's working set from its header
+func estimateMemory(path string) int64 {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	c, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0
+	}
+	return int64(c.Width) * int64(c.Height) * bytesPerPixel
+}
+
+func process(ctx context.Context, cfg Config, budget *memoryBudget, j *job) Result {
+	start := time.Now()
+	r := Result{Input: j.rel, Output: j.output, Message: j.message}
+	fail := func(err error) Result {
+		r.Status = StatusFailed
+		r.Error = err.Error()
+		r.Duration = time.Since(start)
+		return r
+	}
+
+	if !cfg.Overwrite && upToDate(j.input, j.output) {
+		r.Status = StatusSkipped
+		return r
+	}
+	if cfg.Messages != nil && strings.Contains(cfg.Message, "{message}") {
+		if _, ok := cfg.Messages[j.rel]; !ok {
+			return fail(errors.New("no message listed for this file"))
+		}
+	}
+	if j.message == "" {
+		return fail(errors.New("message is empty"))
+	}
+	if err := Watermark.CheckMessageLength(j.message, cfg.Options); err != nil {
+		return fail(err)
+	}
+
+	reserved, err := budget.acquire(ctx, estimateMemory(j.input))
+	if err != nil {
+		return fail(err)
+	}
+	defer budget.release(reserved)
+
+	if err := os.MkdirAll(filepath.Dir(j.output), 0o755); err != nil {
+		return fail(err)
+	}
+	if err := embedFile(cfg, j, &r); err != nil {
+		return fail(err)
+	}
+	r.Status = StatusOK
+	r.Duration = time.Since(start)
+	return r
+}
+
+// embedFile writes the watermarked file through a temporary name, so an
+// interrupted run never leaves a partial output that looks up to date
+func embedFile(cfg Config, j *job, r *Result) error {
+	tmp := j.output + ".partial"
+	defer os.Remove(tmp)
+
+	inFormat := ImageIO.FormatFromPath(j.input)
+	outFormat := cfg.Format
+	if outFormat == ImageIO.FormatUnknown {
+		outFormat = inFormat
+	}
+
+	if inFormat == ImageIO.FormatGIF && outFormat == ImageIO.FormatGIF {
+		g, err := ImageIO.ReadGIF(j.input)
+		if err != nil {
+			return err
+		}
+		return embedGIF(cfg, j, r, g, tmp)
+	}
+
+	img, _, meta, err := ImageIO.ReadFileWithMetadata(j.input)
+	if err != nil {
+		return err
+	}
+	img = ImageIO.AutoOrient(img, meta)
+
+	b := img.Bounds()
+	capacity := Watermark.Capacity(b.Dx(), b.Dy())
+	if capacity.Tiles() == 0 {
+		return fmt.Errorf("image is %dx%d; at least 256x256 is needed for one tile", b.Dx(), b.Dy())
+	}
+	r.Tiles = capacity.Tiles()
+
+	// Palette output needs the quantization-aware GIF embedder
+	if outFormat == ImageIO.FormatGIF {
+		frame := ImageIO.QuantizeToPalette(img, ImageIO.MedianCutPalette(img, nil, 256), nil, 0)
+		return embedGIF(cfg, j, r, &gif.GIF{Image: []*image.Paletted{frame}, Delay: []int{0}}, tmp)
+	}
+
+	marked := Watermark.EmbedWithOptions(img, j.message, cfg.Options)
+
+	encodeOptions := ImageIO.DefaultEncodeOptions()
+	if cfg.JPEGQuality > 0 {
+		encodeOptions.JPEGQuality = cfg.JPEGQuality
+	}
+	if outFormat == ImageIO.FormatJPEG {
+		encodeOptions.Metadata = meta
+		encodeOptions.XMPNote = "Invisible watermark embedded"
+	}
+	if err := ImageIO.WriteFile(tmp, marked, outFormat, encodeOptions); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.output)
+}
+
+func embedGIF(cfg Config, j *job, r *Result, g *gif.GIF, tmp string) error {
+	marked, err := Watermark.Embed_Watermark_GIF(g, j.message, cfg.Options)
+	if err != nil {
+		return err
+	}
+	if err := ImageIO.WriteGIF(tmp, marked); err != nil {
+		return err
+	}
+	r.Frames = len(marked.Image)
+	return os.Rename(tmp, j.output)
+}
@@ -0,0 +1,227 @@
+package Batch
+
+import (
+	"InvisibleWaterMarkingSystem/ImageIO"
+	"InvisibleWaterMarkingSystem/Watermark"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	Watermark.Output = io.Discard
+	os.Exit(m.Run())
+}
+
+// writePNG writes a textured width x height PNG to path
+func writePNG(t *testing.T, path string, width, height int) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := 128 + 40*math.Sin(float64(x)/23) + 30*math.Cos(float64(y)/17) + float64((x*7+y*13)%25-12)
+			img.Set(x, y, color.RGBA{R: uint8(v), G: uint8(v * 0.9), B: uint8(255 - v), A: 0xFF})
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	writePNG(t, filepath.Join(in, "a.png"), 256, 256)
+	writePNG(t, filepath.Join(in, "sub", "b.png"), 256, 256)
+	writePNG(t, filepath.Join(in, "small.png"), 64, 64)
+
+	cfg := Config{InputDir: in, OutputDir: out, Message: "{filename}#{index}", Recursive: true}
+	s, err := Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.OK != 2 || s.Failed != 1 {
+		t.Fatalf("ok %d, failed %d: %+v", s.OK, s.Failed, s.Results)
+	}
+	for _, r := range s.Results {
+		if r.Input == "small.png" {
+			if r.Status != StatusFailed {
+				t.Errorf("64x64 image: %s", r.Status)
+			}
+			continue
+		}
+		img, _, err := ImageIO.ReadFile(r.Output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := Watermark.ExtractSingleMessageWithOptions(img, Watermark.DefaultOptions()); got != r.Message {
+			t.Errorf("%s: extracted %q, want %q", r.Input, got, r.Message)
+		}
+	}
+
+	// Outputs are newer than their inputs now
+	s, err = Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Skipped != 2 || s.OK != 0 {
+		t.Errorf("second run: ok %d, skipped %d", s.OK, s.Skipped)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(in, "a.png"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	s, err = Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Skipped != 1 || s.OK != 1 {
+		t.Errorf("after touching a.png: ok %d, skipped %d", s.OK, s.Skipped)
+	}
+	cfg.Overwrite = true
+	if s, err = Run(context.Background(), cfg); err != nil || s.OK != 2 {
+		t.Errorf("with Overwrite: %+v, %v", s, err)
+	}
+}
+
+func TestDuplicateOutputs(t *testing.T) {
+	in := t.TempDir()
+	writePNG(t, filepath.Join(in, "a.png"), 256, 256)
+	writePNG(t, filepath.Join(in, "a.jpg"), 256, 256)
+
+	cfg := Config{InputDir: in, OutputDir: t.TempDir(), Message: "x", Format: ImageIO.FormatPNG, Now: time.Now}
+	if _, err := Run(context.Background(), cfg); err == nil || !strings.Contains(err.Error(), "both be written") {
+		t.Errorf("a.jpg and a.png converted to PNG: %v", err)
+	}
+	cfg.Format = ImageIO.FormatUnknown
+	if _, err := collect(cfg); err != nil {
+		t.Errorf("each in its own format: %v", err)
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	ctx := context.Background()
+	m := newMemoryBudget(100)
+	first, err := m.acquire(ctx, 60)
+	if err != nil || first != 60 {
+		t.Fatalf("acquire 60: %d, %v", first, err)
+	}
+
+	acquired := make(chan int64)
+	go func() {
+		n, _ := m.acquire(ctx, 60)
+		acquired <- n
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("160 bytes in flight under a budget of 100")
+	case <-time.After(20 * time.Millisecond):
+	}
+	m.release(first)
+	second := <-acquired
+
+	// Larger than the whole budget: clamped, and waits for the rest
+	cancelled, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := m.acquire(cancelled, 1000); err != context.DeadlineExceeded {
+		t.Errorf("acquire while 60 are held: %v", err)
+	}
+	m.release(second)
+	if n, err := m.acquire(ctx, 1000); err != nil || n != 100 {
+		t.Errorf("acquire 1000 of 100: %d, %v", n, err)
+	}
+
+	if n, err := newMemoryBudget(0).acquire(ctx, 1<<40); err != nil || n != 0 {
+		t.Errorf("unbounded budget: %d, %v", n, err)
+	}
+}
+
+func TestExpandMessage(t *testing.T) {
+	now := time.Date(2024, 3, 9, 14, 5, 6, 0, time.UTC)
+	got := ExpandMessage("{filename}|{name}|{ext}|{path}|{dir}|{date}|{time}|{index}|{message}", "sub/photo.jpg", 7, "alice", now)
+	want := "photo|photo.jpg|jpg|sub/photo.jpg|sub|2024-03-09|14:05:06|7|alice"
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	if got := ExpandMessage("{dir}/{unknown}", "a.png", 1, "", now); got != "./{unknown}" {
+		t.Errorf("root file: %s", got)
+	}
+}
+
+func TestLoadMessages(t *testing.T) {
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "messages.csv")
+	os.WriteFile(csvPath, []byte("path,message\nsub/a.png,for alice\n./b.png,\"for bob, with a comma\"\n"), 0o644)
+	jsonPath := filepath.Join(dir, "messages.json")
+	os.WriteFile(jsonPath, []byte(`{"sub/a.png": "for alice", "./b.png": "for bob, with a comma"}`), 0o644)
+
+	for _, path := range []string{csvPath, jsonPath} {
+		messages, err := LoadMessages(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(messages) != 2 || messages["sub/a.png"] != "for alice" || messages["b.png"] != "for bob, with a comma" {
+			t.Errorf("%s: %q", filepath.Base(path), messages)
+		}
+	}
+}
+
+func TestWriteManifest(t *testing.T) {
+	s := &Summary{}
+	s.add(Result{Input: "a.png", Output: "out/a.png", Message: "a", Status: StatusOK, Tiles: 4, Duration: 1500 * time.Millisecond})
+	s.add(Result{Input: "b.png", Output: "out/b.png", Message: "b", Status: StatusFailed, Error: "image too small"})
+	if s.OK != 1 || s.Failed != 1 {
+		t.Fatalf("totals %+v", s)
+	}
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "manifest.csv")
+	if err := WriteManifest(path, s); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0][0] != "input" || strings.Join(rows[1], ",") != "a.png,out/a.png,a,ok,,4,0,1500" || rows[2][4] != "image too small" {
+		t.Errorf("CSV manifest: %q", rows)
+	}
+
+	path = filepath.Join(dir, "manifest.JSON")
+	if err := WriteManifest(path, s); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back Summary
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatal(err)
+	}
+	if len(back.Results) != 2 || back.Results[1].Error != "image too small" || back.OK != 1 {
+		t.Errorf("JSON manifest: %s", data)
+	}
+}
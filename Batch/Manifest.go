@@ -0,0 +1,85 @@
+package Batch
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Status is the outcome of one file
+type Status string
+
+const (
+	StatusOK      Status = "ok"
+	StatusSkipped Status = "skipped" // output already up to date
+	StatusFailed  Status = "failed"
+)
+
+// Result is one manifest row
+type Result struct {
+	Input    string        `json:"input"`
+	Output   string        `json:"output"`
+	Message  string        `json:"message"`
+	Status   Status        `json:"status"`
+	Error    string        `json:"error,omitempty"`
+	Tiles    int           `json:"tiles,omitempty"`
+	Frames   int           `json:"frames,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// Summary totals a run
+type Summary struct {
+	Results  []Result      `json:"results"`
+	OK       int           `json:"ok"`
+	Skipped  int           `json:"skipped"`
+	Failed   int           `json:"failed"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+func (s *Summary) add(r Result) {
+	s.Results = append(s.Results, r)
+	switch r.Status {
+	case StatusOK:
+		s.OK++
+	case StatusSkipped:
+		s.Skipped++
+	case StatusFailed:
+		s.Failed++
+	}
+}
+
+// WriteManifest writes the results as JSON when path ends in .json and as
+// CSV otherwise
+func WriteManifest(path string, s *Summary) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(s)
+	} else {
+		w := csv.NewWriter(f)
+		w.Write([]string{"input", "output", "message", "status", "error", "tiles", "frames", "duration_ms"})
+		for _, r := range s.Results {
+			w.Write([]string{
+				r.Input, r.Output, r.Message, string(r.Status), r.Error,
+				strconv.Itoa(r.Tiles), strconv.Itoa(r.Frames),
+				strconv.FormatInt(r.Duration.Milliseconds(), 10),
+			})
+		}
+		w.Flush()
+		err = w.Error()
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
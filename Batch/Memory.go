@@ -0,0 +1,65 @@
+package Batch
+
+import (
+	"context"
+	"sync"
+)
+
+// bytesPerPixel approximates the peak working memory of one embed per pixel:
+// the decoded image, the float64 Y matrix, its four DWT bands, the inverse
+// transform and the YCbCr output
+const bytesPerPixel = 48
+
+// memoryBudget is a weighted semaphore over an estimated byte count, so a few
+// large images or many small ones run at once but never more than the limit
+type memoryBudget struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	limit int64
+	used  int64
+}
+
+func newMemoryBudget(limit int64) *memoryBudget {
+	m := &memoryBudget{limit: limit}
+	m.cond = sync.NewCond(&m.mu)
+	return m
+}
+
+// acquire blocks until n bytes fit in the budget. Requests larger than the
+// whole budget are clamped so they run alone rather than never. Returns the
+// amount actually reserved, to be passed to release.
+func (m *memoryBudget) acquire(ctx context.Context, n int64) (int64, error) {
+	if m.limit <= 0 {
+		return 0, ctx.Err()
+	}
+	n = min(n, m.limit)
+
+	// Wake waiters when the context ends so they can give up
+	stop := context.AfterFunc(ctx, func() {
+		m.mu.Lock()
+		m.cond.Broadcast()
+		m.mu.Unlock()
+	})
+	defer stop()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for m.used+n > m.limit {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		m.cond.Wait()
+	}
+	m.used += n
+	return n, nil
+}
+
+func (m *memoryBudget) release(n int64) {
+	if n == 0 {
+		return
+	}
+	m.mu.Lock()
+	m.used -= n
+	m.mu.Unlock()
+	m.cond.Broadcast()
+}
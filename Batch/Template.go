@@ -0,0 +1,79 @@
+package Batch
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExpandMessage fills in a message template for one file. Supported fields:
+//
+//	{filename}  base name without extension    {name}  base name with extension
+//	{ext}       extension without the dot      {path}  path relative to the input root
+//	{dir}       relative directory ("." at the root)
+//	{date}      2006-01-02                     {time}  15:04:05
+//	{index}     1-based position in the run    {message}  per-file message, if any
+func ExpandMessage(template, relPath string, index int, perFile string, now time.Time) string {
+	name := filepath.Base(relPath)
+	ext := filepath.Ext(name)
+	r := strings.NewReplacer(
+		"{filename}", strings.TrimSuffix(name, ext),
+		"{name}", name,
+		"{ext}", strings.TrimPrefix(ext, "."),
+		"{path}", filepath.ToSlash(relPath),
+		"{dir}", filepath.ToSlash(filepath.Dir(relPath)),
+		"{date}", now.Format("2006-01-02"),
+		"{time}", now.Format("15:04:05"),
+		"{index}", strconv.Itoa(index),
+		"{message}", perFile,
+	)
+	return r.Replace(template)
+}
+
+// LoadMessages reads per-file messages keyed by path relative to the input
+// root. A .json file holds an object {"path": "message"}; anything else is
+// read as two-column CSV (path,message), with an optional header row.
+func LoadMessages(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	messages := make(map[string]string)
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if err := json.NewDecoder(f).Decode(&messages); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	} else {
+		r := csv.NewReader(f)
+		r.FieldsPerRecord = 2
+		for line := 1; ; line++ {
+			rec, err := r.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			if line == 1 && strings.EqualFold(rec[0], "path") {
+				continue
+			}
+			messages[rec[0]] = rec[1]
+		}
+	}
+
+	// Keys are matched against slash-separated relative paths
+	normalized := make(map[string]string, len(messages))
+	for k, v := range messages {
+		normalized[filepath.ToSlash(filepath.Clean(k))] = v
+	}
+	return normalized, nil
+}
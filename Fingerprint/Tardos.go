@@ -0,0 +1,196 @@
+// Package Fingerprint implements collusion-resistant fingerprinting with
+// symmetric Tardos codes (Škorić et al.). Each recipient gets a random
+// codeword whose bits are biased by a per-position probability known only
+// to the holder of the secret. When several recipients combine their copies,
+// the bits where their codewords agree survive, and the accusation score
+// of each colluder grows with the code length while an innocent recipient's
+// stays near zero.
+//
+// The codewords are embedded with Watermark.EmbedBits and read back as soft
+// bits with Watermark.ExtractSoftBits, so positions left ambiguous by
+// averaging count as erasures instead of guesses.
+package Fingerprint
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+)
+
+// detectionMargin is how far above the accusation threshold a colluder's
+// expected score sits at the chosen code length. The expected score is an
+// average, so at a margin of 1 half of the colluders would go unaccused.
+const detectionMargin = 1.5
+
+// ErrInvalidParams is returned for out-of-range Params
+var ErrInvalidParams = errors.New("invalid fingerprint parameters")
+
+// Params fix a code. Codewords and accusations are only comparable between
+// codes built from the same secret and the same Params.
+type Params struct {
+	// Colluders is the largest coalition the code is sized to trace
+	Colluders int `json:"colluders"`
+
+	// FalseAccusation bounds the probability that any innocent recipient is
+	// accused in one trace
+	FalseAccusation float64 `json:"false_accusation"`
+
+	// Recipients is the largest population the code length is sized for;
+	// accusations use the actual number of candidates
+	Recipients int `json:"recipients"`
+}
+
+// DefaultParams traces up to 3 colluders among 1000 recipients with at most
+// a 1 in 1000 chance of accusing anyone innocent
+func DefaultParams() Params {
+	return Params{Colluders: 3, FalseAccusation: 1e-3, Recipients: 1000}
+}
+
+func (p Params) validate() error {
+	switch {
+	case p.Colluders < 1:
+		return fmt.Errorf("%w: colluders must be at least 1", ErrInvalidParams)
+	case p.FalseAccusation <= 0 || p.FalseAccusation >= 1:
+		return fmt.Errorf("%w: false accusation probability must be in (0, 1)", ErrInvalidParams)
+	case p.Recipients < 1:
+		return fmt.Errorf("%w: recipients must be at least 1", ErrInvalidParams)
+	}
+	return nil
+}
+
+// Length is the code length in bits. A coalition of c raises its members'
+// scores by 2m/(πc) each on average, while an innocent score is roughly
+// normal with variance m when all bits are read cleanly; requiring the
+// former to exceed the accusation threshold sqrt(2 m ln(n/ε)) by
+// detectionMargin gives m = margin² π² c² ln(n/ε) / 2.
+func (p Params) Length() int {
+	c := float64(p.Colluders)
+	l := detectionMargin * detectionMargin * math.Pi * math.Pi * c * c * math.Log(float64(p.Recipients)/p.FalseAccusation) / 2
+	return int(math.Ceil(l))
+}
+
+// Code is a Tardos code: the secret bias of every position
+type Code struct {
+	Params Params
+	secret string
+	bias   []float64
+}
+
+// NewCode derives the code for a secret. The secret must stay private: with
+// it the biases, and so the codewords, can be regenerated and framed.
+func NewCode(secret string, p Params) (*Code, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	m := p.Length()
+
+	// Biases follow the arcsine density on [t, 1-t]; the cutoff t keeps the
+	// score weights sqrt((1-p)/p) bounded
+	t := 1 / (300 * float64(p.Colluders))
+	lo := math.Asin(math.Sqrt(t))
+	hi := math.Pi/2 - lo
+
+	rng := newRand("tardos-bias", secret, fmt.Sprintf("%d/%g/%d", p.Colluders, p.FalseAccusation, p.Recipients))
+	bias := make([]float64, m)
+	for i := range bias {
+		r := lo + rng.Float64()*(hi-lo)
+		bias[i] = math.Sin(r) * math.Sin(r)
+	}
+	return &Code{Params: p, secret: secret, bias: bias}, nil
+}
+
+// Length is the number of bits in a codeword
+func (c *Code) Length() int {
+	return len(c.bias)
+}
+
+// Codeword returns the codeword of a recipient ID; the same ID always maps
+// to the same codeword
+func (c *Code) Codeword(id string) []int {
+	rng := newRand("tardos-codeword", c.secret, id)
+	word := make([]int, len(c.bias))
+	for i, p := range c.bias {
+		if rng.Float64() < p {
+			word[i] = 1
+		}
+	}
+	return word
+}
+
+// Score is the symmetric Tardos accusation score of a codeword against
+// extracted soft bits in [-1, 1]. Each position adds y·U, where U is
+// sqrt((1-p)/p) for a 1 in the codeword and -sqrt(p/(1-p)) for a 0, so an
+// innocent codeword scores 0 on average with variance at most one per bit.
+func (c *Code) Score(codeword []int, soft []float64) float64 {
+	var s float64
+	for i, p := range c.bias {
+		u := -math.Sqrt(p / (1 - p))
+		if codeword[i] == 1 {
+			u = math.Sqrt((1 - p) / p)
+		}
+		s += soft[i] * u
+	}
+	return s
+}
+
+// Threshold is the score above which a candidate is accused when n
+// candidates are scored against soft. For an innocent codeword each position
+// contributes y·U with U independent of y, mean 0 and variance 1, so the
+// score is approximately normal with variance Σy²; a union bound over n
+// candidates gives sqrt(2 Σy² ln(n/ε)). Weak or erased bits thus lower the
+// threshold along with the scores they can produce.
+func (c *Code) Threshold(soft []float64, n int) float64 {
+	var energy float64
+	for _, y := range soft {
+		energy += y * y
+	}
+	n = max(n, 1)
+	return math.Sqrt(2 * energy * math.Log(float64(n)/c.Params.FalseAccusation))
+}
+
+// Accusation is the verdict for one candidate
+type Accusation struct {
+	ID      string  `json:"id"`
+	Score   float64 `json:"score"`
+	Accused bool    `json:"accused"`
+}
+
+// Accuse scores every candidate ID against the soft bits and returns the
+// verdicts, highest score first
+func (c *Code) Accuse(soft []float64, ids []string) ([]Accusation, error) {
+	if len(soft) != len(c.bias) {
+		return nil, fmt.Errorf("%w: %d soft bits for a %d-bit code", ErrInvalidParams, len(soft), len(c.bias))
+	}
+	threshold := c.Threshold(soft, len(ids))
+	result := make([]Accusation, len(ids))
+	for i, id := range ids {
+		s := c.Score(c.Codeword(id), soft)
+		result[i] = Accusation{ID: id, Score: s, Accused: s > threshold}
+	}
+	slices.SortStableFunc(result, func(a, b Accusation) int {
+		switch {
+		case a.Score > b.Score:
+			return -1
+		case a.Score < b.Score:
+			return 1
+		}
+		return 0
+	})
+	return result, nil
+}
+
+// newRand seeds a ChaCha8 generator from a domain label and its inputs
+func newRand(domain string, parts ...string) *rand.Rand {
+	h := sha256.New()
+	h.Write([]byte(domain))
+	for _, p := range parts {
+		h.Write([]byte{0})
+		h.Write([]byte(p))
+	}
+	var seed [32]byte
+	copy(seed[:], h.Sum(nil))
+	return rand.New(rand.NewChaCha8(seed))
+}
@@ -0,0 +1,190 @@
+package Fingerprint
+
+import (
+	"InvisibleWaterMarkingSystem/Watermark"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	Watermark.Output = io.Discard
+	os.Exit(m.Run())
+}
+
+func TestLength(t *testing.T) {
+	p := DefaultParams()
+	// 1.5² π² 3² ln(1000/0.001) / 2
+	if got := p.Length(); got != 1381 {
+		t.Errorf("default length %d, want 1381", got)
+	}
+	code, err := NewCode("secret", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code.Length() != p.Length() {
+		t.Errorf("code of %d bits for Params.Length %d", code.Length(), p.Length())
+	}
+	// Quadratic in the coalition size
+	p.Colluders = 6
+	if got := p.Length(); got < 4*1381-4 || got > 4*1381+4 {
+		t.Errorf("6 colluders: %d bits", got)
+	}
+
+	for _, bad := range []Params{
+		{Colluders: 0, FalseAccusation: 1e-3, Recipients: 10},
+		{Colluders: 2, FalseAccusation: 0, Recipients: 10},
+		{Colluders: 2, FalseAccusation: 1, Recipients: 10},
+		{Colluders: 2, FalseAccusation: 1e-3, Recipients: 0},
+	} {
+		if _, err := NewCode("secret", bad); !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("%+v: %v", bad, err)
+		}
+	}
+}
+
+func TestCodewordsAreDeterministic(t *testing.T) {
+	p := DefaultParams()
+	a, _ := NewCode("secret", p)
+	b, _ := NewCode("secret", p)
+	if !slices.Equal(a.Codeword("alice"), b.Codeword("alice")) {
+		t.Error("the same secret and ID give different codewords")
+	}
+	if slices.Equal(a.Codeword("alice"), a.Codeword("bob")) {
+		t.Error("alice and bob share a codeword")
+	}
+	other, _ := NewCode("other secret", p)
+	if slices.Equal(a.Codeword("alice"), other.Codeword("alice")) {
+		t.Error("the codeword does not depend on the secret")
+	}
+	p.Colluders = 2
+	smaller, _ := NewCode("secret", p)
+	if smaller.Length() == a.Length() || len(smaller.Codeword("alice")) != smaller.Length() {
+		t.Errorf("codeword of %d bits for a %d-bit code", len(smaller.Codeword("alice")), smaller.Length())
+	}
+}
+
+func TestInnocentScores(t *testing.T) {
+	code, err := NewCode("secret", DefaultParams())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Soft bits as a coalition would leave them: a third erased, the rest
+	// fixed by someone outside the candidates
+	rng := rand.New(rand.NewPCG(3, 4))
+	soft := make([]float64, code.Length())
+	var energy float64
+	for i := range soft {
+		switch rng.IntN(3) {
+		case 0:
+			soft[i] = 1
+		case 1:
+			soft[i] = -1
+		}
+		energy += soft[i] * soft[i]
+	}
+
+	const n = 2000
+	threshold := code.Threshold(soft, n)
+	var sum, sumSq float64
+	for i := range n {
+		s := code.Score(code.Codeword(fmt.Sprint("innocent-", i)), soft)
+		if s > threshold {
+			t.Errorf("innocent %d scores %.1f over the threshold %.1f", i, s, threshold)
+		}
+		sum += s
+		sumSq += s * s
+	}
+	mean := sum / n
+	variance := sumSq/n - mean*mean
+	// Mean 0 and variance Σy² (a little less where biases are cut off)
+	if math.Abs(mean) > 4*math.Sqrt(energy/n) {
+		t.Errorf("innocent mean %.2f, want about 0 (sd of the mean %.2f)", mean, math.Sqrt(energy/n))
+	}
+	if variance < 0.8*energy || variance > 1.2*energy {
+		t.Errorf("innocent variance %.0f, want about %.0f", variance, energy)
+	}
+
+	if _, err := code.Accuse(soft[1:], []string{"a"}); !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("soft bits of the wrong length: %v", err)
+	}
+}
+
+// average is the pixel mean of equally sized images, as colluders comparing
+// their copies would make
+func average(images []image.Image) image.Image {
+	b := images[0].Bounds()
+	out := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			var r, g, bl uint32
+			for _, img := range images {
+				cr, cg, cb, _ := img.At(x, y).RGBA()
+				r, g, bl = r+cr>>8, g+cg>>8, bl+cb>>8
+			}
+			n := uint32(len(images))
+			out.SetRGBA(x, y, color.RGBA{R: uint8((r + n/2) / n), G: uint8((g + n/2) / n), B: uint8((bl + n/2) / n), A: 0xFF})
+		}
+	}
+	return out
+}
+
+// cover is a deterministic textured image
+func cover(width, height int) image.Image {
+	rng := rand.New(rand.NewPCG(1, 2))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := 128 + 40*math.Sin(float64(x)/23) + 30*math.Cos(float64(y)/17) + 12*rng.NormFloat64()
+			v = math.Max(30, math.Min(225, v))
+			img.SetRGBA(x, y, color.RGBA{R: uint8(v), G: uint8(v * 0.9), B: uint8(255 - v), A: 0xFF})
+		}
+	}
+	return img
+}
+
+func TestCollusionTrace(t *testing.T) {
+	p := Params{Colluders: 3, FalseAccusation: 1e-3, Recipients: 20}
+	code, err := NewCode("secret", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for i := range p.Recipients {
+		ids = append(ids, fmt.Sprintf("recipient-%02d", i))
+	}
+	img := cover(1024, 512)
+	opts := Watermark.DefaultOptions()
+
+	for _, colluders := range [][]string{ids[3:5], ids[7:10]} {
+		var copies []image.Image
+		for _, id := range colluders {
+			marked, err := Watermark.EmbedBits(img, code.Codeword(id), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			copies = append(copies, marked)
+		}
+		soft, err := Watermark.ExtractSoftBits(average(copies), code.Length(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verdicts, err := code.Accuse(soft, ids)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range verdicts {
+			if v.Accused != slices.Contains(colluders, v.ID) {
+				t.Errorf("%d colluders %v: %s scores %.1f, accused %v (threshold %.1f)",
+					len(colluders), colluders, v.ID, v.Score, v.Accused, code.Threshold(soft, len(ids)))
+			}
+		}
+	}
+}
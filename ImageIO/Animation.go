@@ -0,0 +1,27 @@
+package ImageIO
+
+import (
+	"bytes"
+	"image/gif"
+	"os"
+)
+
+// ReadGIF decodes every frame of a (possibly animated) GIF file
+func ReadGIF(path string) (*gif.GIF, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return gif.DecodeAll(file)
+}
+
+// WriteGIF encodes an animation, keeping its timing, disposal and loop settings
+func WriteGIF(path string, g *gif.GIF) error {
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
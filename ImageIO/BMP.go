@@ -0,0 +1,373 @@
+package ImageIO
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math/bits"
+)
+
+const (
+	bmpFileHeaderSize = 14
+	bmpInfoHeaderSize = 40
+	bmpV4HeaderSize   = 108
+
+	bmpCompressionRGB       = 0
+	bmpCompressionBitfields = 3
+)
+
+func init() {
+	image.RegisterFormat("bmp", "BM", DecodeBMP, DecodeBMPConfig)
+}
+
+// bmpHeader holds the fields of the file and DIB headers that the decoder uses
+type bmpHeader struct {
+	dataOffset  uint32
+	width       int
+	height      int
+	topDown     bool
+	bitCount    int
+	compression uint32
+	colorsUsed  uint32
+	masks       [4]uint32 // R, G, B, A
+	palette     color.Palette
+}
+
+func readBMPHeader(r io.Reader) (*bmpHeader, error) {
+	var file [bmpFileHeaderSize]byte
+	if _, err := io.ReadFull(r, file[:]); err != nil {
+		return nil, err
+	}
+	if file[0] != 'B' || file[1] != 'M' {
+		return nil, errors.New("bmp: missing BM signature")
+	}
+
+	var sizeBuf [4]byte
+	if _, err := io.ReadFull(r, sizeBuf[:]); err != nil {
+		return nil, err
+	}
+	infoSize := binary.LittleEndian.Uint32(sizeBuf[:])
+	if infoSize < 12 || infoSize > 1024 {
+		return nil, fmt.Errorf("bmp: unsupported header size %d", infoSize)
+	}
+	info := make([]byte, infoSize)
+	copy(info, sizeBuf[:])
+	if _, err := io.ReadFull(r, info[4:]); err != nil {
+		return nil, err
+	}
+
+	h := &bmpHeader{dataOffset: binary.LittleEndian.Uint32(file[10:14])}
+	paletteEntrySize := 4
+
+	if infoSize == 12 {
+		// OS/2 BITMAPCOREHEADER
+		h.width = int(binary.LittleEndian.Uint16(info[4:6]))
+		h.height = int(binary.LittleEndian.Uint16(info[6:8]))
+		h.bitCount = int(binary.LittleEndian.Uint16(info[10:12]))
+		paletteEntrySize = 3
+	} else {
+		if infoSize < bmpInfoHeaderSize {
+			return nil, fmt.Errorf("bmp: truncated info header (%d bytes)", infoSize)
+		}
+		h.width = int(int32(binary.LittleEndian.Uint32(info[4:8])))
+		h.height = int(int32(binary.LittleEndian.Uint32(info[8:12])))
+		h.bitCount = int(binary.LittleEndian.Uint16(info[14:16]))
+		h.compression = binary.LittleEndian.Uint32(info[16:20])
+		h.colorsUsed = binary.LittleEndian.Uint32(info[32:36])
+	}
+
+	if h.height < 0 {
+		h.height = -h.height
+		h.topDown = true
+	}
+	if h.width <= 0 || h.height <= 0 {
+		return nil, fmt.Errorf("bmp: invalid dimensions %dx%d", h.width, h.height)
+	}
+	if err := checkPixels(h.width, h.height); err != nil {
+		return nil, fmt.Errorf("bmp: %w", err)
+	}
+
+	switch h.compression {
+	case bmpCompressionRGB:
+		switch h.bitCount {
+		case 16:
+			h.masks = [4]uint32{0x7C00, 0x03E0, 0x001F, 0}
+		case 32:
+			h.masks = [4]uint32{0x00FF0000, 0x0000FF00, 0x000000FF, 0}
+		}
+	case bmpCompressionBitfields:
+		if h.bitCount != 16 && h.bitCount != 32 {
+			return nil, fmt.Errorf("bmp: bitfields with %d bits per pixel", h.bitCount)
+		}
+		if infoSize >= 52 {
+			for i := 0; i < 3; i++ {
+				h.masks[i] = binary.LittleEndian.Uint32(info[40+4*i:])
+			}
+			if infoSize >= 56 {
+				h.masks[3] = binary.LittleEndian.Uint32(info[52:56])
+			}
+		} else {
+			// Masks follow a plain BITMAPINFOHEADER
+			var masks [12]byte
+			if _, err := io.ReadFull(r, masks[:]); err != nil {
+				return nil, err
+			}
+			for i := 0; i < 3; i++ {
+				h.masks[i] = binary.LittleEndian.Uint32(masks[4*i:])
+			}
+			infoSize += 12
+		}
+	default:
+		return nil, fmt.Errorf("bmp: unsupported compression %d", h.compression)
+	}
+
+	if h.bitCount <= 8 {
+		switch h.bitCount {
+		case 1, 4, 8:
+		default:
+			return nil, fmt.Errorf("bmp: unsupported bit depth %d", h.bitCount)
+		}
+		n := int(h.colorsUsed)
+		if n == 0 || n > 1<<h.bitCount {
+			n = 1 << h.bitCount
+		}
+		raw := make([]byte, n*paletteEntrySize)
+		if _, err := io.ReadFull(r, raw); err != nil {
+			return nil, err
+		}
+		h.palette = make(color.Palette, n)
+		for i := 0; i < n; i++ {
+			e := raw[i*paletteEntrySize:]
+			h.palette[i] = color.RGBA{R: e[2], G: e[1], B: e[0], A: 0xFF}
+		}
+		infoSize += uint32(len(raw))
+	} else if h.bitCount != 16 && h.bitCount != 24 && h.bitCount != 32 {
+		return nil, fmt.Errorf("bmp: unsupported bit depth %d", h.bitCount)
+	}
+
+	// Skip any gap between the headers and the pixel array
+	consumed := uint32(bmpFileHeaderSize) + infoSize
+	if h.dataOffset > consumed {
+		if _, err := io.CopyN(io.Discard, r, int64(h.dataOffset-consumed)); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// DecodeBMPConfig returns the dimensions and color model of a BMP image
+func DecodeBMPConfig(r io.Reader) (image.Config, error) {
+	h, err := readBMPHeader(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	model := color.Model(color.NRGBAModel)
+	if h.palette != nil {
+		model = h.palette
+	}
+	return image.Config{ColorModel: model, Width: h.width, Height: h.height}, nil
+}
+
+// DecodeBMP reads an uncompressed or bitfield-encoded Windows bitmap
+func DecodeBMP(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	h, err := readBMPHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the pixel array before allocating the image, so that a header
+	// claiming more rows than the file holds costs no more than the file
+	stride := ((h.width*h.bitCount + 31) / 32) * 4
+	data, err := io.ReadAll(io.LimitReader(br, int64(stride)*int64(h.height)))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < stride*h.height {
+		return nil, fmt.Errorf("bmp: %dx%d needs %d bytes of pixel data, file has %d", h.width, h.height, stride*h.height, len(data))
+	}
+	rect := image.Rect(0, 0, h.width, h.height)
+
+	var paletted *image.Paletted
+	var nrgba *image.NRGBA
+	if h.palette != nil {
+		paletted = image.NewPaletted(rect, h.palette)
+	} else {
+		nrgba = image.NewNRGBA(rect)
+	}
+
+	hasAlpha := false
+	for i := 0; i < h.height; i++ {
+		row := data[i*stride : (i+1)*stride]
+		y := h.height - 1 - i
+		if h.topDown {
+			y = i
+		}
+
+		if paletted != nil {
+			dst := paletted.Pix[y*paletted.Stride:]
+			for x := 0; x < h.width; x++ {
+				var idx byte
+				switch h.bitCount {
+				case 8:
+					idx = row[x]
+				case 4:
+					idx = (row[x/2] >> (4 * (1 - uint(x%2)))) & 0x0F
+				case 1:
+					idx = (row[x/8] >> (7 - uint(x%8))) & 0x01
+				}
+				if int(idx) >= len(h.palette) {
+					idx = 0
+				}
+				dst[x] = idx
+			}
+			continue
+		}
+
+		dst := nrgba.Pix[y*nrgba.Stride:]
+		for x := 0; x < h.width; x++ {
+			var r, g, b, a byte = 0, 0, 0, 0xFF
+			switch h.bitCount {
+			case 24:
+				b, g, r = row[3*x], row[3*x+1], row[3*x+2]
+			case 16:
+				v := uint32(binary.LittleEndian.Uint16(row[2*x:]))
+				r, g, b = bmpChannel(v, h.masks[0]), bmpChannel(v, h.masks[1]), bmpChannel(v, h.masks[2])
+				if h.masks[3] != 0 {
+					a = bmpChannel(v, h.masks[3])
+					hasAlpha = true
+				}
+			case 32:
+				v := binary.LittleEndian.Uint32(row[4*x:])
+				r, g, b = bmpChannel(v, h.masks[0]), bmpChannel(v, h.masks[1]), bmpChannel(v, h.masks[2])
+				if h.masks[3] != 0 {
+					a = bmpChannel(v, h.masks[3])
+					hasAlpha = true
+				}
+			}
+			dst[4*x], dst[4*x+1], dst[4*x+2], dst[4*x+3] = r, g, b, a
+		}
+	}
+
+	// Some writers declare an alpha mask but leave it zero everywhere
+	if hasAlpha {
+		transparent := true
+		for i := 3; i < len(nrgba.Pix); i += 4 {
+			if nrgba.Pix[i] != 0 {
+				transparent = false
+				break
+			}
+		}
+		if transparent {
+			for i := 3; i < len(nrgba.Pix); i += 4 {
+				nrgba.Pix[i] = 0xFF
+			}
+		}
+	}
+
+	if paletted != nil {
+		return paletted, nil
+	}
+	return nrgba, nil
+}
+
+// bmpChannel extracts the bits selected by mask and scales them to 8 bits
+func bmpChannel(v, mask uint32) byte {
+	if mask == 0 {
+		return 0
+	}
+	shift := bits.TrailingZeros32(mask)
+	width := bits.OnesCount32(mask)
+	c := (v & mask) >> shift
+	max := uint32(1)<<width - 1
+	return byte((c*255 + max/2) / max)
+}
+
+// EncodeBMP writes img as a bottom-up BMP: 24-bit when opaque, 32-bit with an
+// alpha mask otherwise
+func EncodeBMP(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width <= 0 || height <= 0 {
+		return errors.New("bmp: empty image")
+	}
+
+	opaque := isOpaque(img)
+	bitCount := 24
+	infoSize := bmpInfoHeaderSize
+	compression := uint32(bmpCompressionRGB)
+	if !opaque {
+		bitCount = 32
+		infoSize = bmpV4HeaderSize
+		compression = bmpCompressionBitfields
+	}
+
+	stride := ((width*bitCount + 31) / 32) * 4
+	imageSize := stride * height
+	offset := bmpFileHeaderSize + infoSize
+
+	header := make([]byte, offset)
+	header[0], header[1] = 'B', 'M'
+	binary.LittleEndian.PutUint32(header[2:], uint32(offset+imageSize))
+	binary.LittleEndian.PutUint32(header[10:], uint32(offset))
+
+	info := header[bmpFileHeaderSize:]
+	binary.LittleEndian.PutUint32(info[0:], uint32(infoSize))
+	binary.LittleEndian.PutUint32(info[4:], uint32(width))
+	binary.LittleEndian.PutUint32(info[8:], uint32(height))
+	binary.LittleEndian.PutUint16(info[12:], 1)
+	binary.LittleEndian.PutUint16(info[14:], uint16(bitCount))
+	binary.LittleEndian.PutUint32(info[16:], compression)
+	binary.LittleEndian.PutUint32(info[20:], uint32(imageSize))
+	binary.LittleEndian.PutUint32(info[24:], 2835) // 72 DPI
+	binary.LittleEndian.PutUint32(info[28:], 2835)
+	if !opaque {
+		binary.LittleEndian.PutUint32(info[40:], 0x00FF0000)
+		binary.LittleEndian.PutUint32(info[44:], 0x0000FF00)
+		binary.LittleEndian.PutUint32(info[48:], 0x000000FF)
+		binary.LittleEndian.PutUint32(info[52:], 0xFF000000)
+		copy(info[56:60], "BGRs") // LCS_sRGB, stored little-endian
+	}
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+
+	row := make([]byte, stride)
+	for y := b.Max.Y - 1; y >= b.Min.Y; y-- {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			i := x - b.Min.X
+			if opaque {
+				row[3*i], row[3*i+1], row[3*i+2] = c.B, c.G, c.R
+			} else {
+				row[4*i], row[4*i+1], row[4*i+2], row[4*i+3] = c.B, c.G, c.R, c.A
+			}
+		}
+		if _, err := bw.Write(row); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// isOpaque reports whether every pixel of img is fully opaque
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xFFFF {
+				return false
+			}
+		}
+	}
+	return true
+}
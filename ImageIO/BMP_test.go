@@ -0,0 +1,69 @@
+package ImageIO
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// bmpHeaderOnly is a 24-bit BMP file header and BITMAPINFOHEADER claiming
+// width x height pixels, with no pixel data after it
+func bmpHeaderOnly(width, height int32) []byte {
+	b := make([]byte, bmpFileHeaderSize+bmpInfoHeaderSize)
+	copy(b, "BM")
+	binary.LittleEndian.PutUint32(b[2:], uint32(len(b)))
+	binary.LittleEndian.PutUint32(b[10:], uint32(len(b)))
+	info := b[bmpFileHeaderSize:]
+	binary.LittleEndian.PutUint32(info[0:], bmpInfoHeaderSize)
+	binary.LittleEndian.PutUint32(info[4:], uint32(width))
+	binary.LittleEndian.PutUint32(info[8:], uint32(height))
+	binary.LittleEndian.PutUint16(info[12:], 1)
+	binary.LittleEndian.PutUint16(info[14:], 24)
+	return b
+}
+
+func TestDecodeBMPRejectsHugeHeader(t *testing.T) {
+	_, err := DecodeBMP(bytes.NewReader(bmpHeaderOnly(60000, 60000)))
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("60000x60000 header: got %v, want ErrTooLarge", err)
+	}
+	_, err = DecodeBMP(bytes.NewReader(bmpHeaderOnly(60000, -60000)))
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("top-down 60000x60000 header: got %v, want ErrTooLarge", err)
+	}
+}
+
+func TestDecodeBMPRejectsTruncatedPixels(t *testing.T) {
+	// Within MaxPixels, but the file holds none of the 48 MB it claims
+	if _, err := DecodeBMP(bytes.NewReader(bmpHeaderOnly(4000, 4000))); err == nil {
+		t.Fatal("decoded a 4000x4000 BMP from a 54-byte file")
+	}
+}
+
+func TestBMPRoundTrip(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 5, 3))
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 5; x++ {
+			src.SetNRGBA(x, y, color.NRGBA{R: uint8(40 * x), G: uint8(80 * y), B: 7, A: 0xFF})
+		}
+	}
+	var buf bytes.Buffer
+	if err := EncodeBMP(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeBMP(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 5; x++ {
+			want := src.NRGBAAt(x, y)
+			if c := color.NRGBAModel.Convert(got.At(x, y)).(color.NRGBA); c != want {
+				t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, c, want)
+			}
+		}
+	}
+}
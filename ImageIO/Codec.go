@@ -0,0 +1,204 @@
+package ImageIO
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+)
+
+// MaxPixels bounds the width times height of the images the BMP and TIFF
+// decoders will allocate: a header is a few bytes but can claim gigabytes of
+// pixels
+const MaxPixels = 1 << 26
+
+// ErrTooLarge is returned for images larger than MaxPixels
+var ErrTooLarge = errors.New("image too large")
+
+// checkPixels rejects dimensions beyond MaxPixels without overflowing
+func checkPixels(width, height int) error {
+	if width > 0 && height > MaxPixels/width {
+		return fmt.Errorf("%w: %dx%d is more than %d pixels", ErrTooLarge, width, height, MaxPixels)
+	}
+	return nil
+}
+
+// CheckSize reads only the header of an image of any supported format and
+// returns ErrTooLarge when it claims more than maxPixels pixels, so that
+// untrusted uploads can be refused before Decode allocates them
+func CheckSize(data []byte, maxPixels int) error {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("decoding image header: %w", err)
+	}
+	if cfg.Width > 0 && cfg.Height > maxPixels/cfg.Width {
+		return fmt.Errorf("%w: %dx%d is more than %d pixels", ErrTooLarge, cfg.Width, cfg.Height, maxPixels)
+	}
+	return nil
+}
+
+// TIFFCompression selects how the TIFF encoder stores strip data
+type TIFFCompression int
+
+const (
+	TIFFUncompressed TIFFCompression = iota
+	TIFFDeflate
+)
+
+// EncodeOptions holds the per-format settings used when writing an image
+type EncodeOptions struct {
+	JPEGQuality     int                  // 1–100
+	PNGCompression  png.CompressionLevel // png.DefaultCompression, png.BestSpeed, ...
+	GIFNumColors    int                  // 1–256
+	TIFFCompression TIFFCompression
+
+	// JPEG only: segments copied from the source file and an optional XMP note
+	Metadata *Metadata
+	XMPNote  string
+}
+
+// DefaultEncodeOptions returns the settings used when none are given.
+// JPEG quality stays at 100 so the embedded QIM values survive re-encoding.
+func DefaultEncodeOptions() *EncodeOptions {
+	return &EncodeOptions{
+		JPEGQuality:     100,
+		PNGCompression:  png.DefaultCompression,
+		GIFNumColors:    256,
+		TIFFCompression: TIFFUncompressed,
+	}
+}
+
+// Decode reads an image of any supported format and reports which format it was
+func Decode(r io.Reader) (image.Image, Format, error) {
+	br := bufio.NewReader(r)
+	header, _ := br.Peek(8)
+	format := DetectFormat(header)
+
+	var img image.Image
+	var err error
+
+	switch format {
+	case FormatJPEG:
+		img, err = jpeg.Decode(br)
+	case FormatPNG:
+		img, err = png.Decode(br)
+	case FormatGIF:
+		img, err = gif.Decode(br)
+	case FormatBMP:
+		img, err = DecodeBMP(br)
+	case FormatTIFF:
+		img, err = DecodeTIFF(br)
+	default:
+		return nil, FormatUnknown, fmt.Errorf("unrecognised image format")
+	}
+	if err != nil {
+		return nil, format, fmt.Errorf("decoding %s: %w", format, err)
+	}
+	return img, format, nil
+}
+
+// DecodeBytes is Decode for an in-memory file
+func DecodeBytes(data []byte) (image.Image, Format, error) {
+	return Decode(bytes.NewReader(data))
+}
+
+// Encode writes img in the requested format
+func Encode(w io.Writer, img image.Image, format Format, opts *EncodeOptions) error {
+	if opts == nil {
+		opts = DefaultEncodeOptions()
+	}
+
+	switch format {
+	case FormatJPEG:
+		quality := opts.JPEGQuality
+		if quality <= 0 || quality > 100 {
+			quality = 100
+		}
+		if opts.Metadata == nil && opts.XMPNote == "" {
+			return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+		}
+		return encodeJPEGWithMetadata(w, img, quality, opts)
+	case FormatPNG:
+		enc := png.Encoder{CompressionLevel: opts.PNGCompression}
+		return enc.Encode(w, img)
+	case FormatGIF:
+		// No dithering: error diffusion would scatter noise over the embedded coefficients
+		numColors := opts.GIFNumColors
+		if numColors <= 0 || numColors > 256 {
+			numColors = 256
+		}
+		return gif.Encode(w, img, &gif.Options{NumColors: numColors, Drawer: draw.Src})
+	case FormatBMP:
+		return EncodeBMP(w, img)
+	case FormatTIFF:
+		return EncodeTIFF(w, img, opts.TIFFCompression)
+	}
+	return fmt.Errorf("cannot encode format %s", format)
+}
+
+// ReadFile decodes the image stored at path
+func ReadFile(path string) (image.Image, Format, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, FormatUnknown, err
+	}
+	defer file.Close()
+
+	return Decode(file)
+}
+
+// WriteFile encodes img to path. A FormatUnknown format is resolved from the extension.
+func WriteFile(path string, img image.Image, format Format, opts *EncodeOptions) error {
+	if format == FormatUnknown {
+		format = FormatFromPath(path)
+	}
+	if format == FormatUnknown {
+		return fmt.Errorf("cannot determine output format for %q", path)
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, img, format, opts); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// OutputFormat picks the format to write: the input format unless the output
+// path names a different supported extension
+func OutputFormat(outPath string, input Format) Format {
+	if f := FormatFromPath(outPath); f != FormatUnknown {
+		return f
+	}
+	return input
+}
+
+// encodeJPEGWithMetadata encodes to memory, then splices the source metadata
+// (and the XMP note, if any) in after the SOI marker
+func encodeJPEGWithMetadata(w io.Writer, img image.Image, quality int, opts *EncodeOptions) error {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return err
+	}
+
+	meta := opts.Metadata.Clone()
+	if meta == nil {
+		meta = &Metadata{}
+	}
+	if opts.XMPNote != "" {
+		meta.AddWatermarkXMP(opts.XMPNote)
+	}
+
+	out, err := InsertJPEGMetadata(buf.Bytes(), meta)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
@@ -0,0 +1,108 @@
+package ImageIO
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+)
+
+// Format identifies an image container format supported by the I/O layer
+type Format int
+
+const (
+	FormatUnknown Format = iota
+	FormatJPEG
+	FormatPNG
+	FormatGIF
+	FormatBMP
+	FormatTIFF
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatJPEG:
+		return "jpeg"
+	case FormatPNG:
+		return "png"
+	case FormatGIF:
+		return "gif"
+	case FormatBMP:
+		return "bmp"
+	case FormatTIFF:
+		return "tiff"
+	}
+	return "unknown"
+}
+
+// Extension returns the canonical file extension for the format, including the dot
+func (f Format) Extension() string {
+	switch f {
+	case FormatJPEG:
+		return ".jpg"
+	case FormatPNG:
+		return ".png"
+	case FormatGIF:
+		return ".gif"
+	case FormatBMP:
+		return ".bmp"
+	case FormatTIFF:
+		return ".tif"
+	}
+	return ""
+}
+
+// MIMEType returns the media type of the format
+func (f Format) MIMEType() string {
+	switch f {
+	case FormatJPEG:
+		return "image/jpeg"
+	case FormatPNG:
+		return "image/png"
+	case FormatGIF:
+		return "image/gif"
+	case FormatBMP:
+		return "image/bmp"
+	case FormatTIFF:
+		return "image/tiff"
+	}
+	return "application/octet-stream"
+}
+
+// ParseFormat converts a format name such as "jpg" or "tiff" to a Format
+func ParseFormat(name string) Format {
+	switch strings.ToLower(strings.TrimPrefix(name, ".")) {
+	case "jpg", "jpeg", "jpe":
+		return FormatJPEG
+	case "png":
+		return FormatPNG
+	case "gif":
+		return FormatGIF
+	case "bmp", "dib":
+		return FormatBMP
+	case "tif", "tiff":
+		return FormatTIFF
+	}
+	return FormatUnknown
+}
+
+// FormatFromPath guesses the format from a file name's extension
+func FormatFromPath(path string) Format {
+	return ParseFormat(filepath.Ext(path))
+}
+
+// DetectFormat identifies the format from the leading bytes of a file
+func DetectFormat(header []byte) Format {
+	switch {
+	case bytes.HasPrefix(header, []byte{0xFF, 0xD8, 0xFF}):
+		return FormatJPEG
+	case bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")):
+		return FormatPNG
+	case bytes.HasPrefix(header, []byte("GIF87a")), bytes.HasPrefix(header, []byte("GIF89a")):
+		return FormatGIF
+	case bytes.HasPrefix(header, []byte("BM")):
+		return FormatBMP
+	case bytes.HasPrefix(header, []byte("II*\x00")), bytes.HasPrefix(header, []byte("MM\x00*")):
+		return FormatTIFF
+	}
+	return FormatUnknown
+}
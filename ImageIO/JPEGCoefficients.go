@@ -0,0 +1,828 @@
+package ImageIO
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Remaining JPEG markers needed to walk a full baseline bitstream
+const (
+	markerSOF0 = 0xC0
+	markerSOF1 = 0xC1
+	markerSOF2 = 0xC2
+	markerDHT  = 0xC4
+	markerRST0 = 0xD0
+	markerRST7 = 0xD7
+	markerDQT  = 0xDB
+	markerDRI  = 0xDD
+)
+
+// zigzag maps the i-th coefficient of the entropy-coded order to its
+// natural (row-major) index within the 8x8 block
+var zigzag = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// JPEGComponent holds the quantized DCT coefficients of one color component.
+// Blocks are stored row by row; each block is in natural order, so
+// Blocks[i][v*8+u] is the coefficient for vertical frequency v, horizontal u.
+type JPEGComponent struct {
+	ID         byte
+	H, V       int // sampling factors
+	QuantTable int
+
+	BlocksW, BlocksH int // storage size, padded to whole MCUs
+	Width, Height    int // blocks that actually cover the component's pixels
+	Blocks           [][64]int32
+}
+
+// Block returns the coefficients of the block at block column bx, row by
+func (c *JPEGComponent) Block(bx, by int) *[64]int32 {
+	return &c.Blocks[by*c.BlocksW+bx]
+}
+
+// jpegScan remembers the layout of one scan so it can be written back
+type jpegScan struct {
+	components []int     // indices into JPEGCoefficients.Components
+	restart    int       // restart interval in MCUs, 0 if none
+	preceding  []Segment // non-table segments that appeared before this scan
+}
+
+// JPEGCoefficients is a baseline JPEG decoded only as far as its quantized
+// DCT coefficients. Editing the coefficients and calling Encode produces a
+// new file without any pixel-domain round trip.
+type JPEGCoefficients struct {
+	Width, Height int
+	Components    []*JPEGComponent
+	QuantTables   [4][64]uint16 // natural order
+
+	header []Segment // segments before the first scan, minus DHT and SOS
+	scans  []*jpegScan
+	hmax   int
+	vmax   int
+}
+
+// huffTable is a canonical Huffman table in the form of JPEG Annex C/F
+type huffTable struct {
+	counts [16]byte
+	values []byte
+
+	maxcode [18]int32
+	mincode [17]int32
+	valptr  [17]int
+}
+
+func newHuffTable(counts [16]byte, values []byte) (*huffTable, error) {
+	total := 0
+	for _, c := range counts {
+		total += int(c)
+	}
+	if total != len(values) || total > 256 {
+		return nil, errors.New("jpeg: malformed Huffman table")
+	}
+
+	t := &huffTable{counts: counts, values: values}
+	code := int32(0)
+	k := 0
+	for l := 1; l <= 16; l++ {
+		n := int(counts[l-1])
+		if n == 0 {
+			t.maxcode[l] = -1
+		} else {
+			t.valptr[l] = k
+			t.mincode[l] = code
+			code += int32(n)
+			k += n
+			t.maxcode[l] = code - 1
+		}
+		code <<= 1
+	}
+	t.maxcode[17] = 0x7FFFFFFF
+	return t, nil
+}
+
+// bitReader reads entropy-coded bits, removing 0xFF00 byte stuffing
+type bitReader struct {
+	data []byte
+	pos  int
+	acc  uint32
+	n    int
+}
+
+func (r *bitReader) bit() int {
+	if r.n == 0 {
+		var b byte
+		if r.pos < len(r.data) {
+			b = r.data[r.pos]
+			if b == 0xFF {
+				next := byte(0)
+				if r.pos+1 < len(r.data) {
+					next = r.data[r.pos+1]
+				}
+				if next == 0x00 {
+					r.pos += 2
+				} else {
+					// A marker ends the data; decoders pad with zero bits
+					b = 0
+				}
+			} else {
+				r.pos++
+			}
+		}
+		r.acc = uint32(b)
+		r.n = 8
+	}
+	r.n--
+	return int(r.acc>>uint(r.n)) & 1
+}
+
+func (r *bitReader) bits(n int) int32 {
+	v := int32(0)
+	for i := 0; i < n; i++ {
+		v = v<<1 | int32(r.bit())
+	}
+	return v
+}
+
+func (r *bitReader) decode(t *huffTable) (byte, error) {
+	code := int32(0)
+	for l := 1; l <= 16; l++ {
+		code = code<<1 | int32(r.bit())
+		if code <= t.maxcode[l] {
+			return t.values[t.valptr[l]+int(code-t.mincode[l])], nil
+		}
+	}
+	return 0, errors.New("jpeg: bad Huffman code")
+}
+
+// restart consumes an RSTn marker at a restart boundary
+func (r *bitReader) restart() error {
+	r.n = 0
+	for r.pos+1 < len(r.data) && r.data[r.pos] == 0xFF && r.data[r.pos+1] == 0xFF {
+		r.pos++
+	}
+	if r.pos+1 >= len(r.data) || r.data[r.pos] != 0xFF ||
+		r.data[r.pos+1] < markerRST0 || r.data[r.pos+1] > markerRST7 {
+		return errors.New("jpeg: missing restart marker")
+	}
+	r.pos += 2
+	return nil
+}
+
+// extend converts a received magnitude of s bits into a signed value
+func extend(v int32, s int) int32 {
+	if s == 0 {
+		return 0
+	}
+	if v < 1<<uint(s-1) {
+		return v - (1 << uint(s)) + 1
+	}
+	return v
+}
+
+// ReadJPEGCoefficients parses a baseline sequential Huffman JPEG and returns
+// its quantized coefficients. Progressive and arithmetic-coded files are rejected.
+func ReadJPEGCoefficients(data []byte) (*JPEGCoefficients, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != markerSOI {
+		return nil, errors.New("jpeg: missing SOI marker")
+	}
+
+	jc := &JPEGCoefficients{}
+	var dc, ac [4]*huffTable
+	restart := 0
+	var pending []Segment
+	sawFrame := false
+
+	pos := 2
+	for pos+2 <= len(data) {
+		if data[pos] != 0xFF {
+			return nil, fmt.Errorf("jpeg: expected marker at offset %d", pos)
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			pos++
+			continue
+		}
+		if marker == markerEOI {
+			break
+		}
+		if pos+4 > len(data) {
+			return nil, errors.New("jpeg: truncated segment")
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return nil, fmt.Errorf("jpeg: bad segment length at offset %d", pos)
+		}
+		payload := data[pos+4 : pos+2+length]
+		pos += 2 + length
+
+		switch {
+		case marker == markerSOF0 || marker == markerSOF1:
+			if sawFrame {
+				return nil, errors.New("jpeg: multiple frames")
+			}
+			sawFrame = true
+			if err := jc.parseFrame(payload); err != nil {
+				return nil, err
+			}
+			pending = append(pending, Segment{Marker: marker, Data: append([]byte(nil), payload...)})
+
+		case marker >= 0xC2 && marker <= 0xCF && marker != markerDHT && marker != 0xC8 && marker != 0xCC:
+			return nil, fmt.Errorf("jpeg: only baseline sequential Huffman coding is supported (SOF marker 0x%02X)", marker)
+
+		case marker == markerDHT:
+			for p := payload; len(p) > 0; {
+				if len(p) < 17 {
+					return nil, errors.New("jpeg: truncated DHT")
+				}
+				class, id := p[0]>>4, p[0]&0x0F
+				var counts [16]byte
+				copy(counts[:], p[1:17])
+				total := 0
+				for _, c := range counts {
+					total += int(c)
+				}
+				if id > 3 || class > 1 || len(p) < 17+total {
+					return nil, errors.New("jpeg: malformed DHT")
+				}
+				t, err := newHuffTable(counts, append([]byte(nil), p[17:17+total]...))
+				if err != nil {
+					return nil, err
+				}
+				if class == 0 {
+					dc[id] = t
+				} else {
+					ac[id] = t
+				}
+				p = p[17+total:]
+			}
+
+		case marker == markerDQT:
+			for p := payload; len(p) > 0; {
+				precision, id := p[0]>>4, p[0]&0x0F
+				size := 64
+				if precision == 1 {
+					size = 128
+				}
+				if id > 3 || len(p) < 1+size {
+					return nil, errors.New("jpeg: malformed DQT")
+				}
+				for i := 0; i < 64; i++ {
+					if precision == 1 {
+						jc.QuantTables[id][zigzag[i]] = binary.BigEndian.Uint16(p[1+2*i:])
+					} else {
+						jc.QuantTables[id][zigzag[i]] = uint16(p[1+i])
+					}
+				}
+				p = p[1+size:]
+			}
+			pending = append(pending, Segment{Marker: marker, Data: append([]byte(nil), payload...)})
+
+		case marker == markerDRI:
+			if len(payload) < 2 {
+				return nil, errors.New("jpeg: malformed DRI")
+			}
+			restart = int(binary.BigEndian.Uint16(payload))
+			pending = append(pending, Segment{Marker: marker, Data: append([]byte(nil), payload...)})
+
+		case marker == markerSOS:
+			if !sawFrame {
+				return nil, errors.New("jpeg: scan before frame header")
+			}
+			scan, err := jc.parseScanHeader(payload, restart)
+			if err != nil {
+				return nil, err
+			}
+			if len(jc.scans) == 0 {
+				jc.header = pending
+			} else {
+				scan.preceding = pending
+			}
+			pending = nil
+
+			end, err := jc.decodeScan(data, pos, scan, payload, dc, ac)
+			if err != nil {
+				return nil, err
+			}
+			jc.scans = append(jc.scans, scan)
+			pos = end
+
+		default:
+			pending = append(pending, Segment{Marker: marker, Data: append([]byte(nil), payload...)})
+		}
+	}
+
+	if len(jc.scans) == 0 {
+		return nil, errors.New("jpeg: no scan found")
+	}
+	return jc, nil
+}
+
+func (jc *JPEGCoefficients) parseFrame(p []byte) error {
+	if len(p) < 6 || p[0] != 8 {
+		return errors.New("jpeg: only 8-bit precision is supported")
+	}
+	jc.Height = int(binary.BigEndian.Uint16(p[1:]))
+	jc.Width = int(binary.BigEndian.Uint16(p[3:]))
+	n := int(p[5])
+	if jc.Width == 0 || jc.Height == 0 {
+		return errors.New("jpeg: zero image dimension")
+	}
+	if n == 0 || n > 4 || len(p) < 6+3*n {
+		return errors.New("jpeg: bad component count")
+	}
+
+	jc.hmax, jc.vmax = 1, 1
+	for i := 0; i < n; i++ {
+		c := &JPEGComponent{
+			ID:         p[6+3*i],
+			H:          int(p[7+3*i] >> 4),
+			V:          int(p[7+3*i] & 0x0F),
+			QuantTable: int(p[8+3*i] & 0x03),
+		}
+		if c.H < 1 || c.H > 4 || c.V < 1 || c.V > 4 {
+			return errors.New("jpeg: bad sampling factor")
+		}
+		jc.hmax = max(jc.hmax, c.H)
+		jc.vmax = max(jc.vmax, c.V)
+		jc.Components = append(jc.Components, c)
+	}
+
+	mcusX := (jc.Width + 8*jc.hmax - 1) / (8 * jc.hmax)
+	mcusY := (jc.Height + 8*jc.vmax - 1) / (8 * jc.vmax)
+	for _, c := range jc.Components {
+		c.BlocksW = mcusX * c.H
+		c.BlocksH = mcusY * c.V
+		compW := (jc.Width*c.H + jc.hmax - 1) / jc.hmax
+		compH := (jc.Height*c.V + jc.vmax - 1) / jc.vmax
+		c.Width = (compW + 7) / 8
+		c.Height = (compH + 7) / 8
+		c.Blocks = make([][64]int32, c.BlocksW*c.BlocksH)
+	}
+	return nil
+}
+
+func (jc *JPEGCoefficients) parseScanHeader(p []byte, restart int) (*jpegScan, error) {
+	if len(p) < 1 {
+		return nil, errors.New("jpeg: empty SOS")
+	}
+	ns := int(p[0])
+	if ns < 1 || ns > len(jc.Components) || len(p) < 1+2*ns+3 {
+		return nil, errors.New("jpeg: malformed SOS")
+	}
+	if p[1+2*ns] != 0 || p[2+2*ns] != 63 || p[3+2*ns] != 0 {
+		return nil, errors.New("jpeg: spectral selection is not baseline")
+	}
+
+	scan := &jpegScan{restart: restart}
+	for i := 0; i < ns; i++ {
+		id := p[1+2*i]
+		idx := -1
+		for k, c := range jc.Components {
+			if c.ID == id {
+				idx = k
+			}
+		}
+		if idx < 0 {
+			return nil, fmt.Errorf("jpeg: scan references unknown component %d", id)
+		}
+		scan.components = append(scan.components, idx)
+	}
+	return scan, nil
+}
+
+// forEachBlock walks the blocks of a scan in bitstream order, calling fn with
+// the component index and block position. mcuDone is called after each MCU.
+func (jc *JPEGCoefficients) forEachBlock(scan *jpegScan, fn func(ci, bx, by int) error, mcuDone func(mcu int) error) error {
+	if len(scan.components) == 1 {
+		// Non-interleaved: one block per MCU, covering only the real blocks
+		ci := scan.components[0]
+		c := jc.Components[ci]
+		mcu := 0
+		for by := 0; by < c.Height; by++ {
+			for bx := 0; bx < c.Width; bx++ {
+				if err := fn(ci, bx, by); err != nil {
+					return err
+				}
+				mcu++
+				if err := mcuDone(mcu); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	mcusX := (jc.Width + 8*jc.hmax - 1) / (8 * jc.hmax)
+	mcusY := (jc.Height + 8*jc.vmax - 1) / (8 * jc.vmax)
+	mcu := 0
+	for my := 0; my < mcusY; my++ {
+		for mx := 0; mx < mcusX; mx++ {
+			for _, ci := range scan.components {
+				c := jc.Components[ci]
+				for v := 0; v < c.V; v++ {
+					for h := 0; h < c.H; h++ {
+						if err := fn(ci, mx*c.H+h, my*c.V+v); err != nil {
+							return err
+						}
+					}
+				}
+			}
+			mcu++
+			if err := mcuDone(mcu); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// decodeScan decodes the entropy-coded data starting at pos and returns the
+// offset of the marker that follows it
+func (jc *JPEGCoefficients) decodeScan(data []byte, pos int, scan *jpegScan, header []byte, dc, ac [4]*huffTable) (int, error) {
+	ns := len(scan.components)
+	dcTab := make(map[int]*huffTable, ns)
+	acTab := make(map[int]*huffTable, ns)
+	for i, ci := range scan.components {
+		sel := header[2+2*i]
+		dcTab[ci], acTab[ci] = dc[sel>>4&3], ac[sel&3]
+		if dcTab[ci] == nil || acTab[ci] == nil {
+			return 0, errors.New("jpeg: scan uses an undefined Huffman table")
+		}
+	}
+
+	r := &bitReader{data: data, pos: pos}
+	pred := make(map[int]int32, ns)
+	totalMCUs := jc.mcuCount(scan)
+
+	err := jc.forEachBlock(scan, func(ci, bx, by int) error {
+		block := jc.Components[ci].Block(bx, by)
+
+		s, err := r.decode(dcTab[ci])
+		if err != nil {
+			return err
+		}
+		if s > 11 {
+			return errors.New("jpeg: DC magnitude out of range")
+		}
+		pred[ci] += extend(r.bits(int(s)), int(s))
+		block[0] = pred[ci]
+
+		for k := 1; k < 64; {
+			rs, err := r.decode(acTab[ci])
+			if err != nil {
+				return err
+			}
+			run, size := int(rs>>4), int(rs&0x0F)
+			if size == 0 {
+				if run != 15 {
+					break // EOB
+				}
+				k += 16
+				continue
+			}
+			k += run
+			if k > 63 {
+				return errors.New("jpeg: AC coefficient index out of range")
+			}
+			block[zigzag[k]] = extend(r.bits(size), size)
+			k++
+		}
+		return nil
+	}, func(mcu int) error {
+		if scan.restart > 0 && mcu%scan.restart == 0 && mcu < totalMCUs {
+			for ci := range pred {
+				pred[ci] = 0
+			}
+			return r.restart()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Skip to the next real marker (not a stuffed byte or RST)
+	p := r.pos
+	for p+1 < len(data) {
+		if data[p] == 0xFF && data[p+1] != 0x00 && data[p+1] != 0xFF &&
+			(data[p+1] < markerRST0 || data[p+1] > markerRST7) {
+			return p, nil
+		}
+		p++
+	}
+	return len(data), nil
+}
+
+func (jc *JPEGCoefficients) mcuCount(scan *jpegScan) int {
+	if len(scan.components) == 1 {
+		c := jc.Components[scan.components[0]]
+		return c.Width * c.Height
+	}
+	mcusX := (jc.Width + 8*jc.hmax - 1) / (8 * jc.hmax)
+	mcusY := (jc.Height + 8*jc.vmax - 1) / (8 * jc.vmax)
+	return mcusX * mcusY
+}
+
+// bitWriter writes entropy-coded bits with 0xFF byte stuffing
+type bitWriter struct {
+	out *bytes.Buffer
+	acc uint32
+	n   int
+}
+
+func (w *bitWriter) write(code uint32, size int) {
+	for i := size - 1; i >= 0; i-- {
+		w.acc = w.acc<<1 | (code>>uint(i))&1
+		w.n++
+		if w.n == 8 {
+			b := byte(w.acc)
+			w.out.WriteByte(b)
+			if b == 0xFF {
+				w.out.WriteByte(0x00)
+			}
+			w.acc, w.n = 0, 0
+		}
+	}
+}
+
+// flush pads the final byte with 1 bits, as the standard requires
+func (w *bitWriter) flush() {
+	if w.n > 0 {
+		w.write(0x7F, 8-w.n)
+	}
+}
+
+// huffCode is the encoder-side view of a table
+type huffCode struct {
+	code [256]uint32
+	size [256]int
+}
+
+func (t *huffTable) encoder() *huffCode {
+	e := &huffCode{}
+	code := uint32(0)
+	k := 0
+	for l := 1; l <= 16; l++ {
+		for i := 0; i < int(t.counts[l-1]); i++ {
+			e.code[t.values[k]] = code
+			e.size[t.values[k]] = l
+			code++
+			k++
+		}
+		code <<= 1
+	}
+	return e
+}
+
+// optimalHuffman builds a length-limited table from symbol frequencies (JPEG Annex K.2)
+func optimalHuffman(freq [256]int64) *huffTable {
+	var f [257]int64
+	copy(f[:], freq[:])
+	f[256] = 1 // reserved so that no code consists of all 1 bits
+
+	var codesize [257]int
+	var others [257]int
+	for i := range others {
+		others[i] = -1
+	}
+
+	for {
+		v1, v2 := -1, -1
+		for i := 0; i < 257; i++ {
+			if f[i] > 0 && (v1 < 0 || f[i] <= f[v1]) {
+				v1 = i
+			}
+		}
+		for i := 0; i < 257; i++ {
+			if f[i] > 0 && i != v1 && (v2 < 0 || f[i] <= f[v2]) {
+				v2 = i
+			}
+		}
+		if v2 < 0 {
+			break
+		}
+
+		f[v1] += f[v2]
+		f[v2] = 0
+		codesize[v1]++
+		for others[v1] >= 0 {
+			v1 = others[v1]
+			codesize[v1]++
+		}
+		others[v1] = v2
+		codesize[v2]++
+		for others[v2] >= 0 {
+			v2 = others[v2]
+			codesize[v2]++
+		}
+	}
+
+	var bits [258]int
+	for i := 0; i < 257; i++ {
+		if codesize[i] > 0 {
+			bits[codesize[i]]++
+		}
+	}
+	for i := 257; i > 16; i-- {
+		for bits[i] > 0 {
+			j := i - 2
+			for bits[j] == 0 {
+				j--
+			}
+			bits[i] -= 2
+			bits[i-1]++
+			bits[j+1] += 2
+			bits[j]--
+		}
+	}
+	i := 16
+	for bits[i] == 0 {
+		i--
+	}
+	bits[i]-- // drop the reserved code point
+
+	symbols := make([]int, 0, 256)
+	for s := 0; s < 256; s++ {
+		if codesize[s] > 0 {
+			symbols = append(symbols, s)
+		}
+	}
+	sort.SliceStable(symbols, func(a, b int) bool { return codesize[symbols[a]] < codesize[symbols[b]] })
+
+	var counts [16]byte
+	for l := 1; l <= 16; l++ {
+		counts[l-1] = byte(bits[l])
+	}
+	values := make([]byte, len(symbols))
+	for k, s := range symbols {
+		values[k] = byte(s)
+	}
+	t, _ := newHuffTable(counts, values)
+	return t
+}
+
+// magnitude returns the JPEG size category and the bits that encode v
+func magnitude(v int32) (int, uint32) {
+	a := v
+	if a < 0 {
+		a = -a
+	}
+	s := 0
+	for a > 0 {
+		s++
+		a >>= 1
+	}
+	if v < 0 {
+		v += (1 << uint(s)) - 1
+	}
+	return s, uint32(v) & (1<<uint(s) - 1)
+}
+
+// scanSymbols visits every Huffman symbol (and its extra bits) in a scan
+func (jc *JPEGCoefficients) scanSymbols(scan *jpegScan, emit func(ci int, isDC bool, sym byte, extra uint32, size int), restart func()) {
+	pred := make(map[int]int32)
+	totalMCUs := jc.mcuCount(scan)
+
+	jc.forEachBlock(scan, func(ci, bx, by int) error {
+		block := jc.Components[ci].Block(bx, by)
+
+		s, bitsV := magnitude(block[0] - pred[ci])
+		pred[ci] = block[0]
+		emit(ci, true, byte(s), bitsV, s)
+
+		run := 0
+		for k := 1; k < 64; k++ {
+			v := block[zigzag[k]]
+			if v == 0 {
+				run++
+				continue
+			}
+			for run > 15 {
+				emit(ci, false, 0xF0, 0, 0)
+				run -= 16
+			}
+			s, bitsV := magnitude(v)
+			emit(ci, false, byte(run<<4|s), bitsV, s)
+			run = 0
+		}
+		if run > 0 {
+			emit(ci, false, 0x00, 0, 0)
+		}
+		return nil
+	}, func(mcu int) error {
+		if scan.restart > 0 && mcu%scan.restart == 0 && mcu < totalMCUs {
+			for ci := range pred {
+				pred[ci] = 0
+			}
+			restart()
+		}
+		return nil
+	})
+}
+
+// Encode writes the coefficients back out as a baseline JPEG. Every header
+// segment is copied as is; Huffman tables are rebuilt per scan so that any
+// edited coefficient value remains encodable.
+func (jc *JPEGCoefficients) Encode() ([]byte, error) {
+	var out bytes.Buffer
+	out.Write([]byte{0xFF, markerSOI})
+
+	writeSegment := func(marker byte, data []byte) {
+		out.Write([]byte{0xFF, marker})
+		binary.Write(&out, binary.BigEndian, uint16(len(data)+2))
+		out.Write(data)
+	}
+	for _, seg := range jc.header {
+		writeSegment(seg.Marker, seg.Data)
+	}
+
+	for _, scan := range jc.scans {
+		for _, seg := range scan.preceding {
+			writeSegment(seg.Marker, seg.Data)
+		}
+
+		// Luminance (the first component) gets table 0, everything else table 1
+		tableOf := func(ci int) int {
+			if ci == 0 {
+				return 0
+			}
+			return 1
+		}
+
+		var dcFreq, acFreq [2][256]int64
+		jc.scanSymbols(scan, func(ci int, isDC bool, sym byte, _ uint32, _ int) {
+			if isDC {
+				dcFreq[tableOf(ci)][sym]++
+			} else {
+				acFreq[tableOf(ci)][sym]++
+			}
+		}, func() {})
+
+		var dcCode, acCode [2]*huffCode
+		var dht bytes.Buffer
+		for t := 0; t < 2; t++ {
+			used := false
+			for _, ci := range scan.components {
+				if tableOf(ci) == t {
+					used = true
+				}
+			}
+			if !used {
+				continue
+			}
+			for class, freq := range [][256]int64{dcFreq[t], acFreq[t]} {
+				table := optimalHuffman(freq)
+				dht.WriteByte(byte(class<<4 | t))
+				dht.Write(table.counts[:])
+				dht.Write(table.values)
+				if class == 0 {
+					dcCode[t] = table.encoder()
+				} else {
+					acCode[t] = table.encoder()
+				}
+			}
+		}
+		writeSegment(markerDHT, dht.Bytes())
+
+		sos := []byte{byte(len(scan.components))}
+		for _, ci := range scan.components {
+			t := byte(tableOf(ci))
+			sos = append(sos, jc.Components[ci].ID, t<<4|t)
+		}
+		sos = append(sos, 0, 63, 0)
+		writeSegment(markerSOS, sos)
+
+		w := &bitWriter{out: &out}
+		rst := 0
+		jc.scanSymbols(scan, func(ci int, isDC bool, sym byte, extra uint32, size int) {
+			t := tableOf(ci)
+			code := acCode[t]
+			if isDC {
+				code = dcCode[t]
+			}
+			w.write(code.code[sym], code.size[sym])
+			if size > 0 {
+				w.write(extra, size)
+			}
+		}, func() {
+			w.flush()
+			out.Write([]byte{0xFF, byte(markerRST0 + rst%8)})
+			rst++
+		})
+		w.flush()
+	}
+
+	out.Write([]byte{0xFF, markerEOI})
+	return out.Bytes(), nil
+}
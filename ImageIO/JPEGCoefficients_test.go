@@ -0,0 +1,144 @@
+package ImageIO
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// jpegFixture is a textured baseline JPEG from image/jpeg: 4:2:0 for color,
+// one component for gray
+func jpegFixture(t *testing.T, width, height int, gray bool) []byte {
+	t.Helper()
+	var img image.Image
+	if gray {
+		g := image.NewGray(image.Rect(0, 0, width, height))
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				g.SetGray(x, y, color.Gray{Y: uint8(128 + 60*math.Sin(float64(x*y)/97) + float64((x*7+y*13)%25-12))})
+			}
+		}
+		img = g
+	} else {
+		c := image.NewRGBA(image.Rect(0, 0, width, height))
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				v := 128 + 40*math.Sin(float64(x)/23) + 30*math.Cos(float64(y)/17) + float64((x*7+y*13)%25-12)
+				c.SetRGBA(x, y, color.RGBA{R: uint8(v), G: uint8(255 - v), B: uint8(x * 255 / width), A: 0xFF})
+			}
+		}
+		img = c
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withRestarts re-encodes data with a restart marker every interval MCUs;
+// image/jpeg never writes them
+func withRestarts(t *testing.T, data []byte, interval int) []byte {
+	t.Helper()
+	jc, err := ReadJPEGCoefficients(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jc.header = append(jc.header, Segment{Marker: markerDRI, Data: []byte{byte(interval >> 8), byte(interval)}})
+	for _, scan := range jc.scans {
+		scan.restart = interval
+	}
+	out, err := jc.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func decodePixels(t *testing.T, data []byte) image.Image {
+	t.Helper()
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestJPEGCoefficientsRoundTrip(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"color":             jpegFixture(t, 256, 256, false),
+		"color partial MCU": jpegFixture(t, 101, 37, false),
+		"gray partial MCU":  jpegFixture(t, 67, 45, true),
+		"color restarts":    withRestarts(t, jpegFixture(t, 101, 37, false), 3),
+		"gray restarts":     withRestarts(t, jpegFixture(t, 67, 45, true), 1),
+	} {
+		jc, err := ReadJPEGCoefficients(data)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		out, err := jc.Encode()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		back, err := ReadJPEGCoefficients(out)
+		if err != nil {
+			t.Fatalf("%s: re-read: %v", name, err)
+		}
+		if back.Width != jc.Width || back.Height != jc.Height || back.QuantTables != jc.QuantTables {
+			t.Errorf("%s: header changed", name)
+		}
+		for i, c := range jc.Components {
+			if !reflect.DeepEqual(back.Components[i], c) {
+				t.Errorf("%s: component %d coefficients changed", name, i)
+			}
+		}
+		// Same coefficients and tables decode to the same pixels
+		if !reflect.DeepEqual(decodePixels(t, out), decodePixels(t, data)) {
+			t.Errorf("%s: image/jpeg decodes the re-encoded file differently", name)
+		}
+	}
+}
+
+func TestJPEGRestartsAreDecodable(t *testing.T) {
+	// withRestarts itself must produce a file image/jpeg reads as the original
+	for _, gray := range []bool{false, true} {
+		data := jpegFixture(t, 101, 37, gray)
+		if !reflect.DeepEqual(decodePixels(t, withRestarts(t, data, 2)), decodePixels(t, data)) {
+			t.Errorf("gray=%v: restart markers changed the pixels", gray)
+		}
+	}
+}
+
+func TestJPEGCoefficientEdits(t *testing.T) {
+	data := jpegFixture(t, 101, 37, false)
+	jc, err := ReadJPEGCoefficients(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Y := jc.Components[0]
+	if Y.Width != 13 || Y.Height != 5 || Y.BlocksW != 14 || Y.BlocksH != 6 {
+		t.Fatalf("luminance blocks %dx%d stored as %dx%d", Y.Width, Y.Height, Y.BlocksW, Y.BlocksH)
+	}
+	// Values far outside what the original tables encode
+	Y.Block(12, 4)[1*8+3] = 1000
+	Y.Block(0, 0)[0] = -1500
+	out, err := jc.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := ReadJPEGCoefficients(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := back.Components[0].Block(12, 4)[1*8+3]; got != 1000 {
+		t.Errorf("edited AC coefficient reads back as %d", got)
+	}
+	if got := back.Components[0].Block(0, 0)[0]; got != -1500 {
+		t.Errorf("edited DC coefficient reads back as %d", got)
+	}
+	decodePixels(t, out)
+}
@@ -0,0 +1,378 @@
+package ImageIO
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+	"strings"
+)
+
+// JPEG markers handled by the metadata code
+const (
+	markerSOI  = 0xD8
+	markerEOI  = 0xD9
+	markerSOS  = 0xDA
+	markerAPP0 = 0xE0
+	markerAPP1 = 0xE1
+	markerAPP2 = 0xE2
+	markerAP14 = 0xEE
+	markerAP15 = 0xEF
+	markerCOM  = 0xFE
+)
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	xmpHeader  = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	iccHeader  = []byte("ICC_PROFILE\x00")
+)
+
+// Segment is a JPEG marker segment; Data excludes the marker and length bytes
+type Segment struct {
+	Marker byte
+	Data   []byte
+}
+
+// Metadata holds the APPn and COM segments of a JPEG file. image/jpeg drops
+// these on decode, so they are carried separately and spliced back on encode.
+type Metadata struct {
+	Segments []Segment
+}
+
+// ReadJPEGMetadata collects the APPn and COM segments that precede the first scan
+func ReadJPEGMetadata(data []byte) (*Metadata, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != markerSOI {
+		return nil, errors.New("jpeg: missing SOI marker")
+	}
+
+	meta := &Metadata{}
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return nil, fmt.Errorf("jpeg: expected marker at offset %d", pos)
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			pos++ // fill byte
+			continue
+		}
+		if marker == markerSOS || marker == markerEOI {
+			break
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return nil, fmt.Errorf("jpeg: bad segment length at offset %d", pos)
+		}
+		payload := data[pos+4 : pos+2+length]
+
+		if keepSegment(marker, payload) {
+			meta.Segments = append(meta.Segments, Segment{Marker: marker, Data: append([]byte(nil), payload...)})
+		}
+		pos += 2 + length
+	}
+	return meta, nil
+}
+
+// keepSegment decides whether a segment can be copied to a re-encoded file.
+// The Adobe APP14 segment describes the original color transform, which no
+// longer applies once image/jpeg has written fresh YCbCr data.
+func keepSegment(marker byte, payload []byte) bool {
+	if marker == markerAP14 && bytes.HasPrefix(payload, []byte("Adobe")) {
+		return false
+	}
+	return (marker >= markerAPP0 && marker <= markerAP15) || marker == markerCOM
+}
+
+// InsertJPEGMetadata splices the metadata segments in right after the SOI marker
+func InsertJPEGMetadata(jpegData []byte, meta *Metadata) ([]byte, error) {
+	if len(jpegData) < 2 || jpegData[0] != 0xFF || jpegData[1] != markerSOI {
+		return nil, errors.New("jpeg: missing SOI marker")
+	}
+	if meta == nil || len(meta.Segments) == 0 {
+		return jpegData, nil
+	}
+
+	var out bytes.Buffer
+	out.Write(jpegData[:2])
+	for _, seg := range meta.Segments {
+		if len(seg.Data)+2 > 0xFFFF {
+			return nil, fmt.Errorf("jpeg: segment 0x%02X too large (%d bytes)", seg.Marker, len(seg.Data))
+		}
+		out.Write([]byte{0xFF, seg.Marker})
+		binary.Write(&out, binary.BigEndian, uint16(len(seg.Data)+2))
+		out.Write(seg.Data)
+	}
+	out.Write(jpegData[2:])
+	return out.Bytes(), nil
+}
+
+// HasICCProfile reports whether an embedded ICC color profile is present
+func (m *Metadata) HasICCProfile() bool {
+	return m.find(markerAPP2, iccHeader) >= 0
+}
+
+// HasEXIF reports whether an EXIF block is present
+func (m *Metadata) HasEXIF() bool {
+	return m.find(markerAPP1, exifHeader) >= 0
+}
+
+func (m *Metadata) find(marker byte, prefix []byte) int {
+	if m == nil {
+		return -1
+	}
+	for i, seg := range m.Segments {
+		if seg.Marker == marker && bytes.HasPrefix(seg.Data, prefix) {
+			return i
+		}
+	}
+	return -1
+}
+
+// orientationOffset locates the EXIF orientation value inside the APP1 segment
+func (m *Metadata) orientationOffset() (seg int, offset int, order binary.ByteOrder) {
+	seg = m.find(markerAPP1, exifHeader)
+	if seg < 0 {
+		return -1, 0, nil
+	}
+	tiff := m.Segments[seg].Data[len(exifHeader):]
+	if len(tiff) < 8 {
+		return -1, 0, nil
+	}
+
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return -1, 0, nil
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd+2 > len(tiff) {
+		return -1, 0, nil
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + 12*i
+		if entry+12 > len(tiff) {
+			break
+		}
+		// Orientation: tag 0x0112, type SHORT, count 1, value inline
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			return seg, len(exifHeader) + entry + 8, order
+		}
+	}
+	return -1, 0, nil
+}
+
+// Orientation returns the EXIF orientation (1–8), or 1 when absent
+func (m *Metadata) Orientation() int {
+	if m == nil {
+		return 1
+	}
+	seg, off, order := m.orientationOffset()
+	if seg < 0 {
+		return 1
+	}
+	o := int(order.Uint16(m.Segments[seg].Data[off:]))
+	if o < 1 || o > 8 {
+		return 1
+	}
+	return o
+}
+
+// Clone returns a deep copy so callers can edit segments without touching the original
+func (m *Metadata) Clone() *Metadata {
+	if m == nil {
+		return nil
+	}
+	c := &Metadata{Segments: make([]Segment, len(m.Segments))}
+	for i, seg := range m.Segments {
+		c.Segments[i] = Segment{Marker: seg.Marker, Data: append([]byte(nil), seg.Data...)}
+	}
+	return c
+}
+
+// ResetOrientation marks the pixels as upright, for use after ApplyOrientation
+func (m *Metadata) ResetOrientation() {
+	if m == nil {
+		return
+	}
+	seg, off, order := m.orientationOffset()
+	if seg >= 0 {
+		order.PutUint16(m.Segments[seg].Data[off:], 1)
+	}
+}
+
+// AddWatermarkXMP records in XMP that the image carries a watermark. An
+// existing XMP packet is extended rather than replaced.
+func (m *Metadata) AddWatermarkXMP(note string) {
+	var escaped bytes.Buffer
+	xmlEscape(&escaped, note)
+
+	description := `<rdf:Description rdf:about="" xmlns:wm="https://github.com/JacobGeorgeMathew/MiniProject_Prototype/ns/1.0/"` +
+		` wm:Watermarked="True" wm:Note="` + escaped.String() + `"/>`
+
+	if i := m.find(markerAPP1, xmpHeader); i >= 0 {
+		packet := string(m.Segments[i].Data[len(xmpHeader):])
+		if strings.Contains(packet, "wm:Watermarked") {
+			return
+		}
+		if end := strings.LastIndex(packet, "</rdf:RDF>"); end >= 0 {
+			packet = packet[:end] + description + packet[end:]
+			m.Segments[i].Data = append(append([]byte(nil), xmpHeader...), packet...)
+			return
+		}
+	}
+
+	packet := "<?xpacket begin=\"\uFEFF\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>" +
+		`<x:xmpmeta xmlns:x="adobe:ns:meta/">` +
+		`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+		description +
+		`</rdf:RDF></x:xmpmeta><?xpacket end="w"?>`
+
+	seg := Segment{Marker: markerAPP1, Data: append(append([]byte(nil), xmpHeader...), packet...)}
+
+	// XMP conventionally follows EXIF; keep APP0 and EXIF first
+	insertAt := 0
+	for insertAt < len(m.Segments) && (m.Segments[insertAt].Marker == markerAPP0 ||
+		(m.Segments[insertAt].Marker == markerAPP1 && bytes.HasPrefix(m.Segments[insertAt].Data, exifHeader))) {
+		insertAt++
+	}
+	m.Segments = append(m.Segments, Segment{})
+	copy(m.Segments[insertAt+1:], m.Segments[insertAt:])
+	m.Segments[insertAt] = seg
+}
+
+// HasXMP reports whether an XMP packet is present
+func (m *Metadata) HasXMP() bool {
+	return m.find(markerAPP1, xmpHeader) >= 0
+}
+
+// WatermarkXMP returns the note recorded by AddWatermarkXMP and whether the
+// packet marks the image as watermarked
+func (m *Metadata) WatermarkXMP() (string, bool) {
+	i := m.find(markerAPP1, xmpHeader)
+	if i < 0 {
+		return "", false
+	}
+	packet := string(m.Segments[i].Data[len(xmpHeader):])
+	if !strings.Contains(packet, `wm:Watermarked="True"`) {
+		return "", false
+	}
+
+	const attr = `wm:Note="`
+	start := strings.Index(packet, attr)
+	if start < 0 {
+		return "", true
+	}
+	note := packet[start+len(attr):]
+	if end := strings.IndexByte(note, '"'); end >= 0 {
+		note = note[:end]
+	}
+	return xmlUnescaper.Replace(note), true
+}
+
+var xmlUnescaper = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&quot;", `"`, "&amp;", "&")
+
+func xmlEscape(buf *bytes.Buffer, s string) {
+	for _, r := range s {
+		switch r {
+		case '&':
+			buf.WriteString("&amp;")
+		case '<':
+			buf.WriteString("&lt;")
+		case '>':
+			buf.WriteString("&gt;")
+		case '"':
+			buf.WriteString("&quot;")
+		default:
+			buf.WriteRune(r)
+		}
+	}
+}
+
+// ApplyOrientation rotates and flips img so that it displays upright for the
+// given EXIF orientation value
+func ApplyOrientation(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	W, H := b.Dx(), b.Dy()
+	dw, dh := W, H
+	if orientation >= 5 {
+		dw, dh = H, W
+	}
+
+	src := image.NewNRGBA(image.Rect(0, 0, W, H))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirror horizontal
+				sx, sy = W-1-x, y
+			case 3: // rotate 180
+				sx, sy = W-1-x, H-1-y
+			case 4: // mirror vertical
+				sx, sy = x, H-1-y
+			case 5: // transpose
+				sx, sy = y, x
+			case 6: // rotate 90 clockwise
+				sx, sy = y, H-1-x
+			case 7: // transverse
+				sx, sy = W-1-y, H-1-x
+			case 8: // rotate 90 counter-clockwise
+				sx, sy = W-1-y, x
+			}
+			dst.SetNRGBA(x, y, src.NRGBAAt(sx, sy))
+		}
+	}
+	return dst
+}
+
+// AutoOrient applies the EXIF orientation to img and resets the tag in meta so
+// the written file is not rotated a second time by viewers
+func AutoOrient(img image.Image, meta *Metadata) image.Image {
+	o := meta.Orientation()
+	if o == 1 {
+		return img
+	}
+	meta.ResetOrientation()
+	return ApplyOrientation(img, o)
+}
+
+// ReadFileWithMetadata decodes the image at path and, for JPEG files, also
+// returns its metadata segments
+func ReadFileWithMetadata(path string) (image.Image, Format, *Metadata, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, FormatUnknown, nil, err
+	}
+	return DecodeWithMetadata(data)
+}
+
+// DecodeWithMetadata is DecodeBytes plus JPEG metadata extraction
+func DecodeWithMetadata(data []byte) (image.Image, Format, *Metadata, error) {
+	img, format, err := DecodeBytes(data)
+	if err != nil {
+		return nil, format, nil, err
+	}
+	if format != FormatJPEG {
+		return img, format, nil, nil
+	}
+	meta, err := ReadJPEGMetadata(data)
+	if err != nil {
+		return nil, format, nil, err
+	}
+	return img, format, meta, nil
+}
@@ -0,0 +1,189 @@
+package ImageIO
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// plainJPEG is a small JPEG as image/jpeg writes it, with no APPn segments
+func plainJPEG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 32, 24))
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 32; x++ {
+			img.SetRGBA(x, y, color.RGBA{R: uint8(x * 8), G: uint8(y * 10), B: 128, A: 0xFF})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// exifSegment is an APP1 EXIF block whose only IFD0 entry is the orientation
+func exifSegment(order binary.ByteOrder, orientation uint16) Segment {
+	tiff := make([]byte, 8+2+12+4)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	entry := tiff[10:]
+	order.PutUint16(entry[0:], 0x0112)
+	order.PutUint16(entry[2:], 3)
+	order.PutUint32(entry[4:], 1)
+	order.PutUint16(entry[8:], orientation)
+	return Segment{Marker: markerAPP1, Data: append(append([]byte(nil), exifHeader...), tiff...)}
+}
+
+func TestMetadataSurvivesReencoding(t *testing.T) {
+	source, err := InsertJPEGMetadata(plainJPEG(t), &Metadata{Segments: []Segment{
+		exifSegment(binary.BigEndian, 1),
+		{Marker: markerAPP2, Data: append(append([]byte(nil), iccHeader...), 1, 1, 0, 0, 0, 0)},
+		{Marker: markerAP14, Data: []byte("Adobe\x00\x64\x00\x00\x00\x00\x01")},
+		{Marker: markerCOM, Data: []byte("a comment")},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, format, meta, err := DecodeWithMetadata(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != FormatJPEG || !meta.HasEXIF() || !meta.HasICCProfile() || meta.HasXMP() {
+		t.Fatalf("source metadata: %s, %+v", format, meta)
+	}
+	// EXIF, ICC and COM; the Adobe transform flag is dropped
+	if len(meta.Segments) != 3 {
+		t.Errorf("%d segments kept", len(meta.Segments))
+	}
+
+	const note = `marked by "wm" <test> & co`
+	var out bytes.Buffer
+	opts := DefaultEncodeOptions()
+	opts.Metadata = meta
+	opts.XMPNote = note
+	if err := Encode(&out, img, FormatJPEG, opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(meta.Segments) != 3 || meta.HasXMP() {
+		t.Error("encoding changed the caller's metadata")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(out.Bytes())); err != nil {
+		t.Fatalf("written file does not decode: %v", err)
+	}
+
+	back, err := ReadJPEGMetadata(out.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !back.HasEXIF() || !back.HasICCProfile() {
+		t.Error("EXIF or ICC profile lost")
+	}
+	if got, ok := back.WatermarkXMP(); !ok || got != note {
+		t.Errorf("XMP note %q, %v", got, ok)
+	}
+	// XMP goes right after EXIF
+	if i := back.find(markerAPP1, xmpHeader); i != 1 {
+		t.Errorf("XMP is segment %d", i)
+	}
+	var com bool
+	for _, seg := range back.Segments {
+		com = com || (seg.Marker == markerCOM && string(seg.Data) == "a comment")
+		if seg.Marker == markerAP14 && bytes.HasPrefix(seg.Data, []byte("Adobe")) {
+			t.Error("Adobe APP14 copied")
+		}
+	}
+	if !com {
+		t.Error("comment lost")
+	}
+}
+
+func TestReadJPEGMetadataRejectsBadFiles(t *testing.T) {
+	data := plainJPEG(t)
+	for name, bad := range map[string][]byte{
+		"not a JPEG":     []byte("\x89PNG\r\n\x1a\n"),
+		"short segment":  append(data[:2:2], 0xFF, markerAPP1, 0x00, 0x01),
+		"long segment":   append(data[:2:2], 0xFF, markerAPP1, 0x10, 0x00, 'E'),
+		"missing marker": append(data[:2:2], 0x00, 0x00, 0x00, 0x00),
+	} {
+		if _, err := ReadJPEGMetadata(bad); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestAddWatermarkXMPExtendsPacket(t *testing.T) {
+	packet := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+		`<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/" dc:creator="someone"/></rdf:RDF></x:xmpmeta>`
+	meta := &Metadata{Segments: []Segment{{Marker: markerAPP1, Data: append(append([]byte(nil), xmpHeader...), packet...)}}}
+
+	meta.AddWatermarkXMP("first")
+	meta.AddWatermarkXMP("second")
+	if len(meta.Segments) != 1 {
+		t.Fatalf("%d segments", len(meta.Segments))
+	}
+	if !bytes.Contains(meta.Segments[0].Data, []byte(`dc:creator="someone"`)) {
+		t.Error("existing description lost")
+	}
+	if note, ok := meta.WatermarkXMP(); !ok || note != "first" {
+		t.Errorf("note %q, %v", note, ok)
+	}
+}
+
+func TestAutoOrient(t *testing.T) {
+	// 3x2 with every pixel distinct
+	src := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			src.SetNRGBA(x, y, color.NRGBA{R: uint8(10*y + x), A: 0xFF})
+		}
+	}
+	at := func(img image.Image, x, y int) uint8 {
+		return img.(*image.NRGBA).NRGBAAt(x, y).R
+	}
+
+	for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+		meta := &Metadata{Segments: []Segment{exifSegment(order, 6)}}
+		if o := meta.Orientation(); o != 6 {
+			t.Fatalf("%v: orientation %d", order, o)
+		}
+		// Rotated 90° clockwise: the bottom-left pixel moves to the top left
+		upright := AutoOrient(src, meta)
+		if b := upright.Bounds(); b.Dx() != 2 || b.Dy() != 3 {
+			t.Fatalf("%v: upright image is %dx%d", order, b.Dx(), b.Dy())
+		}
+		if at(upright, 0, 0) != 10 || at(upright, 1, 0) != 0 || at(upright, 0, 2) != 12 {
+			t.Errorf("%v: rotated wrongly", order)
+		}
+		if o := meta.Orientation(); o != 1 {
+			t.Errorf("%v: orientation %d after AutoOrient", order, o)
+		}
+		if AutoOrient(upright, meta) != upright {
+			t.Errorf("%v: rotated a second time", order)
+		}
+	}
+
+	// Each orientation undone by its inverse
+	for o, inverse := range map[int]int{2: 2, 3: 3, 4: 4, 5: 5, 6: 8, 7: 7, 8: 6} {
+		back := ApplyOrientation(ApplyOrientation(src, o), inverse)
+		for y := 0; y < 2; y++ {
+			for x := 0; x < 3; x++ {
+				if at(back, x, y) != at(src, x, y) {
+					t.Fatalf("orientation %d then %d moves (%d,%d)", o, inverse, x, y)
+				}
+			}
+		}
+	}
+	if (&Metadata{}).Orientation() != 1 || (*Metadata)(nil).Orientation() != 1 {
+		t.Error("orientation without EXIF")
+	}
+}
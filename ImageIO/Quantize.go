@@ -0,0 +1,169 @@
+package ImageIO
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// colorBox is one cell of the median-cut partition
+type colorBox struct {
+	colors []color.RGBA
+}
+
+func (b *colorBox) ranges() (int, int) {
+	var lo, hi [3]uint8
+	lo = [3]uint8{255, 255, 255}
+	for _, c := range b.colors {
+		ch := [3]uint8{c.R, c.G, c.B}
+		for i := 0; i < 3; i++ {
+			lo[i] = min(lo[i], ch[i])
+			hi[i] = max(hi[i], ch[i])
+		}
+	}
+	axis, width := 0, -1
+	for i := 0; i < 3; i++ {
+		if w := int(hi[i]) - int(lo[i]); w > width {
+			axis, width = i, w
+		}
+	}
+	return axis, width
+}
+
+func (b *colorBox) average() color.RGBA {
+	var r, g, bl int
+	for _, c := range b.colors {
+		r += int(c.R)
+		g += int(c.G)
+		bl += int(c.B)
+	}
+	n := len(b.colors)
+	return color.RGBA{R: uint8((r + n/2) / n), G: uint8((g + n/2) / n), B: uint8((bl + n/2) / n), A: 0xFF}
+}
+
+// MedianCutPalette builds an opaque palette of at most n colors from the
+// pixels of img for which include returns true (all pixels when include is nil)
+func MedianCutPalette(img image.Image, include func(x, y int) bool, n int) color.Palette {
+	b := img.Bounds()
+	var pixels []color.RGBA
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if include != nil && !include(x, y) {
+				continue
+			}
+			r, g, bl, _ := img.At(x, y).RGBA()
+			pixels = append(pixels, color.RGBA{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(bl >> 8), A: 0xFF})
+		}
+	}
+	if len(pixels) == 0 || n <= 0 {
+		return color.Palette{color.RGBA{A: 0xFF}}
+	}
+
+	boxes := []*colorBox{{colors: pixels}}
+	for len(boxes) < n {
+		// Split the box with the widest channel range
+		best, bestWidth, bestAxis := -1, 0, 0
+		for i, box := range boxes {
+			if len(box.colors) < 2 {
+				continue
+			}
+			axis, width := box.ranges()
+			if width > bestWidth {
+				best, bestWidth, bestAxis = i, width, axis
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		box := boxes[best]
+		sort.Slice(box.colors, func(i, j int) bool {
+			a, c := box.colors[i], box.colors[j]
+			switch bestAxis {
+			case 0:
+				return a.R < c.R
+			case 1:
+				return a.G < c.G
+			}
+			return a.B < c.B
+		})
+		mid := len(box.colors) / 2
+		boxes[best] = &colorBox{colors: box.colors[:mid]}
+		boxes = append(boxes, &colorBox{colors: box.colors[mid:]})
+	}
+
+	p := make(color.Palette, len(boxes))
+	for i, box := range boxes {
+		p[i] = box.average()
+	}
+	return p
+}
+
+// paletteMatcher finds nearest palette entries, weighting luminance error
+// above chroma error so that luminance-domain watermarks survive quantization
+type paletteMatcher struct {
+	palette color.Palette
+	ycc     [][3]float64
+	cache   map[uint32]uint8
+}
+
+func newPaletteMatcher(p color.Palette) *paletteMatcher {
+	m := &paletteMatcher{palette: p, cache: make(map[uint32]uint8)}
+	for _, c := range p {
+		r, g, b, a := c.RGBA()
+		if a == 0 {
+			// Transparent entries are never chosen by color
+			m.ycc = append(m.ycc, [3]float64{1e9, 1e9, 1e9})
+			continue
+		}
+		m.ycc = append(m.ycc, toYCC(uint8(r>>8), uint8(g>>8), uint8(b>>8)))
+	}
+	return m
+}
+
+func toYCC(r, g, b uint8) [3]float64 {
+	rr, gg, bb := float64(r), float64(g), float64(b)
+	return [3]float64{
+		0.299*rr + 0.587*gg + 0.114*bb,
+		-0.1687*rr - 0.3313*gg + 0.5*bb,
+		0.5*rr - 0.4187*gg - 0.0813*bb,
+	}
+}
+
+func (m *paletteMatcher) index(r, g, b uint8) uint8 {
+	key := uint32(r)<<16 | uint32(g)<<8 | uint32(b)
+	if idx, ok := m.cache[key]; ok {
+		return idx
+	}
+	want := toYCC(r, g, b)
+	best, bestDist := 0, 1e18
+	for i, c := range m.ycc {
+		dy, dcb, dcr := want[0]-c[0], want[1]-c[1], want[2]-c[2]
+		d := 4*dy*dy + dcb*dcb + dcr*dcr
+		if d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	m.cache[key] = uint8(best)
+	return uint8(best)
+}
+
+// QuantizeToPalette maps img onto p without dithering. Pixels for which keep
+// returns false are set to keepIndex instead (e.g. a transparent entry).
+func QuantizeToPalette(img image.Image, p color.Palette, keep func(x, y int) bool, keepIndex uint8) *image.Paletted {
+	b := img.Bounds()
+	out := image.NewPaletted(b, p)
+	m := newPaletteMatcher(p)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			i := out.PixOffset(x, y)
+			if keep != nil && !keep(x, y) {
+				out.Pix[i] = keepIndex
+				continue
+			}
+			r, g, bl, _ := img.At(x, y).RGBA()
+			out.Pix[i] = m.index(uint8(r>>8), uint8(g>>8), uint8(bl>>8))
+		}
+	}
+	return out
+}
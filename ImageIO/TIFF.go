@@ -0,0 +1,574 @@
+package ImageIO
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// Baseline TIFF tags used by the decoder and encoder
+const (
+	tiffTagImageWidth      = 256
+	tiffTagImageLength     = 257
+	tiffTagBitsPerSample   = 258
+	tiffTagCompression     = 259
+	tiffTagPhotometric     = 262
+	tiffTagStripOffsets    = 273
+	tiffTagSamplesPerPixel = 277
+	tiffTagRowsPerStrip    = 278
+	tiffTagStripByteCounts = 279
+	tiffTagXResolution     = 282
+	tiffTagYResolution     = 283
+	tiffTagPlanarConfig    = 284
+	tiffTagResolutionUnit  = 296
+	tiffTagPredictor       = 317
+	tiffTagColorMap        = 320
+	tiffTagTileWidth       = 322
+	tiffTagExtraSamples    = 338
+)
+
+const (
+	tiffCompressionNone     = 1
+	tiffCompressionDeflate  = 8
+	tiffCompressionPackBits = 32773
+	tiffCompressionZlibOld  = 32946
+
+	tiffPhotometricWhiteIsZero = 0
+	tiffPhotometricBlackIsZero = 1
+	tiffPhotometricRGB         = 2
+	tiffPhotometricPalette     = 3
+)
+
+// maxTIFFBytes bounds the files the decoder reads into memory: MaxPixels of
+// uncompressed 16-bit RGBA, with room for the tables
+const maxTIFFBytes = 8*MaxPixels + 1<<20
+
+// Field type sizes indexed by TIFF type code
+var tiffTypeSize = [...]int{0, 1, 1, 2, 4, 8, 1, 1, 2, 4, 8, 4, 8}
+
+func init() {
+	image.RegisterFormat("tiff", "II*\x00", DecodeTIFF, DecodeTIFFConfig)
+	image.RegisterFormat("tiff", "MM\x00*", DecodeTIFF, DecodeTIFFConfig)
+}
+
+// tiffDecoder parses the first IFD of a TIFF file held in memory
+type tiffDecoder struct {
+	data  []byte
+	order binary.ByteOrder
+	tags  map[uint16][]uint32
+
+	width, height   int
+	bitsPerSample   int
+	samplesPerPixel int
+	photometric     uint32
+	compression     uint32
+	predictor       uint32
+	extraAlpha      bool
+}
+
+func newTIFFDecoder(r io.Reader) (*tiffDecoder, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxTIFFBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxTIFFBytes {
+		return nil, fmt.Errorf("tiff: %w: the file exceeds %d bytes", ErrTooLarge, maxTIFFBytes)
+	}
+	if len(data) < 8 {
+		return nil, errors.New("tiff: file too short")
+	}
+
+	d := &tiffDecoder{data: data, tags: make(map[uint16][]uint32)}
+	switch string(data[0:4]) {
+	case "II*\x00":
+		d.order = binary.LittleEndian
+	case "MM\x00*":
+		d.order = binary.BigEndian
+	default:
+		return nil, errors.New("tiff: invalid header")
+	}
+
+	ifd := int(d.order.Uint32(data[4:8]))
+	if ifd+2 > len(data) {
+		return nil, errors.New("tiff: IFD offset out of range")
+	}
+	count := int(d.order.Uint16(data[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + 12*i
+		if entry+12 > len(data) {
+			return nil, errors.New("tiff: truncated IFD")
+		}
+		if err := d.readEntry(data[entry : entry+12]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := d.parseTags(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// readEntry decodes the integer values of one IFD entry
+func (d *tiffDecoder) readEntry(entry []byte) error {
+	tag := d.order.Uint16(entry[0:2])
+	typ := int(d.order.Uint16(entry[2:4]))
+	count := int(d.order.Uint32(entry[4:8]))
+
+	if typ <= 0 || typ >= len(tiffTypeSize) {
+		return nil // unknown types are ignored
+	}
+	size := tiffTypeSize[typ] * count
+	raw := entry[8:12]
+	if size > 4 {
+		off := int(d.order.Uint32(entry[8:12]))
+		if off < 0 || off+size > len(d.data) {
+			return fmt.Errorf("tiff: tag %d data out of range", tag)
+		}
+		raw = d.data[off : off+size]
+	}
+
+	values := make([]uint32, 0, count)
+	for i := 0; i < count; i++ {
+		switch typ {
+		case 1, 2, 6, 7: // BYTE, ASCII, SBYTE, UNDEFINED
+			values = append(values, uint32(raw[i]))
+		case 3, 8: // SHORT, SSHORT
+			values = append(values, uint32(d.order.Uint16(raw[2*i:])))
+		case 4, 9: // LONG, SLONG
+			values = append(values, d.order.Uint32(raw[4*i:]))
+		default:
+			// RATIONAL and floating point values are not needed for decoding
+			return nil
+		}
+	}
+	d.tags[tag] = values
+	return nil
+}
+
+func (d *tiffDecoder) first(tag uint16, def uint32) uint32 {
+	if v, ok := d.tags[tag]; ok && len(v) > 0 {
+		return v[0]
+	}
+	return def
+}
+
+func (d *tiffDecoder) parseTags() error {
+	d.width = int(d.first(tiffTagImageWidth, 0))
+	d.height = int(d.first(tiffTagImageLength, 0))
+	if d.width <= 0 || d.height <= 0 {
+		return errors.New("tiff: missing image dimensions")
+	}
+	if err := checkPixels(d.width, d.height); err != nil {
+		return fmt.Errorf("tiff: %w", err)
+	}
+	if _, tiled := d.tags[tiffTagTileWidth]; tiled {
+		return errors.New("tiff: tiled images are not supported")
+	}
+	if d.first(tiffTagPlanarConfig, 1) != 1 {
+		return errors.New("tiff: planar configuration is not supported")
+	}
+
+	d.bitsPerSample = int(d.first(tiffTagBitsPerSample, 1))
+	d.samplesPerPixel = int(d.first(tiffTagSamplesPerPixel, 1))
+	if d.samplesPerPixel < 1 || d.samplesPerPixel > 4 {
+		return fmt.Errorf("tiff: unsupported %d samples per pixel", d.samplesPerPixel)
+	}
+	d.photometric = d.first(tiffTagPhotometric, tiffPhotometricBlackIsZero)
+	d.compression = d.first(tiffTagCompression, tiffCompressionNone)
+	d.predictor = d.first(tiffTagPredictor, 1)
+	if extra, ok := d.tags[tiffTagExtraSamples]; ok && len(extra) > 0 {
+		d.extraAlpha = extra[0] == 1 || extra[0] == 2
+	}
+
+	switch d.photometric {
+	case tiffPhotometricWhiteIsZero, tiffPhotometricBlackIsZero:
+		if d.bitsPerSample != 1 && d.bitsPerSample != 8 && d.bitsPerSample != 16 {
+			return fmt.Errorf("tiff: unsupported grayscale depth %d", d.bitsPerSample)
+		}
+	case tiffPhotometricRGB:
+		if d.bitsPerSample != 8 && d.bitsPerSample != 16 {
+			return fmt.Errorf("tiff: unsupported RGB depth %d", d.bitsPerSample)
+		}
+		if d.samplesPerPixel < 3 {
+			return errors.New("tiff: RGB image with fewer than 3 samples")
+		}
+	case tiffPhotometricPalette:
+		if d.bitsPerSample != 4 && d.bitsPerSample != 8 {
+			return fmt.Errorf("tiff: unsupported palette depth %d", d.bitsPerSample)
+		}
+	default:
+		return fmt.Errorf("tiff: unsupported photometric interpretation %d", d.photometric)
+	}
+
+	switch d.compression {
+	case tiffCompressionNone, tiffCompressionDeflate, tiffCompressionZlibOld, tiffCompressionPackBits:
+	default:
+		return fmt.Errorf("tiff: unsupported compression %d", d.compression)
+	}
+	return nil
+}
+
+func (d *tiffDecoder) colorModel() color.Model {
+	switch d.photometric {
+	case tiffPhotometricPalette:
+		return d.palette()
+	case tiffPhotometricRGB:
+		if d.bitsPerSample == 16 {
+			return color.NRGBA64Model
+		}
+		return color.NRGBAModel
+	}
+	if d.bitsPerSample == 16 {
+		return color.Gray16Model
+	}
+	return color.GrayModel
+}
+
+func (d *tiffDecoder) palette() color.Palette {
+	cmap := d.tags[tiffTagColorMap]
+	n := 1 << d.bitsPerSample
+	p := make(color.Palette, n)
+	for i := 0; i < n; i++ {
+		if len(cmap) < 3*n {
+			p[i] = color.Gray{Y: uint8(i * 255 / (n - 1))}
+			continue
+		}
+		p[i] = color.RGBA64{
+			R: uint16(cmap[i]), G: uint16(cmap[n+i]), B: uint16(cmap[2*n+i]), A: 0xFFFF,
+		}
+	}
+	return p
+}
+
+// pixelData concatenates and decompresses all strips
+func (d *tiffDecoder) pixelData() ([]byte, error) {
+	offsets := d.tags[tiffTagStripOffsets]
+	counts := d.tags[tiffTagStripByteCounts]
+	if len(offsets) == 0 || len(offsets) != len(counts) {
+		return nil, errors.New("tiff: missing or inconsistent strip tables")
+	}
+
+	// Expand no more than the image can use, so a deflate or PackBits bomb
+	// fails there
+	size := (d.width*d.bitsPerSample*d.samplesPerPixel + 7) / 8 * d.height
+
+	var out bytes.Buffer
+	for i := range offsets {
+		start, n := int(offsets[i]), int(counts[i])
+		if start < 0 || start+n > len(d.data) {
+			return nil, fmt.Errorf("tiff: strip %d out of range", i)
+		}
+		strip := d.data[start : start+n]
+
+		switch d.compression {
+		case tiffCompressionNone:
+			out.Write(strip)
+		case tiffCompressionDeflate, tiffCompressionZlibOld:
+			zr, err := zlib.NewReader(bytes.NewReader(strip))
+			if err != nil {
+				return nil, fmt.Errorf("tiff: strip %d: %w", i, err)
+			}
+			if _, err := io.Copy(&out, io.LimitReader(zr, int64(size-out.Len()+1))); err != nil {
+				return nil, fmt.Errorf("tiff: strip %d: %w", i, err)
+			}
+			zr.Close()
+			if out.Len() > size {
+				return nil, fmt.Errorf("tiff: strip %d inflates past the %d bytes of the image", i, size)
+			}
+		case tiffCompressionPackBits:
+			if err := unpackBits(&out, strip, size); err != nil {
+				return nil, fmt.Errorf("tiff: strip %d: %w", i, err)
+			}
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// unpackBits expands Apple PackBits run-length data, failing once out would
+// grow past limit bytes
+func unpackBits(out *bytes.Buffer, src []byte, limit int) error {
+	for i := 0; i < len(src); {
+		n := int(int8(src[i]))
+		i++
+		switch {
+		case n >= 0:
+			if i+n+1 > len(src) {
+				return errors.New("packbits: literal run overflows input")
+			}
+			if out.Len()+n+1 > limit {
+				return fmt.Errorf("packbits: expands past %d bytes", limit)
+			}
+			out.Write(src[i : i+n+1])
+			i += n + 1
+		case n != -128:
+			if i >= len(src) {
+				return errors.New("packbits: missing repeat byte")
+			}
+			if out.Len()+1-n > limit {
+				return fmt.Errorf("packbits: expands past %d bytes", limit)
+			}
+			for k := 0; k < 1-n; k++ {
+				out.WriteByte(src[i])
+			}
+			i++
+		}
+	}
+	return nil
+}
+
+// DecodeTIFFConfig returns the dimensions and color model of a TIFF image
+func DecodeTIFFConfig(r io.Reader) (image.Config, error) {
+	d, err := newTIFFDecoder(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: d.colorModel(), Width: d.width, Height: d.height}, nil
+}
+
+// DecodeTIFF reads the first image of a baseline strip-based TIFF file
+func DecodeTIFF(r io.Reader) (image.Image, error) {
+	d, err := newTIFFDecoder(r)
+	if err != nil {
+		return nil, err
+	}
+	pix, err := d.pixelData()
+	if err != nil {
+		return nil, err
+	}
+
+	bitsPerPixel := d.bitsPerSample * d.samplesPerPixel
+	stride := (d.width*bitsPerPixel + 7) / 8
+	if len(pix) < stride*d.height {
+		return nil, errors.New("tiff: not enough pixel data")
+	}
+
+	if d.predictor == 2 {
+		if d.bitsPerSample != 8 {
+			return nil, errors.New("tiff: horizontal predictor only supported for 8-bit samples")
+		}
+		for y := 0; y < d.height; y++ {
+			row := pix[y*stride : (y+1)*stride]
+			for x := d.samplesPerPixel; x < len(row); x++ {
+				row[x] += row[x-d.samplesPerPixel]
+			}
+		}
+	}
+
+	rect := image.Rect(0, 0, d.width, d.height)
+
+	switch d.photometric {
+	case tiffPhotometricPalette:
+		img := image.NewPaletted(rect, d.palette())
+		for y := 0; y < d.height; y++ {
+			row := pix[y*stride:]
+			for x := 0; x < d.width; x++ {
+				if d.bitsPerSample == 8 {
+					img.Pix[y*img.Stride+x] = row[x]
+				} else {
+					img.Pix[y*img.Stride+x] = (row[x/2] >> (4 * (1 - uint(x%2)))) & 0x0F
+				}
+			}
+		}
+		return img, nil
+
+	case tiffPhotometricRGB:
+		spp := d.samplesPerPixel
+		alpha := d.extraAlpha && spp >= 4
+		if d.bitsPerSample == 16 {
+			img := image.NewNRGBA64(rect)
+			for y := 0; y < d.height; y++ {
+				row := pix[y*stride:]
+				for x := 0; x < d.width; x++ {
+					s := row[2*spp*x:]
+					c := color.NRGBA64{
+						R: d.order.Uint16(s[0:]), G: d.order.Uint16(s[2:]), B: d.order.Uint16(s[4:]), A: 0xFFFF,
+					}
+					if alpha {
+						c.A = d.order.Uint16(s[6:])
+					}
+					img.SetNRGBA64(x, y, c)
+				}
+			}
+			return img, nil
+		}
+		img := image.NewNRGBA(rect)
+		for y := 0; y < d.height; y++ {
+			row := pix[y*stride:]
+			for x := 0; x < d.width; x++ {
+				s := row[spp*x:]
+				a := uint8(0xFF)
+				if alpha {
+					a = s[3]
+				}
+				i := y*img.Stride + 4*x
+				img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = s[0], s[1], s[2], a
+			}
+		}
+		return img, nil
+	}
+
+	// Grayscale
+	invert := d.photometric == tiffPhotometricWhiteIsZero
+	spp := d.samplesPerPixel
+	if d.bitsPerSample == 16 {
+		img := image.NewGray16(rect)
+		for y := 0; y < d.height; y++ {
+			row := pix[y*stride:]
+			for x := 0; x < d.width; x++ {
+				v := d.order.Uint16(row[2*spp*x:])
+				if invert {
+					v = 0xFFFF - v
+				}
+				img.SetGray16(x, y, color.Gray16{Y: v})
+			}
+		}
+		return img, nil
+	}
+	img := image.NewGray(rect)
+	for y := 0; y < d.height; y++ {
+		row := pix[y*stride:]
+		for x := 0; x < d.width; x++ {
+			var v uint8
+			if d.bitsPerSample == 1 {
+				if (row[x/8]>>(7-uint(x%8)))&1 == 1 {
+					v = 0xFF
+				}
+			} else {
+				v = row[spp*x]
+			}
+			if invert {
+				v = 0xFF - v
+			}
+			img.Pix[y*img.Stride+x] = v
+		}
+	}
+	return img, nil
+}
+
+// tiffEntry is one IFD entry waiting to be written
+type tiffEntry struct {
+	tag    uint16
+	typ    uint16
+	values []uint32
+}
+
+// EncodeTIFF writes img as a little-endian, single-strip, 8-bit RGB or RGBA TIFF
+func EncodeTIFF(w io.Writer, img image.Image, compression TIFFCompression) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width <= 0 || height <= 0 {
+		return errors.New("tiff: empty image")
+	}
+
+	opaque := isOpaque(img)
+	spp := 3
+	if !opaque {
+		spp = 4
+	}
+
+	raw := make([]byte, 0, width*height*spp)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			raw = append(raw, c.R, c.G, c.B)
+			if !opaque {
+				raw = append(raw, c.A)
+			}
+		}
+	}
+
+	compressionTag := uint32(tiffCompressionNone)
+	strip := raw
+	if compression == TIFFDeflate {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		if _, err := zw.Write(raw); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		strip = buf.Bytes()
+		compressionTag = tiffCompressionDeflate
+	}
+
+	// Layout: header | strip | bits-per-sample | resolutions | IFD
+	const headerSize = 8
+	stripOffset := uint32(headerSize)
+	bpsOffset := stripOffset + uint32(len(strip))
+	if bpsOffset%2 == 1 {
+		bpsOffset++
+	}
+	resOffset := bpsOffset + uint32(2*spp)
+	ifdOffset := resOffset + 16
+
+	bps := make([]uint32, spp)
+	for i := range bps {
+		bps[i] = 8
+	}
+
+	entries := []tiffEntry{
+		{tiffTagImageWidth, 4, []uint32{uint32(width)}},
+		{tiffTagImageLength, 4, []uint32{uint32(height)}},
+		{tiffTagBitsPerSample, 3, bps},
+		{tiffTagCompression, 3, []uint32{compressionTag}},
+		{tiffTagPhotometric, 3, []uint32{tiffPhotometricRGB}},
+		{tiffTagStripOffsets, 4, []uint32{stripOffset}},
+		{tiffTagSamplesPerPixel, 3, []uint32{uint32(spp)}},
+		{tiffTagRowsPerStrip, 4, []uint32{uint32(height)}},
+		{tiffTagStripByteCounts, 4, []uint32{uint32(len(strip))}},
+		{tiffTagXResolution, 5, []uint32{resOffset}},
+		{tiffTagYResolution, 5, []uint32{resOffset + 8}},
+		{tiffTagPlanarConfig, 3, []uint32{1}},
+		{tiffTagResolutionUnit, 3, []uint32{2}},
+	}
+	if !opaque {
+		entries = append(entries, tiffEntry{tiffTagExtraSamples, 3, []uint32{2}})
+	}
+
+	le := binary.LittleEndian
+	var out bytes.Buffer
+	out.WriteString("II*\x00")
+	binary.Write(&out, le, ifdOffset)
+	out.Write(strip)
+	for uint32(out.Len()) < bpsOffset {
+		out.WriteByte(0)
+	}
+	for _, v := range bps {
+		binary.Write(&out, le, uint16(v))
+	}
+	// 72/1 dots per inch for both axes
+	binary.Write(&out, le, []uint32{72, 1, 72, 1})
+
+	binary.Write(&out, le, uint16(len(entries)))
+	for _, e := range entries {
+		binary.Write(&out, le, e.tag)
+		binary.Write(&out, le, e.typ)
+		binary.Write(&out, le, uint32(len(e.values)))
+
+		var field [4]byte
+		switch {
+		case e.tag == tiffTagBitsPerSample && len(e.values) > 2:
+			le.PutUint32(field[:], bpsOffset)
+		case e.typ == 5:
+			le.PutUint32(field[:], e.values[0])
+		case e.typ == 3:
+			for i, v := range e.values {
+				le.PutUint16(field[2*i:], uint16(v))
+			}
+		default:
+			le.PutUint32(field[:], e.values[0])
+		}
+		out.Write(field[:])
+	}
+	binary.Write(&out, le, uint32(0)) // no further IFDs
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
@@ -0,0 +1,122 @@
+package ImageIO
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// grayTIFF is a little-endian 8-bit greyscale TIFF with a single strip
+func grayTIFF(width, height int, compression uint16, strip []byte) []byte {
+	type entry struct {
+		tag, typ uint16
+		value    uint32
+	}
+	entries := []entry{
+		{tiffTagImageWidth, 4, uint32(width)},
+		{tiffTagImageLength, 4, uint32(height)},
+		{tiffTagBitsPerSample, 3, 8},
+		{tiffTagCompression, 3, uint32(compression)},
+		{tiffTagPhotometric, 3, tiffPhotometricBlackIsZero},
+		{tiffTagStripOffsets, 4, 0}, // filled in below
+		{tiffTagSamplesPerPixel, 3, 1},
+		{tiffTagRowsPerStrip, 4, uint32(height)},
+		{tiffTagStripByteCounts, 4, uint32(len(strip))},
+	}
+	ifdSize := 2 + 12*len(entries) + 4
+	entries[5].value = uint32(8 + ifdSize)
+
+	b := []byte("II*\x00\x08\x00\x00\x00")
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(entries)))
+	for _, e := range entries {
+		b = binary.LittleEndian.AppendUint16(b, e.tag)
+		b = binary.LittleEndian.AppendUint16(b, e.typ)
+		b = binary.LittleEndian.AppendUint32(b, 1)
+		if e.typ == 3 {
+			b = binary.LittleEndian.AppendUint16(b, uint16(e.value))
+			b = append(b, 0, 0)
+		} else {
+			b = binary.LittleEndian.AppendUint32(b, e.value)
+		}
+	}
+	b = append(b, 0, 0, 0, 0)
+	return append(b, strip...)
+}
+
+func TestTIFFRoundTrip(t *testing.T) {
+	opaque := image.NewNRGBA(image.Rect(0, 0, 13, 7))
+	translucent := image.NewNRGBA(image.Rect(0, 0, 13, 7))
+	for y := 0; y < 7; y++ {
+		for x := 0; x < 13; x++ {
+			c := color.NRGBA{R: uint8(x * 19), G: uint8(y * 37), B: uint8(x*y + 5), A: 0xFF}
+			opaque.SetNRGBA(x, y, c)
+			c.A = uint8(40 + x*y*3)
+			translucent.SetNRGBA(x, y, c)
+		}
+	}
+	for name, img := range map[string]*image.NRGBA{"opaque": opaque, "translucent": translucent} {
+		for _, compression := range []TIFFCompression{TIFFUncompressed, TIFFDeflate} {
+			var buf bytes.Buffer
+			if err := EncodeTIFF(&buf, img, compression); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := DecodeTIFFConfig(bytes.NewReader(buf.Bytes()))
+			if err != nil || cfg.Width != 13 || cfg.Height != 7 {
+				t.Errorf("%s, compression %d: config %+v, %v", name, compression, cfg, err)
+			}
+			got, err := DecodeTIFF(&buf)
+			if err != nil {
+				t.Fatalf("%s, compression %d: %v", name, compression, err)
+			}
+			for y := 0; y < 7; y++ {
+				for x := 0; x < 13; x++ {
+					if c := color.NRGBAModel.Convert(got.At(x, y)); c != img.NRGBAAt(x, y) {
+						t.Fatalf("%s, compression %d: (%d, %d) is %v, want %v", name, compression, x, y, c, img.NRGBAAt(x, y))
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestTIFFPackBits(t *testing.T) {
+	// A run of 4 x 0x10, a literal 1 2 3 4, and a run of 4 x 0x20 fill 3x4
+	strip := []byte{0xFD, 0x10, 0x03, 1, 2, 3, 4, 0xFD, 0x20}
+	img, err := DecodeTIFF(bytes.NewReader(grayTIFF(3, 4, tiffCompressionPackBits, strip)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x10, 0x10, 0x10, 0x10, 1, 2, 3, 4, 0x20, 0x20, 0x20, 0x20}
+	if got := img.(*image.Gray).Pix; !bytes.Equal(got, want) {
+		t.Errorf("pixels %v, want %v", got, want)
+	}
+}
+
+func TestTIFFExpansionBombs(t *testing.T) {
+	// Each two-byte PackBits run expands to 128 bytes, far past 8x8
+	packBits := bytes.Repeat([]byte{0x81, 0x00}, 4096)
+
+	var deflated bytes.Buffer
+	zw := zlib.NewWriter(&deflated)
+	zw.Write(make([]byte, 1<<20))
+	zw.Close()
+
+	for name, file := range map[string][]byte{
+		"packbits": grayTIFF(8, 8, tiffCompressionPackBits, packBits),
+		"deflate":  grayTIFF(8, 8, tiffCompressionDeflate, deflated.Bytes()),
+	} {
+		if _, err := DecodeTIFF(bytes.NewReader(file)); err == nil || !strings.Contains(err.Error(), "past") {
+			t.Errorf("%s: %v, want an error for expanding past the image", name, err)
+		}
+	}
+
+	// Dimensions alone beyond MaxPixels are refused before any allocation
+	if _, err := DecodeTIFF(bytes.NewReader(grayTIFF(50000, 50000, tiffCompressionNone, nil))); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("50000x50000: %v, want ErrTooLarge", err)
+	}
+}
@@ -0,0 +1,196 @@
+package ImageIO
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	y4mSignature   = "YUV4MPEG2"
+	y4mFrameMarker = "FRAME"
+)
+
+// Y4MHeader is the stream header of a YUV4MPEG2 file. Width and Height are
+// required; the other fields are carried through verbatim when present.
+type Y4MHeader struct {
+	Width, Height int
+	FrameRate     string // e.g. "30000:1001"
+	Interlace     string // e.g. "p"
+	Aspect        string // e.g. "1:1"
+	Colorspace    string // "420jpeg", "420mpeg2", "420paldv", "420", "422", "444" or "mono"
+	Extra         []string
+}
+
+// ChromaSize returns the dimensions of each chroma plane (0x0 for mono)
+func (h *Y4MHeader) ChromaSize() (int, int) {
+	switch {
+	case h.Colorspace == "mono":
+		return 0, 0
+	case h.Colorspace == "444":
+		return h.Width, h.Height
+	case h.Colorspace == "422":
+		return (h.Width + 1) / 2, h.Height
+	}
+	// All 4:2:0 variants, which is also the default when C is omitted
+	return (h.Width + 1) / 2, (h.Height + 1) / 2
+}
+
+func (h *Y4MHeader) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s W%d H%d", y4mSignature, h.Width, h.Height)
+	if h.FrameRate != "" {
+		b.WriteString(" F" + h.FrameRate)
+	}
+	if h.Interlace != "" {
+		b.WriteString(" I" + h.Interlace)
+	}
+	if h.Aspect != "" {
+		b.WriteString(" A" + h.Aspect)
+	}
+	if h.Colorspace != "" {
+		b.WriteString(" C" + h.Colorspace)
+	}
+	for _, x := range h.Extra {
+		b.WriteString(" " + x)
+	}
+	return b.String()
+}
+
+// Y4MFrame holds the planes of one frame
+type Y4MFrame struct {
+	Y, Cb, Cr []byte
+	Params    string // frame header parameters after "FRAME", usually empty
+}
+
+// Y4MReader reads frames from a YUV4MPEG2 stream one at a time
+type Y4MReader struct {
+	Header Y4MHeader
+	r      *bufio.Reader
+}
+
+// NewY4MReader parses the stream header
+func NewY4MReader(r io.Reader) (*Y4MReader, error) {
+	br := bufio.NewReader(r)
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("y4m: reading header: %w", err)
+	}
+	fields := strings.Fields(strings.TrimSuffix(line, "\n"))
+	if len(fields) == 0 || fields[0] != y4mSignature {
+		return nil, errors.New("y4m: missing YUV4MPEG2 signature")
+	}
+
+	y := &Y4MReader{r: br}
+	h := &y.Header
+	for _, f := range fields[1:] {
+		value := f[1:]
+		switch f[0] {
+		case 'W':
+			h.Width, err = strconv.Atoi(value)
+		case 'H':
+			h.Height, err = strconv.Atoi(value)
+		case 'F':
+			h.FrameRate = value
+		case 'I':
+			h.Interlace = value
+		case 'A':
+			h.Aspect = value
+		case 'C':
+			h.Colorspace = value
+		default:
+			h.Extra = append(h.Extra, f)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("y4m: bad header field %q", f)
+		}
+	}
+
+	if h.Width <= 0 || h.Height <= 0 {
+		return nil, errors.New("y4m: missing frame dimensions")
+	}
+	// Every frame is allocated at this size, whatever the stream holds
+	if err := checkPixels(h.Width, h.Height); err != nil {
+		return nil, fmt.Errorf("y4m: %w", err)
+	}
+	switch h.Colorspace {
+	case "", "420", "420jpeg", "420mpeg2", "420paldv", "422", "444", "mono":
+	default:
+		return nil, fmt.Errorf("y4m: unsupported colorspace %q (8-bit 4:2:0, 4:2:2, 4:4:4 and mono only)", h.Colorspace)
+	}
+	return y, nil
+}
+
+// ReadFrame returns the next frame, or io.EOF after the last one
+func (y *Y4MReader) ReadFrame() (*Y4MFrame, error) {
+	line, err := y.r.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("y4m: reading frame header: %w", err)
+	}
+	line = strings.TrimSuffix(line, "\n")
+	if !strings.HasPrefix(line, y4mFrameMarker) {
+		return nil, fmt.Errorf("y4m: expected FRAME, got %q", line)
+	}
+
+	cw, ch := y.Header.ChromaSize()
+	f := &Y4MFrame{
+		Y:      make([]byte, y.Header.Width*y.Header.Height),
+		Cb:     make([]byte, cw*ch),
+		Cr:     make([]byte, cw*ch),
+		Params: strings.TrimSpace(strings.TrimPrefix(line, y4mFrameMarker)),
+	}
+	for _, plane := range [][]byte{f.Y, f.Cb, f.Cr} {
+		if _, err := io.ReadFull(y.r, plane); err != nil {
+			return nil, fmt.Errorf("y4m: truncated frame: %w", err)
+		}
+	}
+	return f, nil
+}
+
+// Y4MWriter writes a YUV4MPEG2 stream
+type Y4MWriter struct {
+	Header Y4MHeader
+	w      *bufio.Writer
+}
+
+// NewY4MWriter writes the stream header
+func NewY4MWriter(w io.Writer, header Y4MHeader) (*Y4MWriter, error) {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(header.String() + "\n"); err != nil {
+		return nil, err
+	}
+	return &Y4MWriter{Header: header, w: bw}, nil
+}
+
+// WriteFrame appends one frame; the planes must match the header dimensions
+func (y *Y4MWriter) WriteFrame(f *Y4MFrame) error {
+	cw, ch := y.Header.ChromaSize()
+	if len(f.Y) != y.Header.Width*y.Header.Height || len(f.Cb) != cw*ch || len(f.Cr) != cw*ch {
+		return errors.New("y4m: frame planes do not match header dimensions")
+	}
+
+	header := y4mFrameMarker
+	if f.Params != "" {
+		header += " " + f.Params
+	}
+	if _, err := y.w.WriteString(header + "\n"); err != nil {
+		return err
+	}
+	for _, plane := range [][]byte{f.Y, f.Cb, f.Cr} {
+		if _, err := y.w.Write(plane); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush writes any buffered data to the underlying writer
+func (y *Y4MWriter) Flush() error {
+	return y.w.Flush()
+}
@@ -0,0 +1,81 @@
+package ImageIO
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestY4MRoundTrip(t *testing.T) {
+	header := Y4MHeader{Width: 5, Height: 3, FrameRate: "30000:1001", Interlace: "p", Colorspace: "420jpeg", Extra: []string{"XYSCSS=420JPEG"}}
+	cw, ch := header.ChromaSize()
+	if cw != 3 || ch != 2 {
+		t.Fatalf("chroma %dx%d, want 3x2", cw, ch)
+	}
+	var frames []*Y4MFrame
+	for n := range 2 {
+		f := &Y4MFrame{Y: make([]byte, 15), Cb: make([]byte, 6), Cr: make([]byte, 6)}
+		for i := range f.Y {
+			f.Y[i] = byte(n*50 + i)
+		}
+		for i := range f.Cb {
+			f.Cb[i], f.Cr[i] = byte(100+i), byte(200-i)
+		}
+		frames = append(frames, f)
+	}
+	frames[1].Params = "Ixyz"
+
+	var buf bytes.Buffer
+	w, err := NewY4MWriter(&buf, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range frames {
+		if err := w.WriteFrame(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewY4MReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r.Header, header) {
+		t.Errorf("header %+v, want %+v", r.Header, header)
+	}
+	for i, want := range frames {
+		got, err := r.ReadFrame()
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("frame %d: %+v, want %+v", i, got, want)
+		}
+	}
+	if _, err := r.ReadFrame(); err != io.EOF {
+		t.Errorf("after the last frame: %v, want io.EOF", err)
+	}
+}
+
+func TestY4MHeaderBomb(t *testing.T) {
+	stream := "YUV4MPEG2 W99999 H99999 C420jpeg\nFRAME\n" + strings.Repeat("\x80", 60)
+	if _, err := NewY4MReader(strings.NewReader(stream)); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("got %v, want ErrTooLarge", err)
+	}
+}
+
+func TestY4MTruncatedFrame(t *testing.T) {
+	r, err := NewY4MReader(strings.NewReader("YUV4MPEG2 W4 H4 Cmono\nFRAME\n" + strings.Repeat("\x80", 10)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReadFrame(); err == nil || err == io.EOF {
+		t.Fatalf("truncated frame read without an error: %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+// Package Jobs runs embed and extract work in the background. Jobs are kept
+// on disk, one directory each, so queued work survives a restart; a pool of
+// workers processes them, retrying transient failures, and an optional
+// webhook is called when a job finishes.
+package Jobs
+
+import (
+	"InvisibleWaterMarkingSystem/Watermark"
+	"fmt"
+	"time"
+)
+
+// Kind is the operation a job performs
+type Kind string
+
+const (
+	KindEmbed   Kind = "embed"
+	KindExtract Kind = "extract"
+)
+
+// State is where a job is in its life cycle
+type State string
+
+const (
+	StateQueued    State = "queued"
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+)
+
+// Done reports whether the state is terminal
+func (s State) Done() bool {
+	return s == StateSucceeded || s == StateFailed
+}
+
+// Spec is what a client submits alongside the image
+type Spec struct {
+	Kind    Kind               `json:"kind"`
+	Message string             `json:"message,omitempty"` // embed only
+	Options *Watermark.Options `json:"options,omitempty"`
+
+	// Keyed and PayloadKeyed record that Options had a key and a payload
+	// key. The keys themselves are held in memory only, so they never reach
+	// job.json, the API or a callback.
+	Keyed        bool `json:"keyed,omitempty"`
+	PayloadKeyed bool `json:"payload_keyed,omitempty"`
+
+	// Format names the embed output format; empty keeps the input format
+	Format      string `json:"format,omitempty"`
+	JPEGQuality int    `json:"jpeg_quality,omitempty"`
+	Coefficient bool   `json:"coefficient,omitempty"`
+
+	// CallbackURL receives a POST of the job when it finishes
+	CallbackURL string `json:"callback_url,omitempty"`
+}
+
+// EmbedResult describes the file an embed job wrote
+type EmbedResult struct {
+	Format      string `json:"format"`
+	ContentType string `json:"content_type"`
+	Tiles       int    `json:"tiles,omitempty"`
+	Frames      int    `json:"frames,omitempty"`
+	Size        int    `json:"size"`
+}
+
+// LogEntry is one line of a job's log
+type LogEntry struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// Job is the persisted record of one submission
+type Job struct {
+	ID       string     `json:"id"`
+	Spec     Spec       `json:"spec"`
+	State    State      `json:"state"`
+	Attempts int        `json:"attempts"`
+	Created  time.Time  `json:"created"`
+	Updated  time.Time  `json:"updated"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+
+	// NextAttempt is set while a failed attempt waits to be retried
+	NextAttempt *time.Time `json:"next_attempt,omitempty"`
+
+	Error   string                   `json:"error,omitempty"`
+	Embed   *EmbedResult             `json:"embed,omitempty"`
+	Extract *Watermark.ExtractReport `json:"extract,omitempty"`
+	Log     []LogEntry               `json:"log"`
+
+	// secrets are the keys taken out of Spec.Options at submission
+	secrets secrets
+}
+
+// secrets are the parts of the options that are never persisted or shown
+type secrets struct {
+	key        string
+	payloadKey string
+}
+
+// seal moves the keys out of j.Spec.Options into j.secrets
+func (j *Job) seal() {
+	if j.Spec.Options == nil {
+		return
+	}
+	opts := *j.Spec.Options
+	j.secrets = secrets{key: opts.Key, payloadKey: opts.PayloadKey}
+	j.Spec.Keyed = opts.Key != ""
+	j.Spec.PayloadKeyed = opts.PayloadKey != ""
+	opts.Key, opts.PayloadKey = "", ""
+	j.Spec.Options = &opts
+}
+
+// options returns the options to run j with, keys restored
+func (j *Job) options() *Watermark.Options {
+	opts := *j.Spec.Options
+	opts.Key, opts.PayloadKey = j.secrets.key, j.secrets.payloadKey
+	return &opts
+}
+
+// sealed reports whether j needs keys that were lost with a restart
+func (j *Job) sealed() bool {
+	return (j.Spec.Keyed && j.secrets.key == "") || (j.Spec.PayloadKeyed && j.secrets.payloadKey == "")
+}
+
+func (j *Job) logf(now time.Time, format string, args ...any) {
+	j.Log = append(j.Log, LogEntry{Time: now, Message: fmt.Sprintf(format, args...)})
+}
+
+// clone returns a copy safe to hand out while workers keep updating j. The
+// secrets are copied too, but being unexported they are never marshalled,
+// so the copy can be listed or sent to a callback as it is.
+func (j *Job) clone() *Job {
+	c := *j
+	c.Log = append([]LogEntry(nil), j.Log...)
+	if j.Spec.Options != nil {
+		opts := *j.Spec.Options
+		c.Spec.Options = &opts
+	}
+	return &c
+}
@@ -0,0 +1,457 @@
+package Jobs
+
+import (
+	"InvisibleWaterMarkingSystem/ImageIO"
+	"InvisibleWaterMarkingSystem/Watermark"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned for unknown job IDs
+	ErrNotFound = errors.New("job not found")
+
+	// ErrNoOutput is returned when asking for the file of a job that has not
+	// produced one: still pending, failed, or an extract job
+	ErrNoOutput = errors.New("job has no output")
+
+	// ErrClosed is returned by Submit after Close
+	ErrClosed = errors.New("job queue closed")
+
+	// errKeysLost fails keyed jobs left pending by a restart: their keys
+	// were never written to disk
+	errKeysLost = errors.New("job keys are not kept across restarts; submit it again")
+)
+
+// Config controls a queue; zero fields take their DefaultConfig values
+type Config struct {
+	Dir         string        // root of the on-disk store, required
+	Workers     int           // jobs processed at once
+	MaxAttempts int           // attempts per job before it is marked failed
+	RetryDelay  time.Duration // wait before the first retry, doubling after each
+	HTTPClient  *http.Client  // used for webhook callbacks
+
+	// CallbackHosts lists the host names callback URLs may point at; with
+	// none, jobs cannot ask for a callback at all. Any client of the service
+	// can submit one, so the default HTTPClient also refuses to connect to
+	// loopback, private and link-local addresses and does not follow
+	// redirects.
+	CallbackHosts []string
+}
+
+// DefaultConfig returns the settings used for zero fields
+func DefaultConfig() Config {
+	return Config{
+		Workers:     2,
+		MaxAttempts: 3,
+		RetryDelay:  5 * time.Second,
+		HTTPClient:  callbackClient(),
+	}
+}
+
+// Queue accepts jobs and runs them on a fixed pool of workers
+type Queue struct {
+	cfg   Config
+	store *store
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	jobs   map[string]*Job
+	ready  []string // IDs waiting for a worker, oldest first
+	timers map[string]*time.Timer
+	closed bool
+	quit   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// Open loads the jobs stored under cfg.Dir and starts the workers. Jobs that
+// were running when the process stopped are queued again, except those
+// submitted with a key, which fail since the key was only held in memory.
+func Open(cfg Config) (*Queue, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("job queue needs a directory")
+	}
+	def := DefaultConfig()
+	if cfg.Workers <= 0 {
+		cfg.Workers = def.Workers
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = def.MaxAttempts
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = def.RetryDelay
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = def.HTTPClient
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	q := &Queue{
+		cfg:    cfg,
+		store:  &store{dir: cfg.Dir},
+		jobs:   make(map[string]*Job),
+		timers: make(map[string]*time.Timer),
+		quit:   make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.mu)
+
+	jobs, err := q.store.load()
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(jobs, func(a, b *Job) int { return a.Created.Compare(b.Created) })
+	now := time.Now()
+	for _, j := range jobs {
+		q.jobs[j.ID] = j
+		if !j.State.Done() && j.sealed() {
+			j.State = StateFailed
+			j.Error = errKeysLost.Error()
+			j.Finished, j.NextAttempt, j.Updated = &now, nil, now
+			j.logf(now, "%v; giving up", errKeysLost)
+			if err := q.store.save(j); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		switch j.State {
+		case StateRunning:
+			j.State = StateQueued
+			j.logf(now, "interrupted by a restart during attempt %d; queued again", j.Attempts)
+			j.Updated = now
+			if err := q.store.save(j); err != nil {
+				return nil, err
+			}
+			q.ready = append(q.ready, j.ID)
+		case StateQueued:
+			if j.NextAttempt != nil && j.NextAttempt.After(now) {
+				q.scheduleLocked(j.ID, j.NextAttempt.Sub(now))
+			} else {
+				q.ready = append(q.ready, j.ID)
+			}
+		}
+	}
+
+	for range cfg.Workers {
+		q.wg.Add(1)
+		go q.worker()
+	}
+	return q, nil
+}
+
+// Close stops taking jobs, waits for running ones to finish and abandons
+// pending webhook retries. Queued jobs stay on disk for the next Open.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	for _, t := range q.timers {
+		t.Stop()
+	}
+	close(q.quit)
+	q.cond.Broadcast()
+	q.mu.Unlock()
+	q.wg.Wait()
+}
+
+// Submit validates spec, stores the image and queues the job
+func (q *Queue) Submit(spec Spec, image []byte) (*Job, error) {
+	if err := validate(&spec, image, q.cfg.CallbackHosts); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	j := &Job{
+		ID:      newID(),
+		Spec:    spec,
+		State:   StateQueued,
+		Created: now,
+		Updated: now,
+	}
+	j.seal()
+	j.logf(now, "submitted %s job with a %d-byte %s image", spec.Kind, len(image), ImageIO.DetectFormat(image))
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil, ErrClosed
+	}
+	if err := q.store.create(j, image); err != nil {
+		return nil, err
+	}
+	q.jobs[j.ID] = j
+	q.ready = append(q.ready, j.ID)
+	q.cond.Signal()
+	return j.clone(), nil
+}
+
+func validate(spec *Spec, image []byte, callbackHosts []string) error {
+	switch spec.Kind {
+	case KindEmbed:
+		if spec.Message == "" {
+			return fmt.Errorf("%w: embed jobs need a message", Watermark.ErrInvalidOptions)
+		}
+		if err := Watermark.CheckMessageLength(spec.Message, spec.Options); err != nil {
+			return err
+		}
+	case KindExtract:
+	default:
+		return fmt.Errorf("%w: unknown job kind %q", Watermark.ErrInvalidOptions, spec.Kind)
+	}
+	if spec.Format != "" && ImageIO.ParseFormat(spec.Format) == ImageIO.FormatUnknown {
+		return fmt.Errorf("%w: unknown format %q", Watermark.ErrInvalidOptions, spec.Format)
+	}
+	if spec.JPEGQuality < 0 || spec.JPEGQuality > 100 {
+		return fmt.Errorf("%w: JPEG quality must be between 1 and 100", Watermark.ErrInvalidOptions)
+	}
+	if spec.CallbackURL != "" {
+		u, err := url.Parse(spec.CallbackURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: callback URL must be an absolute http(s) URL", Watermark.ErrInvalidOptions)
+		}
+		if len(callbackHosts) == 0 {
+			return fmt.Errorf("%w: callbacks are disabled on this server", Watermark.ErrInvalidOptions)
+		}
+		if !slices.ContainsFunc(callbackHosts, func(h string) bool { return strings.EqualFold(h, u.Hostname()) }) {
+			return fmt.Errorf("%w: callback host %q is not allowed", Watermark.ErrInvalidOptions, u.Hostname())
+		}
+	}
+	if spec.Options == nil {
+		spec.Options = Watermark.DefaultOptions()
+	}
+	if err := Watermark.CheckModulation(spec.Options); err != nil {
+		return err
+	}
+	if ImageIO.DetectFormat(image) == ImageIO.FormatUnknown {
+		return fmt.Errorf("%w: unrecognised format", Watermark.ErrInvalidImage)
+	}
+	return nil
+}
+
+// Get returns a snapshot of a job
+func (q *Queue) Get(id string) (*Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return j.clone(), nil
+}
+
+// List returns snapshots of all jobs, oldest first
+func (q *Queue) List() []*Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]*Job, 0, len(q.jobs))
+	for _, j := range q.jobs {
+		jobs = append(jobs, j.clone())
+	}
+	slices.SortFunc(jobs, func(a, b *Job) int { return a.Created.Compare(b.Created) })
+	return jobs
+}
+
+// Output returns the path of the file a finished embed job wrote, with the
+// job snapshot describing it
+func (q *Queue) Output(id string) (string, *Job, error) {
+	j, err := q.Get(id)
+	if err != nil {
+		return "", nil, err
+	}
+	if j.State != StateSucceeded || j.Embed == nil {
+		return "", j, ErrNoOutput
+	}
+	return q.store.path(id, outputFile), j, nil
+}
+
+// scheduleLocked queues id again after d; q.mu must be held
+func (q *Queue) scheduleLocked(id string, d time.Duration) {
+	q.timers[id] = time.AfterFunc(d, func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		delete(q.timers, id)
+		if q.closed {
+			return
+		}
+		q.ready = append(q.ready, id)
+		q.cond.Signal()
+	})
+}
+
+func (q *Queue) worker() {
+	defer q.wg.Done()
+	for {
+		j := q.next()
+		if j == nil {
+			return
+		}
+		result, err := q.execute(j)
+		q.finish(j.ID, result, err)
+	}
+}
+
+// next blocks for a ready job, marks it running and returns a snapshot; nil
+// once the queue is closed
+func (q *Queue) next() *Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.ready) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return nil
+	}
+	id := q.ready[0]
+	q.ready = q.ready[1:]
+
+	j := q.jobs[id]
+	now := time.Now()
+	j.State = StateRunning
+	j.Attempts++
+	j.Started, j.NextAttempt, j.Updated = &now, nil, now
+	j.logf(now, "attempt %d of %d started", j.Attempts, q.cfg.MaxAttempts)
+	q.saveLocked(j)
+	return j.clone()
+}
+
+// result carries what one attempt produced
+type result struct {
+	embed   *EmbedResult
+	extract *Watermark.ExtractReport
+}
+
+// execute runs one attempt. The transforms panic on inconsistent band sizes
+// rather than returning errors, so a panic becomes an error that counts
+// against the attempts instead of taking the process down.
+func (q *Queue) execute(j *Job) (res result, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	data, err := os.ReadFile(q.store.path(j.ID, inputFile))
+	if err != nil {
+		return res, err
+	}
+	spec := j.Spec
+	spec.Options = j.options()
+
+	switch spec.Kind {
+	case KindEmbed:
+		fopts := &Watermark.FileOptions{
+			Format:      ImageIO.ParseFormat(spec.Format),
+			JPEGQuality: spec.JPEGQuality,
+			XMPNote:     "Invisible watermark embedded",
+			Coefficient: spec.Coefficient,
+		}
+		out, err := Watermark.EmbedBytes(data, spec.Message, spec.Options, fopts)
+		if err != nil {
+			return res, err
+		}
+		if err := writeAtomic(q.store.path(j.ID, outputFile), out.Data); err != nil {
+			return res, err
+		}
+		res.embed = &EmbedResult{
+			Format:      out.Format.String(),
+			ContentType: out.Format.MIMEType(),
+			Tiles:       out.Tiles,
+			Frames:      out.Frames,
+			Size:        len(out.Data),
+		}
+	case KindExtract:
+		report, err := Watermark.ExtractBytes(data, spec.Options, spec.Coefficient)
+		if err != nil {
+			return res, err
+		}
+		res.extract = report
+	}
+	return res, nil
+}
+
+// permanent reports whether retrying err cannot help: the input or the
+// options are at fault rather than the environment
+func permanent(err error) bool {
+	for _, target := range []error{
+		Watermark.ErrInvalidImage,
+		Watermark.ErrInvalidOptions,
+		Watermark.ErrMessageTooLong,
+		Watermark.ErrImageTooSmall,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *Queue) finish(id string, res result, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j := q.jobs[id]
+	now := time.Now()
+	j.Updated = now
+
+	switch {
+	case err == nil:
+		j.State = StateSucceeded
+		j.Error = ""
+		j.Embed, j.Extract = res.embed, res.extract
+		j.Finished = &now
+		if res.extract != nil && !res.extract.Found {
+			j.logf(now, "attempt %d succeeded; no watermark found", j.Attempts)
+		} else {
+			j.logf(now, "attempt %d succeeded", j.Attempts)
+		}
+	case permanent(err) || j.Attempts >= q.cfg.MaxAttempts:
+		j.State = StateFailed
+		j.Error = err.Error()
+		j.Finished = &now
+		j.logf(now, "attempt %d failed: %v; giving up", j.Attempts, err)
+	default:
+		delay := q.cfg.RetryDelay << (j.Attempts - 1)
+		next := now.Add(delay)
+		j.State = StateQueued
+		j.Error = err.Error()
+		j.NextAttempt = &next
+		j.logf(now, "attempt %d failed: %v; retrying in %v", j.Attempts, err, delay)
+		if !q.closed {
+			q.scheduleLocked(id, delay)
+		}
+	}
+	q.saveLocked(j)
+
+	if j.State.Done() && j.Spec.CallbackURL != "" && !q.closed {
+		q.wg.Add(1)
+		go q.notify(j.clone())
+	}
+}
+
+// saveLocked persists j; a failed write is recorded in the in-memory log,
+// since the job itself has still run
+func (q *Queue) saveLocked(j *Job) {
+	if err := q.store.save(j); err != nil {
+		j.logf(time.Now(), "saving job record: %v", err)
+	}
+}
+
+// appendLog adds a line to a job's log from outside a worker
+func (q *Queue) appendLog(id, format string, args ...any) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if j, ok := q.jobs[id]; ok {
+		j.logf(time.Now(), format, args...)
+		q.saveLocked(j)
+	}
+}
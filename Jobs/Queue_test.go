@@ -0,0 +1,293 @@
+package Jobs
+
+import (
+	"InvisibleWaterMarkingSystem/Watermark"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	Watermark.Output = io.Discard
+	os.Exit(m.Run())
+}
+
+// testPNG is a deterministic textured PNG large enough to hold a message
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := 128 + 40*math.Sin(float64(x)/23) + 30*math.Cos(float64(y)/17) + float64((x*7+y*13)%25-12)
+			img.Set(x, y, color.RGBA{R: uint8(v), G: uint8(v * 0.9), B: uint8(255 - v), A: 0xFF})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func openQueue(t *testing.T, cfg Config) *Queue {
+	t.Helper()
+	cfg.Dir = t.TempDir()
+	q, err := Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(q.Close)
+	return q
+}
+
+// wait polls until the job finishes
+func wait(t *testing.T, q *Queue, id string) *Job {
+	t.Helper()
+	for deadline := time.Now().Add(time.Minute); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		j, err := q.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if j.State.Done() {
+			return j
+		}
+	}
+	t.Fatalf("job %s did not finish", id)
+	return nil
+}
+
+// assertNoSecret fails when data contains any of the secrets
+func assertNoSecret(t *testing.T, where string, data []byte, secrets ...string) {
+	t.Helper()
+	for _, s := range secrets {
+		if bytes.Contains(data, []byte(s)) {
+			t.Errorf("%s contains the secret %q:\n%s", where, s, data)
+		}
+	}
+}
+
+func TestJobKeysAreNotStoredOrListed(t *testing.T) {
+	const key = "job-key-not-for-disk"
+	q := openQueue(t, Config{})
+	opts := Watermark.DefaultOptions()
+	opts.Key = key
+	j, err := q.Submit(Spec{Kind: KindEmbed, Message: "Hello World", Options: opts}, testPNG(t, 512, 512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Key != key {
+		t.Fatal("Submit changed the caller's options")
+	}
+	j = wait(t, q, j.ID)
+	if j.State != StateSucceeded {
+		t.Fatalf("job %s: %s", j.State, j.Error)
+	}
+	if !j.Spec.Keyed {
+		t.Error("job does not record that it was keyed")
+	}
+
+	listed, err := json.Marshal(q.List())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertNoSecret(t, "job list", listed, key)
+	stored, err := os.ReadFile(filepath.Join(q.cfg.Dir, j.ID, recordFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertNoSecret(t, "job.json", stored, key)
+
+	// The job still ran with the key
+	path, _, err := q.Output(j.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := Watermark.ExtractBytes(out, opts, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Found || report.Message != "Hello World" {
+		t.Fatalf("extracting with the key: %+v", report)
+	}
+}
+
+func TestJobWebhookCarriesNoKeys(t *testing.T) {
+	const key, payloadKey = "job-key-not-for-callbacks", "payload-key-not-for-callbacks"
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	q := openQueue(t, Config{CallbackHosts: []string{"127.0.0.1"}, HTTPClient: srv.Client()})
+	opts := Watermark.DefaultOptions()
+	opts.Key, opts.PayloadKey = key, payloadKey
+	spec := Spec{Kind: KindEmbed, Message: "Hello World", Options: opts, CallbackURL: srv.URL}
+	j, err := q.Submit(spec, testPNG(t, 512, 512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	submitted, _ := json.Marshal(j)
+	assertNoSecret(t, "submitted job", submitted, key, payloadKey)
+
+	select {
+	case body := <-bodies:
+		assertNoSecret(t, "callback body", body, key, payloadKey)
+		var notified Job
+		if err := json.Unmarshal(body, &notified); err != nil {
+			t.Fatal(err)
+		}
+		if notified.State != StateSucceeded {
+			t.Fatalf("job %s: %s", notified.State, notified.Error)
+		}
+		if !notified.Spec.Keyed || !notified.Spec.PayloadKeyed {
+			t.Error("callback does not record that the job was keyed")
+		}
+	case <-time.After(time.Minute):
+		t.Fatal("no callback")
+	}
+	got, err := q.Get(j.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	one, _ := json.Marshal(got)
+	assertNoSecret(t, "job", one, key, payloadKey)
+	stored, err := os.ReadFile(filepath.Join(q.cfg.Dir, j.ID, recordFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertNoSecret(t, "job.json", stored, key, payloadKey)
+
+	// The message was sealed with the payload key
+	path, _, err := q.Output(j.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := Watermark.ExtractBytes(out, opts, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Found || report.Message != "Hello World" {
+		t.Fatalf("extracting with both keys: %+v", report)
+	}
+}
+
+func TestKeyedJobFailsAfterRestart(t *testing.T) {
+	// A keyed job left queued by a previous process: its record is on
+	// disk, its key was not
+	dir := t.TempDir()
+	now := time.Now()
+	j := &Job{
+		ID:      newID(),
+		Spec:    Spec{Kind: KindExtract, Options: Watermark.DefaultOptions(), Keyed: true},
+		State:   StateQueued,
+		Created: now,
+		Updated: now,
+	}
+	if err := (&store{dir: dir}).create(j, testPNG(t, 64, 64)); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := Open(Config{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	got, err := q.Get(j.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.State != StateFailed || got.Error != errKeysLost.Error() {
+		t.Fatalf("keyed job after a restart: %s %q", got.State, got.Error)
+	}
+}
+
+func TestCallbacksNeedAnAllowedHost(t *testing.T) {
+	data := testPNG(t, 64, 64)
+	for _, c := range []struct {
+		hosts []string
+		url   string
+		ok    bool
+	}{
+		{nil, "https://hooks.example.com/done", false},
+		{[]string{"hooks.example.com"}, "https://hooks.example.com/done", true},
+		{[]string{"hooks.example.com"}, "https://HOOKS.example.com:8443/done", true},
+		{[]string{"hooks.example.com"}, "http://169.254.169.254/latest", false},
+		{[]string{"hooks.example.com"}, "http://hooks.example.com.evil.test/", false},
+	} {
+		q := openQueue(t, Config{CallbackHosts: c.hosts})
+		_, err := q.Submit(Spec{Kind: KindExtract, CallbackURL: c.url}, data)
+		if c.ok && err != nil {
+			t.Errorf("hosts %q, callback %s: %v", c.hosts, c.url, err)
+		}
+		if !c.ok && !errors.Is(err, Watermark.ErrInvalidOptions) {
+			t.Errorf("hosts %q, callback %s: %v, want ErrInvalidOptions", c.hosts, c.url, err)
+		}
+	}
+}
+
+func TestCallbackClientStaysOnPublicAddresses(t *testing.T) {
+	for addr, public := range map[string]bool{
+		"93.184.216.34":    true,
+		"2606:2800:220::1": true,
+		"127.0.0.1":        false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"::1":              false,
+		"fe80::1":          false,
+		"fd00::1":          false,
+		"::ffff:127.0.0.1": false,
+	} {
+		if got := publicAddr(netip.MustParseAddr(addr)); got != public {
+			t.Errorf("publicAddr(%s) = %v", addr, got)
+		}
+	}
+
+	hits := 0
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { hits++ }))
+	defer internal.Close()
+	redirect := httptest.NewServer(http.RedirectHandler(internal.URL, http.StatusFound))
+	defer redirect.Close()
+
+	// Loopback is refused once resolved
+	if resp, err := callbackClient().Post(internal.URL, "application/json", nil); err == nil {
+		resp.Body.Close()
+		t.Error("callback client connected to a loopback address")
+	}
+	// Redirects are not followed, whatever the transport
+	client := callbackClient()
+	client.Transport = http.DefaultTransport
+	resp, err := client.Post(redirect.URL, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound || hits != 0 {
+		t.Errorf("redirect followed: status %d, %d requests to its target", resp.StatusCode, hits)
+	}
+}
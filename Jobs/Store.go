@@ -0,0 +1,96 @@
+package Jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// The store keeps each job in its own directory under the queue's root:
+//
+//	<dir>/<id>/job.json  the Job record
+//	<dir>/<id>/input     the uploaded image
+//	<dir>/<id>/output    the watermarked file, for finished embed jobs
+const (
+	recordFile = "job.json"
+	inputFile  = "input"
+	outputFile = "output"
+)
+
+type store struct {
+	dir string
+}
+
+func newID() string {
+	var b [12]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func (s *store) path(id, name string) string {
+	return filepath.Join(s.dir, id, name)
+}
+
+// create makes the job directory and writes the input and the first record
+func (s *store) create(j *Job, input []byte) error {
+	if err := os.MkdirAll(filepath.Join(s.dir, j.ID), 0o755); err != nil {
+		return err
+	}
+	if err := writeAtomic(s.path(j.ID, inputFile), input); err != nil {
+		return err
+	}
+	return s.save(j)
+}
+
+func (s *store) save(j *Job) error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeAtomic(s.path(j.ID, recordFile), data)
+}
+
+// load reads every job record; directories without a readable record, such
+// as a submission interrupted half way, are skipped
+func (s *store) load() ([]*Job, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var jobs []*Job
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(s.path(e.Name(), recordFile))
+		if err != nil {
+			continue
+		}
+		var j Job
+		if json.Unmarshal(data, &j) != nil || j.ID != e.Name() {
+			continue
+		}
+		jobs = append(jobs, &j)
+	}
+	return jobs, nil
+}
+
+// writeAtomic writes through a temporary file and a rename so a crash never
+// leaves a truncated record behind
+func writeAtomic(path string, data []byte) error {
+	tmp := path + ".partial"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package Jobs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// webhookAttempts bounds the deliveries tried per finished job
+const webhookAttempts = 3
+
+// notify POSTs the finished job as JSON to its callback URL, retrying with
+// backoff until a 2xx response, the attempt limit or Close. Each outcome is
+// recorded in the job's log. The body carries the redacted spec, no keys.
+func (q *Queue) notify(j *Job) {
+	defer q.wg.Done()
+	body, err := json.Marshal(j)
+	if err != nil {
+		q.appendLog(j.ID, "callback: %v", err)
+		return
+	}
+
+	delay := time.Second
+	for attempt := 1; ; attempt++ {
+		err := q.post(j.ID, j.Spec.CallbackURL, body)
+		if err == nil {
+			q.appendLog(j.ID, "callback delivered to %s", j.Spec.CallbackURL)
+			return
+		}
+		if attempt == webhookAttempts {
+			q.appendLog(j.ID, "callback failed after %d attempts: %v", attempt, err)
+			return
+		}
+		q.appendLog(j.ID, "callback attempt %d failed: %v", attempt, err)
+
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-q.quit:
+			return
+		}
+	}
+}
+
+// callbackClient is the default webhook client. Callback URLs come from
+// whoever submits a job, so it only connects to public addresses, checked
+// after DNS resolution, and treats a redirect as the response rather than
+// following it somewhere else.
+func callbackClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if !publicAddr(ip) {
+				return fmt.Errorf("callback to %s refused: not a public address", ip)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicAddr reports whether ip is routable on the internet
+func publicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+func (q *Queue) post(id, url string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Watermark-Job", id)
+
+	resp, err := q.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s responded %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package RPC
+
+import (
+	pb "InvisibleWaterMarkingSystem/RPC/watermarkpb"
+	"bytes"
+	"context"
+	"io"
+
+	"google.golang.org/grpc"
+)
+
+// Client wraps the generated stub with helpers that split uploads into
+// chunks and reassemble the embedded file
+type Client struct {
+	pb.WatermarkServiceClient
+	ChunkSize int
+}
+
+// NewClient returns a client sending DefaultConfig().ChunkSize chunks
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{WatermarkServiceClient: pb.NewWatermarkServiceClient(cc), ChunkSize: DefaultConfig().ChunkSize}
+}
+
+// sendChunks streams data through send, one chunk per message
+func (c *Client) sendChunks(data []byte, send func(chunk []byte) error) error {
+	size := c.ChunkSize
+	if size <= 0 {
+		size = DefaultConfig().ChunkSize
+	}
+	for len(data) > 0 {
+		n := min(len(data), size)
+		if err := send(data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// EmbedFile uploads an encoded image and returns the watermarked file
+func (c *Client) EmbedFile(ctx context.Context, data []byte, header *pb.EmbedHeader) ([]byte, *pb.EmbedInfo, error) {
+	stream, err := c.Embed(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := stream.Send(&pb.EmbedRequest{Payload: &pb.EmbedRequest_Header{Header: header}}); err != nil {
+		return nil, nil, recvError(stream, err)
+	}
+	err = c.sendChunks(data, func(chunk []byte) error {
+		return stream.Send(&pb.EmbedRequest{Payload: &pb.EmbedRequest_Chunk{Chunk: chunk}})
+	})
+	if err != nil {
+		return nil, nil, recvError(stream, err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, nil, err
+	}
+
+	var info *pb.EmbedInfo
+	var out bytes.Buffer
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if i := resp.GetInfo(); i != nil {
+			info = i
+			out.Grow(int(i.Size))
+		}
+		out.Write(resp.GetChunk())
+	}
+	return out.Bytes(), info, nil
+}
+
+// ExtractFile uploads an encoded image and returns the extraction result
+func (c *Client) ExtractFile(ctx context.Context, data []byte, opts *pb.Options) (*pb.ExtractResponse, error) {
+	stream, err := c.Extract(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if opts != nil {
+		if err := stream.Send(&pb.ExtractRequest{Payload: &pb.ExtractRequest_Options{Options: opts}}); err != nil {
+			return stream.CloseAndRecv()
+		}
+	}
+	// Send fails once the server has ended the call, whose status
+	// CloseAndRecv then reports
+	_ = c.sendChunks(data, func(chunk []byte) error {
+		return stream.Send(&pb.ExtractRequest{Payload: &pb.ExtractRequest_Chunk{Chunk: chunk}})
+	})
+	return stream.CloseAndRecv()
+}
+
+// DetectFile uploads an encoded image and reports whether it is watermarked
+func (c *Client) DetectFile(ctx context.Context, data []byte, opts *pb.Options) (*pb.DetectResponse, error) {
+	stream, err := c.Detect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if opts != nil {
+		if err := stream.Send(&pb.DetectRequest{Payload: &pb.DetectRequest_Options{Options: opts}}); err != nil {
+			return stream.CloseAndRecv()
+		}
+	}
+	_ = c.sendChunks(data, func(chunk []byte) error {
+		return stream.Send(&pb.DetectRequest{Payload: &pb.DetectRequest_Chunk{Chunk: chunk}})
+	})
+	return stream.CloseAndRecv()
+}
+
+// recvError replaces the io.EOF a Send returns once the server has ended
+// the call with the status the server sent
+func recvError(stream grpc.BidiStreamingClient[pb.EmbedRequest, pb.EmbedResponse], err error) error {
+	if err != io.EOF {
+		return err
+	}
+	for {
+		if _, err := stream.Recv(); err != nil {
+			return err
+		}
+	}
+}
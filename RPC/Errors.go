@@ -0,0 +1,42 @@
+package RPC
+
+import (
+	"InvisibleWaterMarkingSystem/ImageIO"
+	"InvisibleWaterMarkingSystem/Watermark"
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// toStatus maps library errors onto gRPC status codes; errors that already
+// carry a status pass through unchanged
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+
+	code := codes.Internal
+	switch {
+	case errors.Is(err, Watermark.ErrNoWatermark):
+		code = codes.NotFound
+	case errors.Is(err, Watermark.ErrMessageTooLong),
+		errors.Is(err, Watermark.ErrInvalidOptions),
+		errors.Is(err, Watermark.ErrInvalidImage):
+		code = codes.InvalidArgument
+	case errors.Is(err, Watermark.ErrImageTooSmall):
+		code = codes.FailedPrecondition
+	case errors.Is(err, Watermark.ErrAuthFailed):
+		code = codes.PermissionDenied
+	case errors.Is(err, ImageIO.ErrTooLarge):
+		code = codes.ResourceExhausted
+	}
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,36 @@
+package RPC
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// StartInProcess runs the service on an in-memory listener and returns a
+// client connected to it, for integration tests that should not open a
+// port. stop closes the client and shuts the server down.
+func StartInProcess(cfg Config) (client *Client, stop func(), err error) {
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	Register(srv, cfg)
+	go srv.Serve(lis)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		srv.Stop()
+		return nil, nil, err
+	}
+	stop = func() {
+		conn.Close()
+		srv.Stop()
+	}
+	return NewClient(conn), stop, nil
+}
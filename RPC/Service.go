@@ -0,0 +1,314 @@
+// Package RPC exposes the watermarking library as the gRPC service defined in
+// watermarkpb/watermark.proto. Images are uploaded as a stream of chunks, so
+// files larger than the 4 MiB default message size can be sent; Embed streams
+// the marked file back the same way.
+package RPC
+
+import (
+	"InvisibleWaterMarkingSystem/ImageIO"
+	pb "InvisibleWaterMarkingSystem/RPC/watermarkpb"
+	"InvisibleWaterMarkingSystem/Watermark"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Config bounds what the service accepts
+type Config struct {
+	MaxImageBytes int64 // largest upload after reassembling its chunks
+	MaxPixels     int   // largest accepted image, by the width and height in its header
+	ChunkSize     int   // size of the chunks Embed streams back
+}
+
+// DefaultConfig returns the limits used for zero fields
+func DefaultConfig() Config {
+	return Config{
+		MaxImageBytes: 64 << 20,
+		MaxPixels:     ImageIO.MaxPixels,
+		ChunkSize:     64 << 10,
+	}
+}
+
+// Service implements pb.WatermarkServiceServer
+type Service struct {
+	pb.UnimplementedWatermarkServiceServer
+	cfg Config
+}
+
+// New builds a service; zero fields of cfg take their DefaultConfig values
+func New(cfg Config) *Service {
+	def := DefaultConfig()
+	if cfg.MaxImageBytes <= 0 {
+		cfg.MaxImageBytes = def.MaxImageBytes
+	}
+	if cfg.MaxPixels <= 0 {
+		cfg.MaxPixels = def.MaxPixels
+	}
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = def.ChunkSize
+	}
+	return &Service{cfg: cfg}
+}
+
+// Register adds a service built from cfg to a gRPC server
+func Register(s grpc.ServiceRegistrar, cfg Config) {
+	pb.RegisterWatermarkServiceServer(s, New(cfg))
+}
+
+// receive reads a client stream until EOF. split returns the header message
+// carried by a request, if any, and its image bytes; exactly one header must
+// arrive, before the first chunk. Images whose header claims more than
+// MaxPixels are refused before anything decodes them.
+func receive[Req any, H any](s *Service, recv func() (*Req, error), split func(*Req) (*H, []byte)) (*H, []byte, error) {
+	var header *H
+	var buf bytes.Buffer
+	for {
+		req, err := recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		h, chunk := split(req)
+		switch {
+		case h != nil && (header != nil || buf.Len() > 0):
+			return nil, nil, status.Error(codes.InvalidArgument, "the header must be the first and only header message")
+		case h != nil:
+			header = h
+		default:
+			if int64(buf.Len()+len(chunk)) > s.cfg.MaxImageBytes {
+				return nil, nil, status.Errorf(codes.ResourceExhausted, "image exceeds %d bytes", s.cfg.MaxImageBytes)
+			}
+			buf.Write(chunk)
+		}
+	}
+	if buf.Len() == 0 {
+		return nil, nil, status.Error(codes.InvalidArgument, "no image data received")
+	}
+	if err := ImageIO.CheckSize(buf.Bytes(), s.cfg.MaxPixels); errors.Is(err, ImageIO.ErrTooLarge) {
+		return nil, nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	return header, buf.Bytes(), nil
+}
+
+// options converts request options; a nil message means the defaults
+func options(o *pb.Options) (*Watermark.Options, bool, error) {
+	opts := Watermark.DefaultOptions()
+	if o == nil {
+		return opts, false, nil
+	}
+	opts.Key = o.Key
+	opts.PayloadKey = o.PayloadKey
+	if o.Strength < 0 || o.PaletteStrength < 0 || o.PalettePasses < 0 || o.CoefficientStep < 0 || o.SyncStrength < 0 {
+		return nil, false, status.Error(codes.InvalidArgument, "strengths, passes and step must not be negative")
+	}
+	opts.SyncStrength = o.SyncStrength
+	opts.Synchronize = o.Synchronize
+	opts.Align = o.Align
+	opts.EstimateGain = o.EstimateGain
+	opts.Perceptual = o.Perceptual
+	modulation, err := Watermark.ParseModulation(o.Modulation)
+	if err != nil {
+		return nil, false, status.Error(codes.InvalidArgument, err.Error())
+	}
+	opts.Modulation = modulation
+	if err := Watermark.CheckModulation(opts); err != nil {
+		return nil, false, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if o.FalsePositiveRate < 0 || o.FalsePositiveRate >= 1 {
+		return nil, false, status.Error(codes.InvalidArgument, "false_positive_rate must be below 1")
+	}
+	if o.FalsePositiveRate > 0 {
+		opts.FalsePositiveRate = o.FalsePositiveRate
+	}
+	if o.Strength > 0 {
+		opts.Strength = o.Strength
+	}
+	if o.PaletteStrength > 0 {
+		opts.PaletteStrength = o.PaletteStrength
+	}
+	if o.PalettePasses > 0 {
+		opts.PalettePasses = int(o.PalettePasses)
+	}
+	if o.CoefficientStep > 0 {
+		opts.CoefficientStep = int(o.CoefficientStep)
+	}
+	switch o.Domain {
+	case pb.Domain_DOMAIN_PIXEL:
+		return opts, false, nil
+	case pb.Domain_DOMAIN_COEFFICIENT:
+		return opts, true, nil
+	}
+	return nil, false, status.Errorf(codes.InvalidArgument, "unknown domain %v", o.Domain)
+}
+
+// validUTF8 replaces invalid UTF-8 in an extracted message, which proto3
+// strings cannot carry: a tile read back with bit errors can decode to any
+// bytes, and one such tile would otherwise fail the whole response
+func validUTF8(s string) string {
+	return strings.ToValidUTF8(s, "\uFFFD")
+}
+
+// Embed receives a header and the image chunks, then streams back an
+// EmbedInfo followed by the marked file in chunks
+func (s *Service) Embed(stream grpc.BidiStreamingServer[pb.EmbedRequest, pb.EmbedResponse]) error {
+	header, data, err := receive(s, stream.Recv, func(r *pb.EmbedRequest) (*pb.EmbedHeader, []byte) {
+		return r.GetHeader(), r.GetChunk()
+	})
+	if err != nil {
+		return err
+	}
+	if header == nil || header.Message == "" {
+		return status.Error(codes.InvalidArgument, "missing header with a message")
+	}
+	opts, coefficient, err := options(header.Options)
+	if err != nil {
+		return err
+	}
+
+	fopts := &Watermark.FileOptions{
+		JPEGQuality: int(header.JpegQuality),
+		XMPNote:     "Invisible watermark embedded",
+		Coefficient: coefficient,
+	}
+	if fopts.JPEGQuality < 0 || fopts.JPEGQuality > 100 {
+		return status.Error(codes.InvalidArgument, "jpeg_quality must be between 1 and 100")
+	}
+	if header.OutputFormat != "" {
+		if fopts.Format = ImageIO.ParseFormat(header.OutputFormat); fopts.Format == ImageIO.FormatUnknown {
+			return status.Errorf(codes.InvalidArgument, "unknown output format %q", header.OutputFormat)
+		}
+	}
+
+	result, err := Watermark.EmbedBytes(data, header.Message, opts, fopts)
+	if err != nil {
+		return toStatus(err)
+	}
+	if err := stream.Context().Err(); err != nil {
+		return toStatus(err)
+	}
+
+	info := &pb.EmbedInfo{
+		Format:      result.Format.String(),
+		ContentType: result.Format.MIMEType(),
+		Tiles:       int32(result.Tiles),
+		Frames:      int32(result.Frames),
+		Size:        int64(len(result.Data)),
+	}
+	if err := stream.Send(&pb.EmbedResponse{Payload: &pb.EmbedResponse_Info{Info: info}}); err != nil {
+		return err
+	}
+	for rest := result.Data; len(rest) > 0; {
+		n := min(len(rest), s.cfg.ChunkSize)
+		if err := stream.Send(&pb.EmbedResponse{Payload: &pb.EmbedResponse_Chunk{Chunk: rest[:n]}}); err != nil {
+			return err
+		}
+		rest = rest[n:]
+	}
+	return nil
+}
+
+// Extract reads the watermark from the uploaded image. An image without one
+// yields found=false rather than an error.
+func (s *Service) Extract(stream grpc.ClientStreamingServer[pb.ExtractRequest, pb.ExtractResponse]) error {
+	o, data, err := receive(s, stream.Recv, func(r *pb.ExtractRequest) (*pb.Options, []byte) {
+		return r.GetOptions(), r.GetChunk()
+	})
+	if err != nil {
+		return err
+	}
+	opts, coefficient, err := options(o)
+	if err != nil {
+		return err
+	}
+
+	report, err := Watermark.ExtractBytes(data, opts, coefficient)
+	if err != nil {
+		return toStatus(err)
+	}
+
+	resp := &pb.ExtractResponse{
+		Found:         report.Found,
+		Message:       validUTF8(report.Message),
+		Confidence:    report.Confidence,
+		TileCount:     int32(report.TileCount),
+		AgreeingTiles: int32(report.Agreeing),
+		Frames:        int32(report.Frames),
+		AuthFailed:    report.AuthFailed,
+	}
+	for _, t := range report.Tiles {
+		resp.Tiles = append(resp.Tiles, &pb.Tile{
+			Row:        int32(t.Row),
+			Col:        int32(t.Col),
+			Found:      t.Found,
+			Message:    validUTF8(t.Message),
+			FlagErrors: int32(t.FlagErrors),
+			AuthFailed: t.AuthFailed,
+		})
+	}
+	return stream.SendAndClose(resp)
+}
+
+// Detect reports whether the uploaded image carries a watermark
+func (s *Service) Detect(stream grpc.ClientStreamingServer[pb.DetectRequest, pb.DetectResponse]) error {
+	o, data, err := receive(s, stream.Recv, func(r *pb.DetectRequest) (*pb.Options, []byte) {
+		return r.GetOptions(), r.GetChunk()
+	})
+	if err != nil {
+		return err
+	}
+	opts, coefficient, err := options(o)
+	if err != nil {
+		return err
+	}
+
+	d, err := Watermark.DetectBytes(data, opts, coefficient)
+	if err != nil {
+		return toStatus(err)
+	}
+	return stream.SendAndClose(&pb.DetectResponse{
+		Present:     d.Present,
+		TileCount:   int32(d.TileCount),
+		FlagTiles:   int32(d.FlagTiles),
+		Message:     validUTF8(d.Message),
+		AuthFailed:  d.AuthFailed,
+		PValue:      d.PValue,
+		FlagBits:    int32(d.FlagBits),
+		FlagMatches: int32(d.FlagMatches),
+	})
+}
+
+// Capacity reports what an image of the given size holds. Instead of a size
+// the request may carry the first bytes of the file, enough for its header.
+func (s *Service) Capacity(ctx context.Context, req *pb.CapacityRequest) (*pb.CapacityResponse, error) {
+	w, h := int(req.Width), int(req.Height)
+	if len(req.ImageHeader) > 0 {
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(req.ImageHeader))
+		if err != nil {
+			return nil, toStatus(fmt.Errorf("%w: %v", Watermark.ErrInvalidImage, err))
+		}
+		w, h = cfg.Width, cfg.Height
+	}
+	if w <= 0 || h <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "width and height, or an image header, are required")
+	}
+
+	c := Watermark.Capacity(w, h)
+	return &pb.CapacityResponse{
+		Width:           int32(c.Width),
+		Height:          int32(c.Height),
+		TilesX:          int32(c.TilesX),
+		TilesY:          int32(c.TilesY),
+		BitsPerTile:     int32(c.BitsPerTile),
+		MaxMessageBytes: int32(c.MaxMessageBytes),
+	}, nil
+}
@@ -0,0 +1,213 @@
+package RPC
+
+import (
+	pb "InvisibleWaterMarkingSystem/RPC/watermarkpb"
+	"InvisibleWaterMarkingSystem/Watermark"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMain(m *testing.M) {
+	Watermark.Output = io.Discard
+	os.Exit(m.Run())
+}
+
+// texturedImage is a deterministic noisy image large enough to hold a
+// message; its top half is smooth, like the sky of a photo
+func texturedImage(width, height int) *image.RGBA {
+	rng := rand.New(rand.NewPCG(1, 2))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if y < height/2 {
+				v := uint8(150 + 60*y/height)
+				img.SetRGBA(x, y, color.RGBA{R: v - 40, G: v - 10, B: v + 30, A: 0xFF})
+				continue
+			}
+			v := 128 + 40*math.Sin(float64(x)/23) + 30*math.Cos(float64(y)/17) + 12*rng.NormFloat64()
+			v = math.Max(30, math.Min(225, v))
+			img.SetRGBA(x, y, color.RGBA{R: uint8(v), G: uint8(v * 0.9), B: uint8(255 - v), A: 0xFF})
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// hugePNG is a valid 1x1 PNG whose header claims width x height pixels
+func hugePNG(t *testing.T, width, height uint32) []byte {
+	t.Helper()
+	data := encodePNG(t, image.NewGray(image.Rect(0, 0, 1, 1)))
+	// Signature (8), IHDR length (4) and type (4), then width and height
+	binary.BigEndian.PutUint32(data[16:], width)
+	binary.BigEndian.PutUint32(data[20:], height)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+// hugeBMP is a 54-byte 24-bit BMP header claiming width x height pixels
+func hugeBMP(width, height int32) []byte {
+	b := make([]byte, 54)
+	copy(b, "BM")
+	binary.LittleEndian.PutUint32(b[2:], 54)
+	binary.LittleEndian.PutUint32(b[10:], 54)
+	binary.LittleEndian.PutUint32(b[14:], 40)
+	binary.LittleEndian.PutUint32(b[18:], uint32(width))
+	binary.LittleEndian.PutUint32(b[22:], uint32(height))
+	binary.LittleEndian.PutUint16(b[26:], 1)
+	binary.LittleEndian.PutUint16(b[28:], 24)
+	return b
+}
+
+func startClient(t *testing.T, cfg Config) *Client {
+	t.Helper()
+	client, stop, err := StartInProcess(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(stop)
+	return client
+}
+
+// embed marks img over RPC and returns the decoded result
+func embed(t *testing.T, client *Client, img image.Image, message string, opts *pb.Options) image.Image {
+	t.Helper()
+	data, info, err := client.EmbedFile(context.Background(), encodePNG(t, img), &pb.EmbedHeader{Message: message, Options: opts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Format != "png" || info.Size != int64(len(data)) {
+		t.Fatalf("embed info %v for %d bytes", info, len(data))
+	}
+	marked, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return marked
+}
+
+func TestRoundTrip(t *testing.T) {
+	const message = "Hello World"
+	// Small chunks so that the marked file comes back in several messages
+	client := startClient(t, Config{ChunkSize: 4 << 10})
+	opts := &pb.Options{Key: "k", PayloadKey: "pk", Modulation: "dithered"}
+	marked := encodePNG(t, embed(t, client, texturedImage(512, 512), message, opts))
+
+	r, err := client.ExtractFile(context.Background(), marked, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Found || r.Message != message || r.AuthFailed {
+		t.Errorf("extract with the embed options: found=%v message=%q auth_failed=%v", r.Found, r.Message, r.AuthFailed)
+	}
+
+	d, err := client.DetectFile(context.Background(), marked, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Present {
+		t.Errorf("detect with the embed options: p-value %g", d.PValue)
+	}
+
+	wrong := &pb.Options{Key: "k", PayloadKey: "not pk", Modulation: "dithered"}
+	r, err = client.ExtractFile(context.Background(), marked, wrong)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Found || !r.AuthFailed {
+		t.Errorf("extract with the wrong payload key: %v", r)
+	}
+}
+
+func TestInvalidUTF8Message(t *testing.T) {
+	// Messages are bytes; one that is not UTF-8 must still come back
+	client := startClient(t, Config{})
+	marked := encodePNG(t, Watermark.EmbedWithOptions(texturedImage(512, 512), "Hello\xffWorld", Watermark.DefaultOptions()))
+	r, err := client.ExtractFile(context.Background(), marked, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Found || r.Message != "Hello\uFFFDWorld" {
+		t.Errorf("extract: found=%v message=%q", r.Found, r.Message)
+	}
+}
+
+func TestAlignedExtraction(t *testing.T) {
+	const message = "Hello World"
+	client := startClient(t, Config{})
+	marked := embed(t, client, texturedImage(1024, 768), message, nil)
+
+	// Drop 100 columns and 5 rows, off the tile grid
+	b := marked.Bounds()
+	crop := image.NewRGBA(image.Rect(0, 0, b.Dx()-100, b.Dy()-5))
+	draw.Draw(crop, crop.Bounds(), marked, image.Pt(100, 5), draw.Src)
+	data := encodePNG(t, crop)
+
+	r, err := client.ExtractFile(context.Background(), data, &pb.Options{Align: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Found || r.Message != message {
+		t.Errorf("extract with align: found=%v message=%q", r.Found, r.Message)
+	}
+}
+
+func TestKeyedModulationNeedsAKey(t *testing.T) {
+	client := startClient(t, Config{})
+	data := encodePNG(t, texturedImage(256, 256))
+	for _, opts := range []*pb.Options{{Modulation: "dithered"}, {Modulation: "fm", Key: "k"}} {
+		_, err := client.ExtractFile(context.Background(), data, opts)
+		if got := status.Code(err); got != codes.InvalidArgument {
+			t.Errorf("%v: %v, want %v", opts, err, codes.InvalidArgument)
+		}
+	}
+}
+
+func TestOversizedImagesAreRejected(t *testing.T) {
+	client := startClient(t, Config{})
+	for name, data := range map[string][]byte{
+		"png": hugePNG(t, 50000, 50000),
+		"bmp": hugeBMP(50000, 50000),
+	} {
+		_, err := client.ExtractFile(context.Background(), data, nil)
+		if got := status.Code(err); got != codes.ResourceExhausted {
+			t.Errorf("%s bomb: %v, want %v", name, err, codes.ResourceExhausted)
+		}
+	}
+}
+
+func TestToStatus(t *testing.T) {
+	for err, want := range map[error]codes.Code{
+		fmt.Errorf("%w in 3 tiles", Watermark.ErrAuthFailed):   codes.PermissionDenied,
+		fmt.Errorf("%w in any tile", Watermark.ErrNoWatermark): codes.NotFound,
+		Watermark.ErrInvalidOptions:                            codes.InvalidArgument,
+		context.DeadlineExceeded:                               codes.DeadlineExceeded,
+		status.Error(codes.Aborted, "as is"):                   codes.Aborted,
+	} {
+		if got := status.Code(toStatus(err)); got != want {
+			t.Errorf("%v: %v, want %v", err, got, want)
+		}
+	}
+}
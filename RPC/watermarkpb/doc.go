@@ -0,0 +1,5 @@
+// Package watermarkpb holds the protobuf messages and gRPC stubs generated
+// from watermark.proto.
+package watermarkpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative watermark.proto
@@ -0,0 +1,1324 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: watermark.proto
+
+package watermarkpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Domain int32
+
+const (
+	Domain_DOMAIN_PIXEL       Domain = 0 // DWT-DCT embedding on decoded pixels
+	Domain_DOMAIN_COEFFICIENT Domain = 1 // QIM on quantized JPEG coefficients, JPEG only
+)
+
+// Enum value maps for Domain.
+var (
+	Domain_name = map[int32]string{
+		0: "DOMAIN_PIXEL",
+		1: "DOMAIN_COEFFICIENT",
+	}
+	Domain_value = map[string]int32{
+		"DOMAIN_PIXEL":       0,
+		"DOMAIN_COEFFICIENT": 1,
+	}
+)
+
+func (x Domain) Enum() *Domain {
+	p := new(Domain)
+	*p = x
+	return p
+}
+
+func (x Domain) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Domain) Descriptor() protoreflect.EnumDescriptor {
+	return file_watermark_proto_enumTypes[0].Descriptor()
+}
+
+func (Domain) Type() protoreflect.EnumType {
+	return &file_watermark_proto_enumTypes[0]
+}
+
+func (x Domain) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Domain.Descriptor instead.
+func (Domain) EnumDescriptor() ([]byte, []int) {
+	return file_watermark_proto_rawDescGZIP(), []int{0}
+}
+
+// Options mirrors Watermark.Options; zero values take the library defaults
+type Options struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Key               string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Strength          float64                `protobuf:"fixed64,2,opt,name=strength,proto3" json:"strength,omitempty"`
+	PaletteStrength   float64                `protobuf:"fixed64,3,opt,name=palette_strength,json=paletteStrength,proto3" json:"palette_strength,omitempty"`
+	PalettePasses     int32                  `protobuf:"varint,4,opt,name=palette_passes,json=palettePasses,proto3" json:"palette_passes,omitempty"`
+	CoefficientStep   int32                  `protobuf:"varint,5,opt,name=coefficient_step,json=coefficientStep,proto3" json:"coefficient_step,omitempty"`
+	Domain            Domain                 `protobuf:"varint,6,opt,name=domain,proto3,enum=watermark.v1.Domain" json:"domain,omitempty"`
+	PayloadKey        string                 `protobuf:"bytes,7,opt,name=payload_key,json=payloadKey,proto3" json:"payload_key,omitempty"`                          // encrypts and authenticates the message; extraction needs the same key
+	FalsePositiveRate float64                `protobuf:"fixed64,8,opt,name=false_positive_rate,json=falsePositiveRate,proto3" json:"false_positive_rate,omitempty"` // p-value threshold of Detect; 0 means the default
+	SyncStrength      float64                `protobuf:"fixed64,9,opt,name=sync_strength,json=syncStrength,proto3" json:"sync_strength,omitempty"`                  // amplitude of the synchronization template added on embed; 0 adds none
+	Synchronize       bool                   `protobuf:"varint,10,opt,name=synchronize,proto3" json:"synchronize,omitempty"`                                        // undo rotation and scaling using the template before extracting
+	Align             bool                   `protobuf:"varint,11,opt,name=align,proto3" json:"align,omitempty"`                                                    // search for the tile grid of a cropped copy before extracting
+	Perceptual        bool                   `protobuf:"varint,12,opt,name=perceptual,proto3" json:"perceptual,omitempty"`                                          // scale the QIM step per block by perceptual masking; extraction needs it too
+	Modulation        string                 `protobuf:"bytes,13,opt,name=modulation,proto3" json:"modulation,omitempty"`                                           // "qim" (default), "dithered", "stdm" or "spread", which need key; extraction needs the same
+	EstimateGain      bool                   `protobuf:"varint,14,opt,name=estimate_gain,json=estimateGain,proto3" json:"estimate_gain,omitempty"`                  // estimate a change of contrast and scale the QIM step to match before extracting
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *Options) Reset() {
+	*x = Options{}
+	mi := &file_watermark_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Options) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Options) ProtoMessage() {}
+
+func (x *Options) ProtoReflect() protoreflect.Message {
+	mi := &file_watermark_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Options.ProtoReflect.Descriptor instead.
+func (*Options) Descriptor() ([]byte, []int) {
+	return file_watermark_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Options) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *Options) GetStrength() float64 {
+	if x != nil {
+		return x.Strength
+	}
+	return 0
+}
+
+func (x *Options) GetPaletteStrength() float64 {
+	if x != nil {
+		return x.PaletteStrength
+	}
+	return 0
+}
+
+func (x *Options) GetPalettePasses() int32 {
+	if x != nil {
+		return x.PalettePasses
+	}
+	return 0
+}
+
+func (x *Options) GetCoefficientStep() int32 {
+	if x != nil {
+		return x.CoefficientStep
+	}
+	return 0
+}
+
+func (x *Options) GetDomain() Domain {
+	if x != nil {
+		return x.Domain
+	}
+	return Domain_DOMAIN_PIXEL
+}
+
+func (x *Options) GetPayloadKey() string {
+	if x != nil {
+		return x.PayloadKey
+	}
+	return ""
+}
+
+func (x *Options) GetFalsePositiveRate() float64 {
+	if x != nil {
+		return x.FalsePositiveRate
+	}
+	return 0
+}
+
+func (x *Options) GetSyncStrength() float64 {
+	if x != nil {
+		return x.SyncStrength
+	}
+	return 0
+}
+
+func (x *Options) GetSynchronize() bool {
+	if x != nil {
+		return x.Synchronize
+	}
+	return false
+}
+
+func (x *Options) GetAlign() bool {
+	if x != nil {
+		return x.Align
+	}
+	return false
+}
+
+func (x *Options) GetPerceptual() bool {
+	if x != nil {
+		return x.Perceptual
+	}
+	return false
+}
+
+func (x *Options) GetModulation() string {
+	if x != nil {
+		return x.Modulation
+	}
+	return ""
+}
+
+func (x *Options) GetEstimateGain() bool {
+	if x != nil {
+		return x.EstimateGain
+	}
+	return false
+}
+
+type EmbedHeader struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Message       string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	Options       *Options               `protobuf:"bytes,2,opt,name=options,proto3" json:"options,omitempty"`
+	OutputFormat  string                 `protobuf:"bytes,3,opt,name=output_format,json=outputFormat,proto3" json:"output_format,omitempty"` // "jpeg", "png", "gif", "bmp", "tiff"; empty keeps the input format
+	JpegQuality   int32                  `protobuf:"varint,4,opt,name=jpeg_quality,json=jpegQuality,proto3" json:"jpeg_quality,omitempty"`   // 1-100, 0 means 100
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EmbedHeader) Reset() {
+	*x = EmbedHeader{}
+	mi := &file_watermark_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EmbedHeader) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EmbedHeader) ProtoMessage() {}
+
+func (x *EmbedHeader) ProtoReflect() protoreflect.Message {
+	mi := &file_watermark_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EmbedHeader.ProtoReflect.Descriptor instead.
+func (*EmbedHeader) Descriptor() ([]byte, []int) {
+	return file_watermark_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *EmbedHeader) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *EmbedHeader) GetOptions() *Options {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+func (x *EmbedHeader) GetOutputFormat() string {
+	if x != nil {
+		return x.OutputFormat
+	}
+	return ""
+}
+
+func (x *EmbedHeader) GetJpegQuality() int32 {
+	if x != nil {
+		return x.JpegQuality
+	}
+	return 0
+}
+
+type EmbedRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*EmbedRequest_Header
+	//	*EmbedRequest_Chunk
+	Payload       isEmbedRequest_Payload `protobuf_oneof:"payload"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EmbedRequest) Reset() {
+	*x = EmbedRequest{}
+	mi := &file_watermark_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EmbedRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EmbedRequest) ProtoMessage() {}
+
+func (x *EmbedRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_watermark_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EmbedRequest.ProtoReflect.Descriptor instead.
+func (*EmbedRequest) Descriptor() ([]byte, []int) {
+	return file_watermark_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *EmbedRequest) GetPayload() isEmbedRequest_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *EmbedRequest) GetHeader() *EmbedHeader {
+	if x != nil {
+		if x, ok := x.Payload.(*EmbedRequest_Header); ok {
+			return x.Header
+		}
+	}
+	return nil
+}
+
+func (x *EmbedRequest) GetChunk() []byte {
+	if x != nil {
+		if x, ok := x.Payload.(*EmbedRequest_Chunk); ok {
+			return x.Chunk
+		}
+	}
+	return nil
+}
+
+type isEmbedRequest_Payload interface {
+	isEmbedRequest_Payload()
+}
+
+type EmbedRequest_Header struct {
+	Header *EmbedHeader `protobuf:"bytes,1,opt,name=header,proto3,oneof"`
+}
+
+type EmbedRequest_Chunk struct {
+	Chunk []byte `protobuf:"bytes,2,opt,name=chunk,proto3,oneof"`
+}
+
+func (*EmbedRequest_Header) isEmbedRequest_Payload() {}
+
+func (*EmbedRequest_Chunk) isEmbedRequest_Payload() {}
+
+type EmbedInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Format        string                 `protobuf:"bytes,1,opt,name=format,proto3" json:"format,omitempty"`
+	ContentType   string                 `protobuf:"bytes,2,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	Tiles         int32                  `protobuf:"varint,3,opt,name=tiles,proto3" json:"tiles,omitempty"`
+	Frames        int32                  `protobuf:"varint,4,opt,name=frames,proto3" json:"frames,omitempty"`
+	Size          int64                  `protobuf:"varint,5,opt,name=size,proto3" json:"size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EmbedInfo) Reset() {
+	*x = EmbedInfo{}
+	mi := &file_watermark_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EmbedInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EmbedInfo) ProtoMessage() {}
+
+func (x *EmbedInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_watermark_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EmbedInfo.ProtoReflect.Descriptor instead.
+func (*EmbedInfo) Descriptor() ([]byte, []int) {
+	return file_watermark_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *EmbedInfo) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+func (x *EmbedInfo) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *EmbedInfo) GetTiles() int32 {
+	if x != nil {
+		return x.Tiles
+	}
+	return 0
+}
+
+func (x *EmbedInfo) GetFrames() int32 {
+	if x != nil {
+		return x.Frames
+	}
+	return 0
+}
+
+func (x *EmbedInfo) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+type EmbedResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*EmbedResponse_Info
+	//	*EmbedResponse_Chunk
+	Payload       isEmbedResponse_Payload `protobuf_oneof:"payload"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EmbedResponse) Reset() {
+	*x = EmbedResponse{}
+	mi := &file_watermark_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EmbedResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EmbedResponse) ProtoMessage() {}
+
+func (x *EmbedResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_watermark_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EmbedResponse.ProtoReflect.Descriptor instead.
+func (*EmbedResponse) Descriptor() ([]byte, []int) {
+	return file_watermark_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *EmbedResponse) GetPayload() isEmbedResponse_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *EmbedResponse) GetInfo() *EmbedInfo {
+	if x != nil {
+		if x, ok := x.Payload.(*EmbedResponse_Info); ok {
+			return x.Info
+		}
+	}
+	return nil
+}
+
+func (x *EmbedResponse) GetChunk() []byte {
+	if x != nil {
+		if x, ok := x.Payload.(*EmbedResponse_Chunk); ok {
+			return x.Chunk
+		}
+	}
+	return nil
+}
+
+type isEmbedResponse_Payload interface {
+	isEmbedResponse_Payload()
+}
+
+type EmbedResponse_Info struct {
+	Info *EmbedInfo `protobuf:"bytes,1,opt,name=info,proto3,oneof"`
+}
+
+type EmbedResponse_Chunk struct {
+	Chunk []byte `protobuf:"bytes,2,opt,name=chunk,proto3,oneof"`
+}
+
+func (*EmbedResponse_Info) isEmbedResponse_Payload() {}
+
+func (*EmbedResponse_Chunk) isEmbedResponse_Payload() {}
+
+type ExtractRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*ExtractRequest_Options
+	//	*ExtractRequest_Chunk
+	Payload       isExtractRequest_Payload `protobuf_oneof:"payload"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExtractRequest) Reset() {
+	*x = ExtractRequest{}
+	mi := &file_watermark_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExtractRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExtractRequest) ProtoMessage() {}
+
+func (x *ExtractRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_watermark_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExtractRequest.ProtoReflect.Descriptor instead.
+func (*ExtractRequest) Descriptor() ([]byte, []int) {
+	return file_watermark_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ExtractRequest) GetPayload() isExtractRequest_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *ExtractRequest) GetOptions() *Options {
+	if x != nil {
+		if x, ok := x.Payload.(*ExtractRequest_Options); ok {
+			return x.Options
+		}
+	}
+	return nil
+}
+
+func (x *ExtractRequest) GetChunk() []byte {
+	if x != nil {
+		if x, ok := x.Payload.(*ExtractRequest_Chunk); ok {
+			return x.Chunk
+		}
+	}
+	return nil
+}
+
+type isExtractRequest_Payload interface {
+	isExtractRequest_Payload()
+}
+
+type ExtractRequest_Options struct {
+	Options *Options `protobuf:"bytes,1,opt,name=options,proto3,oneof"`
+}
+
+type ExtractRequest_Chunk struct {
+	Chunk []byte `protobuf:"bytes,2,opt,name=chunk,proto3,oneof"`
+}
+
+func (*ExtractRequest_Options) isExtractRequest_Payload() {}
+
+func (*ExtractRequest_Chunk) isExtractRequest_Payload() {}
+
+type Tile struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Row           int32                  `protobuf:"varint,1,opt,name=row,proto3" json:"row,omitempty"`
+	Col           int32                  `protobuf:"varint,2,opt,name=col,proto3" json:"col,omitempty"`
+	Found         bool                   `protobuf:"varint,3,opt,name=found,proto3" json:"found,omitempty"`
+	Message       string                 `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`
+	FlagErrors    int32                  `protobuf:"varint,5,opt,name=flag_errors,json=flagErrors,proto3" json:"flag_errors,omitempty"`
+	AuthFailed    bool                   `protobuf:"varint,6,opt,name=auth_failed,json=authFailed,proto3" json:"auth_failed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Tile) Reset() {
+	*x = Tile{}
+	mi := &file_watermark_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Tile) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Tile) ProtoMessage() {}
+
+func (x *Tile) ProtoReflect() protoreflect.Message {
+	mi := &file_watermark_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Tile.ProtoReflect.Descriptor instead.
+func (*Tile) Descriptor() ([]byte, []int) {
+	return file_watermark_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Tile) GetRow() int32 {
+	if x != nil {
+		return x.Row
+	}
+	return 0
+}
+
+func (x *Tile) GetCol() int32 {
+	if x != nil {
+		return x.Col
+	}
+	return 0
+}
+
+func (x *Tile) GetFound() bool {
+	if x != nil {
+		return x.Found
+	}
+	return false
+}
+
+func (x *Tile) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Tile) GetFlagErrors() int32 {
+	if x != nil {
+		return x.FlagErrors
+	}
+	return 0
+}
+
+func (x *Tile) GetAuthFailed() bool {
+	if x != nil {
+		return x.AuthFailed
+	}
+	return false
+}
+
+type ExtractResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Found         bool                   `protobuf:"varint,1,opt,name=found,proto3" json:"found,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	Confidence    float64                `protobuf:"fixed64,3,opt,name=confidence,proto3" json:"confidence,omitempty"`
+	TileCount     int32                  `protobuf:"varint,4,opt,name=tile_count,json=tileCount,proto3" json:"tile_count,omitempty"`
+	AgreeingTiles int32                  `protobuf:"varint,5,opt,name=agreeing_tiles,json=agreeingTiles,proto3" json:"agreeing_tiles,omitempty"`
+	Frames        int32                  `protobuf:"varint,6,opt,name=frames,proto3" json:"frames,omitempty"`
+	Tiles         []*Tile                `protobuf:"bytes,7,rep,name=tiles,proto3" json:"tiles,omitempty"`
+	AuthFailed    bool                   `protobuf:"varint,8,opt,name=auth_failed,json=authFailed,proto3" json:"auth_failed,omitempty"` // a payload was found but did not open with the payload key
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExtractResponse) Reset() {
+	*x = ExtractResponse{}
+	mi := &file_watermark_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExtractResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExtractResponse) ProtoMessage() {}
+
+func (x *ExtractResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_watermark_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExtractResponse.ProtoReflect.Descriptor instead.
+func (*ExtractResponse) Descriptor() ([]byte, []int) {
+	return file_watermark_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ExtractResponse) GetFound() bool {
+	if x != nil {
+		return x.Found
+	}
+	return false
+}
+
+func (x *ExtractResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *ExtractResponse) GetConfidence() float64 {
+	if x != nil {
+		return x.Confidence
+	}
+	return 0
+}
+
+func (x *ExtractResponse) GetTileCount() int32 {
+	if x != nil {
+		return x.TileCount
+	}
+	return 0
+}
+
+func (x *ExtractResponse) GetAgreeingTiles() int32 {
+	if x != nil {
+		return x.AgreeingTiles
+	}
+	return 0
+}
+
+func (x *ExtractResponse) GetFrames() int32 {
+	if x != nil {
+		return x.Frames
+	}
+	return 0
+}
+
+func (x *ExtractResponse) GetTiles() []*Tile {
+	if x != nil {
+		return x.Tiles
+	}
+	return nil
+}
+
+func (x *ExtractResponse) GetAuthFailed() bool {
+	if x != nil {
+		return x.AuthFailed
+	}
+	return false
+}
+
+type DetectRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*DetectRequest_Options
+	//	*DetectRequest_Chunk
+	Payload       isDetectRequest_Payload `protobuf_oneof:"payload"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DetectRequest) Reset() {
+	*x = DetectRequest{}
+	mi := &file_watermark_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DetectRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DetectRequest) ProtoMessage() {}
+
+func (x *DetectRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_watermark_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DetectRequest.ProtoReflect.Descriptor instead.
+func (*DetectRequest) Descriptor() ([]byte, []int) {
+	return file_watermark_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *DetectRequest) GetPayload() isDetectRequest_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *DetectRequest) GetOptions() *Options {
+	if x != nil {
+		if x, ok := x.Payload.(*DetectRequest_Options); ok {
+			return x.Options
+		}
+	}
+	return nil
+}
+
+func (x *DetectRequest) GetChunk() []byte {
+	if x != nil {
+		if x, ok := x.Payload.(*DetectRequest_Chunk); ok {
+			return x.Chunk
+		}
+	}
+	return nil
+}
+
+type isDetectRequest_Payload interface {
+	isDetectRequest_Payload()
+}
+
+type DetectRequest_Options struct {
+	Options *Options `protobuf:"bytes,1,opt,name=options,proto3,oneof"`
+}
+
+type DetectRequest_Chunk struct {
+	Chunk []byte `protobuf:"bytes,2,opt,name=chunk,proto3,oneof"`
+}
+
+func (*DetectRequest_Options) isDetectRequest_Payload() {}
+
+func (*DetectRequest_Chunk) isDetectRequest_Payload() {}
+
+type DetectResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// present is p_value <= false_positive_rate for still images; a decoded
+	// message alone does not count. Animations and coefficient marks have no
+	// p-value and are present when a message decodes.
+	Present    bool   `protobuf:"varint,1,opt,name=present,proto3" json:"present,omitempty"`
+	TileCount  int32  `protobuf:"varint,2,opt,name=tile_count,json=tileCount,proto3" json:"tile_count,omitempty"`
+	FlagTiles  int32  `protobuf:"varint,3,opt,name=flag_tiles,json=flagTiles,proto3" json:"flag_tiles,omitempty"`
+	Message    string `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`
+	AuthFailed bool   `protobuf:"varint,5,opt,name=auth_failed,json=authFailed,proto3" json:"auth_failed,omitempty"`
+	// p_value is the chance of flag_matches or more of flag_bits start-flag
+	// bits matching in an unmarked image
+	PValue        float64 `protobuf:"fixed64,6,opt,name=p_value,json=pValue,proto3" json:"p_value,omitempty"`
+	FlagBits      int32   `protobuf:"varint,7,opt,name=flag_bits,json=flagBits,proto3" json:"flag_bits,omitempty"`
+	FlagMatches   int32   `protobuf:"varint,8,opt,name=flag_matches,json=flagMatches,proto3" json:"flag_matches,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DetectResponse) Reset() {
+	*x = DetectResponse{}
+	mi := &file_watermark_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DetectResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DetectResponse) ProtoMessage() {}
+
+func (x *DetectResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_watermark_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DetectResponse.ProtoReflect.Descriptor instead.
+func (*DetectResponse) Descriptor() ([]byte, []int) {
+	return file_watermark_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *DetectResponse) GetPresent() bool {
+	if x != nil {
+		return x.Present
+	}
+	return false
+}
+
+func (x *DetectResponse) GetTileCount() int32 {
+	if x != nil {
+		return x.TileCount
+	}
+	return 0
+}
+
+func (x *DetectResponse) GetFlagTiles() int32 {
+	if x != nil {
+		return x.FlagTiles
+	}
+	return 0
+}
+
+func (x *DetectResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *DetectResponse) GetAuthFailed() bool {
+	if x != nil {
+		return x.AuthFailed
+	}
+	return false
+}
+
+func (x *DetectResponse) GetPValue() float64 {
+	if x != nil {
+		return x.PValue
+	}
+	return 0
+}
+
+func (x *DetectResponse) GetFlagBits() int32 {
+	if x != nil {
+		return x.FlagBits
+	}
+	return 0
+}
+
+func (x *DetectResponse) GetFlagMatches() int32 {
+	if x != nil {
+		return x.FlagMatches
+	}
+	return 0
+}
+
+// CapacityRequest gives either the dimensions or the leading bytes of an
+// image file (enough to contain its header)
+type CapacityRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Width         int32                  `protobuf:"varint,1,opt,name=width,proto3" json:"width,omitempty"`
+	Height        int32                  `protobuf:"varint,2,opt,name=height,proto3" json:"height,omitempty"`
+	ImageHeader   []byte                 `protobuf:"bytes,3,opt,name=image_header,json=imageHeader,proto3" json:"image_header,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CapacityRequest) Reset() {
+	*x = CapacityRequest{}
+	mi := &file_watermark_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CapacityRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CapacityRequest) ProtoMessage() {}
+
+func (x *CapacityRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_watermark_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CapacityRequest.ProtoReflect.Descriptor instead.
+func (*CapacityRequest) Descriptor() ([]byte, []int) {
+	return file_watermark_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *CapacityRequest) GetWidth() int32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *CapacityRequest) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *CapacityRequest) GetImageHeader() []byte {
+	if x != nil {
+		return x.ImageHeader
+	}
+	return nil
+}
+
+type CapacityResponse struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Width           int32                  `protobuf:"varint,1,opt,name=width,proto3" json:"width,omitempty"`
+	Height          int32                  `protobuf:"varint,2,opt,name=height,proto3" json:"height,omitempty"`
+	TilesX          int32                  `protobuf:"varint,3,opt,name=tiles_x,json=tilesX,proto3" json:"tiles_x,omitempty"`
+	TilesY          int32                  `protobuf:"varint,4,opt,name=tiles_y,json=tilesY,proto3" json:"tiles_y,omitempty"`
+	BitsPerTile     int32                  `protobuf:"varint,5,opt,name=bits_per_tile,json=bitsPerTile,proto3" json:"bits_per_tile,omitempty"`
+	MaxMessageBytes int32                  `protobuf:"varint,6,opt,name=max_message_bytes,json=maxMessageBytes,proto3" json:"max_message_bytes,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *CapacityResponse) Reset() {
+	*x = CapacityResponse{}
+	mi := &file_watermark_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CapacityResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CapacityResponse) ProtoMessage() {}
+
+func (x *CapacityResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_watermark_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CapacityResponse.ProtoReflect.Descriptor instead.
+func (*CapacityResponse) Descriptor() ([]byte, []int) {
+	return file_watermark_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *CapacityResponse) GetWidth() int32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *CapacityResponse) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *CapacityResponse) GetTilesX() int32 {
+	if x != nil {
+		return x.TilesX
+	}
+	return 0
+}
+
+func (x *CapacityResponse) GetTilesY() int32 {
+	if x != nil {
+		return x.TilesY
+	}
+	return 0
+}
+
+func (x *CapacityResponse) GetBitsPerTile() int32 {
+	if x != nil {
+		return x.BitsPerTile
+	}
+	return 0
+}
+
+func (x *CapacityResponse) GetMaxMessageBytes() int32 {
+	if x != nil {
+		return x.MaxMessageBytes
+	}
+	return 0
+}
+
+var File_watermark_proto protoreflect.FileDescriptor
+
+const file_watermark_proto_rawDesc = "" +
+	"\n" +
+	"\x0fwatermark.proto\x12\fwatermark.v1\"\xf5\x03\n" +
+	"\aOptions\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x1a\n" +
+	"\bstrength\x18\x02 \x01(\x01R\bstrength\x12)\n" +
+	"\x10palette_strength\x18\x03 \x01(\x01R\x0fpaletteStrength\x12%\n" +
+	"\x0epalette_passes\x18\x04 \x01(\x05R\rpalettePasses\x12)\n" +
+	"\x10coefficient_step\x18\x05 \x01(\x05R\x0fcoefficientStep\x12,\n" +
+	"\x06domain\x18\x06 \x01(\x0e2\x14.watermark.v1.DomainR\x06domain\x12\x1f\n" +
+	"\vpayload_key\x18\a \x01(\tR\n" +
+	"payloadKey\x12.\n" +
+	"\x13false_positive_rate\x18\b \x01(\x01R\x11falsePositiveRate\x12#\n" +
+	"\rsync_strength\x18\t \x01(\x01R\fsyncStrength\x12 \n" +
+	"\vsynchronize\x18\n" +
+	" \x01(\bR\vsynchronize\x12\x14\n" +
+	"\x05align\x18\v \x01(\bR\x05align\x12\x1e\n" +
+	"\n" +
+	"perceptual\x18\f \x01(\bR\n" +
+	"perceptual\x12\x1e\n" +
+	"\n" +
+	"modulation\x18\r \x01(\tR\n" +
+	"modulation\x12#\n" +
+	"\restimate_gain\x18\x0e \x01(\bR\festimateGain\"\xa0\x01\n" +
+	"\vEmbedHeader\x12\x18\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\x12/\n" +
+	"\aoptions\x18\x02 \x01(\v2\x15.watermark.v1.OptionsR\aoptions\x12#\n" +
+	"\routput_format\x18\x03 \x01(\tR\foutputFormat\x12!\n" +
+	"\fjpeg_quality\x18\x04 \x01(\x05R\vjpegQuality\"f\n" +
+	"\fEmbedRequest\x123\n" +
+	"\x06header\x18\x01 \x01(\v2\x19.watermark.v1.EmbedHeaderH\x00R\x06header\x12\x16\n" +
+	"\x05chunk\x18\x02 \x01(\fH\x00R\x05chunkB\t\n" +
+	"\apayload\"\x88\x01\n" +
+	"\tEmbedInfo\x12\x16\n" +
+	"\x06format\x18\x01 \x01(\tR\x06format\x12!\n" +
+	"\fcontent_type\x18\x02 \x01(\tR\vcontentType\x12\x14\n" +
+	"\x05tiles\x18\x03 \x01(\x05R\x05tiles\x12\x16\n" +
+	"\x06frames\x18\x04 \x01(\x05R\x06frames\x12\x12\n" +
+	"\x04size\x18\x05 \x01(\x03R\x04size\"a\n" +
+	"\rEmbedResponse\x12-\n" +
+	"\x04info\x18\x01 \x01(\v2\x17.watermark.v1.EmbedInfoH\x00R\x04info\x12\x16\n" +
+	"\x05chunk\x18\x02 \x01(\fH\x00R\x05chunkB\t\n" +
+	"\apayload\"f\n" +
+	"\x0eExtractRequest\x121\n" +
+	"\aoptions\x18\x01 \x01(\v2\x15.watermark.v1.OptionsH\x00R\aoptions\x12\x16\n" +
+	"\x05chunk\x18\x02 \x01(\fH\x00R\x05chunkB\t\n" +
+	"\apayload\"\x9c\x01\n" +
+	"\x04Tile\x12\x10\n" +
+	"\x03row\x18\x01 \x01(\x05R\x03row\x12\x10\n" +
+	"\x03col\x18\x02 \x01(\x05R\x03col\x12\x14\n" +
+	"\x05found\x18\x03 \x01(\bR\x05found\x12\x18\n" +
+	"\amessage\x18\x04 \x01(\tR\amessage\x12\x1f\n" +
+	"\vflag_errors\x18\x05 \x01(\x05R\n" +
+	"flagErrors\x12\x1f\n" +
+	"\vauth_failed\x18\x06 \x01(\bR\n" +
+	"authFailed\"\x8a\x02\n" +
+	"\x0fExtractResponse\x12\x14\n" +
+	"\x05found\x18\x01 \x01(\bR\x05found\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12\x1e\n" +
+	"\n" +
+	"confidence\x18\x03 \x01(\x01R\n" +
+	"confidence\x12\x1d\n" +
+	"\n" +
+	"tile_count\x18\x04 \x01(\x05R\ttileCount\x12%\n" +
+	"\x0eagreeing_tiles\x18\x05 \x01(\x05R\ragreeingTiles\x12\x16\n" +
+	"\x06frames\x18\x06 \x01(\x05R\x06frames\x12(\n" +
+	"\x05tiles\x18\a \x03(\v2\x12.watermark.v1.TileR\x05tiles\x12\x1f\n" +
+	"\vauth_failed\x18\b \x01(\bR\n" +
+	"authFailed\"e\n" +
+	"\rDetectRequest\x121\n" +
+	"\aoptions\x18\x01 \x01(\v2\x15.watermark.v1.OptionsH\x00R\aoptions\x12\x16\n" +
+	"\x05chunk\x18\x02 \x01(\fH\x00R\x05chunkB\t\n" +
+	"\apayload\"\xfc\x01\n" +
+	"\x0eDetectResponse\x12\x18\n" +
+	"\apresent\x18\x01 \x01(\bR\apresent\x12\x1d\n" +
+	"\n" +
+	"tile_count\x18\x02 \x01(\x05R\ttileCount\x12\x1d\n" +
+	"\n" +
+	"flag_tiles\x18\x03 \x01(\x05R\tflagTiles\x12\x18\n" +
+	"\amessage\x18\x04 \x01(\tR\amessage\x12\x1f\n" +
+	"\vauth_failed\x18\x05 \x01(\bR\n" +
+	"authFailed\x12\x17\n" +
+	"\ap_value\x18\x06 \x01(\x01R\x06pValue\x12\x1b\n" +
+	"\tflag_bits\x18\a \x01(\x05R\bflagBits\x12!\n" +
+	"\fflag_matches\x18\b \x01(\x05R\vflagMatches\"b\n" +
+	"\x0fCapacityRequest\x12\x14\n" +
+	"\x05width\x18\x01 \x01(\x05R\x05width\x12\x16\n" +
+	"\x06height\x18\x02 \x01(\x05R\x06height\x12!\n" +
+	"\fimage_header\x18\x03 \x01(\fR\vimageHeader\"\xc2\x01\n" +
+	"\x10CapacityResponse\x12\x14\n" +
+	"\x05width\x18\x01 \x01(\x05R\x05width\x12\x16\n" +
+	"\x06height\x18\x02 \x01(\x05R\x06height\x12\x17\n" +
+	"\atiles_x\x18\x03 \x01(\x05R\x06tilesX\x12\x17\n" +
+	"\atiles_y\x18\x04 \x01(\x05R\x06tilesY\x12\"\n" +
+	"\rbits_per_tile\x18\x05 \x01(\x05R\vbitsPerTile\x12*\n" +
+	"\x11max_message_bytes\x18\x06 \x01(\x05R\x0fmaxMessageBytes*2\n" +
+	"\x06Domain\x12\x10\n" +
+	"\fDOMAIN_PIXEL\x10\x00\x12\x16\n" +
+	"\x12DOMAIN_COEFFICIENT\x10\x012\xb4\x02\n" +
+	"\x10WatermarkService\x12D\n" +
+	"\x05Embed\x12\x1a.watermark.v1.EmbedRequest\x1a\x1b.watermark.v1.EmbedResponse(\x010\x01\x12H\n" +
+	"\aExtract\x12\x1c.watermark.v1.ExtractRequest\x1a\x1d.watermark.v1.ExtractResponse(\x01\x12E\n" +
+	"\x06Detect\x12\x1b.watermark.v1.DetectRequest\x1a\x1c.watermark.v1.DetectResponse(\x01\x12I\n" +
+	"\bCapacity\x12\x1d.watermark.v1.CapacityRequest\x1a\x1e.watermark.v1.CapacityResponseB-Z+InvisibleWaterMarkingSystem/RPC/watermarkpbb\x06proto3"
+
+var (
+	file_watermark_proto_rawDescOnce sync.Once
+	file_watermark_proto_rawDescData []byte
+)
+
+func file_watermark_proto_rawDescGZIP() []byte {
+	file_watermark_proto_rawDescOnce.Do(func() {
+		file_watermark_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_watermark_proto_rawDesc), len(file_watermark_proto_rawDesc)))
+	})
+	return file_watermark_proto_rawDescData
+}
+
+var file_watermark_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_watermark_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_watermark_proto_goTypes = []any{
+	(Domain)(0),              // 0: watermark.v1.Domain
+	(*Options)(nil),          // 1: watermark.v1.Options
+	(*EmbedHeader)(nil),      // 2: watermark.v1.EmbedHeader
+	(*EmbedRequest)(nil),     // 3: watermark.v1.EmbedRequest
+	(*EmbedInfo)(nil),        // 4: watermark.v1.EmbedInfo
+	(*EmbedResponse)(nil),    // 5: watermark.v1.EmbedResponse
+	(*ExtractRequest)(nil),   // 6: watermark.v1.ExtractRequest
+	(*Tile)(nil),             // 7: watermark.v1.Tile
+	(*ExtractResponse)(nil),  // 8: watermark.v1.ExtractResponse
+	(*DetectRequest)(nil),    // 9: watermark.v1.DetectRequest
+	(*DetectResponse)(nil),   // 10: watermark.v1.DetectResponse
+	(*CapacityRequest)(nil),  // 11: watermark.v1.CapacityRequest
+	(*CapacityResponse)(nil), // 12: watermark.v1.CapacityResponse
+}
+var file_watermark_proto_depIdxs = []int32{
+	0,  // 0: watermark.v1.Options.domain:type_name -> watermark.v1.Domain
+	1,  // 1: watermark.v1.EmbedHeader.options:type_name -> watermark.v1.Options
+	2,  // 2: watermark.v1.EmbedRequest.header:type_name -> watermark.v1.EmbedHeader
+	4,  // 3: watermark.v1.EmbedResponse.info:type_name -> watermark.v1.EmbedInfo
+	1,  // 4: watermark.v1.ExtractRequest.options:type_name -> watermark.v1.Options
+	7,  // 5: watermark.v1.ExtractResponse.tiles:type_name -> watermark.v1.Tile
+	1,  // 6: watermark.v1.DetectRequest.options:type_name -> watermark.v1.Options
+	3,  // 7: watermark.v1.WatermarkService.Embed:input_type -> watermark.v1.EmbedRequest
+	6,  // 8: watermark.v1.WatermarkService.Extract:input_type -> watermark.v1.ExtractRequest
+	9,  // 9: watermark.v1.WatermarkService.Detect:input_type -> watermark.v1.DetectRequest
+	11, // 10: watermark.v1.WatermarkService.Capacity:input_type -> watermark.v1.CapacityRequest
+	5,  // 11: watermark.v1.WatermarkService.Embed:output_type -> watermark.v1.EmbedResponse
+	8,  // 12: watermark.v1.WatermarkService.Extract:output_type -> watermark.v1.ExtractResponse
+	10, // 13: watermark.v1.WatermarkService.Detect:output_type -> watermark.v1.DetectResponse
+	12, // 14: watermark.v1.WatermarkService.Capacity:output_type -> watermark.v1.CapacityResponse
+	11, // [11:15] is the sub-list for method output_type
+	7,  // [7:11] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
+}
+
+func init() { file_watermark_proto_init() }
+func file_watermark_proto_init() {
+	if File_watermark_proto != nil {
+		return
+	}
+	file_watermark_proto_msgTypes[2].OneofWrappers = []any{
+		(*EmbedRequest_Header)(nil),
+		(*EmbedRequest_Chunk)(nil),
+	}
+	file_watermark_proto_msgTypes[4].OneofWrappers = []any{
+		(*EmbedResponse_Info)(nil),
+		(*EmbedResponse_Chunk)(nil),
+	}
+	file_watermark_proto_msgTypes[5].OneofWrappers = []any{
+		(*ExtractRequest_Options)(nil),
+		(*ExtractRequest_Chunk)(nil),
+	}
+	file_watermark_proto_msgTypes[8].OneofWrappers = []any{
+		(*DetectRequest_Options)(nil),
+		(*DetectRequest_Chunk)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_watermark_proto_rawDesc), len(file_watermark_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   12,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_watermark_proto_goTypes,
+		DependencyIndexes: file_watermark_proto_depIdxs,
+		EnumInfos:         file_watermark_proto_enumTypes,
+		MessageInfos:      file_watermark_proto_msgTypes,
+	}.Build()
+	File_watermark_proto = out.File
+	file_watermark_proto_goTypes = nil
+	file_watermark_proto_depIdxs = nil
+}
@@ -0,0 +1,232 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: watermark.proto
+
+package watermarkpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	WatermarkService_Embed_FullMethodName    = "/watermark.v1.WatermarkService/Embed"
+	WatermarkService_Extract_FullMethodName  = "/watermark.v1.WatermarkService/Extract"
+	WatermarkService_Detect_FullMethodName   = "/watermark.v1.WatermarkService/Detect"
+	WatermarkService_Capacity_FullMethodName = "/watermark.v1.WatermarkService/Capacity"
+)
+
+// WatermarkServiceClient is the client API for WatermarkService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// WatermarkService exposes the watermark library. Images are sent as a
+// stream of chunks so files larger than one gRPC message can be processed:
+// the first message of each request stream carries the parameters, every
+// following message a chunk of the image file.
+type WatermarkServiceClient interface {
+	// Embed returns the marked image as a stream: an EmbedInfo first, then chunks
+	Embed(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[EmbedRequest, EmbedResponse], error)
+	// Extract fails with NOT_FOUND when no tile carries a message
+	Extract(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ExtractRequest, ExtractResponse], error)
+	// Detect reports presence without requiring the message to decode
+	Detect(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[DetectRequest, DetectResponse], error)
+	Capacity(ctx context.Context, in *CapacityRequest, opts ...grpc.CallOption) (*CapacityResponse, error)
+}
+
+type watermarkServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewWatermarkServiceClient(cc grpc.ClientConnInterface) WatermarkServiceClient {
+	return &watermarkServiceClient{cc}
+}
+
+func (c *watermarkServiceClient) Embed(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[EmbedRequest, EmbedResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &WatermarkService_ServiceDesc.Streams[0], WatermarkService_Embed_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[EmbedRequest, EmbedResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WatermarkService_EmbedClient = grpc.BidiStreamingClient[EmbedRequest, EmbedResponse]
+
+func (c *watermarkServiceClient) Extract(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ExtractRequest, ExtractResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &WatermarkService_ServiceDesc.Streams[1], WatermarkService_Extract_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ExtractRequest, ExtractResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WatermarkService_ExtractClient = grpc.ClientStreamingClient[ExtractRequest, ExtractResponse]
+
+func (c *watermarkServiceClient) Detect(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[DetectRequest, DetectResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &WatermarkService_ServiceDesc.Streams[2], WatermarkService_Detect_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[DetectRequest, DetectResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WatermarkService_DetectClient = grpc.ClientStreamingClient[DetectRequest, DetectResponse]
+
+func (c *watermarkServiceClient) Capacity(ctx context.Context, in *CapacityRequest, opts ...grpc.CallOption) (*CapacityResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CapacityResponse)
+	err := c.cc.Invoke(ctx, WatermarkService_Capacity_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// WatermarkServiceServer is the server API for WatermarkService service.
+// All implementations must embed UnimplementedWatermarkServiceServer
+// for forward compatibility.
+//
+// WatermarkService exposes the watermark library. Images are sent as a
+// stream of chunks so files larger than one gRPC message can be processed:
+// the first message of each request stream carries the parameters, every
+// following message a chunk of the image file.
+type WatermarkServiceServer interface {
+	// Embed returns the marked image as a stream: an EmbedInfo first, then chunks
+	Embed(grpc.BidiStreamingServer[EmbedRequest, EmbedResponse]) error
+	// Extract fails with NOT_FOUND when no tile carries a message
+	Extract(grpc.ClientStreamingServer[ExtractRequest, ExtractResponse]) error
+	// Detect reports presence without requiring the message to decode
+	Detect(grpc.ClientStreamingServer[DetectRequest, DetectResponse]) error
+	Capacity(context.Context, *CapacityRequest) (*CapacityResponse, error)
+	mustEmbedUnimplementedWatermarkServiceServer()
+}
+
+// UnimplementedWatermarkServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedWatermarkServiceServer struct{}
+
+func (UnimplementedWatermarkServiceServer) Embed(grpc.BidiStreamingServer[EmbedRequest, EmbedResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Embed not implemented")
+}
+func (UnimplementedWatermarkServiceServer) Extract(grpc.ClientStreamingServer[ExtractRequest, ExtractResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Extract not implemented")
+}
+func (UnimplementedWatermarkServiceServer) Detect(grpc.ClientStreamingServer[DetectRequest, DetectResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Detect not implemented")
+}
+func (UnimplementedWatermarkServiceServer) Capacity(context.Context, *CapacityRequest) (*CapacityResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Capacity not implemented")
+}
+func (UnimplementedWatermarkServiceServer) mustEmbedUnimplementedWatermarkServiceServer() {}
+func (UnimplementedWatermarkServiceServer) testEmbeddedByValue()                          {}
+
+// UnsafeWatermarkServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to WatermarkServiceServer will
+// result in compilation errors.
+type UnsafeWatermarkServiceServer interface {
+	mustEmbedUnimplementedWatermarkServiceServer()
+}
+
+func RegisterWatermarkServiceServer(s grpc.ServiceRegistrar, srv WatermarkServiceServer) {
+	// If the following call pancis, it indicates UnimplementedWatermarkServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&WatermarkService_ServiceDesc, srv)
+}
+
+func _WatermarkService_Embed_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(WatermarkServiceServer).Embed(&grpc.GenericServerStream[EmbedRequest, EmbedResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WatermarkService_EmbedServer = grpc.BidiStreamingServer[EmbedRequest, EmbedResponse]
+
+func _WatermarkService_Extract_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(WatermarkServiceServer).Extract(&grpc.GenericServerStream[ExtractRequest, ExtractResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WatermarkService_ExtractServer = grpc.ClientStreamingServer[ExtractRequest, ExtractResponse]
+
+func _WatermarkService_Detect_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(WatermarkServiceServer).Detect(&grpc.GenericServerStream[DetectRequest, DetectResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WatermarkService_DetectServer = grpc.ClientStreamingServer[DetectRequest, DetectResponse]
+
+func _WatermarkService_Capacity_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CapacityRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WatermarkServiceServer).Capacity(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WatermarkService_Capacity_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WatermarkServiceServer).Capacity(ctx, req.(*CapacityRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// WatermarkService_ServiceDesc is the grpc.ServiceDesc for WatermarkService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var WatermarkService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "watermark.v1.WatermarkService",
+	HandlerType: (*WatermarkServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Capacity",
+			Handler:    _WatermarkService_Capacity_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Embed",
+			Handler:       _WatermarkService_Embed_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Extract",
+			Handler:       _WatermarkService_Extract_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Detect",
+			Handler:       _WatermarkService_Detect_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "watermark.proto",
+}
@@ -0,0 +1,292 @@
+// Package Registry records which payload was embedded for whom, so a
+// message extracted from a leaked copy can be traced back to its recipient.
+//
+// Records are appended to a JSON-lines file, one object per embed. The file
+// is only ever appended to, so it can be copied or tailed while in use; a
+// torn last line left by a crash is ignored on the next Open.
+//
+// Beside the file, path.secret holds a random secret created on the first
+// Open. Records identify their watermark key by an HMAC under it, so the
+// records alone do not let anyone test guesses at a key.
+package Registry
+
+import (
+	"InvisibleWaterMarkingSystem/Fingerprint"
+	"InvisibleWaterMarkingSystem/Watermark"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrDuplicate is returned when a payload ID is already registered
+	ErrDuplicate = errors.New("payload ID already registered")
+
+	// ErrNotFound is returned by Get for unknown payload IDs
+	ErrNotFound = errors.New("payload ID not registered")
+)
+
+// Record is one registered embed
+type Record struct {
+	PayloadID string `json:"payload_id"`
+	Recipient string `json:"recipient"`
+	Note      string `json:"note,omitempty"`
+
+	// SourceSHA256 is the hex SHA-256 of the file that was watermarked
+	SourceSHA256 string `json:"source_sha256"`
+	SourceName   string `json:"source_name,omitempty"`
+
+	// Options are those used to embed, without the key. KeyID identifies
+	// the key within this registry, from Registry.KeyID; empty when none
+	// was used.
+	Options *Watermark.Options `json:"options"`
+	KeyID   string             `json:"key_id,omitempty"`
+
+	// Fingerprint is set for records embedded as a Tardos codeword; the
+	// codeword is derived from the key, these parameters and PayloadID
+	Fingerprint *Fingerprint.Params `json:"fingerprint,omitempty"`
+
+	Created time.Time `json:"created"`
+}
+
+// Registry is an open registry file
+type Registry struct {
+	path    string
+	secret  []byte // keys KeyID
+	mu      sync.Mutex
+	f       *os.File
+	records map[string]*Record
+	order   []string // payload IDs in file order
+}
+
+// Open reads the registry at path, creating it when missing
+func Open(path string) (*Registry, error) {
+	secret, err := loadSecret(path + ".secret")
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	r := &Registry{path: path, secret: secret, f: f, records: make(map[string]*Record)}
+	if err := r.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// loadSecret reads the registry secret from name, creating it readable by
+// the owner only when missing
+func loadSecret(name string) ([]byte, error) {
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		secret := make([]byte, 32)
+		rand.Read(secret)
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if errors.Is(err, os.ErrExist) {
+			// Another process created it first
+			return loadSecret(name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if _, err := f.WriteString(hex.EncodeToString(secret) + "\n"); err != nil {
+			return nil, err
+		}
+		return secret, f.Sync()
+	}
+	if err != nil {
+		return nil, err
+	}
+	secret, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(secret) < 16 {
+		return nil, fmt.Errorf("%s: unreadable registry secret", name)
+	}
+	return secret, nil
+}
+
+func (r *Registry) load() error {
+	data, err := io.ReadAll(r.f)
+	if err != nil {
+		return err
+	}
+
+	offset := 0
+	for line := 1; offset < len(data); line++ {
+		n := bytes.IndexByte(data[offset:], '\n')
+		complete := n >= 0
+		if !complete {
+			n = len(data) - offset
+		}
+		text := bytes.TrimSpace(data[offset : offset+n])
+
+		var rec Record
+		if len(text) > 0 {
+			if err := json.Unmarshal(text, &rec); err != nil || rec.PayloadID == "" {
+				// A write cut short leaves a damaged last line; drop it so
+				// the next record does not follow it
+				if !complete || len(bytes.TrimSpace(data[offset+n:])) == 0 {
+					return r.f.Truncate(int64(offset))
+				}
+				return fmt.Errorf("%s:%d: unreadable record", r.path, line)
+			}
+			if _, dup := r.records[rec.PayloadID]; !dup {
+				r.order = append(r.order, rec.PayloadID)
+			}
+			r.records[rec.PayloadID] = &rec
+		}
+		if !complete {
+			// A valid record without its newline: finish the line
+			_, err := r.f.Write([]byte{'\n'})
+			return err
+		}
+		offset += n + 1
+	}
+	return nil
+}
+
+// Close closes the underlying file
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
+
+// Add appends rec and syncs the file. A zero Created is set to now, the key
+// is moved out of Options into KeyID, the payload key is dropped, and an
+// empty PayloadID gets a new one.
+func (r *Registry) Add(rec Record) (*Record, error) {
+	if rec.PayloadID == "" {
+		rec.PayloadID = NewPayloadID()
+	}
+	if strings.TrimSpace(rec.Recipient) == "" {
+		return nil, errors.New("registry record needs a recipient")
+	}
+	if rec.Created.IsZero() {
+		rec.Created = time.Now().UTC()
+	}
+	if rec.Options != nil {
+		opts := *rec.Options
+		if opts.Key != "" {
+			rec.KeyID = r.KeyID(opts.Key)
+			opts.Key = ""
+		}
+		opts.PayloadKey = ""
+		rec.Options = &opts
+	}
+
+	line, err := json.Marshal(&rec)
+	if err != nil {
+		return nil, err
+	}
+	line = append(line, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, dup := r.records[rec.PayloadID]; dup {
+		return nil, fmt.Errorf("%w: %s", ErrDuplicate, rec.PayloadID)
+	}
+	if _, err := r.f.Write(line); err != nil {
+		return nil, err
+	}
+	if err := r.f.Sync(); err != nil {
+		return nil, err
+	}
+	r.records[rec.PayloadID] = &rec
+	r.order = append(r.order, rec.PayloadID)
+	c := rec
+	return &c, nil
+}
+
+// Get returns the record for a payload ID
+func (r *Registry) Get(payloadID string) (*Record, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, ok := r.records[payloadID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, payloadID)
+	}
+	c := *rec
+	return &c, nil
+}
+
+// List returns every record in the order they were added
+func (r *Registry) List() []Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	records := make([]Record, 0, len(r.order))
+	for _, id := range r.order {
+		records = append(records, *r.records[id])
+	}
+	return records
+}
+
+// Fingerprinted returns the fingerprint records embedded with key, oldest
+// first
+func (r *Registry) Fingerprinted(key string) []Record {
+	keyID := ""
+	if key != "" {
+		keyID = r.KeyID(key)
+	}
+	return slices.DeleteFunc(r.List(), func(rec Record) bool {
+		return rec.Fingerprint == nil || rec.KeyID != keyID
+	})
+}
+
+// ByRecipient returns the records of one recipient, oldest first
+func (r *Registry) ByRecipient(recipient string) []Record {
+	return slices.DeleteFunc(r.List(), func(rec Record) bool { return rec.Recipient != recipient })
+}
+
+// payloadAlphabet avoids letters easily misread in a printed report
+const payloadAlphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+
+// NewPayloadID returns a random 12-character ID (60 bits), short enough to
+// leave most of a tile's capacity free
+func NewPayloadID() string {
+	var b [12]byte
+	rand.Read(b[:])
+	for i := range b {
+		b[i] = payloadAlphabet[b[i]&31]
+	}
+	return "wm-" + string(b[:])
+}
+
+// KeyID is a short fingerprint of a watermark key, for telling records
+// embedded with different keys apart without storing the keys. It is an
+// HMAC under the registry's secret, so the same key has a different ID in
+// every registry and an ID cannot be matched against guessed keys.
+func (r *Registry) KeyID(key string) string {
+	mac := hmac.New(sha256.New, r.secret)
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// HashFile returns the hex SHA-256 of a file's contents
+func HashFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return HashBytes(data), nil
+}
+
+// HashBytes returns the hex SHA-256 of data
+func HashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
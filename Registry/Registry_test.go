@@ -0,0 +1,144 @@
+package Registry
+
+import (
+	"InvisibleWaterMarkingSystem/Fingerprint"
+	"InvisibleWaterMarkingSystem/Watermark"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func openRegistry(t *testing.T, path string) *Registry {
+	t.Helper()
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestAddAndGet(t *testing.T) {
+	r := openRegistry(t, filepath.Join(t.TempDir(), "reg.jsonl"))
+
+	opts := Watermark.DefaultOptions()
+	opts.Key, opts.PayloadKey = "secret", "payload secret"
+	rec, err := r.Add(Record{Recipient: "alice", SourceSHA256: HashBytes([]byte("a")), Options: opts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(rec.PayloadID, "wm-") || rec.Created.IsZero() {
+		t.Errorf("defaults not filled in: %+v", rec)
+	}
+	if rec.Options.Key != "" || rec.Options.PayloadKey != "" || rec.KeyID != r.KeyID("secret") {
+		t.Errorf("keys stored: options %+v, key ID %q", rec.Options, rec.KeyID)
+	}
+	if opts.Key != "secret" {
+		t.Error("Add cleared the caller's options")
+	}
+
+	got, err := r.Get(rec.PayloadID)
+	if err != nil || got.Recipient != "alice" {
+		t.Errorf("Get: %+v, %v", got, err)
+	}
+	if _, err := r.Get("wm-unknown"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of an unknown ID: %v", err)
+	}
+	if _, err := r.Add(Record{PayloadID: rec.PayloadID, Recipient: "bob"}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("duplicate payload ID: %v", err)
+	}
+	if _, err := r.Add(Record{Recipient: " "}); err == nil {
+		t.Error("record without a recipient added")
+	}
+}
+
+func TestReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reg.jsonl")
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := &Fingerprint.Params{Colluders: 3, FalseAccusation: 0.01, Recipients: 100}
+	for _, rec := range []Record{
+		{PayloadID: "wm-1", Recipient: "alice"},
+		{PayloadID: "wm-2", Recipient: "bob", Options: &Watermark.Options{Key: "k"}, Fingerprint: params},
+		{PayloadID: "wm-3", Recipient: "alice", Options: &Watermark.Options{Key: "other"}, Fingerprint: params},
+	} {
+		if _, err := r.Add(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keyID := r.KeyID("k")
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Add(Record{Recipient: "carol"}); err == nil {
+		t.Error("Add after Close succeeded")
+	}
+
+	r = openRegistry(t, path)
+	if r.KeyID("k") != keyID {
+		t.Error("key IDs changed on reopening")
+	}
+	var ids []string
+	for _, rec := range r.List() {
+		ids = append(ids, rec.PayloadID)
+	}
+	if got := strings.Join(ids, " "); got != "wm-1 wm-2 wm-3" {
+		t.Errorf("records after reopening: %s", got)
+	}
+	if got := r.ByRecipient("alice"); len(got) != 2 {
+		t.Errorf("%d records for alice, want 2", len(got))
+	}
+	if got := r.Fingerprinted("k"); len(got) != 1 || got[0].PayloadID != "wm-2" || *got[0].Fingerprint != *params {
+		t.Errorf("fingerprinted with k: %+v", got)
+	}
+}
+
+func TestTornLastLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reg.jsonl")
+	r := openRegistry(t, path)
+	if _, err := r.Add(Record{PayloadID: "wm-1", Recipient: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+
+	// A crash in the middle of writing the next record
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"payload_id":"wm-2","recip`)
+	f.Close()
+
+	r = openRegistry(t, path)
+	if _, err := r.Add(Record{PayloadID: "wm-3", Recipient: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	r = openRegistry(t, path)
+	if got := r.List(); len(got) != 2 || got[1].PayloadID != "wm-3" {
+		t.Errorf("records after a torn write: %+v", got)
+	}
+}
+
+func TestKeyIDsDifferBetweenRegistries(t *testing.T) {
+	dir := t.TempDir()
+	a := openRegistry(t, filepath.Join(dir, "a.jsonl"))
+	b := openRegistry(t, filepath.Join(dir, "b.jsonl"))
+	if a.KeyID("k") == b.KeyID("k") {
+		t.Error("two registries give a key the same ID")
+	}
+	if a.KeyID("k") == a.KeyID("l") {
+		t.Error("two keys share an ID")
+	}
+	info, err := os.Stat(filepath.Join(dir, "a.jsonl.secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		t.Errorf("secret file mode %v", info.Mode())
+	}
+}
@@ -0,0 +1,207 @@
+package Server
+
+import (
+	"InvisibleWaterMarkingSystem/ImageIO"
+	"InvisibleWaterMarkingSystem/Registry"
+	"InvisibleWaterMarkingSystem/Watermark"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// requestOptions are the form fields shared by /embed, /extract and /jobs,
+// the same options as the gRPC Options message
+type requestOptions struct {
+	opts        *Watermark.Options
+	coefficient bool // domain=coefficient
+}
+
+func parseOptions(form url.Values) (*requestOptions, error) {
+	ro := &requestOptions{opts: Watermark.DefaultOptions()}
+	ro.opts.Key = form.Get("key")
+	ro.opts.PayloadKey = form.Get("payload_key")
+
+	floats := map[string]*float64{
+		"strength":         &ro.opts.Strength,
+		"palette_strength": &ro.opts.PaletteStrength,
+	}
+	for name, dst := range floats {
+		if v := form.Get(name); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || f <= 0 {
+				return nil, errorf(http.StatusBadRequest, "%s must be a positive number", name)
+			}
+			*dst = f
+		}
+	}
+
+	ints := map[string]*int{
+		"palette_passes":   &ro.opts.PalettePasses,
+		"coefficient_step": &ro.opts.CoefficientStep,
+	}
+	for name, dst := range ints {
+		if v := form.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return nil, errorf(http.StatusBadRequest, "%s must be a positive integer", name)
+			}
+			*dst = n
+		}
+	}
+
+	if v := form.Get("sync_strength"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 {
+			return nil, errorf(http.StatusBadRequest, "sync_strength must not be negative")
+		}
+		ro.opts.SyncStrength = f
+	}
+	if v := form.Get("false_positive_rate"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 || f >= 1 {
+			return nil, errorf(http.StatusBadRequest, "false_positive_rate must be between 0 and 1")
+		}
+		ro.opts.FalsePositiveRate = f
+	}
+
+	bools := map[string]*bool{
+		"perceptual":    &ro.opts.Perceptual,
+		"synchronize":   &ro.opts.Synchronize,
+		"align":         &ro.opts.Align,
+		"estimate_gain": &ro.opts.EstimateGain,
+	}
+	for name, dst := range bools {
+		if v := form.Get(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errorf(http.StatusBadRequest, "%s must be true or false", name)
+			}
+			*dst = b
+		}
+	}
+
+	modulation, err := Watermark.ParseModulation(form.Get("modulation"))
+	if err != nil {
+		return nil, errorf(http.StatusBadRequest, "%v", err)
+	}
+	ro.opts.Modulation = modulation
+	if err := Watermark.CheckModulation(ro.opts); err != nil {
+		return nil, errorf(http.StatusBadRequest, "%v", err)
+	}
+
+	switch d := form.Get("domain"); d {
+	case "", "pixel":
+	case "coefficient":
+		ro.coefficient = true
+	default:
+		return nil, errorf(http.StatusBadRequest, "domain must be pixel or coefficient")
+	}
+	return ro, nil
+}
+
+func (s *Server) handleEmbed(ctx context.Context, w http.ResponseWriter, u *upload) error {
+	ro, err := parseOptions(u.form)
+	if err != nil {
+		return err
+	}
+	message, recipient := u.form.Get("message"), u.form.Get("recipient")
+	if recipient != "" {
+		if s.cfg.Registry == nil {
+			return errorf(http.StatusBadRequest, "recipient given but the server has no registry")
+		}
+		if message == "" {
+			message = Registry.NewPayloadID()
+		} else if _, err := s.cfg.Registry.Get(message); err == nil {
+			return errorf(http.StatusConflict, "%v: %s", Registry.ErrDuplicate, message)
+		}
+	}
+	if message == "" {
+		return errorf(http.StatusBadRequest, "missing \"message\" field")
+	}
+
+	fopts := &Watermark.FileOptions{
+		JPEGQuality: 100,
+		XMPNote:     "Invisible watermark embedded",
+		Coefficient: ro.coefficient,
+	}
+	if name := u.form.Get("format"); name != "" {
+		if fopts.Format = ImageIO.ParseFormat(name); fopts.Format == ImageIO.FormatUnknown {
+			return errorf(http.StatusBadRequest, "unknown format %q", name)
+		}
+	}
+	if v := u.form.Get("quality"); v != "" {
+		if fopts.JPEGQuality, err = strconv.Atoi(v); err != nil || fopts.JPEGQuality < 1 || fopts.JPEGQuality > 100 {
+			return errorf(http.StatusBadRequest, "quality must be between 1 and 100")
+		}
+	}
+
+	result, err := Watermark.EmbedBytes(u.image, message, ro.opts, fopts)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if recipient != "" {
+		_, err := s.cfg.Registry.Add(Registry.Record{
+			PayloadID:    message,
+			Recipient:    recipient,
+			Note:         u.form.Get("note"),
+			SourceSHA256: Registry.HashBytes(u.image),
+			SourceName:   u.filename,
+			Options:      ro.opts,
+		})
+		if errors.Is(err, Registry.ErrDuplicate) {
+			return errorf(http.StatusConflict, "%v", err)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	w.Header().Set("X-Watermark-Payload", message)
+	w.Header().Set("Content-Type", result.Format.MIMEType())
+	w.Header().Set("Content-Disposition", `attachment; filename="watermarked`+result.Format.Extension()+`"`)
+	if result.Tiles > 0 {
+		w.Header().Set("X-Watermark-Tiles", strconv.Itoa(result.Tiles))
+	}
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(result.Data)
+	return err
+}
+
+// extractResponse is the library report plus the registry record of the
+// payload, when the server has a registry and the payload is in it
+type extractResponse struct {
+	*Watermark.ExtractReport
+	Recipient *Registry.Record `json:"recipient,omitempty"`
+}
+
+func (s *Server) handleExtract(ctx context.Context, w http.ResponseWriter, u *upload) error {
+	ro, err := parseOptions(u.form)
+	if err != nil {
+		return err
+	}
+
+	report, err := Watermark.ExtractBytes(u.image, ro.opts, ro.coefficient)
+	if err != nil {
+		return err
+	}
+
+	resp := extractResponse{ExtractReport: report}
+	if report.Found && s.cfg.Registry != nil {
+		if rec, err := s.cfg.Registry.Get(report.Message); err == nil {
+			// The key ID is for the registry's owner, not for clients
+			rec.KeyID = ""
+			resp.Recipient = rec
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, resp)
+	return nil
+}
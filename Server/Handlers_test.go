@@ -0,0 +1,127 @@
+package Server
+
+import (
+	"InvisibleWaterMarkingSystem/Watermark"
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	Watermark.Output = io.Discard
+	os.Exit(m.Run())
+}
+
+// texturedPNG is a deterministic textured PNG large enough to hold a message
+func texturedPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := 128 + 40*math.Sin(float64(x)/23) + 30*math.Cos(float64(y)/17) + float64((x*7+y*13)%25-12)
+			img.Set(x, y, color.RGBA{R: uint8(v), G: uint8(v * 0.9), B: uint8(255 - v), A: 0xFF})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseOptions(t *testing.T) {
+	ro, err := parseOptions(url.Values{
+		"key":                 {"k"},
+		"strength":            {"40"},
+		"perceptual":          {"true"},
+		"modulation":          {"stdm"},
+		"sync_strength":       {"2"},
+		"synchronize":         {"true"},
+		"align":               {"1"},
+		"estimate_gain":       {"true"},
+		"false_positive_rate": {"0.001"},
+		"domain":              {"coefficient"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Watermark.DefaultOptions()
+	want.Key = "k"
+	want.Strength = 40
+	want.Perceptual = true
+	want.Modulation = Watermark.ModulationSTDM
+	want.SyncStrength = 2
+	want.Synchronize = true
+	want.Align = true
+	want.EstimateGain = true
+	want.FalsePositiveRate = 0.001
+	if *ro.opts != *want {
+		t.Errorf("options\n got %+v\nwant %+v", *ro.opts, *want)
+	}
+	if !ro.coefficient {
+		t.Error("domain=coefficient not parsed")
+	}
+
+	for name, value := range map[string]string{
+		"perceptual":          "maybe",
+		"align":               "yes please",
+		"estimate_gain":       "2",
+		"modulation":          "fm",
+		"sync_strength":       "-1",
+		"false_positive_rate": "1",
+	} {
+		if _, err := parseOptions(url.Values{name: {value}}); err == nil {
+			t.Errorf("%s=%s accepted", name, value)
+		}
+	}
+	for _, modulation := range []string{"dithered", "stdm", "spread"} {
+		if _, err := parseOptions(url.Values{"modulation": {modulation}}); err == nil {
+			t.Errorf("modulation=%s accepted without a key", modulation)
+		}
+	}
+}
+
+func TestEmbedExtractWithModulation(t *testing.T) {
+	s := New(Config{})
+	fields := map[string]string{"modulation": "dithered", "perceptual": "true", "key": "k"}
+
+	embedFields := map[string]string{"message": "Hello World", "format": "png"}
+	for k, v := range fields {
+		embedFields[k] = v
+	}
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, multipartRequest(t, "/embed", texturedPNG(t, 512, 512), embedFields))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("embed: %d %s", rr.Code, rr.Body)
+	}
+	marked := rr.Body.Bytes()
+
+	extract := func(fields map[string]string) *Watermark.ExtractReport {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, multipartRequest(t, "/extract", marked, fields))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("extract: %d %s", rr.Code, rr.Body)
+		}
+		var report Watermark.ExtractReport
+		if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+		return &report
+	}
+	if r := extract(fields); !r.Found || r.Message != "Hello World" {
+		t.Errorf("extract with the embed options: %+v", r)
+	}
+	if r := extract(map[string]string{"key": "k"}); r.Found && r.Message == "Hello World" {
+		t.Error("modulation and perceptual had no effect on embedding")
+	}
+}
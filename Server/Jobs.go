@@ -0,0 +1,76 @@
+package Server
+
+import (
+	"InvisibleWaterMarkingSystem/Jobs"
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// handleSubmit queues an embed or extract job and answers 202 with the job.
+// It goes through limited like /embed: reading and checking the upload is
+// work a flood of submissions could otherwise pile up without bound.
+func (s *Server) handleSubmit(ctx context.Context, w http.ResponseWriter, u *upload) error {
+	ro, err := parseOptions(u.form)
+	if err != nil {
+		return err
+	}
+
+	spec := Jobs.Spec{
+		Kind:        Jobs.Kind(u.form.Get("kind")),
+		Message:     u.form.Get("message"),
+		Options:     ro.opts,
+		Format:      u.form.Get("format"),
+		Coefficient: ro.coefficient,
+		CallbackURL: u.form.Get("callback_url"),
+	}
+	if spec.Kind == "" {
+		spec.Kind = Jobs.KindEmbed
+	}
+	if v := u.form.Get("quality"); v != "" {
+		if spec.JPEGQuality, err = strconv.Atoi(v); err != nil || spec.JPEGQuality < 1 || spec.JPEGQuality > 100 {
+			return errorf(http.StatusBadRequest, "quality must be between 1 and 100")
+		}
+	}
+
+	job, err := s.cfg.Jobs.Submit(spec, u.image)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+	return nil
+}
+
+func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.cfg.Jobs.List())
+}
+
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	job, err := s.cfg.Jobs.Get(r.PathValue("id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// handleJobOutput serves the file a finished embed job wrote
+func (s *Server) handleJobOutput(w http.ResponseWriter, r *http.Request) {
+	path, job, err := s.cfg.Jobs.Output(r.PathValue("id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", job.Embed.ContentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+job.ID+"."+job.Embed.Format+`"`)
+	http.ServeContent(w, r, "", job.Updated, f)
+}
@@ -0,0 +1,61 @@
+package Server
+
+import (
+	"InvisibleWaterMarkingSystem/Jobs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func jobServer(t *testing.T, cfg Config) *Server {
+	t.Helper()
+	queue, err := Jobs.Open(Jobs.Config{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(queue.Close)
+	cfg.Jobs = queue
+	return New(cfg)
+}
+
+func TestSubmitChecksFields(t *testing.T) {
+	s := jobServer(t, Config{})
+	image := texturedPNG(t, 256, 256)
+	for _, c := range []struct {
+		fields map[string]string
+		code   int
+	}{
+		{map[string]string{"message": "Hello World", "quality": "90"}, http.StatusAccepted},
+		{map[string]string{"message": "Hello World", "quality": "0"}, http.StatusBadRequest},
+		{map[string]string{"message": "Hello World", "quality": "-5"}, http.StatusBadRequest},
+		{map[string]string{"message": "Hello World", "quality": "101"}, http.StatusBadRequest},
+		{map[string]string{"message": "Hello World", "modulation": "fm"}, http.StatusBadRequest},
+		// No callback hosts are configured
+		{map[string]string{"message": "Hello World", "callback_url": "http://169.254.169.254/"}, http.StatusBadRequest},
+	} {
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, multipartRequest(t, "/jobs", image, c.fields))
+		if rr.Code != c.code {
+			t.Errorf("%v: status %d, want %d: %s", c.fields, rr.Code, c.code, rr.Body)
+		}
+	}
+}
+
+func TestSubmitIsLimited(t *testing.T) {
+	s := jobServer(t, Config{MaxConcurrent: 1})
+	s.slots <- struct{}{} // every slot taken
+	s.cfg.Timeout = 50 * time.Millisecond
+
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, multipartRequest(t, "/jobs", texturedPNG(t, 256, 256), map[string]string{"message": "Hello World"}))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("submission with no free slot: status %d: %s", rr.Code, rr.Body)
+	}
+
+	rr = httptest.NewRecorder()
+	s.ServeHTTP(rr, multipartRequest(t, "/jobs", hugePNG(t, 50000, 50000), map[string]string{"message": "Hello World"}))
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized submission: status %d: %s", rr.Code, rr.Body)
+	}
+}
@@ -0,0 +1,98 @@
+package Server
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// metrics is a small set of counters exposed in the Prometheus text format
+type metrics struct {
+	mu        sync.Mutex
+	requests  map[requestKey]uint64 // by endpoint and status code
+	durations map[string]*durationStat
+
+	inFlight atomic.Int64
+	rejected atomic.Uint64 // requests turned away because every slot was busy
+	started  time.Time
+}
+
+type requestKey struct {
+	endpoint string
+	code     int
+}
+
+type durationStat struct {
+	count uint64
+	sum   time.Duration
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests:  make(map[requestKey]uint64),
+		durations: make(map[string]*durationStat),
+		started:   time.Now(),
+	}
+}
+
+func (m *metrics) observe(endpoint string, code int, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[requestKey{endpoint, code}]++
+	s := m.durations[endpoint]
+	if s == nil {
+		s = &durationStat{}
+		m.durations[endpoint] = s
+	}
+	s.count++
+	s.sum += d
+}
+
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP wm_requests_total Requests handled, by endpoint and status code.")
+	fmt.Fprintln(w, "# TYPE wm_requests_total counter")
+	keys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].endpoint != keys[j].endpoint {
+			return keys[i].endpoint < keys[j].endpoint
+		}
+		return keys[i].code < keys[j].code
+	})
+	for _, k := range keys {
+		fmt.Fprintf(w, "wm_requests_total{endpoint=%q,code=\"%d\"} %d\n", k.endpoint, k.code, m.requests[k])
+	}
+
+	fmt.Fprintln(w, "# HELP wm_request_duration_seconds Time spent handling requests, by endpoint.")
+	fmt.Fprintln(w, "# TYPE wm_request_duration_seconds summary")
+	endpoints := make([]string, 0, len(m.durations))
+	for e := range m.durations {
+		endpoints = append(endpoints, e)
+	}
+	sort.Strings(endpoints)
+	for _, e := range endpoints {
+		s := m.durations[e]
+		fmt.Fprintf(w, "wm_request_duration_seconds_sum{endpoint=%q} %g\n", e, s.sum.Seconds())
+		fmt.Fprintf(w, "wm_request_duration_seconds_count{endpoint=%q} %d\n", e, s.count)
+	}
+
+	fmt.Fprintln(w, "# HELP wm_requests_in_flight Requests currently being processed.")
+	fmt.Fprintln(w, "# TYPE wm_requests_in_flight gauge")
+	fmt.Fprintf(w, "wm_requests_in_flight %d\n", m.inFlight.Load())
+
+	fmt.Fprintln(w, "# HELP wm_requests_rejected_total Requests rejected because all processing slots stayed busy.")
+	fmt.Fprintln(w, "# TYPE wm_requests_rejected_total counter")
+	fmt.Fprintf(w, "wm_requests_rejected_total %d\n", m.rejected.Load())
+
+	fmt.Fprintln(w, "# HELP wm_uptime_seconds Seconds since the server started.")
+	fmt.Fprintln(w, "# TYPE wm_uptime_seconds gauge")
+	fmt.Fprintf(w, "wm_uptime_seconds %g\n", time.Since(m.started).Seconds())
+}
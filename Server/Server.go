@@ -0,0 +1,312 @@
+// Package Server exposes the watermarking library over HTTP:
+//
+//	POST /embed    multipart image + message + options, responds with the marked image
+//	POST /extract  multipart image + options, responds with JSON
+//
+// With Config.Registry set, /embed accepts a recipient field (the message
+// then defaults to a new payload ID) and /extract adds the recipient of the
+// payload it finds.
+//
+// A payload_key field encrypts the message on /embed; /extract with a
+// different key reports auth_failed rather than a missing watermark.
+//
+// The other option fields are named as in the gRPC Options message: key,
+// strength, palette_strength, palette_passes, coefficient_step, domain,
+// perceptual, modulation, sync_strength, synchronize, align, estimate_gain
+// and false_positive_rate.
+//
+//	GET  /healthz  liveness
+//	GET  /metrics  Prometheus text format
+//
+// With Config.Jobs set, large files can be processed in the background:
+//
+//	POST /jobs              multipart image + kind (embed|extract) + the fields above + callback_url
+//	GET  /jobs              all jobs
+//	GET  /jobs/{id}         state, result and log of one job
+//	GET  /jobs/{id}/output  the file written by a finished embed job
+//
+// callback_url is refused unless its host is one of the queue's
+// Jobs.Config.CallbackHosts.
+package Server
+
+import (
+	"InvisibleWaterMarkingSystem/ImageIO"
+	"InvisibleWaterMarkingSystem/Jobs"
+	"InvisibleWaterMarkingSystem/Registry"
+	"InvisibleWaterMarkingSystem/Watermark"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"runtime"
+	"time"
+)
+
+// Config bounds the resources a server will spend on requests
+type Config struct {
+	MaxUploadBytes int64         // largest accepted request body
+	MaxPixels      int           // largest accepted image, by the width and height in its header
+	MaxConcurrent  int           // requests processed at once; others wait for a slot
+	Timeout        time.Duration // per request, including the wait for a slot
+	Jobs           *Jobs.Queue   // enables the /jobs endpoints when set
+
+	// Registry, when set, records embeds that name a recipient and lets
+	// /extract report who received the extracted payload
+	Registry *Registry.Registry
+}
+
+// DefaultConfig returns the limits used for zero fields
+func DefaultConfig() Config {
+	return Config{
+		MaxUploadBytes: 32 << 20,
+		MaxPixels:      ImageIO.MaxPixels,
+		MaxConcurrent:  runtime.NumCPU(),
+		Timeout:        60 * time.Second,
+	}
+}
+
+// Server is an http.Handler serving the watermark endpoints
+type Server struct {
+	cfg     Config
+	slots   chan struct{}
+	metrics *metrics
+	mux     *http.ServeMux
+}
+
+// New builds a server; zero fields of cfg take their DefaultConfig values
+func New(cfg Config) *Server {
+	def := DefaultConfig()
+	if cfg.MaxUploadBytes <= 0 {
+		cfg.MaxUploadBytes = def.MaxUploadBytes
+	}
+	if cfg.MaxPixels <= 0 {
+		cfg.MaxPixels = def.MaxPixels
+	}
+	if cfg.MaxConcurrent <= 0 {
+		cfg.MaxConcurrent = def.MaxConcurrent
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = def.Timeout
+	}
+
+	s := &Server{
+		cfg:     cfg,
+		slots:   make(chan struct{}, cfg.MaxConcurrent),
+		metrics: newMetrics(),
+		mux:     http.NewServeMux(),
+	}
+	s.mux.Handle("POST /embed", s.instrument("embed", s.limited(s.handleEmbed)))
+	s.mux.Handle("POST /extract", s.instrument("extract", s.limited(s.handleExtract)))
+	s.mux.Handle("GET /healthz", s.instrument("healthz", http.HandlerFunc(s.handleHealth)))
+	s.mux.Handle("GET /metrics", http.HandlerFunc(s.handleMetrics))
+	if cfg.Jobs != nil {
+		s.mux.Handle("POST /jobs", s.instrument("jobs_submit", s.limited(s.handleSubmit)))
+		s.mux.Handle("GET /jobs", s.instrument("jobs_list", http.HandlerFunc(s.handleListJobs)))
+		s.mux.Handle("GET /jobs/{id}", s.instrument("jobs_get", http.HandlerFunc(s.handleJob)))
+		s.mux.Handle("GET /jobs/{id}/output", s.instrument("jobs_output", http.HandlerFunc(s.handleJobOutput)))
+	}
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// httpError carries a status code to writeError
+type httpError struct {
+	code int
+	msg  string
+}
+
+func (e *httpError) Error() string { return e.msg }
+
+func errorf(code int, format string, args ...any) error {
+	return &httpError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// statusWriter records the status code for metrics
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (s *Server) instrument(endpoint string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+		h.ServeHTTP(sw, r)
+		s.metrics.observe(endpoint, sw.code, time.Since(start))
+	})
+}
+
+// upload is a parsed multipart request: the "image" file and the other fields
+type upload struct {
+	image    []byte
+	filename string
+	form     url.Values
+}
+
+// readUpload parses the request and refuses images whose header claims more
+// than MaxPixels: a small compressed file can decode to gigabytes, and
+// running out of memory is not an error the server can recover from
+func (s *Server) readUpload(r *http.Request) (*upload, error) {
+	if err := r.ParseMultipartForm(s.cfg.MaxUploadBytes); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, err
+		}
+		return nil, errorf(http.StatusBadRequest, "expected a multipart/form-data body: %v", err)
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("image")
+	if err != nil {
+		return nil, errorf(http.StatusBadRequest, "missing \"image\" file field")
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := ImageIO.CheckSize(data, s.cfg.MaxPixels); errors.Is(err, ImageIO.ErrTooLarge) {
+		return nil, errorf(http.StatusRequestEntityTooLarge, "%v", err)
+	}
+	return &upload{image: data, filename: header.Filename, form: r.MultipartForm.Value}, nil
+}
+
+// limited applies the body size limit and the request timeout, reads the
+// upload, waits for a processing slot and runs h. The library is not
+// cancellable, so h runs in its own goroutine and keeps its slot until it
+// finishes even if the client has been answered with a timeout; this keeps
+// MaxConcurrent a true bound. A panic in h is answered with a 500 instead of
+// taking the whole server down.
+func (s *Server) limited(h func(ctx context.Context, w http.ResponseWriter, u *upload) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), s.cfg.Timeout)
+		defer cancel()
+		r.Body = http.MaxBytesReader(w, r.Body, s.cfg.MaxUploadBytes)
+
+		u, err := s.readUpload(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		select {
+		case s.slots <- struct{}{}:
+		case <-ctx.Done():
+			s.metrics.rejected.Add(1)
+			writeError(w, errorf(http.StatusServiceUnavailable, "server busy, try again later"))
+			return
+		}
+
+		// The handler writes into a buffer so a late result cannot race
+		// with the timeout response
+		rec := newBufferedResponse()
+		done := make(chan error, 1)
+		go func() {
+			defer func() { <-s.slots }()
+			s.metrics.inFlight.Add(1)
+			defer s.metrics.inFlight.Add(-1)
+			defer func() {
+				if p := recover(); p != nil {
+					done <- errorf(http.StatusInternalServerError, "internal error: %v", p)
+				}
+			}()
+			done <- h(ctx, rec, u)
+		}()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			rec.copyTo(w)
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				writeError(w, errorf(http.StatusGatewayTimeout, "processing exceeded %v", s.cfg.Timeout))
+			} else {
+				writeError(w, errorf(http.StatusServiceUnavailable, "request cancelled"))
+			}
+		}
+	})
+}
+
+// bufferedResponse is a minimal ResponseWriter held in memory
+type bufferedResponse struct {
+	header http.Header
+	code   int
+	body   []byte
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: make(http.Header), code: http.StatusOK}
+}
+
+func (b *bufferedResponse) Header() http.Header  { return b.header }
+func (b *bufferedResponse) WriteHeader(code int) { b.code = code }
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.body = append(b.body, p...)
+	return len(p), nil
+}
+
+func (b *bufferedResponse) copyTo(w http.ResponseWriter) {
+	for k, v := range b.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(b.code)
+	w.Write(b.body)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	var he *httpError
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &he):
+		code = he.code
+	case errors.As(err, &tooLarge):
+		code = http.StatusRequestEntityTooLarge
+	case errors.Is(err, Watermark.ErrInvalidImage):
+		code = http.StatusUnsupportedMediaType
+	case errors.Is(err, Watermark.ErrInvalidOptions):
+		code = http.StatusBadRequest
+	case errors.Is(err, Watermark.ErrMessageTooLong), errors.Is(err, Watermark.ErrImageTooSmall):
+		code = http.StatusUnprocessableEntity
+	case errors.Is(err, Jobs.ErrNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, Jobs.ErrNoOutput):
+		code = http.StatusConflict
+	case errors.Is(err, Jobs.ErrClosed):
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":    "ok",
+		"in_flight": s.metrics.inFlight.Load(),
+		"capacity":  s.cfg.MaxConcurrent,
+	})
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	s.metrics.write(w)
+}
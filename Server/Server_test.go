@@ -0,0 +1,116 @@
+package Server
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// multipartRequest builds a POST with an "image" file field and the given
+// form fields
+func multipartRequest(t *testing.T, target string, data []byte, fields map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("image", "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(data)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, target, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+// hugePNG is a valid 1x1 PNG whose header is rewritten to claim
+// width x height pixels
+func hugePNG(t *testing.T, width, height uint32) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// Signature (8), IHDR length (4) and type (4), then width and height
+	binary.BigEndian.PutUint32(data[16:], width)
+	binary.BigEndian.PutUint32(data[20:], height)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+// hugeBMP is a 54-byte 24-bit BMP header claiming width x height pixels
+func hugeBMP(width, height int32) []byte {
+	b := make([]byte, 54)
+	copy(b, "BM")
+	binary.LittleEndian.PutUint32(b[2:], 54)
+	binary.LittleEndian.PutUint32(b[10:], 54)
+	binary.LittleEndian.PutUint32(b[14:], 40)
+	binary.LittleEndian.PutUint32(b[18:], uint32(width))
+	binary.LittleEndian.PutUint32(b[22:], uint32(height))
+	binary.LittleEndian.PutUint16(b[26:], 1)
+	binary.LittleEndian.PutUint16(b[28:], 24)
+	return b
+}
+
+func TestOversizedImagesAreRejected(t *testing.T) {
+	s := New(Config{})
+	for name, data := range map[string][]byte{
+		"png": hugePNG(t, 50000, 50000),
+		"bmp": hugeBMP(50000, 50000),
+	} {
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, multipartRequest(t, "/extract", data, nil))
+		if rr.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s bomb: status %d, want %d: %s", name, rr.Code, http.StatusRequestEntityTooLarge, rr.Body)
+		}
+	}
+
+	// A BMP under the pixel limit whose rows are missing fails cleanly
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, multipartRequest(t, "/extract", hugeBMP(4000, 4000), nil))
+	if rr.Code < 400 || rr.Code == http.StatusInternalServerError {
+		t.Errorf("truncated BMP: status %d: %s", rr.Code, rr.Body)
+	}
+}
+
+func TestHandlerPanicIsA500(t *testing.T) {
+	s := New(Config{})
+	h := s.limited(func(ctx context.Context, w http.ResponseWriter, u *upload) error {
+		panic("boom")
+	})
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, multipartRequest(t, "/extract", []byte("not an image"), nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d, want 500", rr.Code)
+	}
+
+	// The server still answers, and the slot is given back
+	for deadline := time.Now().Add(time.Second); ; {
+		rr = httptest.NewRecorder()
+		s.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		body, _ := io.ReadAll(rr.Body)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("healthz after a panic: %d %s", rr.Code, body)
+		}
+		if bytes.Contains(body, []byte(`"in_flight":0`)) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("slot still held after a panic: %s", body)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,342 @@
+package Watermark
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"sync"
+)
+
+// Tiles are laid out from the top-left pixel of the marked image, so a copy
+// cropped by an amount that is not a multiple of 256 pixels has its tiles,
+// blocks and even its DWT pairs out of step with the extractor. The grid is
+// found again by trying every offset modulo 256: the DWT parity, the 8x8
+// block phase of the HL band and the tile offset, one of 16x16 block
+// positions. Dithered modulators leave no lattice to find the block phase by
+// on its own, so each offset is scored by the binomial p-value of the start
+// flag matches of its tiles, reading each flag block with its index in the
+// tile. The blocks of each phase are transformed once and shared by its 256
+// tile offsets.
+//
+// Text is far from random bits, and without a key a shift by whole blocks
+// can line message data up with the first bits of the start flag in every
+// tile. Offsets are therefore ranked by both bits of each flag block, ties
+// go to the offset nearest the top-left, and Align keeps the crop only when
+// a message decodes from it, which takes the end flag as well.
+
+// Alignment is where the tile grid starts in a possibly cropped image
+type Alignment struct {
+	// X and Y are the pixel offset of the first whole tile; an image
+	// cropped by c pixels on the left has X = (256 - c mod 256) mod 256
+	X int `json:"x"`
+	Y int `json:"y"`
+
+	// Tiles is the number of whole tiles at the offset, and PValue the
+	// chance of start-flag matches as good at any of the alignOffsets
+	// offsets tried in an unmarked image
+	Tiles  int     `json:"tiles"`
+	PValue float64 `json:"p_value"`
+
+	// score is the log p-value of both bits of the flag blocks, by which
+	// offsets are ranked
+	score float64
+}
+
+// better reports whether a ranks above b: a lower score, or the same score
+// nearer the top-left
+func (a *Alignment) better(b *Alignment) bool {
+	if a.score != b.score {
+		return a.score < b.score
+	}
+	return a.X+a.Y < b.X+b.Y || (a.X+a.Y == b.X+b.Y && a.Y < b.Y)
+}
+
+// Identity reports whether the grid already starts at the top-left pixel
+func (a *Alignment) Identity() bool {
+	return a.X == 0 && a.Y == 0
+}
+
+// alignOffsets is the number of pixel offsets FindAlignment tries, each
+// modulo 256 in both directions
+const alignOffsets = 256 * 256
+
+// dctMatrix is the 8-point orthonormal DCT of dct1D as a matrix
+var dctMatrix = func() [8][8]float64 {
+	var m [8][8]float64
+	for k := range m {
+		alpha := math.Sqrt(2.0 / 8)
+		if k == 0 {
+			alpha = math.Sqrt(1.0 / 8)
+		}
+		for n := range m[k] {
+			m[k][n] = alpha * math.Cos(math.Pi*float64((2*n+1)*k)/16)
+		}
+	}
+	return m
+}()
+
+// haarBands returns the LL and HL bands of Ymatrix with the Haar pairs
+// starting at pixel (px, py), as PerformCompleteDWT computes them for a crop
+// at that point
+func haarBands(Ymatrix [][]float64, px, py int) *DWTResult {
+	h, w := (len(Ymatrix)-py)/2, (len(Ymatrix[0])-px)/2
+	d := &DWTResult{LL: make([][]float64, h), HL: make([][]float64, h)}
+	for r := 0; r < h; r++ {
+		d.LL[r], d.HL[r] = make([]float64, w), make([]float64, w)
+		top, bottom := Ymatrix[py+2*r], Ymatrix[py+2*r+1]
+		for c := 0; c < w; c++ {
+			x := px + 2*c
+			d.LL[r][c] = (top[x] + top[x+1] + bottom[x] + bottom[x+1]) / 2
+			d.HL[r][c] = (top[x] - top[x+1] + bottom[x] - bottom[x+1]) / 2
+		}
+	}
+	return d
+}
+
+// shifted is a view of m without its first dy rows and dx columns
+func shifted(m [][]float64, dx, dy int) [][]float64 {
+	view := make([][]float64, len(m)-dy)
+	for r := range view {
+		view[r] = m[dy+r][dx:]
+	}
+	return view
+}
+
+// blockScanner computes the DCT of 8x8 blocks of an HL band as dct2D does,
+// by matrix products into reused buffers, fast enough to repeat for every
+// candidate phase
+type blockScanner struct {
+	temp [8][8]float64
+	dct  [][]float64
+}
+
+func newBlockScanner() *blockScanner {
+	s := &blockScanner{dct: make([][]float64, 8)}
+	for i := range s.dct {
+		s.dct[i] = make([]float64, 8)
+	}
+	return s
+}
+
+// transform returns the DCT of the block of hl at block row by, column bx
+func (s *blockScanner) transform(hl [][]float64, bx, by int) [][]float64 {
+	for i := 0; i < 8; i++ {
+		row := hl[8*by+i][8*bx : 8*bx+8]
+		for k := 0; k < 8; k++ {
+			var sum float64
+			for n, v := range row {
+				sum += dctMatrix[k][n] * v
+			}
+			s.temp[i][k] = sum
+		}
+	}
+	for k := 0; k < 8; k++ {
+		for j := 0; j < 8; j++ {
+			var sum float64
+			for n := 0; n < 8; n++ {
+				sum += dctMatrix[k][n] * s.temp[n][j]
+			}
+			s.dct[k][j] = sum
+		}
+	}
+	return s.dct
+}
+
+// phaseBlocks holds the DCT of every whole block of an HL band, computed by
+// a blockScanner into one buffer reused from phase to phase
+type phaseBlocks struct {
+	rows, cols int
+	dct        [][][]float64
+}
+
+// load transforms the blocks of hl, growing the buffer as needed
+func (p *phaseBlocks) load(hl [][]float64, scanner *blockScanner) {
+	p.rows, p.cols = len(hl)/8, 0
+	if p.rows > 0 {
+		p.cols = len(hl[0]) / 8
+	}
+	for len(p.dct) < p.rows*p.cols {
+		block := make([][]float64, 8)
+		for i := range block {
+			block[i] = make([]float64, 8)
+		}
+		p.dct = append(p.dct, block)
+	}
+	for by := 0; by < p.rows; by++ {
+		for bx := 0; bx < p.cols; bx++ {
+			dct := scanner.transform(hl, bx, by)
+			for i, row := range dct {
+				copy(p.dct[by*p.cols+bx][i], row)
+			}
+		}
+	}
+}
+
+// bestTileOffset scores each of the 16x16 tile offsets of a phase by the
+// start flags of its whole tiles and returns the best, first in raster order
+// among equals. It is ranked by the log p-value of both bits of each flag
+// block; the uncorrected p-value returned counts only the first bit, as
+// Detect does, since the two are correlated in flat areas.
+func bestTileOffset(p *phaseBlocks, steps [][]float64, c blockCoding) (ox, oy, tiles int, score, pValue float64) {
+	startFlag := BuildWatermarkBits("")[:16]
+	score, pValue = math.Inf(1), 1
+	for y := 0; y < tileBlocks; y++ {
+		for x := 0; x < tileBlocks; x++ {
+			var count, n, first, both int
+			for ty := y; ty+tileBlocks <= p.rows; ty += tileBlocks {
+				for tx := x; tx+tileBlocks <= p.cols; tx += tileBlocks {
+					count++
+					for k := 0; k < len(startFlag)/2; k++ {
+						idx := blockAt(c.order, k)
+						by, bx := ty+idx/tileBlocks, tx+idx%tileBlocks
+						bits := c.modulator.Extract(p.dct[by*p.cols+bx], steps[by][bx], idx)
+						if bits[0] == startFlag[2*k] {
+							first++
+							both++
+						}
+						if bits[1] == startFlag[2*k+1] {
+							both++
+						}
+						n++
+					}
+				}
+			}
+			if count == 0 {
+				continue
+			}
+			if s := logBinomialTail(2*n, both); s < score {
+				ox, oy, tiles, score, pValue = x, y, count, s, binomialTail(n, first)
+			}
+		}
+	}
+	return ox, oy, tiles, score, pValue
+}
+
+// FindAlignment locates the tile grid of an image marked with the strength
+// and key in opts, for copies cropped on the top or left. It returns
+// ErrNoWatermark when no offset gives start flags significant at
+// opts.FalsePositiveRate.
+func FindAlignment(img image.Image, opts *Options) (*Alignment, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	if err := CheckModulation(opts); err != nil {
+		return nil, err
+	}
+	b := img.Bounds()
+	if b.Dx() < 256 || b.Dy() < 256 {
+		return nil, fmt.Errorf("%w: need at least 256x256 pixels to align, got %dx%d", ErrImageTooSmall, b.Dx(), b.Dy())
+	}
+	_, Ymatrix := ConvertToYC(img)
+
+	// Every DWT parity and block phase in the HL band, each with the best
+	// of its tile offsets
+	coding := codingFor(opts, opts.Strength)
+	var phases [16][16]*Alignment
+	var wg sync.WaitGroup
+	for py := 0; py < 2; py++ {
+		for px := 0; px < 2; px++ {
+			bands := haarBands(Ymatrix, px, py)
+			for hy := 0; hy < 8; hy++ {
+				wg.Add(1)
+				go func(y int) {
+					defer wg.Done()
+					scanner := newBlockScanner()
+					var blocks phaseBlocks
+					for hx := 0; hx < 8; hx++ {
+						x := px + 2*hx
+						phase := &DWTResult{LL: shifted(bands.LL, hx, hy), HL: shifted(bands.HL, hx, hy)}
+						blocks.load(phase.HL, scanner)
+						ox, oy, tiles, score, p := bestTileOffset(&blocks, blockSteps(phase, coding.alpha, coding.perceptual), coding)
+						if tiles > 0 {
+							phases[y][x] = &Alignment{X: x + 16*ox, Y: y + 16*oy, Tiles: tiles, PValue: p, score: score}
+						}
+					}
+				}(py + 2*hy)
+			}
+		}
+	}
+	wg.Wait()
+
+	var found *Alignment
+	for y := range phases {
+		for _, a := range phases[y] {
+			if a != nil && (found == nil || a.better(found)) {
+				found = a
+			}
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%w: no whole tile at any offset", ErrImageTooSmall)
+	}
+	found.PValue = min(1, alignOffsets*found.PValue)
+	fmt.Fprintf(Output, "Align: tiles start at (%d, %d), %d tiles, p-value %.3g\n",
+		found.X, found.Y, found.Tiles, found.PValue)
+	if found.PValue > opts.FalsePositiveRate {
+		return found, fmt.Errorf("%w: best tile offset (%d, %d) has p-value %.3g", ErrNoWatermark, found.X, found.Y, found.PValue)
+	}
+	return found, nil
+}
+
+// Align is the image extraction runs on when opts.Align is set: img
+// synchronized first if opts.Synchronize is also set, then cropped to start
+// at the tile grid FindAlignment finds. The crop is kept only when a
+// message, or a payload that fails authentication, decodes from it;
+// otherwise img is returned as it is, with an error wrapping ErrNoWatermark.
+func Align(img image.Image, opts *Options) (image.Image, *Alignment, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	img, opts = synchronized(img, opts)
+	a, err := FindAlignment(img, opts)
+	if err != nil {
+		return nil, a, err
+	}
+	if a.Identity() {
+		return img, a, nil
+	}
+	cropped := cropTo(img, a)
+	o := *opts
+	o.Align = false
+	if messages, authFailed := ExtractMessages(cropped, &o); len(messages) == 0 && authFailed == 0 {
+		return img, a, fmt.Errorf("%w: nothing decodes with the tiles at (%d, %d); keeping them at (0, 0)", ErrNoWatermark, a.X, a.Y)
+	}
+	return cropped, a, nil
+}
+
+// cropTo drops the pixels above and left of the tile grid
+func cropTo(img image.Image, a *Alignment) image.Image {
+	if a.Identity() {
+		return img
+	}
+	b := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, b.Dx()-a.X, b.Dy()-a.Y))
+	draw.Draw(out, out.Bounds(), img, b.Min.Add(image.Pt(a.X, a.Y)), draw.Src)
+	return out
+}
+
+// aligned is img as Align crops it, with the alignment; when no grid is
+// found, or nothing decodes on it, img is returned as is with a nil one
+func aligned(img image.Image, opts *Options) (image.Image, *Alignment) {
+	out, a, err := Align(img, opts)
+	if err != nil {
+		fmt.Fprintf(Output, "Align: %v; extracting without it\n", err)
+		return img, nil
+	}
+	return out, a
+}
+
+// prepared is the image extraction runs on, synchronized and then aligned as
+// opts asks, and the options to read it with, their Strength scaled by the
+// gain found when opts.EstimateGain is set
+func prepared(img image.Image, opts *Options) (image.Image, *Options) {
+	img, opts = synchronized(img, opts)
+	if opts.Align {
+		img, _ = aligned(img, opts)
+	}
+	if opts.EstimateGain {
+		opts, _ = gained(img, opts)
+	}
+	return img, opts
+}
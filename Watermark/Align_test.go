@@ -0,0 +1,50 @@
+package Watermark
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// skyImage is testImage with a smooth, noiseless top half, like the sky of
+// a photo: blocks there read back the same bits whatever the shift
+func skyImage(width, height int) *image.RGBA {
+	img := testImage(width, height)
+	for y := 0; y < height/2; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8(150 + 60*y/height)
+			img.SetRGBA(x, y, color.RGBA{R: v - 40, G: v - 10, B: v + 30, A: 0xFF})
+		}
+	}
+	return img
+}
+
+// cropped drops x columns on the left and y rows on the top
+func cropped(img image.Image, x, y int) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, b.Dx()-x, b.Dy()-y))
+	draw.Draw(out, out.Bounds(), img, b.Min.Add(image.Pt(x, y)), draw.Src)
+	return out
+}
+
+func TestAlignCroppedText(t *testing.T) {
+	const message = "Hello World"
+	opts := DefaultOptions()
+	marked := EmbedWithOptions(skyImage(1024, 768), message, opts)
+	opts.Align = true
+
+	for _, c := range []struct{ x, y int }{{0, 0}, {100, 5}} {
+		img := cropped(marked, c.x, c.y)
+		a, err := FindAlignment(img, opts)
+		if err != nil {
+			t.Fatalf("crop (%d, %d): %v", c.x, c.y, err)
+		}
+		if want := (image.Point{X: (256 - c.x%256) % 256, Y: (256 - c.y%256) % 256}); a.X != want.X || a.Y != want.Y {
+			t.Errorf("crop (%d, %d): tiles found at (%d, %d), want %v", c.x, c.y, a.X, a.Y, want)
+		}
+		if !hasMessage(img, message, opts) {
+			t.Errorf("crop (%d, %d): %q not extracted", c.x, c.y, message)
+		}
+	}
+}
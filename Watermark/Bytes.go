@@ -0,0 +1,246 @@
+package Watermark
+
+import (
+	"InvisibleWaterMarkingSystem/ImageIO"
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+)
+
+// FileOptions control how EmbedBytes handles and writes an in-memory file
+type FileOptions struct {
+	Format      ImageIO.Format // output format; FormatUnknown keeps the input format
+	JPEGQuality int            // 1–100, 0 means 100
+	XMPNote     string         // recorded in JPEG output metadata when set
+	Coefficient bool           // embed in the JPEG coefficients instead of pixels
+}
+
+// FileResult is an encoded watermarked file
+type FileResult struct {
+	Data   []byte
+	Format ImageIO.Format
+	Tiles  int // tiles per still image; 0 for animations and coefficient mode
+	Frames int // GIF frames written
+}
+
+// EmbedBytes watermarks an encoded image file. Still images go through
+// EmbedWithOptions, GIF output through the palette-aware GIF embedder and,
+// with fopts.Coefficient, JPEG input through Embed_Watermark_JPEG. EXIF
+// orientation is applied first and JPEG metadata carried over.
+func EmbedBytes(data []byte, message string, opts *Options, fopts *FileOptions) (*FileResult, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	if err := CheckModulation(opts); err != nil {
+		return nil, err
+	}
+	if fopts == nil {
+		fopts = &FileOptions{}
+	}
+	if err := CheckMessageLength(message, opts); err != nil {
+		return nil, err
+	}
+
+	inFormat := ImageIO.DetectFormat(data)
+	if inFormat == ImageIO.FormatUnknown {
+		return nil, fmt.Errorf("%w: unrecognised format", ErrInvalidImage)
+	}
+	outFormat := fopts.Format
+	if outFormat == ImageIO.FormatUnknown {
+		outFormat = inFormat
+	}
+
+	if fopts.Coefficient {
+		if inFormat != ImageIO.FormatJPEG || outFormat != ImageIO.FormatJPEG {
+			return nil, fmt.Errorf("%w: coefficient embedding needs JPEG in and out", ErrInvalidOptions)
+		}
+		out, err := Embed_Watermark_JPEG(data, message, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &FileResult{Data: out, Format: ImageIO.FormatJPEG}, nil
+	}
+
+	if inFormat == ImageIO.FormatGIF && outFormat == ImageIO.FormatGIF {
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+		}
+		return embedGIFBytes(g, message, opts)
+	}
+
+	img, _, meta, err := ImageIO.DecodeWithMetadata(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	img = ImageIO.AutoOrient(img, meta)
+	b := img.Bounds()
+	if err := CheckMessage(b.Dx(), b.Dy(), message, opts); err != nil {
+		return nil, err
+	}
+
+	// A palette cannot hold pixel-domain marks, so single images written as
+	// GIF go through the embedder that re-checks the bits after quantization
+	if outFormat == ImageIO.FormatGIF {
+		frame := ImageIO.QuantizeToPalette(img, ImageIO.MedianCutPalette(img, nil, 256), nil, 0)
+		return embedGIFBytes(&gif.GIF{Image: []*image.Paletted{frame}, Delay: []int{0}}, message, opts)
+	}
+
+	marked := EmbedWithOptions(img, message, opts)
+
+	encodeOptions := ImageIO.DefaultEncodeOptions()
+	if fopts.JPEGQuality > 0 {
+		encodeOptions.JPEGQuality = fopts.JPEGQuality
+	}
+	if outFormat == ImageIO.FormatJPEG {
+		encodeOptions.Metadata = meta
+		encodeOptions.XMPNote = fopts.XMPNote
+	}
+	var buf bytes.Buffer
+	if err := ImageIO.Encode(&buf, marked, outFormat, encodeOptions); err != nil {
+		return nil, err
+	}
+	return &FileResult{Data: buf.Bytes(), Format: outFormat, Tiles: Capacity(b.Dx(), b.Dy()).Tiles()}, nil
+}
+
+func embedGIFBytes(g *gif.GIF, message string, opts *Options) (*FileResult, error) {
+	marked, err := Embed_Watermark_GIF(g, message, opts)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, marked); err != nil {
+		return nil, err
+	}
+	return &FileResult{Data: buf.Bytes(), Format: ImageIO.FormatGIF, Frames: len(marked.Image)}, nil
+}
+
+// ExtractReport summarises extraction from an encoded file
+type ExtractReport struct {
+	Found   bool   `json:"found"`
+	Message string `json:"message"`
+
+	// AuthFailed is set when no message was found but some tile held an
+	// encrypted payload that did not open with the PayloadKey
+	AuthFailed bool `json:"auth_failed,omitempty"`
+
+	// Confidence is the fraction of tiles whose message equals Message. GIF
+	// bits are voted across frames, so there it is 1 when the vote decodes.
+	Confidence float64      `json:"confidence"`
+	TileCount  int          `json:"tile_count"`
+	Agreeing   int          `json:"agreeing_tiles"`
+	Frames     int          `json:"frames,omitempty"`
+	Tiles      []TileResult `json:"tiles,omitempty"` // per tile, still images in the pixel domain only
+}
+
+// ExtractBytes reads the watermark from an encoded image file. Not finding
+// one is reported through Found rather than as an error.
+func ExtractBytes(data []byte, opts *Options, coefficient bool) (*ExtractReport, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	if err := CheckModulation(opts); err != nil {
+		return nil, err
+	}
+	format := ImageIO.DetectFormat(data)
+	if format == ImageIO.FormatUnknown {
+		return nil, fmt.Errorf("%w: unrecognised format", ErrInvalidImage)
+	}
+
+	report := &ExtractReport{}
+	var messages []string
+	switch {
+	case coefficient:
+		if format != ImageIO.FormatJPEG {
+			return nil, fmt.Errorf("%w: coefficient extraction needs a JPEG", ErrInvalidOptions)
+		}
+		_, Y, err := luminanceCoefficients(data)
+		if err != nil {
+			return nil, err
+		}
+		var authFailed int
+		if messages, authFailed, err = ExtractJPEGMessages(data, opts); err != nil {
+			return nil, err
+		}
+		report.AuthFailed = authFailed > 0
+		report.TileCount = (Y.Width / coefficientTileBlocks) * (Y.Height / coefficientTileBlocks)
+
+	case format == ImageIO.FormatGIF:
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+		}
+		seq := Extract_Watermark_GIF(g, opts)
+		report.Found, report.Message, report.AuthFailed = seq.Found, seq.Message, seq.AuthFailed
+		report.TileCount, report.Frames = seq.TileCount, seq.FrameCount
+		if seq.Found {
+			report.Confidence, report.Agreeing = 1, seq.TileCount
+		}
+		return report, nil
+
+	default:
+		img, _, meta, err := ImageIO.DecodeWithMetadata(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+		}
+		report.Tiles = ExtractTiles(ImageIO.AutoOrient(img, meta), opts)
+		for _, t := range report.Tiles {
+			if t.Found {
+				messages = append(messages, t.Message)
+			}
+			report.AuthFailed = report.AuthFailed || t.AuthFailed
+		}
+		report.TileCount = len(report.Tiles)
+	}
+
+	report.Message, report.Agreeing = MostCommonMessage(messages)
+	report.Found = report.Agreeing > 0
+	report.AuthFailed = report.AuthFailed && !report.Found
+	if report.TileCount > 0 {
+		report.Confidence = float64(report.Agreeing) / float64(report.TileCount)
+	}
+	return report, nil
+}
+
+// MostCommonMessage returns the message reported by the most tiles, ties
+// going to the one seen first so results are stable
+func MostCommonMessage(messages []string) (string, int) {
+	counts := make(map[string]int)
+	for _, m := range messages {
+		counts[m]++
+	}
+	best, bestCount := "", 0
+	for _, m := range messages {
+		if counts[m] > bestCount {
+			best, bestCount = m, counts[m]
+		}
+	}
+	return best, bestCount
+}
+
+// DetectBytes is Detect for an encoded still image. Animations and
+// coefficient marks have no flag statistics: they count as present when a
+// message decodes, and their PValue is 1.
+func DetectBytes(data []byte, opts *Options, coefficient bool) (*Detection, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	if err := CheckModulation(opts); err != nil {
+		return nil, err
+	}
+	format := ImageIO.DetectFormat(data)
+	if coefficient || format == ImageIO.FormatGIF {
+		r, err := ExtractBytes(data, opts, coefficient)
+		if err != nil {
+			return nil, err
+		}
+		return &Detection{Present: r.Found || r.AuthFailed, TileCount: r.TileCount, Message: r.Message, AuthFailed: r.AuthFailed, PValue: 1}, nil
+	}
+
+	img, _, meta, err := ImageIO.DecodeWithMetadata(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	return Detect(ImageIO.AutoOrient(img, meta), opts), nil
+}
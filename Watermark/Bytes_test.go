@@ -0,0 +1,21 @@
+package Watermark
+
+import "testing"
+
+func TestMostCommonMessage(t *testing.T) {
+	for _, c := range []struct {
+		messages []string
+		want     string
+		count    int
+	}{
+		{nil, "", 0},
+		{[]string{"a", "b", "b", "a", "b"}, "b", 3},
+		// Ties go to the message seen first
+		{[]string{"b", "a", "a", "b"}, "b", 2},
+		{[]string{"a", "b", "b", "a"}, "a", 2},
+	} {
+		if got, count := MostCommonMessage(c.messages); got != c.want || count != c.count {
+			t.Errorf("%q: %q in %d, want %q in %d", c.messages, got, count, c.want, c.count)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package Watermark
+
+import (
+	"InvisibleWaterMarkingSystem/ImageIO"
+	"fmt"
+)
+
+// A coefficient-domain tile is 16x16 luminance blocks (128x128 pixels), which
+// carries the same 512 bits as a 128x128 tile of the HL band
+const coefficientTileBlocks = 16
+
+// Natural-order indices of the mid-frequency pair used by PerformEmbedd: [1][3] and [3][1]
+var coefficientPositions = [2]int{1*8 + 3, 3*8 + 1}
+
+func coefficientStep(opts *Options) (float64, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	if opts.CoefficientStep <= 0 || opts.CoefficientStep%4 != 0 {
+		return 0, fmt.Errorf("%w: coefficient step must be a positive multiple of 4, got %d", ErrInvalidOptions, opts.CoefficientStep)
+	}
+	return float64(opts.CoefficientStep), nil
+}
+
+func luminanceCoefficients(data []byte) (*ImageIO.JPEGCoefficients, *ImageIO.JPEGComponent, error) {
+	jc, err := ImageIO.ReadJPEGCoefficients(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	Y := jc.Components[0]
+	if Y.Width < coefficientTileBlocks || Y.Height < coefficientTileBlocks {
+		return nil, nil, fmt.Errorf("%w: need at least %dx%d luminance blocks", ErrImageTooSmall, coefficientTileBlocks, coefficientTileBlocks)
+	}
+	return jc, Y, nil
+}
+
+// Embed_Watermark_JPEG embeds the message by QIM on the quantized luminance
+// coefficients of a baseline JPEG file. The entropy-coded data is rewritten
+// without decoding to pixels, so no generation loss is added.
+func Embed_Watermark_JPEG(data []byte, message string, opts *Options) ([]byte, error) {
+	step, err := coefficientStep(opts)
+	if err != nil {
+		return nil, err
+	}
+	jc, Y, err := luminanceCoefficients(data)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := payloadBits(message, opts)
+
+	numTilesY := Y.Height / coefficientTileBlocks
+	numTilesX := Y.Width / coefficientTileBlocks
+	fmt.Fprintf(Output, "Embedding in %d x %d = %d coefficient tiles\n", numTilesY, numTilesX, numTilesY*numTilesX)
+
+	order := orderFor(opts)
+	for i := 0; i < numTilesY; i++ {
+		for j := 0; j < numTilesX; j++ {
+			for bitIndex := 0; bitIndex < len(stream)-1 && bitIndex < tileCapacityBits; bitIndex += 2 {
+				idx := blockAt(order, bitIndex/2)
+				block := Y.Block(j*coefficientTileBlocks+idx%coefficientTileBlocks, i*coefficientTileBlocks+idx/coefficientTileBlocks)
+				for k, pos := range coefficientPositions {
+					block[pos] = int32(qimEmbed(float64(block[pos]), stream[bitIndex+k], step))
+				}
+			}
+		}
+	}
+
+	return jc.Encode()
+}
+
+// extractFromCoefficientTile reads 2 bits from every block of one tile
+func extractFromCoefficientTile(Y *ImageIO.JPEGComponent, tileX, tileY int, step float64, order []int) []int {
+	var extractedBits []int
+	for k := 0; k < coefficientTileBlocks*coefficientTileBlocks; k++ {
+		idx := blockAt(order, k)
+		block := Y.Block(tileX*coefficientTileBlocks+idx%coefficientTileBlocks, tileY*coefficientTileBlocks+idx/coefficientTileBlocks)
+		for _, pos := range coefficientPositions {
+			extractedBits = append(extractedBits, qimExtract(float64(block[pos]), step))
+		}
+	}
+	return extractedBits
+}
+
+// Extract_Watermark_JPEG reads the messages embedded by Embed_Watermark_JPEG
+// straight from the coefficients, one per tile where the flags are intact
+func Extract_Watermark_JPEG(data []byte, opts *Options) ([]string, error) {
+	messages, _, err := ExtractJPEGMessages(data, opts)
+	return messages, err
+}
+
+// ExtractJPEGMessages is Extract_Watermark_JPEG also counting the tiles whose
+// message was found but failed to open with the PayloadKey
+func ExtractJPEGMessages(data []byte, opts *Options) (messages []string, authFailed int, err error) {
+	step, err := coefficientStep(opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	_, Y, err := luminanceCoefficients(data)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	numTilesY := Y.Height / coefficientTileBlocks
+	numTilesX := Y.Width / coefficientTileBlocks
+	fmt.Fprintf(Output, "Processing %d x %d = %d coefficient tiles\n", numTilesY, numTilesX, numTilesY*numTilesX)
+
+	order := orderFor(opts)
+	for i := 0; i < numTilesY; i++ {
+		for j := 0; j < numTilesX; j++ {
+			message, found, failed := readPayload(extractFromCoefficientTile(Y, j, i, step, order), opts)
+			if found {
+				messages = append(messages, message)
+			} else if failed {
+				authFailed++
+			}
+		}
+	}
+	return messages, authFailed, nil
+}
+
+// ExtractSingleMessageJPEG is ExtractSingleMessage for the coefficient-domain mark
+func ExtractSingleMessageJPEG(data []byte, opts *Options) (string, error) {
+	messages, authFailed, err := ExtractJPEGMessages(data, opts)
+	if err != nil {
+		return "", err
+	}
+	return selectMessage(messages, authFailed)
+}
@@ -0,0 +1,73 @@
+package Watermark
+
+import (
+	"bytes"
+	"image/jpeg"
+	"testing"
+)
+
+func encodeJPEG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(width, height), &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCoefficientRoundTrip(t *testing.T) {
+	const message = "Hello World"
+	opts := DefaultOptions()
+	keyed := DefaultOptions()
+	keyed.Key = "k"
+	for name, c := range map[string]struct {
+		width, height, tiles int
+		opts                 *Options
+	}{
+		"aligned":     {512, 384, 12, opts},
+		"partial MCU": {301, 203, 2, opts},
+		"keyed":       {301, 203, 2, keyed},
+	} {
+		data := encodeJPEG(t, c.width, c.height)
+		if messages, err := Extract_Watermark_JPEG(data, c.opts); err != nil || len(messages) != 0 {
+			t.Errorf("%s: unmarked file gives %q, %v", name, messages, err)
+		}
+
+		marked, err := Embed_Watermark_JPEG(data, message, c.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		img, err := jpeg.Decode(bytes.NewReader(marked))
+		if err != nil {
+			t.Fatalf("%s: marked file does not decode: %v", name, err)
+		}
+		if b := img.Bounds(); b.Dx() != c.width || b.Dy() != c.height {
+			t.Errorf("%s: marked file is %dx%d", name, b.Dx(), b.Dy())
+		}
+
+		messages, err := Extract_Watermark_JPEG(marked, c.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(messages) != c.tiles {
+			t.Errorf("%s: %d of %d tiles found", name, len(messages), c.tiles)
+		}
+		for _, m := range messages {
+			if m != message {
+				t.Errorf("%s: tile reads %q", name, m)
+			}
+		}
+	}
+}
+
+func TestCoefficientNeedsTheKey(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Key = "k"
+	marked, err := Embed_Watermark_JPEG(encodeJPEG(t, 301, 203), "Hello World", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ExtractSingleMessageJPEG(marked, DefaultOptions()); err == nil {
+		t.Error("message read without the key")
+	}
+}
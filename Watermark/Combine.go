@@ -0,0 +1,49 @@
+package Watermark
+
+// bitVotes accumulates per-position counts of extracted bits
+type bitVotes struct {
+	ones   []int
+	counts []int
+}
+
+func (v *bitVotes) add(bits []int) {
+	for len(v.counts) < len(bits) {
+		v.ones = append(v.ones, 0)
+		v.counts = append(v.counts, 0)
+	}
+	for i, bit := range bits {
+		v.ones[i] += bit
+		v.counts[i]++
+	}
+}
+
+// result returns the majority bit per position; ties resolve to 0
+func (v *bitVotes) result() []int {
+	voted := make([]int, len(v.counts))
+	for i := range voted {
+		if 2*v.ones[i] > v.counts[i] {
+			voted[i] = 1
+		}
+	}
+	return voted
+}
+
+// voteBits combines several extractions of the same bit stream by majority
+// vote per position. Streams may differ in length.
+func voteBits(streams [][]int) []int {
+	var v bitVotes
+	for _, s := range streams {
+		v.add(s)
+	}
+	return v.result()
+}
+
+// SequenceResult reports extraction from a multi-frame source (animation or video)
+type SequenceResult struct {
+	Message     string   // decoded from the bits voted across every tile of every frame
+	Found       bool     // whether the combined bits contained a valid message
+	AuthFailed  bool     // a message was found but its encrypted payload did not open
+	FrameCount  int      // frames examined
+	TileCount   int      // tiles that contributed votes
+	FrameResult []string // per-frame message, "" where a frame alone was not decodable
+}
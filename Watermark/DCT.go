@@ -77,17 +77,23 @@ func dct2D(block [][]float64) [][]float64 {
 	return result
 }
 
+// defaultStrength is the QIM step used by the DWT-DCT pixel pipeline
+const defaultStrength = 10.0
+
 // PerformEmbedd modifies the block in-place by embedding watermark bits
 func PerformEmbedd(block [][]float64, bits []int) {
 	// Use alpha = 10.0 for stronger watermark
-	alpha := 10.0
+	embedBlockBits(block, bits, defaultStrength, QIM{}, 0)
+}
 
+// embedBlockBits is PerformEmbedd with an explicit step and modulator, for
+// the block with raster index k in its tile
+func embedBlockBits(block [][]float64, bits []int, alpha float64, m Modulator, k int) {
 	// Perform DCT
 	dctBlock := dct2D(block)
 
 	// Embed watermark in mid-frequency coefficients
-	dctBlock[1][3] = qimEmbed(dctBlock[1][3], bits[0], alpha)
-	dctBlock[3][1] = qimEmbed(dctBlock[3][1], bits[1], alpha)
+	m.Embed(dctBlock, bits, alpha, k)
 
 	// Perform IDCT and copy back to original block
 	idctBlock := idct2D(dctBlock)
@@ -98,14 +104,11 @@ func PerformEmbedd(block [][]float64, bits []int) {
 
 func PerformExtract(block [][]float64) []int {
 	// Must match the alpha used in PerformEmbedd
-	alpha := 10.0
-
-	dctBlock := dct2D(block)
-
-	bits := make([]int, 2)
-
-	bits[0] = qimExtract(dctBlock[1][3], alpha)
-	bits[1] = qimExtract(dctBlock[3][1], alpha)
+	return extractBlockBits(block, defaultStrength, QIM{}, 0)
+}
 
-	return bits
+// extractBlockBits is PerformExtract with an explicit step and modulator, for
+// the block with raster index k in its tile
+func extractBlockBits(block [][]float64, alpha float64, m Modulator, k int) []int {
+	return m.Extract(dct2D(block), alpha, k)
 }
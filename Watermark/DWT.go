@@ -126,7 +126,7 @@ func PerformCompleteDWT(Ymatrix [][]float64) *DWTResult {
 	wg.Wait()
 
 	t2 := time.Now()
-	fmt.Printf("DWT completed in %v\n", t2.Sub(t1))
+	fmt.Fprintf(Output, "DWT completed in %v\n", t2.Sub(t1))
 
 	return &DWTResult{
 		LL: LL,
@@ -156,12 +156,12 @@ func GetStatistics(matrix [][]float64, name string) {
 		}
 	}
 
-	fmt.Printf("%s - Min: %.4f, Max: %.4f, Range: %.4f\n", name, min, max, max-min)
+	fmt.Fprintf(Output, "%s - Min: %.4f, Max: %.4f, Range: %.4f\n", name, min, max, max-min)
 }
 
 // PrintDWTStatistics prints statistics for all DWT components
 func PrintDWTStatistics(result *DWTResult) {
-	fmt.Println("\n=== DWT Component Statistics ===")
+	fmt.Fprintln(Output, "\n=== DWT Component Statistics ===")
 	GetStatistics(result.LL, "LL (Approximation)")
 	GetStatistics(result.LH, "LH (Horizontal)")
 	GetStatistics(result.HL, "HL (Vertical)")
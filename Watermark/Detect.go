@@ -0,0 +1,159 @@
+package Watermark
+
+import (
+	"image"
+	"math"
+)
+
+// MaxMessageBytes is the longest message a single tile holds: the tile
+// capacity less the 16-bit start and end flags
+const MaxMessageBytes = (tileCapacityBits - 32) / 8
+
+// CapacityInfo describes how much an image of a given size can carry
+type CapacityInfo struct {
+	Width, Height   int
+	TilesX, TilesY  int // 128x128 tiles of the HL band, which is half the image size
+	BitsPerTile     int
+	MaxMessageBytes int // 0 when the image is too small for a single tile
+}
+
+// Tiles returns the number of tiles carrying a copy of the message
+func (c CapacityInfo) Tiles() int {
+	return c.TilesX * c.TilesY
+}
+
+// Capacity reports the tiling of a width x height image
+func Capacity(width, height int) CapacityInfo {
+	c := CapacityInfo{
+		Width:       width,
+		Height:      height,
+		TilesX:      width / 2 / 128,
+		TilesY:      height / 2 / 128,
+		BitsPerTile: tileCapacityBits,
+	}
+	if c.Tiles() > 0 {
+		c.MaxMessageBytes = MaxMessageBytes
+	}
+	return c
+}
+
+// Detection is the result of looking for a watermark without knowing the message
+type Detection struct {
+	Present    bool
+	TileCount  int    // tiles examined
+	FlagTiles  int    // tiles whose leading bits match the start flag exactly
+	Message    string // decoded from the bits voted across all tiles, if possible
+	AuthFailed bool   // a message was decoded but its encrypted payload did not open
+
+	// Present rests on PValue alone. A decoded Message is reported but is
+	// no evidence by itself: the flags are searched for anywhere in the
+	// voted bits, so noise decodes to some message far more often than a
+	// strict FalsePositiveRate allows.
+
+	// FlagBits is the number of start-flag bits tested, 8 per tile, and
+	// FlagMatches how many of them equal the flag
+	FlagBits    int
+	FlagMatches int
+
+	// PValue is the chance of FlagMatches or more matches in an unmarked
+	// image, where each bit matches with probability 1/2. It is 1 when no
+	// flag bits were read.
+	PValue float64
+
+	// Threshold is the FalsePositiveRate PValue was compared with
+	Threshold float64
+
+	// Alignment is the tile grid found in a cropped copy when opts.Align is
+	// set, nil when none was found or none was looked for
+	Alignment *Alignment
+
+	// Gain is the change of contrast found when opts.EstimateGain is set, 0
+	// when none was found or none was looked for
+	Gain float64
+}
+
+// Detect reports whether img carries a watermark embedded with the strength
+// and key in opts. The start flag at the head of every tile is compared with
+// the bits read there; in an unmarked image each matches by chance with
+// probability 1/2, so the number of matches is binomial and its upper tail is
+// the p-value. The two bits of a block are correlated in flat areas, which
+// would make that tail too thin, so only the first bit of each block counts.
+// The mark is present when the p-value is at most opts.FalsePositiveRate; a
+// message is decoded from the voted bits either way.
+func Detect(img image.Image, opts *Options) *Detection {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+
+	d := &Detection{Threshold: opts.FalsePositiveRate}
+	img, opts = synchronized(img, opts)
+	if opts.Align {
+		img, d.Alignment = aligned(img, opts)
+	}
+	if opts.EstimateGain {
+		opts, d.Gain = gained(img, opts)
+	}
+
+	_, Ymatrix := ConvertToYC(img)
+	tiles := extractTileBits(Ymatrix, codingFor(opts, opts.Strength))
+	startFlag := BuildWatermarkBits("")[:16]
+
+	d.TileCount = len(tiles)
+	for _, bits := range tiles {
+		match := true
+		for i, bit := range startFlag {
+			if bits[i] != bit {
+				match = false
+			} else if i%2 == 0 {
+				d.FlagMatches++
+			}
+		}
+		if match {
+			d.FlagTiles++
+		}
+		d.FlagBits += len(startFlag) / 2
+	}
+	d.PValue = binomialTail(d.FlagBits, d.FlagMatches)
+	if d.Alignment != nil {
+		// The offset was chosen for its flags, so correct for the others tried
+		d.PValue = min(1, alignOffsets*d.PValue)
+	}
+	if d.Gain != 0 {
+		// Likewise for the gains tried
+		d.PValue = min(1, gainCandidates*d.PValue)
+	}
+
+	d.Present = d.PValue <= opts.FalsePositiveRate
+	d.Message, _, d.AuthFailed = readPayload(voteBits(tiles), opts)
+	return d
+}
+
+// binomialTail is P(X >= k) for X ~ Binomial(n, 1/2)
+func binomialTail(n, k int) float64 {
+	return math.Exp(logBinomialTail(n, k))
+}
+
+// logBinomialTail is the natural log of binomialTail, summed in log space so
+// that large n neither overflows the binomial coefficients nor loses the
+// tail, and finite where the tail itself underflows
+func logBinomialTail(n, k int) float64 {
+	if k <= 0 {
+		return 0
+	}
+	if k > n {
+		return math.Inf(-1)
+	}
+	lgn, _ := math.Lgamma(float64(n + 1))
+	logTerm := func(j int) float64 {
+		a, _ := math.Lgamma(float64(j + 1))
+		b, _ := math.Lgamma(float64(n - j + 1))
+		return lgn - a - b - float64(n)*math.Ln2
+	}
+	// The largest term is at j = k, or at n/2 when k is below it
+	peak := logTerm(max(k, n/2))
+	var sum float64
+	for j := k; j <= n; j++ {
+		sum += math.Exp(logTerm(j) - peak)
+	}
+	return min(0, peak+math.Log(sum))
+}
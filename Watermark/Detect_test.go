@@ -0,0 +1,83 @@
+package Watermark
+
+import (
+	"image"
+	"image/color"
+	"math/rand/v2"
+	"testing"
+)
+
+// noiseImage is an unmarked image of independent grey noise around a gradient
+func noiseImage(width, height int, seed uint64) *image.RGBA {
+	rng := rand.New(rand.NewPCG(seed, seed+1))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8(60 + 120*x/width + rng.IntN(40))
+			img.SetRGBA(x, y, color.RGBA{R: v, G: v, B: v, A: 0xFF})
+		}
+	}
+	return img
+}
+
+func TestDetectUnmarked(t *testing.T) {
+	opts := DefaultOptions()
+	opts.FalsePositiveRate = 1e-9
+	small := 0
+	for seed := uint64(1); seed <= 20; seed++ {
+		d := Detect(noiseImage(512, 512, seed), opts)
+		if d.Present {
+			t.Errorf("seed %d: unmarked image detected, p-value %g, message %q", seed, d.PValue, d.Message)
+		}
+		if d.FlagBits != 4*8 || d.PValue <= 0 || d.PValue > 1 {
+			t.Errorf("seed %d: %d flag bits, p-value %g", seed, d.FlagBits, d.PValue)
+		}
+		if d.PValue <= 0.05 {
+			small++
+		}
+	}
+	// p-values of unmarked images are roughly uniform; 20 draws put more
+	// than 5 at or below 0.05 with probability under 0.1%
+	if small > 5 {
+		t.Errorf("%d of 20 unmarked images have a p-value at most 0.05", small)
+	}
+}
+
+func TestDetectMarked(t *testing.T) {
+	opts := DefaultOptions()
+	opts.FalsePositiveRate = 1e-9
+	marked := EmbedWithOptions(testImage(1024, 768), "Hello World", opts)
+	d := Detect(marked, opts)
+	if !d.Present || d.Message != "Hello World" {
+		t.Errorf("marked image: present %v, message %q", d.Present, d.Message)
+	}
+	// 12 tiles of 8 first flag bits, all matching
+	if d.FlagBits != 96 || d.FlagMatches != 96 || d.PValue != binomialTail(96, 96) {
+		t.Errorf("marked image: %d of %d flag bits match, p-value %g", d.FlagMatches, d.FlagBits, d.PValue)
+	}
+
+	// A wrong key reads noise in place of the flags
+	wrong := DefaultOptions()
+	wrong.Key = "not the key"
+	if d := Detect(marked, wrong); d.Present || d.PValue < 1e-3 {
+		t.Errorf("wrong key: present %v, p-value %g", d.Present, d.PValue)
+	}
+}
+
+func TestDetectIgnoresDecodedMessage(t *testing.T) {
+	// A message whose flags sit away from the head of the tile decodes, as
+	// one in noise can, but leaves the start flag unmatched
+	stream := append(BuildWatermarkBits("")[16:], BuildWatermarkBits("x")...)
+	chunks, err := temporalChunks(stream, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := DefaultOptions()
+	d := Detect(embedChunks(testImage(512, 512), chunks, opts), opts)
+	if d.Message != "x" {
+		t.Fatalf("message %q not decoded", d.Message)
+	}
+	if d.Present || d.FlagMatches != 0 || d.PValue != 1 {
+		t.Errorf("present %v with %d flag matches, p-value %g", d.Present, d.FlagMatches, d.PValue)
+	}
+}
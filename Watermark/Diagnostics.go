@@ -11,7 +11,7 @@ import (
 
 // CheckWatermarkInYMatrix checks if watermark exists in Y matrix after IDWT
 func CheckWatermarkInYMatrix(Ymatrix [][]float64, message string) {
-	fmt.Println("\n=== Checking Watermark in Y Matrix (After IDWT) ===")
+	fmt.Fprintln(Output, "\n=== Checking Watermark in Y Matrix (After IDWT) ===")
 
 	stream := BuildWatermarkBits(message)
 
@@ -24,9 +24,9 @@ func CheckWatermarkInYMatrix(Ymatrix [][]float64, message string) {
 	numTilesY := int(math.Floor(float64(h) / 128))
 	numTilesX := int(math.Floor(float64(w) / 128))
 
-	fmt.Printf("HL band size: %dx%d\n", w, h)
-	fmt.Printf("Number of tiles: %dx%d = %d\n", numTilesX, numTilesY, numTilesX*numTilesY)
-	fmt.Printf("Expected watermark bits: %d\n\n", len(stream))
+	fmt.Fprintf(Output, "HL band size: %dx%d\n", w, h)
+	fmt.Fprintf(Output, "Number of tiles: %dx%d = %d\n", numTilesX, numTilesY, numTilesX*numTilesY)
+	fmt.Fprintf(Output, "Expected watermark bits: %d\n\n", len(stream))
 
 	tilesWithWatermark := 0
 
@@ -42,32 +42,32 @@ func CheckWatermarkInYMatrix(Ymatrix [][]float64, message string) {
 
 			if found {
 				tilesWithWatermark++
-				fmt.Printf("  Tile [%d,%d]: ✓ Message found: \"%s\"\n", i, j, extractedMsg)
+				fmt.Fprintf(Output, "  Tile [%d,%d]: ✓ Message found: \"%s\"\n", i, j, extractedMsg)
 			} else {
-				fmt.Printf("  Tile [%d,%d]: ✗ No valid message\n", i, j)
+				fmt.Fprintf(Output, "  Tile [%d,%d]: ✗ No valid message\n", i, j)
 				// Show first 64 bits for debugging
-				fmt.Print("    First 64 bits: ")
+				fmt.Fprint(Output, "    First 64 bits: ")
 				for k := 0; k < 64 && k < len(extractedBits); k++ {
-					fmt.Printf("%d", extractedBits[k])
+					fmt.Fprintf(Output, "%d", extractedBits[k])
 					if (k+1)%8 == 0 {
-						fmt.Print(" ")
+						fmt.Fprint(Output, " ")
 					}
 				}
-				fmt.Println()
+				fmt.Fprintln(Output)
 			}
 		}
 	}
 
-	fmt.Printf("\nSummary: %d/%d tiles contain valid watermark\n", tilesWithWatermark, numTilesX*numTilesY)
+	fmt.Fprintf(Output, "\nSummary: %d/%d tiles contain valid watermark\n", tilesWithWatermark, numTilesX*numTilesY)
 
 	if tilesWithWatermark == 0 {
-		fmt.Println("⚠️  WARNING: No watermark found in Y matrix after IDWT!")
-		fmt.Println("   Problem is likely in: DWT → Embed → IDWT pipeline")
+		fmt.Fprintln(Output, "⚠️  WARNING: No watermark found in Y matrix after IDWT!")
+		fmt.Fprintln(Output, "   Problem is likely in: DWT → Embed → IDWT pipeline")
 	} else if tilesWithWatermark < numTilesX*numTilesY {
-		fmt.Println("⚠️  WARNING: Watermark found in some but not all tiles")
-		fmt.Println("   Problem might be in: Tile iteration during embedding")
+		fmt.Fprintln(Output, "⚠️  WARNING: Watermark found in some but not all tiles")
+		fmt.Fprintln(Output, "   Problem might be in: Tile iteration during embedding")
 	} else {
-		fmt.Println("✓ SUCCESS: Watermark found in all tiles!")
+		fmt.Fprintln(Output, "✓ SUCCESS: Watermark found in all tiles!")
 	}
 }
 
@@ -94,41 +94,41 @@ func extractBitsFromTile(tile [][]float64) []int {
 
 // CheckWatermarkInTile checks if watermark exists in a tile (HL band)
 func CheckWatermarkInTile(tile [][]float64, expectedMessage string) {
-	fmt.Println("\n=== Checking Watermark in Single Tile ===")
+	fmt.Fprintln(Output, "\n=== Checking Watermark in Single Tile ===")
 
 	stream := BuildWatermarkBits(expectedMessage)
-	fmt.Printf("Expected message: \"%s\"\n", expectedMessage)
-	fmt.Printf("Expected bit stream length: %d bits\n", len(stream))
+	fmt.Fprintf(Output, "Expected message: \"%s\"\n", expectedMessage)
+	fmt.Fprintf(Output, "Expected bit stream length: %d bits\n", len(stream))
 
 	// Extract bits from tile
 	extractedBits := extractBitsFromTile(tile)
-	fmt.Printf("Extracted bits from tile: %d bits\n", len(extractedBits))
+	fmt.Fprintf(Output, "Extracted bits from tile: %d bits\n", len(extractedBits))
 
 	// Show first 128 bits
-	fmt.Println("\nFirst 128 extracted bits:")
+	fmt.Fprintln(Output, "\nFirst 128 extracted bits:")
 	for i := 0; i < 128 && i < len(extractedBits); i++ {
-		fmt.Printf("%d", extractedBits[i])
+		fmt.Fprintf(Output, "%d", extractedBits[i])
 		if (i+1)%8 == 0 {
-			fmt.Print(" ")
+			fmt.Fprint(Output, " ")
 		}
 		if (i+1)%32 == 0 {
-			fmt.Println()
+			fmt.Fprintln(Output)
 		}
 	}
-	fmt.Println()
+	fmt.Fprintln(Output)
 
 	// Show expected bits
-	fmt.Println("\nExpected bit stream (first 128 bits):")
+	fmt.Fprintln(Output, "\nExpected bit stream (first 128 bits):")
 	for i := 0; i < 128 && i < len(stream); i++ {
-		fmt.Printf("%d", stream[i])
+		fmt.Fprintf(Output, "%d", stream[i])
 		if (i+1)%8 == 0 {
-			fmt.Print(" ")
+			fmt.Fprint(Output, " ")
 		}
 		if (i+1)%32 == 0 {
-			fmt.Println()
+			fmt.Fprintln(Output)
 		}
 	}
-	fmt.Println()
+	fmt.Fprintln(Output)
 
 	// Compare bit by bit
 	matchCount := 0
@@ -147,20 +147,20 @@ func CheckWatermarkInTile(tile [][]float64, expectedMessage string) {
 	}
 
 	accuracy := float64(matchCount) / float64(compareLength) * 100.0
-	fmt.Printf("\nBit accuracy: %d/%d (%.2f%%)\n", matchCount, compareLength, accuracy)
+	fmt.Fprintf(Output, "\nBit accuracy: %d/%d (%.2f%%)\n", matchCount, compareLength, accuracy)
 
 	// Try to extract message
 	extractedMsg, found := findMessage(extractedBits)
 
 	if found {
-		fmt.Printf("\n✓ Message extracted: \"%s\"\n", extractedMsg)
+		fmt.Fprintf(Output, "\n✓ Message extracted: \"%s\"\n", extractedMsg)
 		if extractedMsg == expectedMessage {
-			fmt.Println("✓ SUCCESS: Extracted message matches expected!")
+			fmt.Fprintln(Output, "✓ SUCCESS: Extracted message matches expected!")
 		} else {
-			fmt.Printf("✗ MISMATCH: Expected \"%s\", got \"%s\"\n", expectedMessage, extractedMsg)
+			fmt.Fprintf(Output, "✗ MISMATCH: Expected \"%s\", got \"%s\"\n", expectedMessage, extractedMsg)
 		}
 	} else {
-		fmt.Println("\n✗ FAILED: Could not extract valid message (flags not found)")
+		fmt.Fprintln(Output, "\n✗ FAILED: Could not extract valid message (flags not found)")
 
 		// Detailed flag analysis
 		analyzeFlags(extractedBits, stream)
@@ -178,10 +178,10 @@ func analyzeFlags(extractedBits []int, expectedBits []int) {
 		0, 0, 0, 0, 1, 1, 1, 1,
 	}
 
-	fmt.Println("\n--- Flag Analysis ---")
+	fmt.Fprintln(Output, "\n--- Flag Analysis ---")
 
 	// Check start flag in extracted bits
-	fmt.Print("Start flag in extracted: ")
+	fmt.Fprint(Output, "Start flag in extracted: ")
 	startFound := false
 	for i := 0; i <= len(extractedBits)-len(startFlag); i++ {
 		match := true
@@ -192,27 +192,27 @@ func analyzeFlags(extractedBits []int, expectedBits []int) {
 			}
 		}
 		if match {
-			fmt.Printf("Found at position %d ✓\n", i)
+			fmt.Fprintf(Output, "Found at position %d ✓\n", i)
 			startFound = true
 			break
 		}
 	}
 	if !startFound {
-		fmt.Println("NOT FOUND ✗")
+		fmt.Fprintln(Output, "NOT FOUND ✗")
 		// Show where it should be
-		fmt.Print("  Expected at position 0: ")
+		fmt.Fprint(Output, "  Expected at position 0: ")
 		for i := 0; i < len(startFlag) && i < len(extractedBits); i++ {
 			if extractedBits[i] == startFlag[i] {
-				fmt.Printf("\033[32m%d\033[0m", extractedBits[i])
+				fmt.Fprintf(Output, "\033[32m%d\033[0m", extractedBits[i])
 			} else {
-				fmt.Printf("\033[31m%d\033[0m", extractedBits[i])
+				fmt.Fprintf(Output, "\033[31m%d\033[0m", extractedBits[i])
 			}
 		}
-		fmt.Println()
+		fmt.Fprintln(Output)
 	}
 
 	// Check end flag
-	fmt.Print("End flag in extracted: ")
+	fmt.Fprint(Output, "End flag in extracted: ")
 	endFound := false
 	expectedEndPos := len(expectedBits) - len(endFlag)
 	for i := 0; i <= len(extractedBits)-len(endFlag); i++ {
@@ -224,18 +224,18 @@ func analyzeFlags(extractedBits []int, expectedBits []int) {
 			}
 		}
 		if match {
-			fmt.Printf("Found at position %d", i)
+			fmt.Fprintf(Output, "Found at position %d", i)
 			if i == expectedEndPos {
-				fmt.Println(" (correct position) ✓")
+				fmt.Fprintln(Output, " (correct position) ✓")
 			} else {
-				fmt.Printf(" (expected at %d) ⚠️\n", expectedEndPos)
+				fmt.Fprintf(Output, " (expected at %d) ⚠️\n", expectedEndPos)
 			}
 			endFound = true
 			break
 		}
 	}
 	if !endFound {
-		fmt.Println("NOT FOUND ✗")
+		fmt.Fprintln(Output, "NOT FOUND ✗")
 	}
 }
 
@@ -245,28 +245,28 @@ func analyzeFlags(extractedBits []int, expectedBits []int) {
 
 // CheckWatermarkInBlock checks if watermark bits are preserved in a single 8x8 block
 func CheckWatermarkInBlock(block [][]float64, bit0 int, bit1 int) {
-	fmt.Println("\n=== Checking Watermark in 8x8 Block (After IDCT) ===")
+	fmt.Fprintln(Output, "\n=== Checking Watermark in 8x8 Block (After IDCT) ===")
 
-	fmt.Printf("Expected bits to embed: [%d, %d]\n", bit0, bit1)
+	fmt.Fprintf(Output, "Expected bits to embed: [%d, %d]\n", bit0, bit1)
 
 	// First, show the block values
-	fmt.Println("\nBlock values (spatial domain):")
+	fmt.Fprintln(Output, "\nBlock values (spatial domain):")
 	for i := 0; i < 8; i++ {
 		for j := 0; j < 8; j++ {
-			fmt.Printf("%7.2f ", block[i][j])
+			fmt.Fprintf(Output, "%7.2f ", block[i][j])
 		}
-		fmt.Println()
+		fmt.Fprintln(Output)
 	}
 
 	// Perform DCT
 	dctBlock := dct2D(block)
 
-	fmt.Println("\nDCT coefficients:")
+	fmt.Fprintln(Output, "\nDCT coefficients:")
 	for i := 0; i < 8; i++ {
 		for j := 0; j < 8; j++ {
-			fmt.Printf("%7.2f ", dctBlock[i][j])
+			fmt.Fprintf(Output, "%7.2f ", dctBlock[i][j])
 		}
-		fmt.Println()
+		fmt.Fprintln(Output)
 	}
 
 	// Extract bits
@@ -274,21 +274,21 @@ func CheckWatermarkInBlock(block [][]float64, bit0 int, bit1 int) {
 	extractedBit0 := qimExtract(dctBlock[1][3], alpha)
 	extractedBit1 := qimExtract(dctBlock[3][1], alpha)
 
-	fmt.Printf("\nWatermark coefficients:\n")
-	fmt.Printf("  Position [1][3]: %.4f\n", dctBlock[1][3])
-	fmt.Printf("  Position [3][1]: %.4f\n", dctBlock[3][1])
+	fmt.Fprintf(Output, "\nWatermark coefficients:\n")
+	fmt.Fprintf(Output, "  Position [1][3]: %.4f\n", dctBlock[1][3])
+	fmt.Fprintf(Output, "  Position [3][1]: %.4f\n", dctBlock[3][1])
 
-	fmt.Printf("\nExtracted bits: [%d, %d]\n", extractedBit0, extractedBit1)
+	fmt.Fprintf(Output, "\nExtracted bits: [%d, %d]\n", extractedBit0, extractedBit1)
 
 	if extractedBit0 == bit0 && extractedBit1 == bit1 {
-		fmt.Println("✓ SUCCESS: Watermark bits correctly preserved!")
+		fmt.Fprintln(Output, "✓ SUCCESS: Watermark bits correctly preserved!")
 	} else {
-		fmt.Println("✗ FAILED: Watermark bits lost or corrupted!")
-		fmt.Printf("  Expected: [%d, %d]\n", bit0, bit1)
-		fmt.Printf("  Got:      [%d, %d]\n", extractedBit0, extractedBit1)
+		fmt.Fprintln(Output, "✗ FAILED: Watermark bits lost or corrupted!")
+		fmt.Fprintf(Output, "  Expected: [%d, %d]\n", bit0, bit1)
+		fmt.Fprintf(Output, "  Got:      [%d, %d]\n", extractedBit0, extractedBit1)
 
 		// Detailed QIM analysis
-		fmt.Println("\nQIM Analysis:")
+		fmt.Fprintln(Output, "\nQIM Analysis:")
 		analyzeQIM(dctBlock[1][3], bit0, alpha, "[1][3]")
 		analyzeQIM(dctBlock[3][1], bit1, alpha, "[3][1]")
 	}
@@ -296,36 +296,36 @@ func CheckWatermarkInBlock(block [][]float64, bit0 int, bit1 int) {
 
 // analyzeQIM analyzes QIM quantization for a coefficient
 func analyzeQIM(coefficient float64, expectedBit int, delta float64, position string) {
-	fmt.Printf("\n  Position %s:\n", position)
-	fmt.Printf("    Coefficient value: %.4f\n", coefficient)
-	fmt.Printf("    Delta (alpha): %.4f\n", delta)
+	fmt.Fprintf(Output, "\n  Position %s:\n", position)
+	fmt.Fprintf(Output, "    Coefficient value: %.4f\n", coefficient)
+	fmt.Fprintf(Output, "    Delta (alpha): %.4f\n", delta)
 
 	base := math.Floor(coefficient/delta) * delta
-	fmt.Printf("    Quantization base: %.4f\n", base)
+	fmt.Fprintf(Output, "    Quantization base: %.4f\n", base)
 
 	remainder := math.Mod(coefficient, delta)
-	fmt.Printf("    Remainder: %.4f\n", remainder)
+	fmt.Fprintf(Output, "    Remainder: %.4f\n", remainder)
 
 	extractedBit := 0
 	if remainder >= delta/2 {
 		extractedBit = 1
 	}
 
-	fmt.Printf("    Expected bit: %d\n", expectedBit)
-	fmt.Printf("    Extracted bit: %d\n", extractedBit)
+	fmt.Fprintf(Output, "    Expected bit: %d\n", expectedBit)
+	fmt.Fprintf(Output, "    Extracted bit: %d\n", extractedBit)
 
 	if expectedBit == 0 {
 		expectedRange := fmt.Sprintf("[%.2f, %.2f)", base, base+delta/2)
-		fmt.Printf("    Expected range for bit 0: %s\n", expectedRange)
+		fmt.Fprintf(Output, "    Expected range for bit 0: %s\n", expectedRange)
 	} else {
 		expectedRange := fmt.Sprintf("[%.2f, %.2f)", base+delta/2, base+delta)
-		fmt.Printf("    Expected range for bit 1: %s\n", expectedRange)
+		fmt.Fprintf(Output, "    Expected range for bit 1: %s\n", expectedRange)
 	}
 
 	if extractedBit == expectedBit {
-		fmt.Println("    ✓ Bit correctly preserved")
+		fmt.Fprintln(Output, "    ✓ Bit correctly preserved")
 	} else {
-		fmt.Println("    ✗ Bit corrupted")
+		fmt.Fprintln(Output, "    ✗ Bit corrupted")
 	}
 }
 
@@ -335,23 +335,23 @@ func analyzeQIM(coefficient float64, expectedBit int, delta float64, position st
 
 // TraceWatermarkPipeline traces watermark through entire pipeline
 func TraceWatermarkPipeline(originalBlock [][]float64, bit0 int, bit1 int) {
-	fmt.Println("\n=== Tracing Watermark Through Pipeline ===")
+	fmt.Fprintln(Output, "\n=== Tracing Watermark Through Pipeline ===")
 
 	alpha := 10.0
 
 	// Step 1: Original block
-	fmt.Println("\n[Step 1] Original 8x8 block (spatial domain)")
-	fmt.Printf("First row: ")
+	fmt.Fprintln(Output, "\n[Step 1] Original 8x8 block (spatial domain)")
+	fmt.Fprintf(Output, "First row: ")
 	for j := 0; j < 8; j++ {
-		fmt.Printf("%.2f ", originalBlock[0][j])
+		fmt.Fprintf(Output, "%.2f ", originalBlock[0][j])
 	}
-	fmt.Println()
+	fmt.Fprintln(Output)
 
 	// Step 2: DCT
 	dctBlock := dct2D(originalBlock)
-	fmt.Println("\n[Step 2] After DCT (frequency domain)")
-	fmt.Printf("Coefficient [1][3] = %.4f\n", dctBlock[1][3])
-	fmt.Printf("Coefficient [3][1] = %.4f\n", dctBlock[3][1])
+	fmt.Fprintln(Output, "\n[Step 2] After DCT (frequency domain)")
+	fmt.Fprintf(Output, "Coefficient [1][3] = %.4f\n", dctBlock[1][3])
+	fmt.Fprintf(Output, "Coefficient [3][1] = %.4f\n", dctBlock[3][1])
 
 	// Step 3: Embed watermark
 	embeddedBlock := make([][]float64, 8)
@@ -363,38 +363,38 @@ func TraceWatermarkPipeline(originalBlock [][]float64, bit0 int, bit1 int) {
 	embeddedBlock[1][3] = qimEmbed(dctBlock[1][3], bit0, alpha)
 	embeddedBlock[3][1] = qimEmbed(dctBlock[3][1], bit1, alpha)
 
-	fmt.Println("\n[Step 3] After QIM embedding")
-	fmt.Printf("Coefficient [1][3] = %.4f (was %.4f, embedded bit %d)\n",
+	fmt.Fprintln(Output, "\n[Step 3] After QIM embedding")
+	fmt.Fprintf(Output, "Coefficient [1][3] = %.4f (was %.4f, embedded bit %d)\n",
 		embeddedBlock[1][3], dctBlock[1][3], bit0)
-	fmt.Printf("Coefficient [3][1] = %.4f (was %.4f, embedded bit %d)\n",
+	fmt.Fprintf(Output, "Coefficient [3][1] = %.4f (was %.4f, embedded bit %d)\n",
 		embeddedBlock[3][1], dctBlock[3][1], bit1)
 
 	// Step 4: IDCT
 	spatialBlock := idct2D(embeddedBlock)
-	fmt.Println("\n[Step 4] After IDCT (back to spatial domain)")
-	fmt.Printf("First row: ")
+	fmt.Fprintln(Output, "\n[Step 4] After IDCT (back to spatial domain)")
+	fmt.Fprintf(Output, "First row: ")
 	for j := 0; j < 8; j++ {
-		fmt.Printf("%.2f ", spatialBlock[0][j])
+		fmt.Fprintf(Output, "%.2f ", spatialBlock[0][j])
 	}
-	fmt.Println()
+	fmt.Fprintln(Output)
 
 	// Step 5: Extract
 	extractDCT := dct2D(spatialBlock)
 	extractedBit0 := qimExtract(extractDCT[1][3], alpha)
 	extractedBit1 := qimExtract(extractDCT[3][1], alpha)
 
-	fmt.Println("\n[Step 5] Extraction")
-	fmt.Printf("Re-DCT coefficient [1][3] = %.4f\n", extractDCT[1][3])
-	fmt.Printf("Re-DCT coefficient [3][1] = %.4f\n", extractDCT[3][1])
-	fmt.Printf("Extracted bits: [%d, %d]\n", extractedBit0, extractedBit1)
+	fmt.Fprintln(Output, "\n[Step 5] Extraction")
+	fmt.Fprintf(Output, "Re-DCT coefficient [1][3] = %.4f\n", extractDCT[1][3])
+	fmt.Fprintf(Output, "Re-DCT coefficient [3][1] = %.4f\n", extractDCT[3][1])
+	fmt.Fprintf(Output, "Extracted bits: [%d, %d]\n", extractedBit0, extractedBit1)
 
 	// Verification
-	fmt.Println("\n[Verification]")
+	fmt.Fprintln(Output, "\n[Verification]")
 	if extractedBit0 == bit0 && extractedBit1 == bit1 {
-		fmt.Println("✓ SUCCESS: DCT→Embed→IDCT→DCT→Extract pipeline works!")
+		fmt.Fprintln(Output, "✓ SUCCESS: DCT→Embed→IDCT→DCT→Extract pipeline works!")
 	} else {
-		fmt.Println("✗ FAILED: Pipeline corrupted the watermark")
-		fmt.Printf("  Input bits:     [%d, %d]\n", bit0, bit1)
-		fmt.Printf("  Extracted bits: [%d, %d]\n", extractedBit0, extractedBit1)
+		fmt.Fprintln(Output, "✗ FAILED: Pipeline corrupted the watermark")
+		fmt.Fprintf(Output, "  Input bits:     [%d, %d]\n", bit0, bit1)
+		fmt.Fprintf(Output, "  Extracted bits: [%d, %d]\n", extractedBit0, extractedBit1)
 	}
 }
@@ -6,6 +6,10 @@ import (
 	"math"
 )
 
+// tileCapacityBits is the number of bits one 128x128 HL tile carries:
+// 16x16 blocks of 8x8, two bits each
+const tileCapacityBits = 2 * (128 / 8) * (128 / 8)
+
 func getBlock(matrix [][]float64, x, y, B int) [][]float64 {
 	block := make([][]float64, B)
 	for i := 0; i < B; i++ {
@@ -21,37 +25,58 @@ func putBlock(matrix [][]float64, block [][]float64, x, y int) {
 	}
 }
 
-func embed_in_a_tile(tile [][]float64, stream []int) [][]float64 {
-	bitIndex := 0
-	for by := 0; by < 128 && bitIndex < len(stream)-1; by += 8 {
-		for bx := 0; bx < 128 && bitIndex < len(stream)-1; bx += 8 {
-
-			block := getBlock(tile, bx, by, 8)
-			bits := make([]int, 2)
-			bits[0] = stream[bitIndex]
-			bits[1] = stream[bitIndex+1]
+// embed_in_a_tile embeds two bits per 8x8 block as c lays them out, with the
+// step steps gives the block, from tileSteps
+func embed_in_a_tile(tile [][]float64, stream []int, steps [][]float64, c blockCoding) [][]float64 {
+	for bitIndex := 0; bitIndex < len(stream)-1 && bitIndex < tileCapacityBits; bitIndex += 2 {
+		idx := blockAt(c.order, bitIndex/2)
+		bx, by := (idx%tileBlocks)*8, (idx/tileBlocks)*8
 
-			// PerformEmbedd now handles DCT and IDCT internally
-			PerformEmbedd(block, bits)
+		block := getBlock(tile, bx, by, 8)
+		bits := make([]int, 2)
+		bits[0] = stream[bitIndex]
+		bits[1] = stream[bitIndex+1]
 
-			// Block is already in spatial domain, just put it back
-			putBlock(tile, block, bx, by)
+		// embedBlockBits handles DCT and IDCT internally
+		embedBlockBits(block, bits, steps[idx/tileBlocks][idx%tileBlocks], c.modulator, idx)
 
-			bitIndex += 2
-		}
+		// Block is already in spatial domain, just put it back
+		putBlock(tile, block, bx, by)
 	}
 	return tile
 }
 
 func Embed_Watermark(img image.Image, message string) *image.YCbCr {
+	return EmbedWithOptions(img, message, DefaultOptions())
+}
 
-	stream := BuildWatermarkBits(message)
+// EmbedWithOptions is Embed_Watermark with explicit options
+func EmbedWithOptions(img image.Image, message string, opts *Options) *image.YCbCr {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+
+	stream := payloadBits(message, opts)
 
 	ycb, Ymatrix := ConvertToYC(img)
+	if opts.SyncStrength > 0 {
+		addSyncTemplate(Ymatrix, opts.SyncStrength)
+	}
 
+	Ymatrix = embedInYMatrix(Ymatrix, stream, codingFor(opts, opts.Strength))
+
+	Modify_YComponent(ycb, Ymatrix)
+	return ycb
+}
+
+// embedInYMatrix runs DWT, embeds stream in every 128x128 tile of the HL band
+// and returns the reconstructed Y matrix
+func embedInYMatrix(Ymatrix [][]float64, stream []int, c blockCoding) [][]float64 {
+	original := Ymatrix
 	img_DWT := PerformCompleteDWT(Ymatrix)
+	steps := blockSteps(img_DWT, c.alpha, c.perceptual)
 
-	fmt.Println("Converted to DWT")
+	fmt.Fprintln(Output, "Converted to DWT")
 
 	h := len(img_DWT.HL)
 	w := len(img_DWT.HL[0])
@@ -61,56 +86,24 @@ func Embed_Watermark(img image.Image, message string) *image.YCbCr {
 		for j := 0; j < int(math.Floor(float64(w)/128)); j++ {
 			block := getBlock(img_DWT.HL, j*128, i*128, 128)
 
-			tile := embed_in_a_tile(block, stream)
+			tile := embed_in_a_tile(block, stream, tileSteps(steps, i, j), c)
 
 			putBlock(img_DWT.HL, tile, j*128, i*128)
 		}
 	}
 
 	Ymatrix = PerformCompleteIDWTFromResult(img_DWT)
-	//------------
-	// Perform DWT
-	// img_DWT2 := PerformCompleteDWT(Ymatrix)
-
-	// fmt.Println("DWT completed for extraction")
-
-	// h = len(img_DWT2.HL)
-	// w = len(img_DWT2.HL[0])
-
-	// var messages []string
-	// tileCount := 0
-
-	// // Process each 128x128 tile
-	// numTilesY := h / 128
-	// numTilesX := w / 128
-
-	// fmt.Printf("Processing %d x %d = %d tiles\n", numTilesY, numTilesX, numTilesY*numTilesX)
-
-	// for i := 0; i < numTilesY; i++ {
-	// 	for j := 0; j < numTilesX; j++ {
-	// 		tileCount++
-
-	// 		// Get the tile
-	// 		tile := getBlock(img_DWT.HL, j*128, i*128, 128)
-
-	// 		// Extract bits from this tile
-	// 		extractedBits := extractFromTile(tile)
-
-	// 		// Try to find the message
-	// 		message, found := findMessage(extractedBits)
+	return restoreOddEdges(Ymatrix, original)
+}
 
-	// 		if found {
-	// 			fmt.Printf("Tile [%d,%d] (tile #%d): Message found: \"%s\"\n", i, j, tileCount, message)
-	// 			messages = append(messages, message)
-	// 		} else {
-	// 			fmt.Printf("Tile [%d,%d] (tile #%d): No valid message found\n", i, j, tileCount)
-	// 		}
-	// 	}
-	// }
-	// for k, msg := range messages {
-	// 	fmt.Println("message ", k, " : ", msg)
-	// }
-	//---------
-	Modify_YComponent(ycb, Ymatrix)
-	return ycb
+// restoreOddEdges copies back the last row/column that the Haar DWT drops
+// for odd-sized images, so the result matches the input dimensions
+func restoreOddEdges(reconstructed, original [][]float64) [][]float64 {
+	if len(reconstructed) == len(original) && len(reconstructed[0]) == len(original[0]) {
+		return reconstructed
+	}
+	for i := range reconstructed {
+		copy(original[i], reconstructed[i])
+	}
+	return original
 }
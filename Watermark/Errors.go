@@ -0,0 +1,54 @@
+package Watermark
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the package, wrapped with details; test with errors.Is
+var (
+	// ErrNoWatermark is returned when no tile yields a message between the flags
+	ErrNoWatermark = errors.New("no watermark found")
+
+	// ErrMessageTooLong is returned when the message and its flags exceed what a tile (or spread of frames) holds
+	ErrMessageTooLong = errors.New("message too long")
+
+	// ErrImageTooSmall is returned when an image or frame cannot hold a single tile
+	ErrImageTooSmall = errors.New("image too small")
+
+	// ErrInvalidOptions is returned for out-of-range Options fields
+	ErrInvalidOptions = errors.New("invalid options")
+
+	// ErrInvalidImage is returned when an input file cannot be decoded
+	ErrInvalidImage = errors.New("invalid image")
+
+	// ErrAuthFailed is returned when a message is found but its encrypted
+	// payload does not open with the PayloadKey given, or none was given
+	ErrAuthFailed = errors.New("payload authentication failed")
+
+	// ErrSignatureInvalid is returned when a signed message is found but its
+	// signature does not verify
+	ErrSignatureInvalid = errors.New("signature invalid")
+
+	// ErrTampered is returned when regions of a protected image fail their
+	// tamper check
+	ErrTampered = errors.New("tampering detected")
+)
+
+// CheckMessage reports whether message fits in a width x height image
+// embedded with opts
+func CheckMessage(width, height int, message string, opts *Options) error {
+	c := Capacity(width, height)
+	if c.Tiles() == 0 {
+		return fmt.Errorf("%w: %dx%d; at least 256x256 is needed for one tile", ErrImageTooSmall, width, height)
+	}
+	return CheckMessageLength(message, opts)
+}
+
+// CheckMessageLength reports whether message fits in one tile under opts
+func CheckMessageLength(message string, opts *Options) error {
+	if limit := MessageLimit(opts); len(message) > limit {
+		return fmt.Errorf("%w: %d bytes; a tile holds at most %d", ErrMessageTooLong, len(message), limit)
+	}
+	return nil
+}
@@ -5,23 +5,42 @@ import (
 	"image"
 )
 
-// extractFromTile extracts watermark bits from a 128x128 tile
-func extractFromTile(tile [][]float64) []int {
+// extractFromTile extracts watermark bits from a 128x128 tile laid out as c
+// says, with the block steps from tileSteps
+func extractFromTile(tile [][]float64, steps [][]float64, c blockCoding) []int {
 	var extractedBits []int
 
-	for by := 0; by < 128; by += 8 {
-		for bx := 0; bx < 128; bx += 8 {
-			block := getBlock(tile, bx, by, 8)
+	for k := 0; k < tileBlocks*tileBlocks; k++ {
+		idx := blockAt(c.order, k)
+		block := getBlock(tile, (idx%tileBlocks)*8, (idx/tileBlocks)*8, 8)
 
-			// Extract 2 bits from this block
-			bits := PerformExtract(block)
-			extractedBits = append(extractedBits, bits...)
-		}
+		// Extract 2 bits from this block
+		bits := extractBlockBits(block, steps[idx/tileBlocks][idx%tileBlocks], c.modulator, idx)
+		extractedBits = append(extractedBits, bits...)
 	}
 
 	return extractedBits
 }
 
+// extractTileBits runs DWT on a Y matrix and returns the bits of every
+// 128x128 HL tile, in raster order
+func extractTileBits(Ymatrix [][]float64, c blockCoding) [][]int {
+	img_DWT := PerformCompleteDWT(Ymatrix)
+	steps := blockSteps(img_DWT, c.alpha, c.perceptual)
+
+	numTilesY := len(img_DWT.HL) / 128
+	numTilesX := len(img_DWT.HL[0]) / 128
+
+	var tiles [][]int
+	for i := 0; i < numTilesY; i++ {
+		for j := 0; j < numTilesX; j++ {
+			tile := getBlock(img_DWT.HL, j*128, i*128, 128)
+			tiles = append(tiles, extractFromTile(tile, tileSteps(steps, i, j), c))
+		}
+	}
+	return tiles
+}
+
 // findMessage locates the message between start and end flags
 func findMessage(bits []int) (string, bool) {
 	startFlag := []int{
@@ -89,25 +108,44 @@ func findMessage(bits []int) (string, bool) {
 
 // Extract_Watermark extracts the watermark message from a watermarked image
 func Extract_Watermark(img image.Image) []string {
+	return ExtractWithOptions(img, DefaultOptions())
+}
+
+// ExtractWithOptions is Extract_Watermark with explicit options; the strength
+// and keys must match those used to embed
+func ExtractWithOptions(img image.Image, opts *Options) []string {
+	messages, _ := ExtractMessages(img, opts)
+	return messages
+}
+
+// ExtractMessages is ExtractWithOptions also counting the tiles whose message
+// was found but failed to open with the PayloadKey
+func ExtractMessages(img image.Image, opts *Options) (messages []string, authFailed int) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	img, opts = prepared(img, opts)
+	coding := codingFor(opts, opts.Strength)
+
 	// Convert image to YCbCr and get Y matrix
 	_, Ymatrix := ConvertToYC(img)
 
 	// Perform DWT
 	img_DWT := PerformCompleteDWT(Ymatrix)
+	steps := blockSteps(img_DWT, coding.alpha, coding.perceptual)
 
-	fmt.Println("DWT completed for extraction")
+	fmt.Fprintln(Output, "DWT completed for extraction")
 
 	h := len(img_DWT.HL)
 	w := len(img_DWT.HL[0])
 
-	var messages []string
 	tileCount := 0
 
 	// Process each 128x128 tile
 	numTilesY := h / 128
 	numTilesX := w / 128
 
-	fmt.Printf("Processing %d x %d = %d tiles\n", numTilesY, numTilesX, numTilesY*numTilesX)
+	fmt.Fprintf(Output, "Processing %d x %d = %d tiles\n", numTilesY, numTilesX, numTilesY*numTilesX)
 
 	for i := 0; i < numTilesY; i++ {
 		for j := 0; j < numTilesX; j++ {
@@ -117,27 +155,70 @@ func Extract_Watermark(img image.Image) []string {
 			tile := getBlock(img_DWT.HL, j*128, i*128, 128)
 
 			// Extract bits from this tile
-			extractedBits := extractFromTile(tile)
+			extractedBits := extractFromTile(tile, tileSteps(steps, i, j), coding)
 
 			// Try to find the message
-			message, found := findMessage(extractedBits)
+			message, found, failed := readPayload(extractedBits, opts)
 
-			if found {
-				fmt.Printf("Tile [%d,%d] (tile #%d): Message found: \"%s\"\n", i, j, tileCount, message)
+			switch {
+			case found:
+				fmt.Fprintf(Output, "Tile [%d,%d] (tile #%d): Message found: \"%s\"\n", i, j, tileCount, message)
 				messages = append(messages, message)
-			} else {
-				fmt.Printf("Tile [%d,%d] (tile #%d): No valid message found\n", i, j, tileCount)
+			case failed:
+				fmt.Fprintf(Output, "Tile [%d,%d] (tile #%d): Message found but payload failed authentication\n", i, j, tileCount)
+				authFailed++
+			default:
+				fmt.Fprintf(Output, "Tile [%d,%d] (tile #%d): No valid message found\n", i, j, tileCount)
 			}
 		}
 	}
 
-	return messages
+	return messages, authFailed
+}
+
+// TileResult is the extraction outcome of one 128x128 HL tile
+type TileResult struct {
+	Row        int    `json:"row"`
+	Col        int    `json:"col"`
+	Found      bool   `json:"found"`
+	Message    string `json:"message,omitempty"`
+	AuthFailed bool   `json:"auth_failed,omitempty"` // a message was found but its encrypted payload did not open
+	FlagErrors int    `json:"flag_errors"`           // bits of the 16-bit start flag that read back wrong at position 0
+}
+
+// ExtractTiles is ExtractWithOptions reporting every tile, including those
+// where no message was found, without printing progress
+func ExtractTiles(img image.Image, opts *Options) []TileResult {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+
+	img, opts = prepared(img, opts)
+	_, Ymatrix := ConvertToYC(img)
+	tiles := extractTileBits(Ymatrix, codingFor(opts, opts.Strength))
+	numTilesX := Capacity(len(Ymatrix[0]), len(Ymatrix)).TilesX
+	startFlag := BuildWatermarkBits("")[:16]
+
+	results := make([]TileResult, len(tiles))
+	for i, bits := range tiles {
+		r := TileResult{Row: i / numTilesX, Col: i % numTilesX}
+		for k, bit := range startFlag {
+			if bits[k] != bit {
+				r.FlagErrors++
+			}
+		}
+		r.Message, r.Found, r.AuthFailed = readPayload(bits, opts)
+		results[i] = r
+	}
+	return results
 }
 
 // Extract_Watermark_Verbose provides detailed extraction information
 func Extract_Watermark_Verbose(img image.Image) {
 	_, Ymatrix := ConvertToYC(img)
 	img_DWT := PerformCompleteDWT(Ymatrix)
+	coding := blockCoding{alpha: defaultStrength, modulator: QIM{}}
+	steps := blockSteps(img_DWT, coding.alpha, coding.perceptual)
 
 	h := len(img_DWT.HL)
 	w := len(img_DWT.HL[0])
@@ -145,45 +226,58 @@ func Extract_Watermark_Verbose(img image.Image) {
 	numTilesY := h / 128
 	numTilesX := w / 128
 
-	fmt.Println("\n=== Watermark Extraction (Verbose Mode) ===")
-	fmt.Printf("Image size: %dx%d\n", w*2, h*2)
-	fmt.Printf("HL band size: %dx%d\n", w, h)
-	fmt.Printf("Number of tiles: %d x %d = %d\n\n", numTilesY, numTilesX, numTilesY*numTilesX)
+	fmt.Fprintln(Output, "\n=== Watermark Extraction (Verbose Mode) ===")
+	fmt.Fprintf(Output, "Image size: %dx%d\n", w*2, h*2)
+	fmt.Fprintf(Output, "HL band size: %dx%d\n", w, h)
+	fmt.Fprintf(Output, "Number of tiles: %d x %d = %d\n\n", numTilesY, numTilesX, numTilesY*numTilesX)
 
 	for i := 0; i < numTilesY; i++ {
 		for j := 0; j < numTilesX; j++ {
-			fmt.Printf("--- Tile [%d,%d] ---\n", i, j)
+			fmt.Fprintf(Output, "--- Tile [%d,%d] ---\n", i, j)
 
 			tile := getBlock(img_DWT.HL, j*128, i*128, 128)
-			extractedBits := extractFromTile(tile)
+			extractedBits := extractFromTile(tile, tileSteps(steps, i, j), coding)
 
-			fmt.Printf("Extracted %d bits from tile\n", len(extractedBits))
+			fmt.Fprintf(Output, "Extracted %d bits from tile\n", len(extractedBits))
 
 			// Show first 32 bits
-			fmt.Print("First 32 bits: ")
+			fmt.Fprint(Output, "First 32 bits: ")
 			for k := 0; k < 32 && k < len(extractedBits); k++ {
-				fmt.Printf("%d", extractedBits[k])
+				fmt.Fprintf(Output, "%d", extractedBits[k])
 			}
-			fmt.Println()
+			fmt.Fprintln(Output)
 
 			message, found := findMessage(extractedBits)
 
 			if found {
-				fmt.Printf("✓ Message found: \"%s\"\n", message)
+				fmt.Fprintf(Output, "✓ Message found: \"%s\"\n", message)
 			} else {
-				fmt.Println("✗ No valid message found (flags not detected)")
+				fmt.Fprintln(Output, "✗ No valid message found (flags not detected)")
 			}
-			fmt.Println()
+			fmt.Fprintln(Output)
 		}
 	}
 }
 
 // ExtractSingleMessage attempts to extract one consistent message across all tiles
 func ExtractSingleMessage(img image.Image) (string, error) {
-	messages := Extract_Watermark(img)
+	return ExtractSingleMessageWithOptions(img, DefaultOptions())
+}
+
+// ExtractSingleMessageWithOptions is ExtractSingleMessage with explicit options
+func ExtractSingleMessageWithOptions(img image.Image, opts *Options) (string, error) {
+	return selectMessage(ExtractMessages(img, opts))
+}
 
+// selectMessage reduces the per-tile messages to one, preferring the most
+// common. With none, tiles whose payload failed to open make it
+// ErrAuthFailed rather than ErrNoWatermark.
+func selectMessage(messages []string, authFailed int) (string, error) {
 	if len(messages) == 0 {
-		return "", fmt.Errorf("no watermark found in any tile")
+		if authFailed > 0 {
+			return "", fmt.Errorf("%w in %d tiles; check the payload key", ErrAuthFailed, authFailed)
+		}
+		return "", fmt.Errorf("%w in any tile", ErrNoWatermark)
 	}
 
 	// Check if all messages are the same
@@ -198,18 +292,18 @@ func ExtractSingleMessage(img image.Image) (string, error) {
 	}
 
 	if allSame {
-		fmt.Printf("\n✓ Consistent message found in %d/%d tiles: \"%s\"\n",
+		fmt.Fprintf(Output, "\n✓ Consistent message found in %d/%d tiles: \"%s\"\n",
 			len(messages), len(messages), firstMessage)
 		return firstMessage, nil
 	} else {
-		fmt.Printf("\n⚠ Warning: Found different messages in tiles\n")
-		fmt.Println("Messages found:")
+		fmt.Fprintf(Output, "\n⚠ Warning: Found different messages in tiles\n")
+		fmt.Fprintln(Output, "Messages found:")
 		messageCount := make(map[string]int)
 		for _, msg := range messages {
 			messageCount[msg]++
 		}
 		for msg, count := range messageCount {
-			fmt.Printf("  \"%s\": %d tiles\n", msg, count)
+			fmt.Fprintf(Output, "  \"%s\": %d tiles\n", msg, count)
 		}
 
 		// Return the most common message
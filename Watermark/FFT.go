@@ -0,0 +1,46 @@
+package Watermark
+
+import (
+	"math"
+	"math/bits"
+	"math/cmplx"
+)
+
+// fft transforms a in place; len(a) must be a power of two
+func fft(a []complex128) {
+	n := len(a)
+	shift := 64 - bits.TrailingZeros(uint(n))
+	for i := range a {
+		if j := int(bits.Reverse64(uint64(i)) >> shift); i < j {
+			a[i], a[j] = a[j], a[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				even, odd := a[start+k], w*a[start+k+size/2]
+				a[start+k], a[start+k+size/2] = even+odd, even-odd
+				w *= step
+			}
+		}
+	}
+}
+
+// fft2D transforms a square power-of-two matrix in place, rows then columns
+func fft2D(m [][]complex128) {
+	for _, row := range m {
+		fft(row)
+	}
+	col := make([]complex128, len(m))
+	for x := range m[0] {
+		for y := range m {
+			col[y] = m[y][x]
+		}
+		fft(col)
+		for y := range m {
+			m[y][x] = col[y]
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package Watermark
+
+import (
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	Output = io.Discard
+	os.Exit(m.Run())
+}
+
+// testImage is a deterministic textured RGB image, smooth gradients with
+// noise on top, that keeps every pixel well away from 0 and 255
+func testImage(width, height int) *image.RGBA {
+	rng := rand.New(rand.NewPCG(1, 2))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := 128 + 40*math.Sin(float64(x)/23) + 30*math.Cos(float64(y)/17) + 12*rng.NormFloat64()
+			v = math.Max(30, math.Min(225, v))
+			img.Set(x, y, color.RGBA{R: uint8(v), G: uint8(v * 0.9), B: uint8(255 - v), A: 0xFF})
+		}
+	}
+	return img
+}
+
+// hasMessage reports whether any tile of img decodes to want
+func hasMessage(img image.Image, want string, opts *Options) bool {
+	for _, m := range ExtractWithOptions(img, opts) {
+		if m == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package Watermark
+
+import (
+	"InvisibleWaterMarkingSystem/ImageIO"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+)
+
+// minFrameSize is the smallest frame side that holds one 128x128 HL tile
+const minFrameSize = 256
+
+// transparentIndex returns the palette index with zero alpha, or -1
+func transparentIndex(p color.Palette) int {
+	for i, c := range p {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// countBitErrors compares every tile's bits against the embedded stream
+func countBitErrors(tiles [][]int, stream []int) int {
+	errors := 0
+	for _, bits := range tiles {
+		for i := 0; i < len(stream) && i < len(bits); i++ {
+			if bits[i] != stream[i] {
+				errors++
+			}
+		}
+	}
+	return errors
+}
+
+// paletteCoding is the block layout of palette frames: plain QIM at the
+// palette strength, as feedbackCorrection works on that lattice directly
+func paletteCoding(opts *Options) blockCoding {
+	return blockCoding{alpha: opts.PaletteStrength, order: orderFor(opts), modulator: QIM{}}
+}
+
+// feedbackCorrection nudges the unquantized working matrix so that, after
+// quantization, each embedded coefficient lands closer to its lattice point.
+// The offset measured on the quantized frame is added to the working frame.
+func feedbackCorrection(working, quantized [][]float64, stream []int, alpha float64, order []int) [][]float64 {
+	wDWT := PerformCompleteDWT(working)
+	qDWT := PerformCompleteDWT(quantized)
+
+	numTilesY := len(wDWT.HL) / 128
+	numTilesX := len(wDWT.HL[0]) / 128
+
+	for i := 0; i < numTilesY; i++ {
+		for j := 0; j < numTilesX; j++ {
+			for bitIndex := 0; bitIndex < len(stream)-1 && bitIndex < tileCapacityBits; bitIndex += 2 {
+				idx := blockAt(order, bitIndex/2)
+				x, y := j*128+(idx%tileBlocks)*8, i*128+(idx/tileBlocks)*8
+				wd := dct2D(getBlock(wDWT.HL, x, y, 8))
+				qd := dct2D(getBlock(qDWT.HL, x, y, 8))
+
+				wd[1][3] += qimEmbed(qd[1][3], stream[bitIndex], alpha) - qd[1][3]
+				wd[3][1] += qimEmbed(qd[3][1], stream[bitIndex+1], alpha) - qd[3][1]
+
+				putBlock(wDWT.HL, idct2D(wd), x, y)
+			}
+		}
+	}
+	return restoreOddEdges(PerformCompleteIDWTFromResult(wDWT), working)
+}
+
+// embedPalettedFrame embeds stream into one GIF frame. Mapping back onto a
+// palette moves coefficients off the QIM lattice, so the quantized frame is
+// re-checked and the error fed back into the unquantized frame until every
+// bit reads back or the pass budget runs out. Returns the residual bit errors.
+func embedPalettedFrame(frame *image.Paletted, stream []int, opts *Options) (*image.Paletted, int) {
+	transparent := transparentIndex(frame.Palette)
+	opaque := func(x, y int) bool {
+		return transparent < 0 || int(frame.ColorIndexAt(x, y)) != transparent
+	}
+
+	coding := paletteCoding(opts)
+	ycb, Ymatrix := ConvertToYC(frame)
+	working := embedInYMatrix(Ymatrix, stream, coding)
+	Modify_YComponent(ycb, working)
+
+	// Build the palette from the watermarked pixels, reserving a slot for transparency
+	size := 256
+	if transparent >= 0 {
+		size = 255
+	}
+	palette := ImageIO.MedianCutPalette(ycb, opaque, size)
+	keepIndex := uint8(0)
+	if transparent >= 0 {
+		keepIndex = uint8(len(palette))
+		palette = append(palette, color.RGBA{})
+	}
+
+	result := ImageIO.QuantizeToPalette(ycb, palette, opaque, keepIndex)
+
+	errors := 0
+	for pass := 1; ; pass++ {
+		_, Yq := ConvertToYC(result)
+		errors = countBitErrors(extractTileBits(Yq, coding), stream)
+		fmt.Fprintf(Output, "Palette pass %d: %d bit errors\n", pass, errors)
+		if errors == 0 || pass >= opts.PalettePasses {
+			break
+		}
+
+		working = feedbackCorrection(working, Yq, stream, coding.alpha, coding.order)
+		Modify_YComponent(ycb, working)
+		result = ImageIO.QuantizeToPalette(ycb, palette, opaque, keepIndex)
+	}
+	return result, errors
+}
+
+// Embed_Watermark_GIF watermarks every frame of an animation large enough to
+// hold a tile. Timing, disposal and looping are kept; frames are re-paletted.
+func Embed_Watermark_GIF(g *gif.GIF, message string, opts *Options) (*gif.GIF, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	if len(g.Image) == 0 {
+		return nil, fmt.Errorf("animation has no frames")
+	}
+
+	stream := payloadBits(message, opts)
+
+	out := *g
+	out.Image = make([]*image.Paletted, len(g.Image))
+	marked := 0
+
+	for i, frame := range g.Image {
+		b := frame.Bounds()
+		if b.Dx() < minFrameSize || b.Dy() < minFrameSize {
+			fmt.Fprintf(Output, "Frame %d (%dx%d) too small for a tile, left unchanged\n", i, b.Dx(), b.Dy())
+			out.Image[i] = frame
+			continue
+		}
+
+		fmt.Fprintf(Output, "--- Frame %d ---\n", i)
+		paletted, _ := embedPalettedFrame(frame, stream, opts)
+		out.Image[i] = paletted
+		marked++
+	}
+
+	if marked == 0 {
+		return nil, fmt.Errorf("%w: no frame is at least %dx%d pixels", ErrImageTooSmall, minFrameSize, minFrameSize)
+	}
+	// Per-frame palettes replace the global one
+	out.Config.ColorModel = nil
+	return &out, nil
+}
+
+// Extract_Watermark_GIF votes the bits of every tile in every frame into one
+// stream, so frames damaged individually still contribute evidence
+func Extract_Watermark_GIF(g *gif.GIF, opts *Options) *SequenceResult {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+
+	coding := paletteCoding(opts)
+	result := &SequenceResult{FrameResult: make([]string, len(g.Image))}
+	var allTiles [][]int
+
+	for i, frame := range g.Image {
+		b := frame.Bounds()
+		if b.Dx() < minFrameSize || b.Dy() < minFrameSize {
+			continue
+		}
+		result.FrameCount++
+
+		_, Ymatrix := ConvertToYC(frame)
+		tiles := extractTileBits(Ymatrix, coding)
+		if message, found, _ := readPayload(voteBits(tiles), opts); found {
+			result.FrameResult[i] = message
+		}
+		allTiles = append(allTiles, tiles...)
+	}
+
+	result.TileCount = len(allTiles)
+	result.Message, result.Found, result.AuthFailed = readPayload(voteBits(allTiles), opts)
+	return result
+}
@@ -0,0 +1,111 @@
+package Watermark
+
+import (
+	"InvisibleWaterMarkingSystem/ImageIO"
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+// palettedFrame is testImage quantized to a median-cut palette, with the
+// pixels inside hole set to a transparent entry when hole is not empty
+func palettedFrame(width, height int, hole image.Rectangle) *image.Paletted {
+	img := testImage(width, height)
+	keep := func(x, y int) bool { return !image.Pt(x, y).In(hole) }
+	palette := ImageIO.MedianCutPalette(img, keep, 255)
+	transparent := uint8(len(palette))
+	palette = append(palette, color.RGBA{})
+	return ImageIO.QuantizeToPalette(img, palette, keep, transparent)
+}
+
+func TestGIFRoundTrip(t *testing.T) {
+	hole := image.Rect(100, 100, 140, 120)
+	g := &gif.GIF{
+		Image: []*image.Paletted{
+			palettedFrame(256, 256, image.Rectangle{}),
+			palettedFrame(64, 64, image.Rectangle{}),
+			palettedFrame(320, 256, hole),
+		},
+		Delay:     []int{10, 20, 30},
+		Disposal:  []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalNone},
+		LoopCount: 3,
+		Config:    image.Config{Width: 320, Height: 256},
+	}
+	marked, err := Embed_Watermark_GIF(g, "Hello World", DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if marked.Image[1] != g.Image[1] {
+		t.Error("a frame too small for a tile was changed")
+	}
+	if marked.Image[0] == g.Image[0] || marked.Image[2] == g.Image[2] {
+		t.Error("a large frame was left unmarked")
+	}
+	if marked.LoopCount != 3 || marked.Delay[2] != 30 || marked.Disposal[1] != gif.DisposalBackground {
+		t.Error("timing, disposal or looping changed")
+	}
+	frame := marked.Image[2]
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 320; x++ {
+			_, _, _, a := frame.At(x, y).RGBA()
+			if (a == 0) != image.Pt(x, y).In(hole) {
+				t.Fatalf("transparency at (%d,%d) changed", x, y)
+			}
+		}
+	}
+
+	// Through the GIF encoder, as a written file would be
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, marked); err != nil {
+		t.Fatal(err)
+	}
+	back, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := Extract_Watermark_GIF(back, DefaultOptions())
+	if !r.Found || r.Message != "Hello World" {
+		t.Fatalf("extracted %q, found %v", r.Message, r.Found)
+	}
+	if r.FrameCount != 2 || r.TileCount != 2 {
+		t.Errorf("%d frames, %d tiles", r.FrameCount, r.TileCount)
+	}
+	if r.FrameResult[0] != "Hello World" || r.FrameResult[1] != "" || r.FrameResult[2] != "Hello World" {
+		t.Errorf("per frame %q", r.FrameResult)
+	}
+
+	if r := Extract_Watermark_GIF(g, DefaultOptions()); r.Found {
+		t.Errorf("unmarked animation gives %q", r.Message)
+	}
+}
+
+func TestGIFCombinesFrames(t *testing.T) {
+	// Three marked frames, one of them overwritten: the other two outvote it
+	g := &gif.GIF{Image: []*image.Paletted{
+		palettedFrame(256, 256, image.Rectangle{}),
+		palettedFrame(256, 256, image.Rectangle{}),
+		palettedFrame(256, 256, image.Rectangle{}),
+	}, Delay: make([]int, 3)}
+	marked, err := Embed_Watermark_GIF(g, "Hello World", DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	marked.Image[1] = g.Image[1]
+	r := Extract_Watermark_GIF(marked, DefaultOptions())
+	if !r.Found || r.Message != "Hello World" {
+		t.Errorf("extracted %q, found %v", r.Message, r.Found)
+	}
+}
+
+func TestGIFTooSmall(t *testing.T) {
+	if _, err := Embed_Watermark_GIF(&gif.GIF{}, "x", nil); err == nil {
+		t.Error("no error for an animation without frames")
+	}
+	small := &gif.GIF{Image: []*image.Paletted{palettedFrame(200, 300, image.Rectangle{})}, Delay: []int{0}}
+	if _, err := Embed_Watermark_GIF(small, "x", nil); !errors.Is(err, ErrImageTooSmall) {
+		t.Errorf("200x300 frame: %v", err)
+	}
+}
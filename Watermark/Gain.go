@@ -0,0 +1,117 @@
+package Watermark
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// A change of contrast multiplies the HL band by the same factor as the
+// pixels, and with it every coefficient QIM put on a lattice point, so the
+// extractor's steps no longer match. A change of brightness alone leaves HL
+// as it is, and gamma acts locally as a contrast change. The gain is found
+// as the alignment is: every step scale in a grid of gainRatio from 1/2 to 2
+// is scored by the start flag matches of the tiles, reading the first bit of
+// each flag block as Detect does, and extraction then runs with the steps
+// scaled by the best.
+
+const (
+	// gainRatio is the spacing of the gains tried. A coefficient k steps
+	// from zero moves by k times the gain error, so 1% keeps coefficients
+	// within a quarter step of their lattice point up to k = 50.
+	gainRatio = 1.01
+
+	// gainSearchSteps is the number of gains tried on either side of 1
+	gainSearchSteps = 70
+
+	// gainCandidates is the number of gains FindGain tries
+	gainCandidates = 2*gainSearchSteps + 1
+)
+
+// flagBlock is a start flag block of a tile: its DCT, step and index in the
+// tile, and the bit its first coefficient should carry
+type flagBlock struct {
+	dct  [][]float64
+	step float64
+	idx  int
+	bit  int
+}
+
+// FindGain estimates the factor by which the contrast of an image marked
+// with the strength and key in opts has changed since embedding: extraction
+// reads it with every step scaled by the gain. It returns ErrNoWatermark
+// when no gain gives start flags significant at opts.FalsePositiveRate.
+func FindGain(img image.Image, opts *Options) (float64, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	if err := CheckModulation(opts); err != nil {
+		return 0, err
+	}
+	coding := codingFor(opts, opts.Strength)
+	_, Ymatrix := ConvertToYC(img)
+	img_DWT := PerformCompleteDWT(Ymatrix)
+	steps := blockSteps(img_DWT, coding.alpha, coding.perceptual)
+
+	// The flag blocks are transformed once and read at every gain
+	startFlag := BuildWatermarkBits("")[:16]
+	var blocks []flagBlock
+	for i := 0; i < len(img_DWT.HL)/128; i++ {
+		for j := 0; j < len(img_DWT.HL[0])/128; j++ {
+			tile := getBlock(img_DWT.HL, j*128, i*128, 128)
+			for k := 0; k < len(startFlag)/2; k++ {
+				idx := blockAt(coding.order, k)
+				bx, by := idx%tileBlocks, idx/tileBlocks
+				blocks = append(blocks, flagBlock{
+					dct:  dct2D(getBlock(tile, bx*8, by*8, 8)),
+					step: steps[i*tileBlocks+by][j*tileBlocks+bx],
+					idx:  idx,
+					bit:  startFlag[2*k],
+				})
+			}
+		}
+	}
+	if len(blocks) == 0 {
+		return 0, fmt.Errorf("%w: need at least one whole tile to estimate the gain", ErrImageTooSmall)
+	}
+
+	// The best gains form a run as wide as the tolerance of the lattice;
+	// the middle of the first such run is the estimate
+	best, runStart, runEnd := -1, 0, 0
+	for s := -gainSearchSteps; s <= gainSearchSteps; s++ {
+		gain := math.Pow(gainRatio, float64(s))
+		var matches int
+		for _, b := range blocks {
+			if coding.modulator.Extract(b.dct, b.step*gain, b.idx)[0] == b.bit {
+				matches++
+			}
+		}
+		switch {
+		case matches > best:
+			best, runStart, runEnd = matches, s, s
+		case matches == best && runEnd == s-1:
+			runEnd = s
+		}
+	}
+	gain := math.Pow(gainRatio, float64(runStart+runEnd)/2)
+	p := min(1, gainCandidates*binomialTail(len(blocks), best))
+	fmt.Fprintf(Output, "Gain: steps scaled by %.3f, %d/%d flag bits match, p-value %.3g\n", gain, best, len(blocks), p)
+	if p > opts.FalsePositiveRate {
+		return gain, fmt.Errorf("%w: best gain %.3f has p-value %.3g", ErrNoWatermark, gain, p)
+	}
+	return gain, nil
+}
+
+// gained is opts with Strength scaled by the gain FindGain finds in img, and
+// the gain; when none is found opts is returned as is with a gain of 0
+func gained(img image.Image, opts *Options) (*Options, float64) {
+	gain, err := FindGain(img, opts)
+	if err != nil {
+		fmt.Fprintf(Output, "Gain: %v; extracting without it\n", err)
+		return opts, 0
+	}
+	o := *opts
+	o.Strength *= gain
+	o.EstimateGain = false
+	return &o, gain
+}
@@ -0,0 +1,42 @@
+package Watermark
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestFindGain(t *testing.T) {
+	opts := DefaultOptions()
+	marked := EmbedWithOptions(testImage(512, 512), "Hello World", opts)
+
+	for _, factor := range []float64{0.6, 0.8, 1} {
+		gain, err := FindGain(lowContrast(marked, factor), opts)
+		if err != nil {
+			t.Fatalf("contrast %.1f: %v", factor, err)
+		}
+		if math.Abs(gain/factor-1) > 0.03 {
+			t.Errorf("contrast %.1f: gain %.3f", factor, gain)
+		}
+	}
+
+	if _, err := FindGain(testImage(512, 512), opts); !errors.Is(err, ErrNoWatermark) {
+		t.Errorf("unmarked image: %v, want ErrNoWatermark", err)
+	}
+}
+
+func TestEstimateGainRecoversMessage(t *testing.T) {
+	opts := DefaultOptions()
+	faded := lowContrast(EmbedWithOptions(testImage(512, 512), "Hello World", opts), 0.6)
+
+	if hasMessage(faded, "Hello World", opts) {
+		t.Error("message read at 60% contrast without EstimateGain")
+	}
+	opts.EstimateGain = true
+	if !hasMessage(faded, "Hello World", opts) {
+		t.Error("message not read at 60% contrast with EstimateGain")
+	}
+	if d := Detect(faded, opts); !d.Present || math.Abs(d.Gain/0.6-1) > 0.03 {
+		t.Errorf("Detect with EstimateGain: present %v, gain %.3f", d.Present, d.Gain)
+	}
+}
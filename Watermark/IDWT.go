@@ -15,11 +15,10 @@ func invHaarCombine(low []float64, high []float64) []float64 {
 
 	for i := 0; i < n; i++ {
 		// Haar forward: L = (x + y)/√2, H = (x - y)/√2
-		// Inverse: x = (L + H), y = (L - H)
-		// Since L and H are already divided by √2, we need:
-		// x = L + H, y = L - H
-		output[2*i] = low[i] + high[i]
-		output[2*i+1] = low[i] - high[i]
+		// Inverse: x = (L + H)/√2, y = (L - H)/√2
+		// Dropping the 1/√2 here doubled every pixel of a 2D round trip
+		output[2*i] = (low[i] + high[i]) / math.Sqrt2
+		output[2*i+1] = (low[i] - high[i]) / math.Sqrt2
 	}
 	return output
 }
@@ -111,7 +110,7 @@ func PerformCompleteIDWT(LL, LH, HL, HH [][]float64) [][]float64 {
 	wg.Wait()
 
 	t2 := time.Now()
-	fmt.Printf("Inverse DWT completed in %v\n", t2.Sub(t1))
+	fmt.Fprintf(Output, "Inverse DWT completed in %v\n", t2.Sub(t1))
 
 	return result
 }
@@ -127,7 +126,7 @@ func CalculateReconstructionError(original, reconstructed [][]float64) {
 	w := len(original[0])
 
 	if len(reconstructed) != h || len(reconstructed[0]) != w {
-		fmt.Printf("ERROR: Dimension mismatch - Original: %dx%d, Reconstructed: %dx%d\n",
+		fmt.Fprintf(Output, "ERROR: Dimension mismatch - Original: %dx%d, Reconstructed: %dx%d\n",
 			h, w, len(reconstructed), len(reconstructed[0]))
 		return
 	}
@@ -153,17 +152,17 @@ func CalculateReconstructionError(original, reconstructed [][]float64) {
 	mse := sumSquaredError / float64(count)
 	rmse := math.Sqrt(mse)
 
-	fmt.Println("\n=== Reconstruction Error Metrics ===")
-	fmt.Printf("Mean Absolute Error (MAE):     %.10f\n", mae)
-	fmt.Printf("Mean Squared Error (MSE):      %.10f\n", mse)
-	fmt.Printf("Root Mean Squared Error (RMSE): %.10f\n", rmse)
-	fmt.Printf("Max Absolute Error:            %.10f\n", maxError)
+	fmt.Fprintln(Output, "\n=== Reconstruction Error Metrics ===")
+	fmt.Fprintf(Output, "Mean Absolute Error (MAE):     %.10f\n", mae)
+	fmt.Fprintf(Output, "Mean Squared Error (MSE):      %.10f\n", mse)
+	fmt.Fprintf(Output, "Root Mean Squared Error (RMSE): %.10f\n", rmse)
+	fmt.Fprintf(Output, "Max Absolute Error:            %.10f\n", maxError)
 
 	if maxError < 1e-10 {
-		fmt.Println("✓ Perfect reconstruction achieved!")
+		fmt.Fprintln(Output, "✓ Perfect reconstruction achieved!")
 	} else if maxError < 1e-6 {
-		fmt.Println("✓ Excellent reconstruction (numerical precision)")
+		fmt.Fprintln(Output, "✓ Excellent reconstruction (numerical precision)")
 	} else {
-		fmt.Println("⚠ Reconstruction has noticeable errors")
+		fmt.Fprintln(Output, "⚠ Reconstruction has noticeable errors")
 	}
 }
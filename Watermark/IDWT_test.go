@@ -0,0 +1,67 @@
+package Watermark
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestIDWTInvertsDWT(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	Ymatrix := make([][]float64, 32)
+	for i := range Ymatrix {
+		Ymatrix[i] = make([]float64, 48)
+		for j := range Ymatrix[i] {
+			Ymatrix[i][j] = rng.Float64()*255 - 128
+		}
+	}
+	got := PerformCompleteIDWTFromResult(PerformCompleteDWT(Ymatrix))
+	for i := range Ymatrix {
+		for j := range Ymatrix[i] {
+			if math.Abs(got[i][j]-Ymatrix[i][j]) > 1e-9 {
+				t.Fatalf("(%d, %d): got %v after a round trip, want %v", i, j, got[i][j], Ymatrix[i][j])
+			}
+		}
+	}
+}
+
+func TestModifyYComponentClampsPerPixel(t *testing.T) {
+	ycb, Ymatrix := ConvertToYC(testImage(4, 4))
+	for i := range Ymatrix {
+		for j := range Ymatrix[i] {
+			Ymatrix[i][j] = float64(10*i+j) - 20.4
+		}
+	}
+	Ymatrix[0][0], Ymatrix[3][3] = 300, -300
+	Modify_YComponent(ycb, Ymatrix)
+
+	// Out-of-range pixels saturate; the rest are rounded, not rescaled
+	if y := ycb.Y[ycb.YOffset(0, 0)]; y != 255 {
+		t.Errorf("pixel above range: Y = %d, want 255", y)
+	}
+	if y := ycb.Y[ycb.YOffset(3, 3)]; y != 0 {
+		t.Errorf("pixel below range: Y = %d, want 0", y)
+	}
+	for i := range Ymatrix {
+		for j := range Ymatrix[i] {
+			if (i == 0 && j == 0) || (i == 3 && j == 3) {
+				continue
+			}
+			want := uint8(math.Round(Ymatrix[i][j] + 128))
+			if y := ycb.Y[ycb.YOffset(j, i)]; y != want {
+				t.Errorf("pixel (%d, %d): Y = %d, want %d", j, i, y, want)
+			}
+		}
+	}
+}
+
+func TestEmbedExtractRoundTrip(t *testing.T) {
+	img := testImage(512, 512)
+	marked := EmbedWithOptions(img, "round trip", DefaultOptions())
+	if !hasMessage(marked, "round trip", DefaultOptions()) {
+		t.Fatal("message not recovered from the marked image")
+	}
+	if hasMessage(img, "round trip", DefaultOptions()) {
+		t.Fatal("message recovered from the unmarked image")
+	}
+}
@@ -0,0 +1,38 @@
+package Watermark
+
+import (
+	"crypto/sha256"
+	"math/rand/v2"
+)
+
+// tileBlocks is the number of 8x8 blocks along one side of a 128x128 tile
+const tileBlocks = 128 / 8
+
+// blockOrder returns the order in which the blocks of a tile carry bit pairs:
+// pair k goes to block order[k], counted in raster order. The permutation is
+// derived from the key so that, without it, the bits cannot be read back in
+// sequence. An empty key returns nil, meaning plain raster order, which keeps
+// images marked without a key readable as before.
+func blockOrder(key string) []int {
+	if key == "" {
+		return nil
+	}
+	seed := sha256.Sum256([]byte("block-order:" + key))
+	return rand.New(rand.NewChaCha8(seed)).Perm(tileBlocks * tileBlocks)
+}
+
+// blockAt returns the raster index of the block carrying bit pair k
+func blockAt(order []int, k int) int {
+	if order == nil {
+		return k
+	}
+	return order[k]
+}
+
+// orderFor is blockOrder for the key in opts
+func orderFor(opts *Options) []int {
+	if opts == nil {
+		return nil
+	}
+	return blockOrder(opts.Key)
+}
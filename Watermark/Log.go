@@ -0,0 +1,11 @@
+package Watermark
+
+import (
+	"io"
+	"os"
+)
+
+// Output receives the progress and diagnostic messages printed by this
+// package. It defaults to standard output; set it to io.Discard to silence
+// them, or to os.Stderr to keep standard output free for program results.
+var Output io.Writer = os.Stdout
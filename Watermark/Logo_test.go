@@ -0,0 +1,138 @@
+package Watermark
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"slices"
+	"testing"
+)
+
+// ringLogo is an NxN grey ring on a white ground, with an off-centre bar so
+// that no flip or rotation of it is the same shape
+func ringLogo(n int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, n, n))
+	c := float64(n-1) / 2
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			v := uint8(230)
+			if r := math.Hypot(float64(x)-c, float64(y)-c); r > float64(n)/4 && r < float64(n)/2.5 {
+				v = 40
+			}
+			if x > n/2 && y >= n/5 && y < n/3 {
+				v = 90
+			}
+			img.SetGray(x, y, color.Gray{Y: v})
+		}
+	}
+	return img
+}
+
+func TestBinaryLogo(t *testing.T) {
+	logo, err := BinaryLogo(ringLogo(32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range logo.Pix {
+		if v != 0 && v != 255 {
+			t.Fatalf("pixel %d in a binary logo", v)
+		}
+	}
+	if logo.GrayAt(0, 0).Y != 255 || logo.GrayAt(16, 4).Y != 0 {
+		t.Error("threshold at mid-grey not applied")
+	}
+	if _, err := BinaryLogo(image.NewGray(image.Rect(0, 0, 32, 16))); !errors.Is(err, ErrInvalidImage) {
+		t.Errorf("32x16 logo: %v", err)
+	}
+}
+
+func TestArnold(t *testing.T) {
+	bits := make([]int, 32*32)
+	for i := range bits {
+		bits[i] = i % 7 % 2
+	}
+	period := arnoldPeriod(32)
+	if period != 24 {
+		t.Errorf("period of the 32x32 cat map: %d", period)
+	}
+	if !slices.Equal(arnold(bits, 32, period), bits) {
+		t.Error("a full period does not restore the logo")
+	}
+	k := arnoldIterations("k", 32)
+	if k < 1 || k >= period {
+		t.Fatalf("%d iterations of %d", k, period)
+	}
+	scrambled := arnold(bits, 32, k)
+	if slices.Equal(scrambled, bits) {
+		t.Error("scrambling left the logo as it was")
+	}
+	if !slices.Equal(arnold(scrambled, 32, period-k), bits) {
+		t.Error("the rest of the period does not unscramble")
+	}
+	if arnoldIterations("", 32) != 0 {
+		t.Error("scrambled without a key")
+	}
+}
+
+func TestLogoRoundTrip(t *testing.T) {
+	logo, _ := BinaryLogo(ringLogo(32))
+	img := testImage(512, 512)
+	opts := DefaultOptions()
+	opts.Key = "k"
+	marked, err := EmbedLogo(img, logo, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ExtractLogo(marked, 32, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nc, _ := LogoCorrelation(got, logo); nc < 0.98 {
+		t.Errorf("recovered logo correlates %.3f with the reference", nc)
+	}
+
+	// Without the key, or from an unmarked image, only noise comes back
+	for name, c := range map[string]struct {
+		img  image.Image
+		opts *Options
+	}{
+		"no key":   {marked, DefaultOptions()},
+		"unmarked": {img, opts},
+	} {
+		got, err := ExtractLogo(c.img, 32, c.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if nc, _ := LogoCorrelation(got, logo); math.Abs(nc) > 0.3 {
+			t.Errorf("%s: correlation %.3f", name, nc)
+		}
+	}
+
+	// A 64x64 logo spans 8 tiles; 512x512 holds 4
+	big, _ := BinaryLogo(ringLogo(64))
+	if _, err := EmbedLogo(img, big, opts); !errors.Is(err, ErrMessageTooLong) {
+		t.Errorf("64x64 logo: %v", err)
+	}
+	if _, err := ExtractLogo(marked, 64, opts); !errors.Is(err, ErrImageTooSmall) {
+		t.Errorf("extracting a 64x64 logo: %v", err)
+	}
+}
+
+func TestLogoCorrelation(t *testing.T) {
+	logo, _ := BinaryLogo(ringLogo(32))
+	negative := image.NewGray(logo.Bounds())
+	for i, v := range logo.Pix {
+		negative.Pix[i] = 255 - v
+	}
+	if nc, _ := LogoCorrelation(logo, logo); nc != 1 {
+		t.Errorf("logo with itself: %g", nc)
+	}
+	if nc, _ := LogoCorrelation(logo, negative); nc != -1 {
+		t.Errorf("logo with its negative: %g", nc)
+	}
+	if _, err := LogoCorrelation(logo, image.NewGray(image.Rect(0, 0, 16, 16))); !errors.Is(err, ErrInvalidImage) {
+		t.Errorf("different sizes: %v", err)
+	}
+}
@@ -0,0 +1,299 @@
+package Watermark
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"math/rand/v2"
+)
+
+// Modulator writes the two bits of an 8x8 HL block into its DCT
+// coefficients and reads them back. step is the block's QIM step, from
+// Options.Strength and, with Options.Perceptual, the masking of the block;
+// each modulator takes it as its own measure of embedding strength. block is
+// the raster index of the block in its tile, for modulators keyed per block.
+type Modulator interface {
+	Embed(dct [][]float64, bits []int, step float64, block int)
+	Extract(dct [][]float64, step float64, block int) []int
+}
+
+// Modulation names the Modulator of the pixel pipeline
+type Modulation string
+
+const (
+	// ModulationQIM quantizes the coefficients [1][3] and [3][1] onto one
+	// of two lattices, the scheme used when none is named
+	ModulationQIM Modulation = "qim"
+
+	// ModulationDithered is QIM with a keyed dither added to the lattice of
+	// each coefficient of each block, so that without the key the marked
+	// coefficients show no lattice in their histogram
+	ModulationDithered Modulation = "dithered"
+
+	// ModulationSTDM is spread-transform dither modulation: dithered QIM
+	// of the projection of the mid-frequency coefficients onto a keyed
+	// direction, spreading each bit's change thinly over many coefficients
+	ModulationSTDM Modulation = "stdm"
+
+	// ModulationSpread adds a keyed pseudo-noise sequence per bit across
+	// the mid-frequency coefficients and reads the bit from the sign of the
+	// correlation, which a change of contrast does not alter
+	ModulationSpread Modulation = "spread"
+)
+
+// ParseModulation checks a modulation name; empty means ModulationQIM
+func ParseModulation(name string) (Modulation, error) {
+	switch m := Modulation(name); m {
+	case "", ModulationQIM:
+		return ModulationQIM, nil
+	case ModulationDithered, ModulationSTDM, ModulationSpread:
+		return m, nil
+	}
+	return "", fmt.Errorf("%w: unknown modulation %q", ErrInvalidOptions, name)
+}
+
+// Keyed reports whether m draws its dithers or directions from
+// Options.Key. Without a key they come from the empty string, which anyone
+// can reproduce, and the mark is as easy to find and strip as plain QIM.
+func (m Modulation) Keyed() bool {
+	return m == ModulationDithered || m == ModulationSTDM || m == ModulationSpread
+}
+
+// CheckModulation reports whether opts names a known modulation and, for a
+// keyed one, carries a key
+func CheckModulation(opts *Options) error {
+	if _, err := ParseModulation(string(opts.Modulation)); err != nil {
+		return err
+	}
+	if opts.Modulation.Keyed() && opts.Key == "" {
+		return fmt.Errorf("%w: %s modulation needs a key", ErrInvalidOptions, opts.Modulation)
+	}
+	return nil
+}
+
+// modulatorFor is the Modulator opts names. The functions that return an
+// error check the name with CheckModulation first; the others panic on an
+// unknown one rather than embed or read with a scheme nobody asked for.
+func modulatorFor(opts *Options) Modulator {
+	if opts == nil {
+		return QIM{}
+	}
+	switch opts.Modulation {
+	case "", ModulationQIM:
+		return QIM{}
+	case ModulationDithered:
+		return newDitheredQIM(opts.Key)
+	case ModulationSTDM:
+		return newSTDM(opts.Key)
+	case ModulationSpread:
+		return newSpreadSpectrum(opts.Key)
+	}
+	panic(fmt.Errorf("%w: unknown modulation %q", ErrInvalidOptions, opts.Modulation))
+}
+
+// modulatorRand is the keyed source of a modulator's sequences
+func modulatorRand(label, key string) *rand.Rand {
+	seed := sha256.Sum256([]byte(label + ":" + key))
+	return rand.New(rand.NewChaCha8(seed))
+}
+
+// blockDithers draws a dither for each bit of each block of a tile, as a
+// fraction of a step. Half a step is enough to cover every residue, since the
+// two lattices are half a step apart, and keeping to [0, 1/2) makes a zero
+// coefficient read as 1 under any key: flat blocks then match the balanced
+// start flag half the time, as they do without dither, instead of in a
+// pattern fixed by the key that Detect would count as a mark.
+func blockDithers(rng *rand.Rand) [][2]float64 {
+	dithers := make([][2]float64, tileBlocks*tileBlocks)
+	for i := range dithers {
+		dithers[i] = [2]float64{rng.Float64() / 2, rng.Float64() / 2}
+	}
+	return dithers
+}
+
+// QIM is quantization index modulation of the coefficients [1][3] and
+// [3][1], one bit each, onto the points step/4 or 3*step/4 modulo step
+type QIM struct{}
+
+func (QIM) Embed(dct [][]float64, bits []int, step float64, block int) {
+	dct[1][3] = qimEmbed(dct[1][3], bits[0], step)
+	dct[3][1] = qimEmbed(dct[3][1], bits[1], step)
+}
+
+func (QIM) Extract(dct [][]float64, step float64, block int) []int {
+	return []int{qimExtract(dct[1][3], step), qimExtract(dct[3][1], step)}
+}
+
+// ditheredQIM is QIM of the same coefficients on lattices shifted by a keyed
+// dither, different for every bit of every block in a tile
+type ditheredQIM struct {
+	dithers [][2]float64
+}
+
+func newDitheredQIM(key string) ditheredQIM {
+	return ditheredQIM{dithers: blockDithers(modulatorRand("qim-dither", key))}
+}
+
+func (q ditheredQIM) Embed(dct [][]float64, bits []int, step float64, block int) {
+	d0, d1 := q.dithers[block][0]*step, q.dithers[block][1]*step
+	dct[1][3] = qimEmbed(dct[1][3]-d0, bits[0], step) + d0
+	dct[3][1] = qimEmbed(dct[3][1]-d1, bits[1], step) + d1
+}
+
+func (q ditheredQIM) Extract(dct [][]float64, step float64, block int) []int {
+	d0, d1 := q.dithers[block][0]*step, q.dithers[block][1]*step
+	return []int{qimExtract(dct[1][3]-d0, step), qimExtract(dct[3][1]-d1, step)}
+}
+
+// spreadPositions are the mid-frequency coefficients a spread-spectrum bit
+// is spread over, those with 2 <= u+v <= 5: bit 0 takes the even entries
+// and bit 1 the odd ones, nine each
+var spreadPositions = func() [][2]int {
+	var positions [][2]int
+	for sum := 2; sum <= 5; sum++ {
+		for u := 0; u <= sum; u++ {
+			positions = append(positions, [2]int{u, sum - u})
+		}
+	}
+	return positions
+}()
+
+// spreadSpectrum modulates each bit onto a ±1 pseudo-noise sequence drawn
+// from the key. The sequence is added with just the amplitude that brings
+// the block's correlation with it to the bit's sign by a margin of step/2,
+// so blocks whose content already agrees are left alone and the content
+// does not interfere with the ones that do not (improved spread spectrum).
+type spreadSpectrum struct {
+	chips [2][]float64 // unit-norm sequences over the positions of each bit
+}
+
+func newSpreadSpectrum(key string) spreadSpectrum {
+	rng := modulatorRand("spread-chips", key)
+	var s spreadSpectrum
+	n := len(spreadPositions) / 2
+	for b := range s.chips {
+		s.chips[b] = make([]float64, n)
+		for i := range s.chips[b] {
+			s.chips[b][i] = 1 / math.Sqrt(float64(n))
+			if rng.IntN(2) == 0 {
+				s.chips[b][i] = -s.chips[b][i]
+			}
+		}
+	}
+	return s
+}
+
+// correlation is the projection of bit b's coefficients onto its sequence
+func (s spreadSpectrum) correlation(dct [][]float64, b int) float64 {
+	var sum float64
+	for i, chip := range s.chips[b] {
+		p := spreadPositions[2*i+b]
+		sum += chip * dct[p[0]][p[1]]
+	}
+	return sum
+}
+
+func (s spreadSpectrum) Embed(dct [][]float64, bits []int, step float64, block int) {
+	for b := range s.chips {
+		sign := float64(2*bits[b] - 1)
+		shortfall := step/2 - sign*s.correlation(dct, b)
+		if shortfall <= 0 {
+			continue
+		}
+		for i, chip := range s.chips[b] {
+			p := spreadPositions[2*i+b]
+			dct[p[0]][p[1]] += sign * shortfall * chip
+		}
+	}
+}
+
+func (s spreadSpectrum) Extract(dct [][]float64, step float64, block int) []int {
+	bits := make([]int, len(s.chips))
+	for b := range s.chips {
+		if s.correlation(dct, b) > 0 {
+			bits[b] = 1
+		}
+	}
+	return bits
+}
+
+// stdm quantizes, for each bit, the projection of that bit's spread
+// positions onto a keyed unit vector, with a keyed dither; the change along
+// the vector is shared out over all of its coefficients. Vectors and
+// dithers differ from block to block.
+type stdm struct {
+	vectors [][2][]float64
+	dithers [][2]float64
+}
+
+func newSTDM(key string) stdm {
+	rng := modulatorRand("stdm", key)
+	n := len(spreadPositions) / 2
+	s := stdm{vectors: make([][2][]float64, tileBlocks*tileBlocks)}
+	for k := range s.vectors {
+		for b := range s.vectors[k] {
+			v := make([]float64, n)
+			var norm float64
+			for i := range v {
+				v[i] = rng.NormFloat64()
+				norm += v[i] * v[i]
+			}
+			for i := range v {
+				v[i] /= math.Sqrt(norm)
+			}
+			s.vectors[k][b] = v
+		}
+	}
+	s.dithers = blockDithers(rng)
+	return s
+}
+
+// projection is bit b's coefficients projected onto the block's vector
+func (s stdm) projection(dct [][]float64, b, block int) float64 {
+	var sum float64
+	for i, u := range s.vectors[block][b] {
+		p := spreadPositions[2*i+b]
+		sum += u * dct[p[0]][p[1]]
+	}
+	return sum
+}
+
+func (s stdm) Embed(dct [][]float64, bits []int, step float64, block int) {
+	for b := range s.vectors[block] {
+		d := s.dithers[block][b] * step
+		proj := s.projection(dct, b, block)
+		change := qimEmbed(proj-d, bits[b], step) + d - proj
+		for i, u := range s.vectors[block][b] {
+			p := spreadPositions[2*i+b]
+			dct[p[0]][p[1]] += change * u
+		}
+	}
+}
+
+func (s stdm) Extract(dct [][]float64, step float64, block int) []int {
+	bits := make([]int, 2)
+	for b := range bits {
+		bits[b] = qimExtract(s.projection(dct, b, block)-s.dithers[block][b]*step, step)
+	}
+	return bits
+}
+
+// blockCoding is how bits are written to the blocks of the HL band: the
+// base step, whether it is scaled per block by perceptualMask, the block
+// order from blockOrder (nil for raster) and the modulator
+type blockCoding struct {
+	alpha      float64
+	perceptual bool
+	order      []int
+	modulator  Modulator
+}
+
+// codingFor is the blockCoding opts asks for, with base step alpha
+func codingFor(opts *Options, alpha float64) blockCoding {
+	return blockCoding{
+		alpha:      alpha,
+		perceptual: opts.Perceptual,
+		order:      orderFor(opts),
+		modulator:  modulatorFor(opts),
+	}
+}
@@ -0,0 +1,140 @@
+package Watermark
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestCheckModulation(t *testing.T) {
+	for _, c := range []struct {
+		modulation Modulation
+		key        string
+		ok         bool
+	}{
+		{"", "", true},
+		{ModulationQIM, "", true},
+		{ModulationDithered, "k", true},
+		{ModulationSTDM, "k", true},
+		{ModulationSpread, "k", true},
+		{ModulationDithered, "", false},
+		{ModulationSTDM, "", false},
+		{ModulationSpread, "", false},
+		{"fm", "k", false},
+	} {
+		opts := DefaultOptions()
+		opts.Modulation, opts.Key = c.modulation, c.key
+		err := CheckModulation(opts)
+		if c.ok && err != nil || !c.ok && !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("%q with key %q: %v", c.modulation, c.key, err)
+		}
+	}
+}
+
+func TestUnknownModulationIsAnError(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Modulation = "fm"
+	if _, err := EmbedBits(testImage(256, 256), []int{1, 0, 1}, opts); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("EmbedBits: %v, want ErrInvalidOptions", err)
+	}
+	if _, err := ExtractSoftBits(testImage(256, 256), 3, opts); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("ExtractSoftBits: %v, want ErrInvalidOptions", err)
+	}
+
+	defer func() {
+		if err, _ := recover().(error); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("EmbedWithOptions panicked with %v, want ErrInvalidOptions", err)
+		}
+	}()
+	EmbedWithOptions(testImage(256, 256), "x", opts)
+	t.Error("EmbedWithOptions embedded with an unknown modulation")
+}
+
+func TestSpreadSpectrumBlocks(t *testing.T) {
+	// Blocks of mid-frequency content much larger than the step: the
+	// sequence still brings each correlation to the bit's sign
+	rng := rand.New(rand.NewPCG(5, 6))
+	s := newSpreadSpectrum("k")
+	other := newSpreadSpectrum("not k")
+	var otherErrors int
+	for block := range 200 {
+		dct := make([][]float64, 8)
+		for i := range dct {
+			dct[i] = make([]float64, 8)
+			for j := range dct[i] {
+				dct[i][j] = 30 * rng.NormFloat64()
+			}
+		}
+		bits := []int{rng.IntN(2), rng.IntN(2)}
+		s.Embed(dct, bits, 10, block)
+		if got := s.Extract(dct, 10, block); !slices.Equal(got, bits) {
+			t.Fatalf("block %d: embedded %v, read %v", block, bits, got)
+		}
+		// Scaling every coefficient keeps the signs of the correlations
+		for i := range dct {
+			for j := range dct[i] {
+				dct[i][j] *= 0.4
+			}
+		}
+		if got := s.Extract(dct, 10, block); !slices.Equal(got, bits) {
+			t.Fatalf("block %d scaled by 0.4: embedded %v, read %v", block, bits, got)
+		}
+		for b, bit := range other.Extract(dct, 10, block) {
+			if bit != bits[b] {
+				otherErrors++
+			}
+		}
+	}
+	// Another key reads about half the bits wrong
+	if otherErrors < 150 || otherErrors > 250 {
+		t.Errorf("another key reads %d of 400 bits wrong", otherErrors)
+	}
+}
+
+// lowContrast is img with every channel pulled towards mid-grey by factor
+func lowContrast(img image.Image, factor float64) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(b)
+	scale := func(v uint32) uint8 {
+		return uint8(math.Round(128 + factor*(float64(v>>8)-128)))
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			out.SetRGBA(x, y, color.RGBA{R: scale(r), G: scale(g), B: scale(bl), A: 0xFF})
+		}
+	}
+	return out
+}
+
+func TestSpreadSurvivesContrast(t *testing.T) {
+	img := testImage(512, 512)
+	qim := DefaultOptions()
+	spread := DefaultOptions()
+	spread.Modulation = ModulationSpread
+	spread.Key = "k"
+
+	for _, opts := range []*Options{qim, spread} {
+		marked := EmbedWithOptions(img, "Hello World", opts)
+		if !hasMessage(marked, "Hello World", opts) {
+			t.Errorf("%s: no message in the marked image", opts.Modulation)
+		}
+		faded := lowContrast(marked, 0.6)
+		if got := hasMessage(faded, "Hello World", opts); got != (opts == spread) {
+			t.Errorf("%q at 60%% contrast: message found %v", opts.Modulation, got)
+		}
+	}
+
+	// The spread mark needs its key
+	marked := EmbedWithOptions(img, "Hello World", spread)
+	wrong := DefaultOptions()
+	wrong.Modulation = ModulationSpread
+	wrong.Key = "not k"
+	if hasMessage(marked, "Hello World", wrong) {
+		t.Error("spread mark read with another key")
+	}
+}
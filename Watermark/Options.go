@@ -0,0 +1,95 @@
+package Watermark
+
+// Options holds the tunable parameters of the embedding and extraction paths
+type Options struct {
+	// Strength is the QIM step used on the DCT coefficients of HL-band blocks
+	Strength float64 `json:"strength"`
+
+	// PaletteStrength is the QIM step for palette images (GIF frames), whose
+	// color quantization adds far more noise than JPEG at quality 100
+	PaletteStrength float64 `json:"palette_strength"`
+
+	// PalettePasses bounds the embed-quantize-verify iterations per frame
+	PalettePasses int `json:"palette_passes"`
+
+	// VideoStrength is the QIM step for raw video planes. Their pixels are
+	// integers, so changes below half a level round away; steps under ~16
+	// lose bits to that rounding alone.
+	VideoStrength float64 `json:"video_strength"`
+
+	// TemporalSpread splits the payload over this many consecutive video
+	// frames, one tile-sized chunk per frame; 1 embeds it whole in every frame
+	TemporalSpread int `json:"temporal_spread"`
+
+	// CoefficientStep is the QIM step, in quantization units, used when
+	// embedding directly into JPEG coefficients. It must be a positive
+	// multiple of 4 so both lattice points (step/4 and 3*step/4) are integers.
+	CoefficientStep int `json:"coefficient_step"`
+
+	// TamperStrength is the QIM step of the tamper-detection bits in the LH
+	// band. Larger steps survive stronger recompression but are more visible.
+	TamperStrength float64 `json:"tamper_strength"`
+
+	// Perceptual scales the step of each block by how well its brightness
+	// and texture mask changes: smaller in flat areas, larger in busy ones.
+	// Extraction must set it too. Palette images ignore it, as the palette
+	// fitting needs the same step everywhere.
+	Perceptual bool `json:"perceptual,omitempty"`
+
+	// Modulation selects how each block carries its bits; empty means
+	// ModulationQIM. Extraction must use the same. Palette images always use
+	// QIM. The dithered, stdm and spread modulations are keyed by Key and
+	// rejected without one; see CheckModulation.
+	Modulation Modulation `json:"modulation,omitempty"`
+
+	// SyncStrength is the amplitude in grey levels of each sinusoid of the
+	// synchronization template, which lets Synchronize undo rotation and
+	// scaling before extraction. 0 embeds no template.
+	SyncStrength float64 `json:"sync_strength,omitempty"`
+
+	// Synchronize makes extraction and Detect look for the synchronization
+	// template first and undo the rotation and scaling it reveals. The
+	// resampling blurs the fine detail the bits sit in: a message embedded
+	// with ModulationSpread at a Strength of about 40 survives a rotation of
+	// a degree or so combined with a scaling by 0.9, while the QIM-based
+	// modulations lose too many bits to be read back.
+	Synchronize bool `json:"synchronize,omitempty"`
+
+	// Align makes extraction search for the tile grid of a copy cropped on
+	// the top or left before reading it; see FindAlignment
+	Align bool `json:"align,omitempty"`
+
+	// EstimateGain makes extraction search for a change of contrast since
+	// embedding and scale the steps to match; see FindGain
+	EstimateGain bool `json:"estimate_gain,omitempty"`
+
+	// FalsePositiveRate is the p-value at or below which Detect reports a
+	// watermark as present: the chance it accepts an unmarked image
+	FalsePositiveRate float64 `json:"false_positive_rate"`
+
+	// Key, when set, permutes which block of a tile carries which bit pair.
+	// Extraction must use the same key; without it the bits read back out
+	// of order and no message is found. Empty keeps the raster layout.
+	Key string `json:"key,omitempty"`
+
+	// PayloadKey, when set, encrypts and authenticates the message with
+	// AES-GCM before embedding, at a cost of SealedOverhead bytes. Extraction
+	// must use the same key; a payload that fails to open is reported as
+	// ErrAuthFailed rather than as a missing watermark.
+	PayloadKey string `json:"payload_key,omitempty"`
+}
+
+// DefaultOptions returns the settings used when no options are given
+func DefaultOptions() *Options {
+	return &Options{
+		Strength:        defaultStrength,
+		PaletteStrength: 24,
+		PalettePasses:   4,
+		VideoStrength:   20,
+		TemporalSpread:  1,
+		CoefficientStep: 4,
+		TamperStrength:  16,
+
+		FalsePositiveRate: 1e-6,
+	}
+}
@@ -0,0 +1,72 @@
+package Watermark
+
+import "math"
+
+// With Options.Perceptual the QIM step of each 8x8 HL block is the strength
+// scaled by a masking factor, after Watson's model for DCT quantization:
+// changes are harder to see in bright areas, in proportion to luminance to
+// the power 0.649, and in busy ones, in proportion to local contrast to the
+// power 0.7. Both are measured on the 8x8 block of the LL band at the same
+// place, the 16x16 pixels the HL block covers. Embedding leaves LL alone, so
+// the extractor recomputes the same steps from the marked image and needs
+// no side information.
+
+const (
+	// perceptualLuminance and perceptualContrast are the masking exponents
+	perceptualLuminance = 0.649
+	perceptualContrast  = 0.7
+
+	// perceptualReference is the block contrast, as the standard deviation
+	// of its grey levels, at which a mid-grey block keeps the plain step
+	perceptualReference = 8.0
+
+	// perceptualMin and perceptualMax bound the masking factor, so flat
+	// areas still carry bits and busy ones are not marked visibly
+	perceptualMin = 0.75
+	perceptualMax = 3.0
+)
+
+// perceptualMask is the masking factor of the 8x8 block of ll at (x, y). LL
+// holds twice the mean of each 2x2 pixel square, with Y centered at 0.
+func perceptualMask(ll [][]float64, x, y int) float64 {
+	var sum, sumSq float64
+	for i := 0; i < 8; i++ {
+		for _, v := range ll[y+i][x : x+8] {
+			sum += v / 2
+			sumSq += v * v / 4
+		}
+	}
+	mean := sum / 64
+	std := math.Sqrt(math.Max(0, sumSq/64-mean*mean))
+
+	luminance := math.Pow(math.Max(mean+128, 16)/128, perceptualLuminance)
+	contrast := math.Pow(math.Max(std, 1)/perceptualReference, perceptualContrast)
+	return math.Max(perceptualMin, math.Min(perceptualMax, luminance*contrast))
+}
+
+// blockSteps returns the QIM step of every 8x8 block of the HL band of d:
+// alpha throughout, or alpha scaled by perceptualMask when perceptual is set
+func blockSteps(d *DWTResult, alpha float64, perceptual bool) [][]float64 {
+	rows, cols := len(d.HL)/8, len(d.HL[0])/8
+	steps := make([][]float64, rows)
+	for by := range steps {
+		steps[by] = make([]float64, cols)
+		for bx := range steps[by] {
+			steps[by][bx] = alpha
+			if perceptual {
+				steps[by][bx] *= perceptualMask(d.LL, bx*8, by*8)
+			}
+		}
+	}
+	return steps
+}
+
+// tileSteps is the part of steps covering tile (i, j), in tile rows and
+// columns
+func tileSteps(steps [][]float64, i, j int) [][]float64 {
+	tile := make([][]float64, tileBlocks)
+	for r := range tile {
+		tile[r] = steps[i*tileBlocks+r][j*tileBlocks : (j+1)*tileBlocks]
+	}
+	return tile
+}
@@ -0,0 +1,102 @@
+package Watermark
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+// halfFlat is a 512x256 image, nearly flat mid-grey on the left and busy
+// on the right
+func halfFlat() *image.RGBA {
+	rng := rand.New(rand.NewPCG(7, 8))
+	img := image.NewRGBA(image.Rect(0, 0, 512, 256))
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 512; x++ {
+			v := 128 + rng.NormFloat64()
+			if x >= 256 {
+				v += 40*math.Sin(float64(x*y)/50) + 25*rng.NormFloat64()
+			}
+			v = math.Max(20, math.Min(235, v))
+			img.SetRGBA(x, y, color.RGBA{R: uint8(v), G: uint8(v), B: uint8(v), A: 0xFF})
+		}
+	}
+	return img
+}
+
+// meanChange is the mean absolute difference of luminance between a and b
+// over r
+func meanChange(a, b image.Image, r image.Rectangle) float64 {
+	var sum float64
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			ya := color.GrayModel.Convert(a.At(x, y)).(color.Gray).Y
+			yb := color.GrayModel.Convert(b.At(x, y)).(color.Gray).Y
+			sum += math.Abs(float64(ya) - float64(yb))
+		}
+	}
+	return sum / float64(r.Dx()*r.Dy())
+}
+
+func TestPerceptualMask(t *testing.T) {
+	block := func(f func(x, y int) float64) [][]float64 {
+		ll := make([][]float64, 8)
+		for y := range ll {
+			ll[y] = make([]float64, 8)
+			for x := range ll[y] {
+				ll[y][x] = 2 * f(x, y) // LL holds twice the pixel mean
+			}
+		}
+		return ll
+	}
+	// A checkerboard of ±20 grey levels about mid-grey, and about 28
+	checker := func(x, y int) float64 { return float64(20 * ((x+y)%2*2 - 1)) }
+	flat := perceptualMask(block(func(x, y int) float64 { return 0 }), 0, 0)
+	busy := perceptualMask(block(checker), 0, 0)
+	dark := perceptualMask(block(func(x, y int) float64 { return checker(x, y) - 100 }), 0, 0)
+	if flat != perceptualMin {
+		t.Errorf("flat block: %g, want the minimum %g", flat, perceptualMin)
+	}
+	if busy <= 1 || busy > perceptualMax {
+		t.Errorf("busy mid-grey block: %g", busy)
+	}
+	if dark >= busy {
+		t.Errorf("the same contrast in the dark masks %g, at mid-grey %g", dark, busy)
+	}
+}
+
+func TestPerceptualEmbedding(t *testing.T) {
+	img := halfFlat()
+	plain := DefaultOptions()
+	perceptual := DefaultOptions()
+	perceptual.Perceptual = true
+	left, right := image.Rect(0, 0, 256, 256), image.Rect(256, 0, 512, 256)
+
+	plainMarked := EmbedWithOptions(img, "Hello World", plain)
+	marked := EmbedWithOptions(img, "Hello World", perceptual)
+	if !hasMessage(marked, "Hello World", perceptual) {
+		t.Fatal("no message with perceptual steps")
+	}
+	// Weaker where it would show, stronger where it would not
+	if p, q := meanChange(img, marked, left), meanChange(img, plainMarked, left); p >= q {
+		t.Errorf("flat half changed by %.2f, %.2f with the plain step", p, q)
+	}
+	if p, q := meanChange(img, marked, right), meanChange(img, plainMarked, right); p <= q {
+		t.Errorf("busy half changed by %.2f, %.2f with the plain step", p, q)
+	}
+
+	// The extractor's steps, from the marked image, match the embedder's
+	_, Yorig := ConvertToYC(img)
+	_, Ymarked := ConvertToYC(marked)
+	before := blockSteps(PerformCompleteDWT(Yorig), perceptual.Strength, true)
+	after := blockSteps(PerformCompleteDWT(Ymarked), perceptual.Strength, true)
+	for by := range before {
+		for bx := range before[by] {
+			if math.Abs(after[by][bx]-before[by][bx]) > 0.05*before[by][bx] {
+				t.Fatalf("block (%d,%d): step %.2f embedded, %.2f recomputed", bx, by, before[by][bx], after[by][bx])
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package Watermark
+
+import (
+	"fmt"
+	"image"
+)
+
+// RawCapacity is the number of bit slots EmbedBits has in a width x height
+// image: every slot of every tile
+func RawCapacity(width, height int) int {
+	return Capacity(width, height).Tiles() * tileCapacityBits
+}
+
+// EmbedBits embeds an unframed bit sequence, such as a fingerprint codeword,
+// across all tiles. There are no start and end flags: slot k of the image,
+// counting tile by tile in raster order, carries bit k mod len(bits), so a
+// sequence shorter than the image's RawCapacity is repeated and
+// ExtractSoftBits averages the copies.
+func EmbedBits(img image.Image, bits []int, opts *Options) (*image.YCbCr, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	if err := CheckModulation(opts); err != nil {
+		return nil, err
+	}
+	b := img.Bounds()
+	capacity := RawCapacity(b.Dx(), b.Dy())
+	if capacity == 0 {
+		return nil, fmt.Errorf("%w: %dx%d has no complete tile", ErrImageTooSmall, b.Dx(), b.Dy())
+	}
+	if len(bits) == 0 || len(bits) > capacity {
+		return nil, fmt.Errorf("%w: %d bits; this image holds 1 to %d", ErrMessageTooLong, len(bits), capacity)
+	}
+	coding := codingFor(opts, opts.Strength)
+
+	ycb, Ymatrix := ConvertToYC(img)
+	original := Ymatrix
+	img_DWT := PerformCompleteDWT(Ymatrix)
+	steps := blockSteps(img_DWT, coding.alpha, coding.perceptual)
+
+	numTilesY := len(img_DWT.HL) / 128
+	numTilesX := len(img_DWT.HL[0]) / 128
+	stream := make([]int, tileCapacityBits)
+	for i := 0; i < numTilesY; i++ {
+		for j := 0; j < numTilesX; j++ {
+			first := (i*numTilesX + j) * tileCapacityBits
+			for s := range stream {
+				stream[s] = bits[(first+s)%len(bits)]
+			}
+			tile := getBlock(img_DWT.HL, j*128, i*128, 128)
+			putBlock(img_DWT.HL, embed_in_a_tile(tile, stream, tileSteps(steps, i, j), coding), j*128, i*128)
+		}
+	}
+
+	Ymatrix = restoreOddEdges(PerformCompleteIDWTFromResult(img_DWT), original)
+	Modify_YComponent(ycb, Ymatrix)
+	return ycb, nil
+}
+
+// ExtractSoftBits reads back n bits embedded with EmbedBits. Each value is
+// the mean of +1 (bit 1) and -1 (bit 0) over every copy of that bit: ±1 when
+// all copies agree, near 0 where they were erased or mixed, for example by
+// averaging differently marked copies of the image.
+func ExtractSoftBits(img image.Image, n int, opts *Options) ([]float64, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	if err := CheckModulation(opts); err != nil {
+		return nil, err
+	}
+	b := img.Bounds()
+	capacity := RawCapacity(b.Dx(), b.Dy())
+	if capacity == 0 {
+		return nil, fmt.Errorf("%w: %dx%d has no complete tile", ErrImageTooSmall, b.Dx(), b.Dy())
+	}
+	if n <= 0 || n > capacity {
+		return nil, fmt.Errorf("%w: %d bits; this image holds 1 to %d", ErrInvalidOptions, n, capacity)
+	}
+
+	_, Ymatrix := ConvertToYC(img)
+	sums := make([]float64, n)
+	counts := make([]int, n)
+	for t, bits := range extractTileBits(Ymatrix, codingFor(opts, opts.Strength)) {
+		for s, bit := range bits {
+			k := (t*tileCapacityBits + s) % n
+			sums[k] += float64(2*bit - 1)
+			counts[k]++
+		}
+	}
+	for i := range sums {
+		sums[i] /= float64(counts[i])
+	}
+	return sums, nil
+}
@@ -0,0 +1,330 @@
+package Watermark
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+)
+
+// The reversible mode hides the message in the integer Haar transform of the
+// R, G and B channels: each horizontal pixel pair (a, b) becomes the average
+// l = floor((a+b)/2) and the difference h = a-b, which map back to (a, b)
+// exactly. Differences are shifted away from zero to open an empty bin next
+// to each of the two fullest ones, 0 and -1, and every pair with h = 0 or -1
+// then carries one bit:
+//
+//	h in [1, Z-1]   -> h+1        h = 0  -> bit
+//	h in [Zn+1, -2] -> h-1        h = -1 -> -1-bit
+//
+// Z > 0 and Zn < 0 are differences no pair has, so the shifted ranges land on
+// empty bins and the extractor can undo every step. Only pairs whose average
+// lies in [G, 255-G] are touched, G being large enough that no shifted pair
+// leaves [0, 255]; the average is unchanged by embedding, so the extractor
+// picks out the same pairs.
+//
+// G, Z and Zn go in the least significant bits of the first reversibleHeader
+// red samples, which take no part in the pairs; the bits they replace lead
+// the embedded stream, followed by the message length, the CRC-32 of the
+// original pixels and the message. Extraction therefore rebuilds the
+// original image bit for bit, and the CRC confirms it.
+
+const (
+	reversibleMagic = 0xA7
+
+	// reversibleHeader is the number of red samples, from the top-left
+	// corner along the first row, holding magic, G, Z and -Zn
+	reversibleHeader = 32
+
+	// reversibleOverhead is the stream preceding the message: the header
+	// samples' own bits, a 16-bit length and a 32-bit CRC
+	reversibleOverhead = reversibleHeader + 16 + 32
+)
+
+// ReversibleInfo describes the reversible capacity of an image
+type ReversibleInfo struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+
+	// Guard is G: pairs whose average is within Guard of 0 or 255 are left
+	// alone so that shifting cannot overflow
+	Guard int `json:"guard"`
+
+	// Zero and NegZero are the empty difference bins Z and Zn
+	Zero    int `json:"zero"`
+	NegZero int `json:"neg_zero"`
+
+	// PayloadBits counts the pairs that carry a bit
+	PayloadBits int `json:"payload_bits"`
+
+	// MaxMessageBytes is what is left for the message after the header,
+	// length and CRC
+	MaxMessageBytes int `json:"max_message_bytes"`
+}
+
+// ReversibleResult is what ExtractReversible recovers
+type ReversibleResult struct {
+	Message string
+
+	// Restored is the image as it was before EmbedReversible
+	Restored *image.NRGBA
+
+	// Verified reports that Restored matches the CRC recorded at embedding;
+	// it is false when the marked image was changed after embedding
+	Verified bool
+}
+
+// reversiblePlane walks the pairs of the R, G and B channels of an NRGBA
+// image, skipping the header samples, and calls fn with the offsets of the
+// two samples in Pix
+func reversiblePlane(img *image.NRGBA, fn func(i, j int)) {
+	b := img.Bounds()
+	for c := 0; c < 3; c++ {
+		for y := 0; y < b.Dy(); y++ {
+			row := y * img.Stride
+			for x := 0; x+1 < b.Dx(); x += 2 {
+				if c == 0 && y == 0 && x < reversibleHeader {
+					continue
+				}
+				i := row + x*4 + c
+				fn(i, i+4)
+			}
+		}
+	}
+}
+
+func haarPair(a, b int) (l, h int) {
+	h = a - b
+	return (a + b) >> 1, h
+}
+
+func haarUnpair(l, h int) (a, b int) {
+	a = l + (h+1)>>1
+	return a, a - h
+}
+
+// toNRGBA returns the 8-bit, non-premultiplied pixels of img with its origin
+// at (0, 0). The result is always a copy.
+func toNRGBA(img image.Image) *image.NRGBA {
+	b := img.Bounds()
+	out := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(out, out.Bounds(), img, b.Min, draw.Src)
+	return out
+}
+
+func checkReversible(b image.Rectangle) error {
+	if b.Dx() < reversibleHeader || b.Dy() < 1 {
+		return fmt.Errorf("%w: %dx%d; the reversible mode needs a first row of %d pixels", ErrImageTooSmall, b.Dx(), b.Dy(), reversibleHeader)
+	}
+	return nil
+}
+
+// reversibleParams finds the smallest guard G for which empty bins Z and Zn
+// exist close enough to zero that no shifted pair overflows, i.e. with
+// ceil(max(Z, -Zn)/2) <= G. A smaller guard touches more pairs.
+func reversibleParams(img *image.NRGBA) (guard, zero, negZero int, ok bool) {
+	var counts [256][511]int // [l][h+255]
+	reversiblePlane(img, func(i, j int) {
+		l, h := haarPair(int(img.Pix[i]), int(img.Pix[j]))
+		counts[l][h+255]++
+	})
+
+	var hist [511]int
+	for l := 0; l < 256; l++ {
+		for h := range hist {
+			hist[h] += counts[l][h]
+		}
+	}
+	for guard = 1; guard < 128; guard++ {
+		// Drop the pairs the guard now excludes
+		for h := range hist {
+			hist[h] -= counts[guard-1][h] + counts[256-guard][h]
+		}
+		zero, negZero = 0, 0
+		for h := 2; h <= 2*guard; h++ {
+			if hist[h+255] == 0 {
+				zero = h
+				break
+			}
+		}
+		for h := -2; h >= -2*guard; h-- {
+			if hist[h+255] == 0 {
+				negZero = h
+				break
+			}
+		}
+		if zero != 0 && negZero != 0 {
+			return guard, zero, negZero, true
+		}
+	}
+	return 0, 0, 0, false
+}
+
+func inGuard(l, guard int) bool {
+	return l >= guard && l <= 255-guard
+}
+
+// ReversibleCapacity reports how many message bytes EmbedReversible can hide
+// in img
+func ReversibleCapacity(img image.Image) (*ReversibleInfo, error) {
+	if err := checkReversible(img.Bounds()); err != nil {
+		return nil, err
+	}
+	return reversibleInfo(toNRGBA(img)), nil
+}
+
+func reversibleInfo(img *image.NRGBA) *ReversibleInfo {
+	b := img.Bounds()
+	info := &ReversibleInfo{Width: b.Dx(), Height: b.Dy()}
+	guard, zero, negZero, ok := reversibleParams(img)
+	if !ok {
+		return info
+	}
+	info.Guard, info.Zero, info.NegZero = guard, zero, negZero
+	reversiblePlane(img, func(i, j int) {
+		l, h := haarPair(int(img.Pix[i]), int(img.Pix[j]))
+		if inGuard(l, guard) && (h == 0 || h == -1) {
+			info.PayloadBits++
+		}
+	})
+	info.MaxMessageBytes = max(0, min((info.PayloadBits-reversibleOverhead)/8, 0xFFFF))
+	return info
+}
+
+// pixelCRC is the CRC-32 of the visible rows of img
+func pixelCRC(img *image.NRGBA) uint32 {
+	b := img.Bounds()
+	crc := crc32.NewIEEE()
+	for y := 0; y < b.Dy(); y++ {
+		crc.Write(img.Pix[y*img.Stride : y*img.Stride+b.Dx()*4])
+	}
+	return crc.Sum32()
+}
+
+// EmbedReversible hides message so that ExtractReversible can return both the
+// message and the original pixels. Colour is handled as 8 bits per channel,
+// and the result must be stored losslessly (PNG, BMP or TIFF): any change to
+// the marked pixels, recompression included, loses the message.
+func EmbedReversible(img image.Image, message string) (*image.NRGBA, error) {
+	if err := checkReversible(img.Bounds()); err != nil {
+		return nil, err
+	}
+	marked := toNRGBA(img)
+	info := reversibleInfo(marked)
+	// A zero guard means no empty bins were found; even an empty message
+	// needs room for the header bits it displaces
+	if info.Guard == 0 || info.PayloadBits < reversibleOverhead+8*len(message) || len(message) > info.MaxMessageBytes {
+		return nil, fmt.Errorf("%w: %d bytes; this image holds %d in reversible mode", ErrMessageTooLong, len(message), info.MaxMessageBytes)
+	}
+
+	header := []byte{reversibleMagic, byte(info.Guard), byte(info.Zero), byte(-info.NegZero)}
+	stream := make([]int, 0, reversibleOverhead+8*len(message))
+	for x := 0; x < reversibleHeader; x++ {
+		stream = append(stream, int(marked.Pix[x*4]&1))
+	}
+	var fields [6]byte
+	binary.BigEndian.PutUint16(fields[:2], uint16(len(message)))
+	binary.BigEndian.PutUint32(fields[2:], pixelCRC(marked))
+	stream = append(stream, bytesToBits(fields[:])...)
+	stream = append(stream, bytesToBits([]byte(message))...)
+
+	// Pairs past the end of the stream carry 0, which leaves them as they were
+	next := 0
+	reversiblePlane(marked, func(i, j int) {
+		l, h := haarPair(int(marked.Pix[i]), int(marked.Pix[j]))
+		if !inGuard(l, info.Guard) {
+			return
+		}
+		bit := 0
+		if (h == 0 || h == -1) && next < len(stream) {
+			bit = stream[next]
+			next++
+		}
+		switch {
+		case h == 0:
+			h = bit
+		case h == -1:
+			h = -1 - bit
+		case h > 0 && h < info.Zero:
+			h++
+		case h < -1 && h > info.NegZero:
+			h--
+		default:
+			return
+		}
+		a, b := haarUnpair(l, h)
+		marked.Pix[i], marked.Pix[j] = uint8(a), uint8(b)
+	})
+
+	for x, bit := range bytesToBits(header) {
+		marked.Pix[x*4] = marked.Pix[x*4]&^1 | uint8(bit)
+	}
+	fmt.Fprintf(Output, "Reversible embed: %d of %d bits used (guard %d, bins %d/%d)\n",
+		len(stream), info.PayloadBits, info.Guard, info.NegZero, info.Zero)
+	return marked, nil
+}
+
+// ExtractReversible reads the message hidden by EmbedReversible and undoes
+// the embedding. It returns ErrNoWatermark when the image carries no
+// reversible mark.
+func ExtractReversible(img image.Image) (*ReversibleResult, error) {
+	if err := checkReversible(img.Bounds()); err != nil {
+		return nil, err
+	}
+	restored := toNRGBA(img)
+
+	var headerBits []int
+	for x := 0; x < reversibleHeader; x++ {
+		headerBits = append(headerBits, int(restored.Pix[x*4]&1))
+	}
+	header := bitsToBytes(headerBits)
+	guard, zero, negZero := int(header[1]), int(header[2]), -int(header[3])
+	if header[0] != reversibleMagic || guard < 1 || guard > 127 ||
+		zero < 2 || zero > 2*guard || negZero > -2 || negZero < -2*guard {
+		return nil, fmt.Errorf("%w: no reversible header", ErrNoWatermark)
+	}
+
+	var stream []int
+	reversiblePlane(restored, func(i, j int) {
+		l, h := haarPair(int(restored.Pix[i]), int(restored.Pix[j]))
+		if !inGuard(l, guard) {
+			return
+		}
+		switch {
+		case h == 0 || h == 1:
+			stream = append(stream, h)
+			h = 0
+		case h == -1 || h == -2:
+			stream = append(stream, -1-h)
+			h = -1
+		case h > 1 && h <= zero:
+			h--
+		case h < -2 && h >= negZero:
+			h++
+		default:
+			return
+		}
+		a, b := haarUnpair(l, h)
+		restored.Pix[i], restored.Pix[j] = uint8(a), uint8(b)
+	})
+
+	if len(stream) < reversibleOverhead {
+		return nil, fmt.Errorf("%w: reversible stream cut short", ErrNoWatermark)
+	}
+	for x, bit := range stream[:reversibleHeader] {
+		restored.Pix[x*4] = restored.Pix[x*4]&^1 | uint8(bit)
+	}
+	fields := bitsToBytes(stream[reversibleHeader:reversibleOverhead])
+	length := int(binary.BigEndian.Uint16(fields[:2]))
+	if reversibleOverhead+8*length > len(stream) {
+		return nil, fmt.Errorf("%w: reversible message length %d exceeds the stream", ErrNoWatermark, length)
+	}
+	message := bitsToBytes(stream[reversibleOverhead : reversibleOverhead+8*length])
+
+	return &ReversibleResult{
+		Message:  string(message),
+		Restored: restored,
+		Verified: pixelCRC(restored) == binary.BigEndian.Uint32(fields[2:]),
+	}, nil
+}
@@ -0,0 +1,68 @@
+package Watermark
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func uniformImage(width, height int, c color.Color) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	return img
+}
+
+func TestReversibleRestoresEveryByte(t *testing.T) {
+	const message = "Hello World"
+	for name, img := range map[string]image.Image{
+		"textured": testImage(256, 192),
+		"grey":     uniformImage(64, 64, color.Gray{Y: 128}),
+		"odd":      testImage(101, 37),
+	} {
+		original := toNRGBA(img)
+		marked, err := EmbedReversible(img, message)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if bytes.Equal(marked.Pix, original.Pix) {
+			t.Errorf("%s: embedding changed nothing", name)
+		}
+		r, err := ExtractReversible(marked)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if r.Message != message || !r.Verified {
+			t.Errorf("%s: message %q, verified %v", name, r.Message, r.Verified)
+		}
+		if !bytes.Equal(r.Restored.Pix, original.Pix) {
+			t.Errorf("%s: restored pixels differ from the original", name)
+		}
+	}
+}
+
+func TestReversibleRefusesWhatItCannotRestore(t *testing.T) {
+	for name, img := range map[string]image.Image{
+		// Every average is 255: no pair is inside any guard
+		"white": uniformImage(64, 64, color.White),
+		// 4 pairs outside the header, far short of the overhead
+		"row": uniformImage(40, 1, color.Gray{Y: 128}),
+	} {
+		for _, message := range []string{"", "x"} {
+			if _, err := EmbedReversible(img, message); !errors.Is(err, ErrMessageTooLong) {
+				t.Errorf("%s, message %q: %v, want ErrMessageTooLong", name, message, err)
+			}
+		}
+	}
+
+	info, err := ReversibleCapacity(testImage(256, 192))
+	if err != nil {
+		t.Fatal(err)
+	}
+	long := string(make([]byte, info.MaxMessageBytes+1))
+	if _, err := EmbedReversible(testImage(256, 192), long); !errors.Is(err, ErrMessageTooLong) {
+		t.Errorf("%d bytes in a %d-byte image: %v", len(long), info.MaxMessageBytes, err)
+	}
+}
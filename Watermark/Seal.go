@@ -0,0 +1,103 @@
+package Watermark
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"slices"
+)
+
+// sealedMagic marks a payload encrypted with a PayloadKey. It is not valid
+// UTF-8 on its own, so a plaintext message never starts with it by accident.
+const sealedMagic = 0xA5
+
+// SealedOverhead is the number of bytes encryption adds to a message: the
+// magic byte, a 12-byte nonce and the 16-byte authentication tag
+const SealedOverhead = 1 + 12 + 16
+
+// MessageLimit is the longest message a tile holds under opts, which is
+// SealedOverhead less than MaxMessageBytes when a PayloadKey is set
+func MessageLimit(opts *Options) int {
+	if opts != nil && opts.PayloadKey != "" {
+		return MaxMessageBytes - SealedOverhead
+	}
+	return MaxMessageBytes
+}
+
+// payloadAEAD returns AES-256-GCM keyed by a hash of the passphrase
+func payloadAEAD(passphrase string) cipher.AEAD {
+	key := sha256.Sum256([]byte("payload-key:" + passphrase))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		panic(err) // 32-byte keys are always accepted
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return aead
+}
+
+// payloadBits is BuildWatermarkBits for the message as it is embedded under
+// opts: sealed with AES-GCM when a PayloadKey is set, as is otherwise. The
+// ciphertext is random, so it can contain the end flag and would be cut
+// short on extraction; a fresh nonce is drawn until the stream reads back
+// whole.
+func payloadBits(message string, opts *Options) []int {
+	if opts == nil || opts.PayloadKey == "" {
+		return BuildWatermarkBits(message)
+	}
+	aead := payloadAEAD(opts.PayloadKey)
+	for {
+		sealed := make([]byte, 1+aead.NonceSize(), SealedOverhead+len(message))
+		sealed[0] = sealedMagic
+		rand.Read(sealed[1:])
+		sealed = aead.Seal(sealed, sealed[1:], []byte(message), sealed[:1])
+
+		stream := BuildWatermarkBits(string(sealed))
+		if got, found := findMessage(stream); found && got == string(sealed) {
+			return stream
+		}
+	}
+}
+
+// readPayload finds the message in bits and, when a PayloadKey is set,
+// decrypts it. authFailed reports a message that was found but could not be
+// opened: sealed under another key, tampered with, or not sealed at all. A
+// sealed message read without a key is reported the same way rather than
+// returned as ciphertext. The signature of a signed message is dropped;
+// Verify checks it.
+func readPayload(bits []int, opts *Options) (message string, found, authFailed bool) {
+	message, found, authFailed = openPayload(bits, opts)
+	if found {
+		message = stripSignature(message)
+	}
+	return message, found, authFailed
+}
+
+// openPayload is readPayload keeping any signature
+func openPayload(bits []int, opts *Options) (message string, found, authFailed bool) {
+	raw, found := findMessage(bits)
+	if !found {
+		return "", false, false
+	}
+	sealed := []byte(raw)
+	isSealed := len(sealed) >= SealedOverhead && sealed[0] == sealedMagic
+	if opts == nil || opts.PayloadKey == "" {
+		if isSealed {
+			return "", false, true
+		}
+		return raw, true, false
+	}
+	if !isSealed {
+		return "", false, true
+	}
+	aead := payloadAEAD(opts.PayloadKey)
+	nonce := sealed[1 : 1+aead.NonceSize()]
+	plain, err := aead.Open(nil, nonce, slices.Clone(sealed[1+aead.NonceSize():]), sealed[:1])
+	if err != nil {
+		return "", false, true
+	}
+	return string(plain), true, false
+}
@@ -0,0 +1,320 @@
+package Watermark
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"image"
+)
+
+// SignatureScheme identifies how a signed payload was signed. Its value is
+// the byte after signedMagic.
+type SignatureScheme byte
+
+// signedMagic starts every signed payload. 0xF8 never occurs in UTF-8, so an
+// unsigned text message cannot be mistaken for a signed one.
+const signedMagic = 0xF8
+
+const (
+	// SchemeEd25519 signs with an Ed25519 private key; anyone holding the
+	// public key can verify, so the signature proves who embedded the mark
+	SchemeEd25519 SignatureScheme = 0xE1
+
+	// SchemeHMAC is HMAC-SHA256 truncated to HMACSize bytes. It fits in a
+	// single tile next to a short message, but verifying needs the secret.
+	SchemeHMAC SignatureScheme = 0xE2
+)
+
+// HMACSize is the length of a truncated HMAC signature in bytes
+const HMACSize = 16
+
+// maxSignedChunks bounds how many tiles one copy of a signed payload may
+// span, and so how many layouts Verify tries
+const maxSignedChunks = 4
+
+// Size is the signature length in bytes
+func (s SignatureScheme) Size() int {
+	switch s {
+	case SchemeEd25519:
+		return ed25519.SignatureSize
+	case SchemeHMAC:
+		return HMACSize
+	}
+	return 0
+}
+
+func (s SignatureScheme) String() string {
+	switch s {
+	case SchemeEd25519:
+		return "ed25519"
+	case SchemeHMAC:
+		return "hmac-sha256"
+	}
+	return fmt.Sprintf("unknown(%#x)", byte(s))
+}
+
+// Signer produces the signature embedded with a message
+type Signer interface {
+	Scheme() SignatureScheme
+	Sign(data []byte) []byte
+}
+
+// Verifier checks a signature read back from an image
+type Verifier interface {
+	Scheme() SignatureScheme
+	Verify(data, signature []byte) bool
+}
+
+// Ed25519Signer signs with a private key
+type Ed25519Signer struct{ Key ed25519.PrivateKey }
+
+func (Ed25519Signer) Scheme() SignatureScheme { return SchemeEd25519 }
+
+func (s Ed25519Signer) Sign(data []byte) []byte { return ed25519.Sign(s.Key, data) }
+
+// Ed25519Verifier verifies with the matching public key
+type Ed25519Verifier struct{ Key ed25519.PublicKey }
+
+func (Ed25519Verifier) Scheme() SignatureScheme { return SchemeEd25519 }
+
+func (v Ed25519Verifier) Verify(data, signature []byte) bool {
+	return ed25519.Verify(v.Key, data, signature)
+}
+
+// HMACKey is a shared secret that both signs and verifies
+type HMACKey []byte
+
+func (HMACKey) Scheme() SignatureScheme { return SchemeHMAC }
+
+func (k HMACKey) Sign(data []byte) []byte {
+	mac := hmac.New(sha256.New, k)
+	mac.Write(data)
+	return mac.Sum(nil)[:HMACSize]
+}
+
+func (k HMACKey) Verify(data, signature []byte) bool {
+	return hmac.Equal(k.Sign(data), signature)
+}
+
+// signedData is what a signature covers. The salt varies the otherwise
+// deterministic signature; see signedStream.
+func signedData(scheme SignatureScheme, salt byte, message string) []byte {
+	data := []byte("wm-signature\x00")
+	data = append(data, byte(scheme), salt)
+	return append(data, message...)
+}
+
+// signedStream returns the flagged bit stream of signedMagic | scheme | salt
+// | signature | message, sealed when opts has a PayloadKey. A signature can contain the
+// end flag and would then be cut short on extraction; the salt is stepped
+// until it does not.
+func signedStream(message string, signer Signer, opts *Options) ([]int, error) {
+	scheme := signer.Scheme()
+	for salt := 0; salt < 256; salt++ {
+		payload := []byte{signedMagic, byte(scheme), byte(salt)}
+		payload = append(payload, signer.Sign(signedData(scheme, byte(salt), message))...)
+		payload = append(payload, message...)
+
+		stream := payloadBits(string(payload), opts)
+		if opts != nil && opts.PayloadKey != "" {
+			return stream, nil // payloadBits already checked the sealed stream
+		}
+		if got, found := findMessage(stream); found && got == string(payload) {
+			return stream, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no salt gives a signature free of the end flag", ErrInvalidOptions)
+}
+
+// SignedChunks is the number of tiles one copy of a signed message spans
+func SignedChunks(message string, scheme SignatureScheme, opts *Options) int {
+	n := len(message) + 3 + scheme.Size()
+	if opts != nil && opts.PayloadKey != "" {
+		n += SealedOverhead
+	}
+	bits := 32 + 8*n
+	return (bits + tileCapacityBits - 1) / tileCapacityBits
+}
+
+// EmbedSigned embeds message together with a signature over it. When the
+// payload outgrows a tile, as an Ed25519 signature does, it is split into
+// tile-sized chunks and tile k carries chunk k mod n, so the image must hold
+// at least n tiles; Verify finds n by trying each layout.
+func EmbedSigned(img image.Image, message string, signer Signer, opts *Options) (*image.YCbCr, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	if err := CheckModulation(opts); err != nil {
+		return nil, err
+	}
+	b := img.Bounds()
+	tiles := Capacity(b.Dx(), b.Dy()).Tiles()
+	if tiles == 0 {
+		return nil, fmt.Errorf("%w: %dx%d; at least 256x256 is needed for one tile", ErrImageTooSmall, b.Dx(), b.Dy())
+	}
+	n := SignedChunks(message, signer.Scheme(), opts)
+	if n > min(tiles, maxSignedChunks) {
+		return nil, fmt.Errorf("%w: the signed payload spans %d tiles; this image holds %d and at most %d are used",
+			ErrMessageTooLong, n, tiles, maxSignedChunks)
+	}
+
+	stream, err := signedStream(message, signer, opts)
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := temporalChunks(stream, n)
+	if err != nil {
+		return nil, err
+	}
+	return embedChunks(img, chunks, opts), nil
+}
+
+// embedChunks embeds chunk k mod len(chunks) in tile k, in raster order
+func embedChunks(img image.Image, chunks [][]int, opts *Options) *image.YCbCr {
+	coding := codingFor(opts, opts.Strength)
+
+	ycb, Ymatrix := ConvertToYC(img)
+	if opts.SyncStrength > 0 {
+		addSyncTemplate(Ymatrix, opts.SyncStrength)
+	}
+	original := Ymatrix
+	img_DWT := PerformCompleteDWT(Ymatrix)
+	steps := blockSteps(img_DWT, coding.alpha, coding.perceptual)
+
+	numTilesY := len(img_DWT.HL) / 128
+	numTilesX := len(img_DWT.HL[0]) / 128
+	for i := 0; i < numTilesY; i++ {
+		for j := 0; j < numTilesX; j++ {
+			tile := getBlock(img_DWT.HL, j*128, i*128, 128)
+			chunk := chunks[(i*numTilesX+j)%len(chunks)]
+			putBlock(img_DWT.HL, embed_in_a_tile(tile, chunk, tileSteps(steps, i, j), coding), j*128, i*128)
+		}
+	}
+
+	Ymatrix = restoreOddEdges(PerformCompleteIDWTFromResult(img_DWT), original)
+	Modify_YComponent(ycb, Ymatrix)
+	return ycb
+}
+
+// chunkVotes reassembles a stream embedded by embedChunks in n chunks,
+// voting across the tiles that carry the same chunk
+func chunkVotes(tiles [][]int, n int) []int {
+	slots := make([]bitVotes, n)
+	for t, bits := range tiles {
+		slots[t%n].add(bits)
+	}
+	var combined []int
+	for i := range slots {
+		combined = append(combined, slots[i].result()...)
+	}
+	return combined
+}
+
+// SignatureStatus is the outcome of Verify
+type SignatureStatus int
+
+const (
+	// SignatureAbsent: no message, or a message carrying no signature
+	SignatureAbsent SignatureStatus = iota
+
+	// SignatureInvalid: a signature was found but does not verify with the
+	// key given, or was made with another scheme
+	SignatureInvalid
+
+	// SignatureValid: the signature verifies with the key given
+	SignatureValid
+)
+
+func (s SignatureStatus) String() string {
+	switch s {
+	case SignatureValid:
+		return "valid"
+	case SignatureInvalid:
+		return "invalid"
+	}
+	return "absent"
+}
+
+func (s SignatureStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// Verification is the result of Verify
+type Verification struct {
+	Status  SignatureStatus `json:"status"`
+	Scheme  string          `json:"scheme,omitempty"`
+	Message string          `json:"message,omitempty"`
+
+	// Chunks is the number of tiles one copy of the payload spans
+	Chunks int `json:"chunks,omitempty"`
+
+	// AuthFailed is set when a payload was found but did not open with the
+	// PayloadKey, so its signature could not be read
+	AuthFailed bool `json:"auth_failed,omitempty"`
+}
+
+// Verify extracts a signed message embedded by EmbedSigned and checks its
+// signature. Each layout of 1 to maxSignedChunks tiles per copy is tried,
+// votes being taken across the tiles carrying the same chunk; the first
+// layout that yields a message decides.
+func Verify(img image.Image, verifier Verifier, opts *Options) *Verification {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	img, opts = prepared(img, opts)
+	_, Ymatrix := ConvertToYC(img)
+	tiles := extractTileBits(Ymatrix, codingFor(opts, opts.Strength))
+
+	v := &Verification{}
+	for n := 1; n <= min(len(tiles), maxSignedChunks); n++ {
+		message, found, authFailed := openPayload(chunkVotes(tiles, n), opts)
+		if authFailed {
+			v.AuthFailed = true
+		}
+		if !found {
+			continue
+		}
+		v.AuthFailed = false
+		v.Chunks = n
+		checkSignature(v, []byte(message), verifier)
+		return v
+	}
+	return v
+}
+
+// splitSigned splits signedMagic | scheme | salt | signature | message; ok is
+// false for an ordinary message embedded without a signature
+func splitSigned(payload []byte) (scheme SignatureScheme, salt byte, signature []byte, message string, ok bool) {
+	if len(payload) < 3 || payload[0] != signedMagic {
+		return 0, 0, nil, string(payload), false
+	}
+	scheme = SignatureScheme(payload[1])
+	size := scheme.Size()
+	if size == 0 || len(payload) < 3+size {
+		return 0, 0, nil, string(payload), false
+	}
+	return scheme, payload[2], payload[3 : 3+size], string(payload[3+size:]), true
+}
+
+// stripSignature returns the message of a signed payload, or the payload
+// itself when it is not signed
+func stripSignature(payload string) string {
+	_, _, _, message, _ := splitSigned([]byte(payload))
+	return message
+}
+
+// checkSignature parses a payload read back by Verify and fills in v
+func checkSignature(v *Verification, payload []byte, verifier Verifier) {
+	scheme, salt, signature, message, ok := splitSigned(payload)
+	v.Message = message
+	if !ok {
+		return
+	}
+	v.Scheme = scheme.String()
+	v.Status = SignatureInvalid
+	if verifier != nil && verifier.Scheme() == scheme && verifier.Verify(signedData(scheme, salt, message), signature) {
+		v.Status = SignatureValid
+	}
+}
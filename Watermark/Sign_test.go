@@ -0,0 +1,35 @@
+package Watermark
+
+import "testing"
+
+func TestUnsignedMessagesKeepTheirFirstBytes(t *testing.T) {
+	// “ and € start with 0xE2, ሴ with 0xE1: the bytes of the signature schemes
+	opts := DefaultOptions()
+	for _, message := range []string{"“Quoted” note for Alice #42", "€100 paid to Alice, invoice 7", "ሴ tag"} {
+		marked := EmbedWithOptions(testImage(512, 512), message, opts)
+		if !hasMessage(marked, message, opts) {
+			t.Errorf("%q not extracted; got %q", message, ExtractWithOptions(marked, opts))
+		}
+		if v := Verify(marked, HMACKey("secret"), opts); v.Status != SignatureAbsent || v.Message != message {
+			t.Errorf("%q: verify reports %s with %q", message, v.Status, v.Message)
+		}
+	}
+}
+
+func TestSignedMessage(t *testing.T) {
+	const message = "€5 to Bob"
+	opts := DefaultOptions()
+	marked, err := EmbedSigned(testImage(512, 512), message, HMACKey("secret"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasMessage(marked, message, opts) {
+		t.Errorf("signature not stripped on extraction: %q", ExtractWithOptions(marked, opts))
+	}
+	if v := Verify(marked, HMACKey("secret"), opts); v.Status != SignatureValid || v.Message != message {
+		t.Errorf("verify with the key: %s %q", v.Status, v.Message)
+	}
+	if v := Verify(marked, HMACKey("other"), opts); v.Status != SignatureInvalid {
+		t.Errorf("verify with another key: %s", v.Status)
+	}
+}
@@ -0,0 +1,454 @@
+package Watermark
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/cmplx"
+	"slices"
+)
+
+// The synchronization template is a sum of syncPeaks sinusoids added to Y
+// before the message is embedded. Each is a pair of sharp peaks in the DFT
+// magnitude, at a frequency fixed in cycles per pixel. Rotating an image
+// rotates those peaks by the same angle and scaling it by s divides their
+// radius by s, so matching the peaks found in a suspect image against the
+// template gives the rotation and scale. The radii differ, so the match is
+// unambiguous; the spectrum of a real image is symmetric, so rotation is
+// known modulo 180 degrees, and angles beyond ±90 are taken as the
+// equivalent turn the other way.
+//
+// The transform is assumed to be about the image centre, as for resizing
+// and for rotating in place. The remaining sub-period shift, from rounding
+// of the canvas size, is read from the phases of the sinusoids, which are
+// zero at the original top-left pixel.
+//
+// The message itself sits in DCT coefficients close to the Nyquist
+// frequency, which resampling at fractional offsets attenuates whatever the
+// interpolator, and a downscaling removes outright. Synchronization restores
+// the geometry, not that band. QIM reads each bit from one coefficient and
+// loses 30 to 50% of them to a 1 degree rotation with a 0.9 scaling;
+// ModulationSpread correlates each bit over many coefficients, most below
+// the lost band, and at a Strength of about 40 keeps all but a few percent.
+
+// syncFrequencies are the template frequencies as (radius in cycles per
+// pixel, angle in degrees). Radii below 0.27 stay under the Nyquist limit
+// after downscaling to half size.
+var syncFrequencies = [][2]float64{
+	{0.19, 20},
+	{0.22, 75},
+	{0.25, 120},
+	{0.21, 160},
+}
+
+const (
+	syncPeaks = 4
+
+	// syncMinMatched is how many template peaks must be found for an
+	// estimate to be trusted
+	syncMinMatched = 3
+
+	// syncWindow bounds the side of the square analysed by the DFT
+	syncWindow = 1024
+
+	// syncCandidates is how many of the strongest spectral peaks are
+	// matched against the template
+	syncCandidates = 24
+)
+
+// syncVector returns template frequency k in cycles per pixel
+func syncVector(k int) (u, v float64) {
+	r, deg := syncFrequencies[k][0], syncFrequencies[k][1]*math.Pi/180
+	return r * math.Cos(deg), r * math.Sin(deg)
+}
+
+// addSyncTemplate adds the template to Ymatrix with the given amplitude in
+// grey levels per sinusoid
+func addSyncTemplate(Ymatrix [][]float64, amplitude float64) {
+	for y, row := range Ymatrix {
+		for x := range row {
+			var sum float64
+			for k := range syncPeaks {
+				u, v := syncVector(k)
+				sum += math.Cos(2 * math.Pi * (u*float64(x) + v*float64(y)))
+			}
+			row[x] += amplitude * sum
+		}
+	}
+}
+
+// Geometry is the transform EstimateGeometry finds between the original
+// image and a suspect copy: the copy is the original rotated by Rotation
+// degrees and scaled by Scale about its centre, with the original top-left
+// pixel landing at (OriginX, OriginY)
+type Geometry struct {
+	Rotation float64 `json:"rotation"`
+	Scale    float64 `json:"scale"`
+	OriginX  float64 `json:"origin_x"`
+	OriginY  float64 `json:"origin_y"`
+
+	// Width and Height are the size of the original, estimated from the
+	// copy's size and Scale
+	Width  int `json:"width"`
+	Height int `json:"height"`
+
+	// Matched is the number of template peaks found
+	Matched int `json:"matched"`
+
+	// shiftX and shiftY are the residual shift read from the template
+	// phases, in original pixels
+	shiftX, shiftY float64
+}
+
+// Identity reports whether g is close enough to no transform at all that
+// resampling would do more harm than good
+func (g *Geometry) Identity(width, height int) bool {
+	return math.Abs(g.Rotation) < 0.05 && math.Abs(g.Scale-1) < 0.001 &&
+		g.Width == width && g.Height == height &&
+		math.Abs(g.shiftX) < 0.01 && math.Abs(g.shiftY) < 0.01
+}
+
+// spectralPeak is a local maximum of the whitened magnitude spectrum, at a
+// frequency in cycles per pixel folded into the upper half plane
+type spectralPeak struct {
+	u, v, score float64
+}
+
+// findSpectralPeaks returns the strongest local maxima of the log magnitude
+// spectrum of Ymatrix, relative to their neighbourhood, in a Hann-windowed
+// square at the centre of the image
+func findSpectralPeaks(Ymatrix [][]float64) []spectralPeak {
+	h, w := len(Ymatrix), len(Ymatrix[0])
+	n := 1
+	for n*2 <= min(w, h, syncWindow) {
+		n *= 2
+	}
+	x0, y0 := (w-n)/2, (h-n)/2
+
+	hann := make([]float64, n)
+	for i := range hann {
+		hann[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n))
+	}
+	spectrum := make([][]complex128, n)
+	for y := range spectrum {
+		spectrum[y] = make([]complex128, n)
+		for x := range spectrum[y] {
+			spectrum[y][x] = complex(Ymatrix[y0+y][x0+x]*hann[x]*hann[y], 0)
+		}
+	}
+	fft2D(spectrum)
+
+	logMag := make([][]float64, n)
+	for y := range logMag {
+		logMag[y] = make([]float64, n)
+		for x := range logMag[y] {
+			logMag[y][x] = math.Log1p(cmplx.Abs(spectrum[y][x]))
+		}
+	}
+	at := func(x, y int) float64 { return logMag[(y+n)%n][(x+n)%n] }
+
+	const radius = 4 // neighbourhood for whitening and for the local maximum test
+	var peaks []spectralPeak
+	for ky := 0; ky <= n/2; ky++ {
+		for kx := -n/2 + 1; kx < n/2; kx++ {
+			if ky == 0 && kx <= 0 {
+				continue
+			}
+			r := math.Hypot(float64(kx), float64(ky)) / float64(n)
+			if r < 0.08 || r > 0.48 {
+				continue
+			}
+			centre := at(kx, ky)
+			var sum float64
+			isMax := true
+			for dy := -radius; dy <= radius && isMax; dy++ {
+				for dx := -radius; dx <= radius; dx++ {
+					if dx == 0 && dy == 0 {
+						continue
+					}
+					v := at(kx+dx, ky+dy)
+					if v > centre {
+						isMax = false
+						break
+					}
+					sum += v
+				}
+			}
+			if !isMax {
+				continue
+			}
+			// Parabolic interpolation places the peak between bins
+			fx := float64(kx) + parabolicOffset(at(kx-1, ky), centre, at(kx+1, ky))
+			fy := float64(ky) + parabolicOffset(at(kx, ky-1), centre, at(kx, ky+1))
+			peaks = append(peaks, spectralPeak{
+				u:     fx / float64(n),
+				v:     fy / float64(n),
+				score: centre - sum/float64((2*radius+1)*(2*radius+1)-1),
+			})
+		}
+	}
+	slices.SortFunc(peaks, func(a, b spectralPeak) int {
+		switch {
+		case a.score > b.score:
+			return -1
+		case a.score < b.score:
+			return 1
+		}
+		return 0
+	})
+	return peaks[:min(len(peaks), syncCandidates)]
+}
+
+func parabolicOffset(left, centre, right float64) float64 {
+	d := left - 2*centre + right
+	if d == 0 {
+		return 0
+	}
+	return math.Max(-0.5, math.Min(0.5, 0.5*(left-right)/d))
+}
+
+// foldHalfPlane maps a frequency to its conjugate when needed, so that both
+// peaks of a sinusoid compare equal
+func foldHalfPlane(u, v float64) (float64, float64) {
+	if v < 0 || (v == 0 && u < 0) {
+		return -u, -v
+	}
+	return u, v
+}
+
+// matchTemplate tries every pairing of a template peak with a spectral peak
+// as the anchor of a rotation and scale, and keeps the hypothesis under
+// which most other template peaks land on spectral peaks. The result is the
+// least-squares similarity (a, b) with f' = [a -b; b a] f over the matches.
+func matchTemplate(peaks []spectralPeak, tolerance float64) (a, b float64, matched int) {
+	type pair struct{ tu, tv, pu, pv float64 }
+	var best []pair
+	var bestScore, bestA, bestB float64
+	for i := range syncPeaks {
+		tu, tv := syncVector(i)
+		for _, p := range peaks {
+			// Similarity taking template i onto p
+			norm := tu*tu + tv*tv
+			ha, hb := (tu*p.u+tv*p.v)/norm, (tu*p.v-tv*p.u)/norm
+
+			var pairs []pair
+			var score float64
+			for k := range syncPeaks {
+				ku, kv := syncVector(k)
+				eu, ev := ha*ku-hb*kv, hb*ku+ha*kv
+				fu, fv := foldHalfPlane(eu, ev)
+				for _, q := range peaks {
+					if math.Hypot(q.u-fu, q.v-fv) < tolerance {
+						// Unfold the peak to the side the hypothesis predicts
+						qu, qv := q.u, q.v
+						if fu != eu || fv != ev {
+							qu, qv = -qu, -qv
+						}
+						pairs = append(pairs, pair{ku, kv, qu, qv})
+						score += q.score
+						break
+					}
+				}
+			}
+			if len(pairs) > len(best) || (len(pairs) == len(best) && score > bestScore) {
+				best, bestScore, bestA, bestB = pairs, score, ha, hb
+			}
+		}
+	}
+	if len(best) < syncMinMatched {
+		return bestA, bestB, len(best)
+	}
+
+	var num1, num2, den float64
+	for _, p := range best {
+		num1 += p.tu*p.pu + p.tv*p.pv
+		num2 += p.tu*p.pv - p.tv*p.pu
+		den += p.tu*p.tu + p.tv*p.tv
+	}
+	return num1 / den, num2 / den, len(best)
+}
+
+// EstimateGeometry locates the synchronization template in img and returns
+// the rotation and scale relative to the marked original. It returns
+// ErrNoWatermark when too few template peaks are found.
+func EstimateGeometry(img image.Image) (*Geometry, error) {
+	b := img.Bounds()
+	if b.Dx() < 64 || b.Dy() < 64 {
+		return nil, fmt.Errorf("%w: %dx%d is too small to find the sync template", ErrImageTooSmall, b.Dx(), b.Dy())
+	}
+	_, Ymatrix := ConvertToYC(img)
+	peaks := findSpectralPeaks(Ymatrix)
+
+	n := 1
+	for n*2 <= min(b.Dx(), b.Dy(), syncWindow) {
+		n *= 2
+	}
+	a, bb, matched := matchTemplate(peaks, 2.5/float64(n))
+	if matched < syncMinMatched {
+		return nil, fmt.Errorf("%w: %d of %d sync template peaks found", ErrNoWatermark, matched, syncPeaks)
+	}
+
+	// Frequencies scale by 1/s and rotate with the image
+	scale := 1 / math.Hypot(a, bb)
+	rotation := math.Atan2(bb, a) * 180 / math.Pi
+	if rotation > 90 {
+		rotation -= 180
+	} else if rotation < -90 {
+		rotation += 180
+	}
+	g := &Geometry{
+		Rotation: rotation,
+		Scale:    scale,
+		Width:    int(math.Round(float64(b.Dx()) / scale)),
+		Height:   int(math.Round(float64(b.Dy()) / scale)),
+		Matched:  matched,
+	}
+	if math.Abs(g.Scale-1) < 0.001 {
+		g.Scale = 1
+		g.Width, g.Height = b.Dx(), b.Dy()
+	}
+	if math.Abs(g.Rotation) < 0.05 {
+		g.Rotation = 0
+	}
+
+	// Read the residual shift from the template phases in the rectified image
+	dx, dy := templateShift(rectify(img, g))
+	g.shiftX, g.shiftY = -dx, -dy
+	g.OriginX, g.OriginY = g.toSuspect(b, 0, 0)
+	fmt.Fprintf(Output, "Sync: rotation %.2f°, scale %.4f, shift (%.2f, %.2f), %d peaks\n",
+		g.Rotation, g.Scale, g.shiftX, g.shiftY, matched)
+	return g, nil
+}
+
+// templateShift finds the shift d for which the template phases best fit
+// img(x) = original(x + d), searching within a few pixels of zero. Rectifying
+// with a further shift of -d then lines the grid up.
+func templateShift(img image.Image) (float64, float64) {
+	_, Ymatrix := ConvertToYC(img)
+	corr := make([]complex128, syncPeaks)
+	for k := range corr {
+		u, v := syncVector(k)
+		var sum complex128
+		for y, row := range Ymatrix {
+			for x, value := range row {
+				sum += complex(value, 0) * cmplx.Exp(complex(0, -2*math.Pi*(u*float64(x)+v*float64(y))))
+			}
+		}
+		corr[k] = sum
+	}
+
+	bestX, bestY, best := 0.0, 0.0, math.Inf(-1)
+	for dy := -3.0; dy <= 3.0; dy += 0.05 {
+		for dx := -3.0; dx <= 3.0; dx += 0.05 {
+			var fit float64
+			for k, c := range corr {
+				u, v := syncVector(k)
+				fit += cmplx.Abs(c) * math.Cos(cmplx.Phase(c)-2*math.Pi*(u*dx+v*dy))
+			}
+			if fit > best {
+				bestX, bestY, best = dx, dy, fit
+			}
+		}
+	}
+	return bestX, bestY
+}
+
+// toSuspect maps a pixel of the original to the suspect image with bounds b
+func (g *Geometry) toSuspect(b image.Rectangle, x, y float64) (float64, float64) {
+	theta := g.Rotation * math.Pi / 180
+	cos, sin := math.Cos(theta), math.Sin(theta)
+	ox, oy := float64(g.Width-1)/2, float64(g.Height-1)/2
+	sx, sy := float64(b.Dx()-1)/2, float64(b.Dy()-1)/2
+	dx, dy := x+g.shiftX-ox, y+g.shiftY-oy
+	return g.Scale*(cos*dx-sin*dy) + sx, g.Scale*(sin*dx+cos*dy) + sy
+}
+
+// rectify resamples img onto the original's pixel grid. The message lives in
+// the finest detail band, which bilinear interpolation all but erases at
+// half-pixel offsets, so the sharper Catmull-Rom cubic is used. Pixels that
+// fall outside img are left black.
+func rectify(img image.Image, g *Geometry) *image.RGBA {
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			src.Set(x, y, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, g.Width, g.Height))
+	for y := 0; y < g.Height; y++ {
+		for x := 0; x < g.Width; x++ {
+			sx, sy := g.toSuspect(b, float64(x), float64(y))
+			x0, y0 := int(math.Floor(sx)), int(math.Floor(sy))
+			if x0 < 0 || y0 < 0 || x0+1 >= b.Dx() || y0+1 >= b.Dy() {
+				continue
+			}
+			wx, wy := catmullRom(sx-float64(x0)), catmullRom(sy-float64(y0))
+			var c [4]float64
+			for j := range 4 {
+				py := min(max(y0-1+j, 0), b.Dy()-1)
+				for i := range 4 {
+					px := min(max(x0-1+i, 0), b.Dx()-1)
+					w := wx[i] * wy[j]
+					p := src.Pix[py*src.Stride+px*4:]
+					for k := range c {
+						c[k] += w * float64(p[k])
+					}
+				}
+			}
+			out.SetRGBA(x, y, color.RGBA{R: clampByte(c[0]), G: clampByte(c[1]), B: clampByte(c[2]), A: clampByte(c[3])})
+		}
+	}
+	return out
+}
+
+// catmullRom returns the weights of the four samples around an offset t in
+// [0, 1) past the second of them
+func catmullRom(t float64) [4]float64 {
+	t2, t3 := t*t, t*t*t
+	return [4]float64{
+		(-t3 + 2*t2 - t) / 2,
+		(3*t3 - 5*t2 + 2) / 2,
+		(-3*t3 + 4*t2 + t) / 2,
+		(t3 - t2) / 2,
+	}
+}
+
+func clampByte(v float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Round(v))))
+}
+
+// Synchronize undoes the rotation and scaling of a copy of an image marked
+// with a sync template, returning it on the original's pixel grid ready for
+// extraction. An image whose geometry is unchanged is returned as is.
+func Synchronize(img image.Image) (image.Image, *Geometry, error) {
+	g, err := EstimateGeometry(img)
+	if err != nil {
+		return nil, nil, err
+	}
+	b := img.Bounds()
+	if g.Identity(b.Dx(), b.Dy()) {
+		return img, g, nil
+	}
+	return rectify(img, g), g, nil
+}
+
+// synchronized is the image extraction runs on: img rectified when
+// opts.Synchronize is set and the template is found, img itself otherwise.
+// The options returned have Synchronize cleared, so that the steps after it,
+// which may extract to test what they found, do not resample again.
+func synchronized(img image.Image, opts *Options) (image.Image, *Options) {
+	if !opts.Synchronize {
+		return img, opts
+	}
+	o := *opts
+	o.Synchronize = false
+	out, _, err := Synchronize(img)
+	if err != nil {
+		fmt.Fprintf(Output, "Sync: %v; extracting without it\n", err)
+		return img, &o
+	}
+	return out, &o
+}
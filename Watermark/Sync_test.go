@@ -0,0 +1,83 @@
+package Watermark
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+// transformed is img rotated by rotation degrees and scaled by scale about
+// its centre, resampled as rectify does
+func transformed(img image.Image, rotation, scale float64) image.Image {
+	b := img.Bounds()
+	return rectify(img, &Geometry{
+		Rotation: -rotation,
+		Scale:    1 / scale,
+		Width:    int(math.Round(float64(b.Dx()) * scale)),
+		Height:   int(math.Round(float64(b.Dy()) * scale)),
+	})
+}
+
+func TestEstimateGeometry(t *testing.T) {
+	opts := DefaultOptions()
+	opts.SyncStrength = 2
+	marked := EmbedWithOptions(testImage(768, 768), "Hello World", opts)
+
+	for _, c := range []struct{ rotation, scale float64 }{
+		{0, 1}, {2, 0.9}, {-5, 1}, {0.5, 1.1},
+	} {
+		g, err := EstimateGeometry(transformed(marked, c.rotation, c.scale))
+		if err != nil {
+			t.Fatalf("rotation %g, scale %g: %v", c.rotation, c.scale, err)
+		}
+		if math.Abs(g.Rotation-c.rotation) > 0.1 || math.Abs(g.Scale-c.scale) > 0.005 {
+			t.Errorf("rotation %g, scale %g: estimated %.3f, %.4f", c.rotation, c.scale, g.Rotation, g.Scale)
+		}
+		if math.Abs(float64(g.Width-768)) > 2 || math.Abs(float64(g.Height-768)) > 2 {
+			t.Errorf("rotation %g, scale %g: original size estimated as %dx%d", c.rotation, c.scale, g.Width, g.Height)
+		}
+	}
+
+	if _, err := EstimateGeometry(testImage(768, 768)); err == nil {
+		t.Error("found a sync template in an unmarked image")
+	}
+}
+
+func TestSynchronizedDetection(t *testing.T) {
+	// Resampling twice costs QIM too many bits to decode the message, but
+	// enough start flags survive a small rotation for Detect
+	opts := DefaultOptions()
+	opts.SyncStrength = 2
+	opts.Strength = 30
+	attacked := transformed(EmbedWithOptions(testImage(768, 768), "Hello World", opts), 0.5, 1)
+
+	if d := Detect(attacked, opts); d.Present {
+		t.Errorf("Detect without Synchronize: p-value %g", d.PValue)
+	}
+	opts.Synchronize = true
+	if d := Detect(attacked, opts); !d.Present {
+		t.Errorf("Detect with Synchronize: p-value %g", d.PValue)
+	}
+}
+
+func TestSynchronizedExtraction(t *testing.T) {
+	// Resampling twice costs QIM-based modulations most of their bits; a
+	// strong spread-spectrum mark keeps enough for some tiles to decode
+	opts := DefaultOptions()
+	opts.SyncStrength = 2
+	opts.Modulation = ModulationSpread
+	opts.Key = "k"
+	opts.Strength = 40
+	attacked := transformed(EmbedWithOptions(testImage(768, 768), "Hello World", opts), 1, 0.9)
+
+	if hasMessage(attacked, "Hello World", opts) {
+		t.Error("message read from the rotated copy without Synchronize")
+	}
+	opts.Synchronize = true
+	if !hasMessage(attacked, "Hello World", opts) {
+		t.Error("message not read from the rotated copy with Synchronize")
+	}
+	if d := Detect(attacked, opts); !d.Present {
+		t.Errorf("Detect with Synchronize: p-value %g", d.PValue)
+	}
+}
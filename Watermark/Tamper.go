@@ -0,0 +1,292 @@
+package Watermark
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// The tamper-detection mark protects the image in 16x16 regions, each of
+// which is one 4x4 block of the second-level Haar subbands (the DWT of LL).
+// The content of a region is summarised by the means of its four 8x8
+// quadrants, read from LL2 and quantized to tamperMeanStep; embedding moves
+// every quadrant mean to the centre of its bin, so recompression that shifts
+// a mean by less than half a step leaves the summary unchanged. A keyed hash
+// of the summary and the region's position gives tamperBits bits, each
+// embedded by QIM in the mean of a 2x2 group of LH2 or HL2 coefficients.
+// Second-level details are orthogonal to LL2, so the bits do not move the
+// summary, and they lie below the frequencies JPEG quantizes hardest. The
+// first-level HL band is left alone, so the mark coexists with the robust
+// message.
+//
+// A JPEG stores luma at full resolution but chroma subsampled; rebuilding
+// RGB from the shared chroma clips dark, saturated pixels and moves the luma
+// computed from them by several grey levels. VerifyTamper therefore reads a
+// decoded JPEG's luma plane as it was stored.
+
+// TamperRegion is the side in pixels of a region checked by VerifyTamper
+const TamperRegion = 16
+
+const (
+	tamperBits = 8
+
+	// tamperMeanStep is the quantization step of a quadrant mean in LL2
+	// units, which are four times the pixel mean: 4 grey levels
+	tamperMeanStep = 16.0
+)
+
+// tamperSummary returns the quantized quadrant means of the 4x4 LL2 block at
+// (x, y), moving each quadrant to the centre of its bin when adjust is set
+func tamperSummary(LL2 [][]float64, x, y int, adjust bool) [4]int32 {
+	var summary [4]int32
+	for q := 0; q < 4; q++ {
+		qx, qy := x+(q%2)*2, y+(q/2)*2
+		mean := (LL2[qy][qx] + LL2[qy][qx+1] + LL2[qy+1][qx] + LL2[qy+1][qx+1]) / 4
+		bin := math.Floor(mean / tamperMeanStep)
+		summary[q] = int32(bin)
+		if adjust {
+			delta := (bin+0.5)*tamperMeanStep - mean
+			LL2[qy][qx] += delta
+			LL2[qy][qx+1] += delta
+			LL2[qy+1][qx] += delta
+			LL2[qy+1][qx+1] += delta
+		}
+	}
+	return summary
+}
+
+// tamperGroup returns the band and top-left corner of the 2x2 coefficient
+// group carrying bit i of the region whose level-2 block starts at (x, y)
+func tamperGroup(d *DWTResult, i, x, y int) ([][]float64, int, int) {
+	band := d.LH
+	if i >= 4 {
+		band = d.HL
+	}
+	q := i % 4
+	return band, x + (q%2)*2, y + (q/2)*2
+}
+
+// tamperCode is the keyed hash of a region's summary and position
+func tamperCode(key string, bx, by int, summary [4]int32) []int {
+	mac := hmac.New(sha256.New, []byte("tamper:"+key))
+	var buf [4]byte
+	for _, v := range []int32{int32(bx), int32(by), summary[0], summary[1], summary[2], summary[3]} {
+		binary.BigEndian.PutUint32(buf[:], uint32(v))
+		mac.Write(buf[:])
+	}
+	sum := mac.Sum(nil)
+	bits := make([]int, tamperBits)
+	for i := range bits {
+		bits[i] = int(sum[i/8]>>(7-i%8)) & 1
+	}
+	return bits
+}
+
+// tamperPasses bounds the embed-verify iterations of EmbedTamper
+const tamperPasses = 3
+
+// EmbedTamper adds the tamper-detection mark. opts.Key is required: without
+// a secret anyone could recompute the codes of an edited image.
+//
+// In dark, saturated colours the conversion back to RGB clips channels and
+// moves luma enough to break some codes, so the marked image is checked and
+// marked again, up to tamperPasses times, until every bit reads back.
+func EmbedTamper(img image.Image, opts *Options) (*image.YCbCr, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	if err := checkTamper(img, opts); err != nil {
+		return nil, err
+	}
+
+	marked := embedTamperPass(img, opts)
+	for pass := 1; pass < tamperPasses; pass++ {
+		// Checked as the RGB a lossless file will hold
+		rgb := image.NewRGBA(marked.Bounds())
+		draw.Draw(rgb, rgb.Bounds(), marked, marked.Bounds().Min, draw.Src)
+		report, err := VerifyTamper(rgb, opts)
+		if err != nil {
+			return nil, err
+		}
+		// The threshold is for recompression; the marked image itself
+		// should carry every bit
+		failing := 0
+		for _, n := range report.Mismatches {
+			if n > 0 {
+				failing++
+			}
+		}
+		fmt.Fprintf(Output, "Tamper pass %d: %d regions have wrong bits\n", pass, failing)
+		if failing == 0 {
+			break
+		}
+		marked = embedTamperPass(marked, opts)
+	}
+	return marked, nil
+}
+
+func embedTamperPass(img image.Image, opts *Options) *image.YCbCr {
+	ycb, Ymatrix := ConvertToYC(img)
+	original := Ymatrix
+	level1 := PerformCompleteDWT(Ymatrix)
+	level2 := PerformCompleteDWT(level1.LL)
+
+	regionsY, regionsX := len(level2.LL)/4, len(level2.LL[0])/4
+	for by := 0; by < regionsY; by++ {
+		for bx := 0; bx < regionsX; bx++ {
+			x, y := bx*4, by*4
+			code := tamperCode(opts.Key, bx, by, tamperSummary(level2.LL, x, y, true))
+			for i, bit := range code {
+				band, gx, gy := tamperGroup(level2, i, x, y)
+				mean := (band[gy][gx] + band[gy][gx+1] + band[gy+1][gx] + band[gy+1][gx+1]) / 4
+				delta := qimEmbed(mean, bit, opts.TamperStrength) - mean
+				band[gy][gx] += delta
+				band[gy][gx+1] += delta
+				band[gy+1][gx] += delta
+				band[gy+1][gx+1] += delta
+			}
+		}
+	}
+
+	level1.LL = restoreOddEdges(PerformCompleteIDWTFromResult(level2), level1.LL)
+	Ymatrix = restoreOddEdges(PerformCompleteIDWTFromResult(level1), original)
+	Modify_YComponent(ycb, Ymatrix)
+	return ycb
+}
+
+func checkTamper(img image.Image, opts *Options) error {
+	if opts.Key == "" {
+		return fmt.Errorf("%w: tamper detection needs a key", ErrInvalidOptions)
+	}
+	if opts.TamperStrength <= 0 {
+		return fmt.Errorf("%w: tamper strength must be positive", ErrInvalidOptions)
+	}
+	b := img.Bounds()
+	if b.Dx() < TamperRegion || b.Dy() < TamperRegion {
+		return fmt.Errorf("%w: %dx%d has no complete %dx%d region", ErrImageTooSmall, b.Dx(), b.Dy(), TamperRegion, TamperRegion)
+	}
+	return nil
+}
+
+// TamperReport is the outcome of VerifyTamper: one entry per region, in
+// raster order
+type TamperReport struct {
+	Region   int `json:"region"` // side of a region in pixels
+	RegionsX int `json:"regions_x"`
+	RegionsY int `json:"regions_y"`
+
+	// Mismatches counts, per region, the code bits that differ from those
+	// recomputed from the region's content
+	Mismatches []int `json:"-"`
+
+	// Threshold is the number of mismatching bits from which a region is
+	// reported as tampered
+	Threshold int `json:"threshold"`
+
+	Tampered int `json:"tampered"` // regions at or above Threshold
+}
+
+// IsTampered reports whether the region at column x, row y was modified
+func (r *TamperReport) IsTampered(x, y int) bool {
+	return r.Mismatches[y*r.RegionsX+x] >= r.Threshold
+}
+
+// Fraction is the share of regions reported as tampered
+func (r *TamperReport) Fraction() float64 {
+	if len(r.Mismatches) == 0 {
+		return 0
+	}
+	return float64(r.Tampered) / float64(len(r.Mismatches))
+}
+
+// tamperThreshold tolerates two flipped bits per region. JPEG resaves down
+// to quality 80 flip one now and then, and two in near-black regions, where
+// the mark is partly clipped away. An edited region keeps a wrong code
+// unnoticed with probability 37/256, so an edit spanning two regions escapes
+// with probability under 1/40.
+const tamperThreshold = 3
+
+// VerifyTamper recomputes the code of every region from its content and
+// compares it with the embedded one. The key and TamperStrength must match
+// those used by EmbedTamper.
+func VerifyTamper(img image.Image, opts *Options) (*TamperReport, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	if err := checkTamper(img, opts); err != nil {
+		return nil, err
+	}
+
+	level2 := PerformCompleteDWT(PerformCompleteDWT(tamperLuma(img)).LL)
+
+	report := &TamperReport{
+		Region:    TamperRegion,
+		RegionsX:  len(level2.LL[0]) / 4,
+		RegionsY:  len(level2.LL) / 4,
+		Threshold: tamperThreshold,
+	}
+	report.Mismatches = make([]int, report.RegionsX*report.RegionsY)
+	for by := 0; by < report.RegionsY; by++ {
+		for bx := 0; bx < report.RegionsX; bx++ {
+			x, y := bx*4, by*4
+			code := tamperCode(opts.Key, bx, by, tamperSummary(level2.LL, x, y, false))
+
+			n := 0
+			for i, bit := range code {
+				band, gx, gy := tamperGroup(level2, i, x, y)
+				mean := (band[gy][gx] + band[gy][gx+1] + band[gy+1][gx] + band[gy+1][gx+1]) / 4
+				if qimExtract(mean, opts.TamperStrength) != bit {
+					n++
+				}
+			}
+			report.Mismatches[by*report.RegionsX+bx] = n
+			if n >= report.Threshold {
+				report.Tampered++
+			}
+		}
+	}
+	return report, nil
+}
+
+// tamperLuma is the centred luma of img, read from the luma plane of a
+// YCbCr image rather than through RGB
+func tamperLuma(img image.Image) [][]float64 {
+	ycb, ok := img.(*image.YCbCr)
+	if !ok {
+		_, Ymatrix := ConvertToYC(img)
+		return Ymatrix
+	}
+	b := ycb.Bounds()
+	Ymatrix := make([][]float64, b.Dy())
+	for y := range Ymatrix {
+		Ymatrix[y] = make([]float64, b.Dx())
+		for x := range Ymatrix[y] {
+			Ymatrix[y][x] = float64(ycb.Y[ycb.YOffset(b.Min.X+x, b.Min.Y+y)]) - 128
+		}
+	}
+	return Ymatrix
+}
+
+// TamperMap renders a report over the image it was made from: the image is
+// shown dimmed and in grey, with tampered regions in red
+func TamperMap(img image.Image, report *TamperReport) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			grey := color.GrayModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.Gray).Y / 2
+			rx, ry := x/report.Region, y/report.Region
+			if rx < report.RegionsX && ry < report.RegionsY && report.IsTampered(rx, ry) {
+				out.SetRGBA(x, y, color.RGBA{R: 128 + grey, G: grey / 2, B: grey / 2, A: 255})
+			} else {
+				out.SetRGBA(x, y, color.RGBA{R: grey, G: grey, B: grey, A: 255})
+			}
+		}
+	}
+	return out
+}
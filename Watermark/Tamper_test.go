@@ -0,0 +1,103 @@
+package Watermark
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"testing"
+)
+
+// darkImage is testImage with its lower half in dark, saturated colours
+// alternating every 3 pixels, where rebuilding RGB from subsampled chroma
+// clips
+func darkImage(width, height int) *image.RGBA {
+	img := testImage(width, height)
+	for y := height / 2; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := img.RGBAAt(x, y).R / 4
+			if (x/3+y/3)%2 == 0 {
+				img.SetRGBA(x, y, color.RGBA{R: 2 + v/4, G: 2, B: 2 + v, A: 0xFF})
+			} else {
+				img.SetRGBA(x, y, color.RGBA{R: 2 + v, G: 2 + v/8, B: 2, A: 0xFF})
+			}
+		}
+	}
+	return img
+}
+
+// resave encodes img as a JPEG of the given quality and decodes it
+func resave(t *testing.T, img image.Image, quality int) image.Image {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestTamperSurvivesJPEGResave(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Key = "tamper-test"
+	marked, err := EmbedTamper(darkImage(512, 512), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// As written to a lossless file, then resaved
+	rgb := image.NewRGBA(marked.Bounds())
+	draw.Draw(rgb, rgb.Bounds(), marked, image.Point{}, draw.Src)
+
+	for _, quality := range []int{95, 90, 85} {
+		for name, img := range map[string]image.Image{"marked": marked, "lossless copy": rgb} {
+			report, err := VerifyTamper(resave(t, img, quality), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Tampered != 0 {
+				t.Errorf("unedited %s resaved at quality %d: %d regions reported tampered", name, quality, report.Tampered)
+			}
+		}
+	}
+}
+
+func TestTamperFindsEdit(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Key = "tamper-test"
+	marked, err := EmbedTamper(darkImage(512, 512), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := image.NewRGBA(marked.Bounds())
+	draw.Draw(edited, edited.Bounds(), marked, image.Point{}, draw.Src)
+	// Paint over a 64x64 area in each half
+	for _, at := range []image.Point{{96, 96}, {320, 352}} {
+		draw.Draw(edited, image.Rectangle{Min: at, Max: at.Add(image.Pt(64, 64))}, image.NewUniform(color.RGBA{R: 200, G: 180, B: 40, A: 0xFF}), image.Point{}, draw.Src)
+	}
+
+	report, err := VerifyTamper(resave(t, edited, 90), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, at := range []image.Point{{96, 96}, {320, 352}} {
+		found := 0
+		for y := at.Y / TamperRegion; y < (at.Y+64)/TamperRegion; y++ {
+			for x := at.X / TamperRegion; x < (at.X+64)/TamperRegion; x++ {
+				if report.IsTampered(x, y) {
+					found++
+				}
+			}
+		}
+		// Each region escapes with probability 37/256
+		if found < 8 {
+			t.Errorf("edit at %v: %d of its 16 regions reported tampered", at, found)
+		}
+	}
+	if report.Tampered > 32 {
+		t.Errorf("%d regions reported tampered for two edits of 16 regions each", report.Tampered)
+	}
+}
@@ -0,0 +1,174 @@
+package Watermark
+
+import (
+	"InvisibleWaterMarkingSystem/ImageIO"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// planeToYMatrix centers an 8-bit luma plane around zero, as ConvertToYC does
+func planeToYMatrix(plane []byte, width, height int) [][]float64 {
+	Ymatrix := make([][]float64, height)
+	for y := 0; y < height; y++ {
+		Ymatrix[y] = make([]float64, width)
+		for x := 0; x < width; x++ {
+			Ymatrix[y][x] = float64(plane[y*width+x]) - 128.0
+		}
+	}
+	return Ymatrix
+}
+
+// yMatrixToPlane writes a centered Y matrix back into an 8-bit plane
+func yMatrixToPlane(Ymatrix [][]float64, plane []byte, width int) {
+	for y, row := range Ymatrix {
+		for x, v := range row {
+			plane[y*width+x] = uint8(math.Min(math.Max(math.Round(v+128.0), 0), 255))
+		}
+	}
+}
+
+// temporalChunks splits the watermark stream into spread chunks of one tile
+// each. With spread 1 the stream is embedded whole in every frame.
+func temporalChunks(stream []int, spread int) ([][]int, error) {
+	if spread <= 1 {
+		if len(stream) > tileCapacityBits {
+			return nil, fmt.Errorf("%w: needs %d bits but a tile holds %d; increase the temporal spread", ErrMessageTooLong, len(stream), tileCapacityBits)
+		}
+		return [][]int{stream}, nil
+	}
+	if len(stream) > spread*tileCapacityBits {
+		return nil, fmt.Errorf("%w: needs %d bits but %d spread frames hold %d", ErrMessageTooLong, len(stream), spread, spread*tileCapacityBits)
+	}
+
+	chunks := make([][]int, spread)
+	for i := range chunks {
+		chunks[i] = make([]int, tileCapacityBits)
+		if i*tileCapacityBits < len(stream) {
+			copy(chunks[i], stream[i*tileCapacityBits:])
+		}
+	}
+	return chunks, nil
+}
+
+// Embed_Watermark_Y4M reads a YUV4MPEG2 stream, embeds the message into the Y
+// plane of every frame and writes the result. Chroma is copied untouched.
+// With opts.TemporalSpread = K > 1, frame n carries the (n mod K)-th tile-sized
+// chunk of the payload, so K frames together hold K times one tile's capacity.
+// Returns the number of frames written.
+func Embed_Watermark_Y4M(r io.Reader, w io.Writer, message string, opts *Options) (int, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	if err := CheckModulation(opts); err != nil {
+		return 0, err
+	}
+
+	reader, err := ImageIO.NewY4MReader(r)
+	if err != nil {
+		return 0, err
+	}
+	header := reader.Header
+	if header.Width < minFrameSize || header.Height < minFrameSize {
+		return 0, fmt.Errorf("%w: frames are %dx%d; at least %dx%d is needed for one tile", ErrImageTooSmall,
+			header.Width, header.Height, minFrameSize, minFrameSize)
+	}
+
+	chunks, err := temporalChunks(payloadBits(message, opts), opts.TemporalSpread)
+	if err != nil {
+		return 0, err
+	}
+
+	coding := codingFor(opts, opts.VideoStrength)
+	writer, err := ImageIO.NewY4MWriter(w, header)
+	if err != nil {
+		return 0, err
+	}
+
+	frames := 0
+	for {
+		frame, err := reader.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return frames, err
+		}
+
+		fmt.Fprintf(Output, "--- Frame %d ---\n", frames)
+		Ymatrix := planeToYMatrix(frame.Y, header.Width, header.Height)
+		Ymatrix = embedInYMatrix(Ymatrix, chunks[frames%len(chunks)], coding)
+		yMatrixToPlane(Ymatrix, frame.Y, header.Width)
+
+		if err := writer.WriteFrame(frame); err != nil {
+			return frames, err
+		}
+		frames++
+	}
+
+	if frames == 0 {
+		return 0, errors.New("stream has no frames")
+	}
+	return frames, writer.Flush()
+}
+
+// Extract_Watermark_Y4M votes the tile bits of all frames together. With a
+// temporal spread, votes are kept per chunk slot and the slots concatenated.
+func Extract_Watermark_Y4M(r io.Reader, opts *Options) (*SequenceResult, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	if err := CheckModulation(opts); err != nil {
+		return nil, err
+	}
+
+	reader, err := ImageIO.NewY4MReader(r)
+	if err != nil {
+		return nil, err
+	}
+	header := reader.Header
+
+	coding := codingFor(opts, opts.VideoStrength)
+	spread := max(opts.TemporalSpread, 1)
+	slots := make([]bitVotes, spread)
+	result := &SequenceResult{}
+
+	for {
+		frame, err := reader.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		Ymatrix := planeToYMatrix(frame.Y, header.Width, header.Height)
+		tiles := extractTileBits(Ymatrix, coding)
+
+		frameMessage := ""
+		if spread == 1 {
+			if message, found, _ := readPayload(voteBits(tiles), opts); found {
+				frameMessage = message
+			}
+		}
+		result.FrameResult = append(result.FrameResult, frameMessage)
+
+		for _, bits := range tiles {
+			slots[result.FrameCount%spread].add(bits)
+		}
+		result.FrameCount++
+		result.TileCount += len(tiles)
+	}
+
+	var combined []int
+	for i := range slots {
+		bits := slots[i].result()
+		if spread > 1 && len(bits) < tileCapacityBits {
+			bits = append(bits, make([]int, tileCapacityBits-len(bits))...)
+		}
+		combined = append(combined, bits...)
+	}
+	result.Message, result.Found, result.AuthFailed = readPayload(combined, opts)
+	return result, nil
+}
@@ -62,42 +62,24 @@ func Modify_YComponent(ycb *image.YCbCr, Ymatrix [][]float64) {
 		}
 	}
 
-	fmt.Printf("Before normalization - Min: %.2f, Max: %.2f\n", minValue, maxValue)
+	fmt.Fprintf(Output, "Before normalization - Min: %.2f, Max: %.2f\n", minValue, maxValue)
 
-	// Check if values are within expected range [-128, 127]
-	needsNormalization := minValue < -128 || maxValue > 127
-
-	if needsNormalization {
-		// Adaptive normalization: scale to fit within [-128, 127] range
-		valueRange := maxValue - minValue
-		targetRange := 255.0 // Range from -128 to 127
-
-		fmt.Printf("Applying adaptive normalization (range: %.2f -> %.2f)\n", valueRange, targetRange)
-
-		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-			for x := bounds.Min.X; x < bounds.Max.X; x++ {
-				yi := y - bounds.Min.Y
-				xi := x - bounds.Min.X
+	// Values outside [-128, 127] come from the watermark pushing already
+	// saturated pixels. They are clamped per pixel: rescaling the whole
+	// matrix to fit would shift every coefficient off the QIM lattice.
+	if minValue < -128 || maxValue > 127 {
+		fmt.Fprintln(Output, "Clamping out-of-range values to [0, 255]")
+	}
 
-				// Normalize to [-128, 127] range, then shift to [0, 255]
-				normalized := ((Ymatrix[yi][xi]-minValue)/valueRange)*targetRange - 128.0
-				value := normalized + 128.0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			yi := y - bounds.Min.Y
+			xi := x - bounds.Min.X
 
-				ycb.Y[ycb.YOffset(x, y)] = uint8(math.Min(math.Max(value, 0), 255))
-			}
-		}
-	} else {
-		// Values are within range, just add 128
-		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-			for x := bounds.Min.X; x < bounds.Max.X; x++ {
-				yi := y - bounds.Min.Y
-				xi := x - bounds.Min.X
-
-				value := Ymatrix[yi][xi] + 128.0
-				ycb.Y[ycb.YOffset(x, y)] = uint8(math.Min(math.Max(value, 0), 255))
-			}
+			value := Ymatrix[yi][xi] + 128.0
+			ycb.Y[ycb.YOffset(x, y)] = uint8(math.Min(math.Max(math.Round(value), 0), 255))
 		}
 	}
 
-	fmt.Println("Y component modification complete")
+	fmt.Fprintln(Output, "Y component modification complete")
 }
@@ -0,0 +1,261 @@
+package Watermark
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"math"
+	"math/rand/v2"
+	"os"
+	"slices"
+)
+
+// Zero-watermarking leaves the pixels untouched. A binary feature is read
+// from the image: the level-1 LL and HL bands are cut into a zeroGrid x
+// zeroGrid grid of cells, and each cell gives one bit for whether its LL mean
+// is above the median of all cells and one for whether its mean absolute HL
+// coefficient is. Both are relative to the image itself, so they survive
+// recompression, moderate rescaling and global brightness changes that move
+// every cell alike. The owner's message, with a CRC-32, is repeated over the
+// feature and XORed with it; the result is the registered ZeroKey, kept by
+// the owner or a trusted party. Recovery XORs the key with the feature of a
+// suspect image and takes a majority vote over the copies of each bit.
+
+const (
+	// zeroGrid is the number of cells along each side of the grid
+	zeroGrid = 32
+
+	// zeroFeatureBits is the length of the feature: one LL and one HL bit
+	// per cell
+	zeroFeatureBits = 2 * zeroGrid * zeroGrid
+
+	zeroKeyVersion = 1
+)
+
+// ZeroMaxMessageBytes is the longest message RegisterZero accepts. With its
+// CRC it is repeated at least four times over the feature.
+const ZeroMaxMessageBytes = 60
+
+// ZeroKey is the registered key of a zero-watermark. It is all that is needed,
+// with the suspect image and the Options key, to recover the message.
+type ZeroKey struct {
+	Version int `json:"version"`
+
+	// Width and Height are those of the registered image, for reference
+	Width  int `json:"width"`
+	Height int `json:"height"`
+
+	// Bits is the length of the message stream, CRC included
+	Bits int `json:"bits"`
+
+	// Keyed records that an Options key shuffled the feature; recovery needs
+	// the same key
+	Keyed bool `json:"keyed"`
+
+	// Code is the feature XOR the repeated message stream, packed MSB first
+	Code []byte `json:"code"`
+}
+
+// ZeroRecovery is the result of RecoverZero
+type ZeroRecovery struct {
+	Message string `json:"message"`
+
+	// Agreement is the share of feature bits that agree with the majority
+	// vote of their message bit: near 1 for the registered image, near 0.5
+	// for an unrelated one
+	Agreement float64 `json:"agreement"`
+}
+
+// zeroFeature reads the binary feature of img
+func zeroFeature(img image.Image) ([]int, error) {
+	b := img.Bounds()
+	if b.Dx() < 2*zeroGrid || b.Dy() < 2*zeroGrid {
+		return nil, fmt.Errorf("%w: %dx%d; zero-watermarking needs at least %dx%d", ErrImageTooSmall, b.Dx(), b.Dy(), 2*zeroGrid, 2*zeroGrid)
+	}
+	_, Ymatrix := ConvertToYC(img)
+	d := PerformCompleteDWT(Ymatrix)
+
+	h, w := len(d.LL), len(d.LL[0])
+	means := make([]float64, zeroGrid*zeroGrid)
+	energies := make([]float64, zeroGrid*zeroGrid)
+	for cy := 0; cy < zeroGrid; cy++ {
+		y0, y1 := cy*h/zeroGrid, (cy+1)*h/zeroGrid
+		for cx := 0; cx < zeroGrid; cx++ {
+			x0, x1 := cx*w/zeroGrid, (cx+1)*w/zeroGrid
+			var sum, energy float64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					sum += d.LL[y][x]
+					energy += math.Abs(d.HL[y][x])
+				}
+			}
+			n := float64((y1 - y0) * (x1 - x0))
+			means[cy*zeroGrid+cx] = sum / n
+			energies[cy*zeroGrid+cx] = energy / n
+		}
+	}
+
+	feature := make([]int, 0, zeroFeatureBits)
+	for _, values := range [][]float64{means, energies} {
+		median := medianOf(values)
+		for _, v := range values {
+			if v > median {
+				feature = append(feature, 1)
+			} else {
+				feature = append(feature, 0)
+			}
+		}
+	}
+	return feature, nil
+}
+
+func medianOf(values []float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// zeroOrder returns which stream bit each feature bit carries. With a key the
+// assignment is shuffled, so the key file alone does not reveal the message.
+func zeroOrder(key string, bits int) []int {
+	order := make([]int, zeroFeatureBits)
+	for i := range order {
+		order[i] = i
+	}
+	if key != "" {
+		seed := sha256.Sum256([]byte("zero-order:" + key))
+		rand.New(rand.NewChaCha8(seed)).Shuffle(len(order), func(i, j int) {
+			order[i], order[j] = order[j], order[i]
+		})
+	}
+	for i := range order {
+		order[i] %= bits
+	}
+	return order
+}
+
+// RegisterZero derives the feature of img and binds message to it. img is
+// not modified. Without opts.Key the feature order is public, so anyone with
+// the ZeroKey and the image, or a copy of it, can read the message.
+func RegisterZero(img image.Image, message string, opts *Options) (*ZeroKey, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	if len(message) > ZeroMaxMessageBytes {
+		return nil, fmt.Errorf("%w: %d bytes; a zero-watermark holds at most %d", ErrMessageTooLong, len(message), ZeroMaxMessageBytes)
+	}
+	feature, err := zeroFeature(img)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := binary.BigEndian.AppendUint32([]byte(message), crc32.ChecksumIEEE([]byte(message)))
+	stream := bytesToBits(payload)
+	order := zeroOrder(opts.Key, len(stream))
+	code := make([]int, zeroFeatureBits)
+	for i, f := range feature {
+		code[i] = f ^ stream[order[i]]
+	}
+
+	b := img.Bounds()
+	return &ZeroKey{
+		Version: zeroKeyVersion,
+		Width:   b.Dx(),
+		Height:  b.Dy(),
+		Bits:    len(stream),
+		Keyed:   opts.Key != "",
+		Code:    bitsToBytes(code),
+	}, nil
+}
+
+// RecoverZero reads the message bound to key from a suspect image. It returns
+// ErrNoWatermark when the recovered message fails its CRC, as it does for an
+// image other than the registered one or a wrong Options key.
+func RecoverZero(img image.Image, key *ZeroKey, opts *Options) (*ZeroRecovery, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	if err := key.check(); err != nil {
+		return nil, err
+	}
+	if key.Keyed && opts.Key == "" {
+		return nil, fmt.Errorf("%w: the zero-watermark was registered with a key", ErrInvalidOptions)
+	}
+	feature, err := zeroFeature(img)
+	if err != nil {
+		return nil, err
+	}
+
+	code := bytesToBits(key.Code)
+	order := zeroOrder(opts.Key, key.Bits)
+	ones := make([]int, key.Bits)
+	total := make([]int, key.Bits)
+	for i, f := range feature {
+		ones[order[i]] += f ^ code[i]
+		total[order[i]]++
+	}
+
+	stream := make([]int, key.Bits)
+	agree := 0
+	for i := range stream {
+		if 2*ones[i] > total[i] {
+			stream[i] = 1
+			agree += ones[i]
+		} else {
+			agree += total[i] - ones[i]
+		}
+	}
+	result := &ZeroRecovery{Agreement: float64(agree) / zeroFeatureBits}
+
+	payload := bitsToBytes(stream)
+	message := payload[:len(payload)-4]
+	if crc32.ChecksumIEEE(message) != binary.BigEndian.Uint32(payload[len(payload)-4:]) {
+		return nil, fmt.Errorf("%w: zero-watermark CRC mismatch (agreement %.1f%%)", ErrNoWatermark, 100*result.Agreement)
+	}
+	result.Message = string(message)
+	return result, nil
+}
+
+func (k *ZeroKey) check() error {
+	switch {
+	case k.Version != zeroKeyVersion:
+		return fmt.Errorf("%w: zero-watermark key version %d", ErrInvalidOptions, k.Version)
+	case k.Bits < 32 || k.Bits%8 != 0 || k.Bits > 8*(ZeroMaxMessageBytes+4):
+		return fmt.Errorf("%w: zero-watermark key has %d stream bits", ErrInvalidOptions, k.Bits)
+	case len(k.Code) != zeroFeatureBits/8:
+		return fmt.Errorf("%w: zero-watermark key code is %d bytes, want %d", ErrInvalidOptions, len(k.Code), zeroFeatureBits/8)
+	}
+	return nil
+}
+
+// WriteZeroKey stores key as JSON at path, readable by the owner only
+func WriteZeroKey(path string, key *ZeroKey) error {
+	data, err := json.MarshalIndent(key, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// ReadZeroKey loads a key written by WriteZeroKey
+func ReadZeroKey(path string) (*ZeroKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var key ZeroKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := key.check(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &key, nil
+}
@@ -0,0 +1,123 @@
+package Watermark
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// brighter is img with every channel raised by delta
+func brighter(img image.Image, delta uint8) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			out.SetRGBA(x, y, color.RGBA{R: uint8(r>>8) + delta, G: uint8(g>>8) + delta, B: uint8(bl>>8) + delta, A: 0xFF})
+		}
+	}
+	return out
+}
+
+func TestZeroWatermark(t *testing.T) {
+	img := testImage(512, 384)
+	original := image.NewRGBA(img.Bounds())
+	draw.Draw(original, img.Bounds(), img, image.Point{}, draw.Src)
+
+	opts := DefaultOptions()
+	opts.Key = "k"
+	key, err := RegisterZero(img, "Hello World", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(img.Pix, original.Pix) {
+		t.Fatal("RegisterZero changed the pixels")
+	}
+	if !key.Keyed || key.Bits != 8*(len("Hello World")+4) || key.Width != 512 || key.Height != 384 {
+		t.Errorf("key %+v", key)
+	}
+
+	path := filepath.Join(t.TempDir(), "zero.json")
+	if err := WriteZeroKey(path, key); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("key file: %v, %v", info.Mode(), err)
+	}
+	key, err = ReadZeroKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 75}); err != nil {
+		t.Fatal(err)
+	}
+	recompressed, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, suspect := range map[string]image.Image{
+		"original":     img,
+		"JPEG q75":     recompressed,
+		"brightness+8": brighter(img, 8),
+	} {
+		r, err := RecoverZero(suspect, key, opts)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if r.Message != "Hello World" || r.Agreement < 0.8 {
+			t.Errorf("%s: %q, agreement %.2f", name, r.Message, r.Agreement)
+		}
+	}
+
+	// A different image, here the same one upside down, or the right one with
+	// the wrong key reads noise
+	other := image.NewRGBA(img.Bounds())
+	for y := 0; y < 384; y++ {
+		for x := 0; x < 512; x++ {
+			other.Set(x, y, img.At(511-x, 383-y))
+		}
+	}
+	wrong := DefaultOptions()
+	wrong.Key = "not k"
+	if _, err := RecoverZero(other, key, opts); !errors.Is(err, ErrNoWatermark) {
+		t.Errorf("other image: %v", err)
+	}
+	if _, err := RecoverZero(img, key, wrong); !errors.Is(err, ErrNoWatermark) {
+		t.Errorf("wrong key: %v", err)
+	}
+	if _, err := RecoverZero(img, key, DefaultOptions()); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("no key: %v", err)
+	}
+}
+
+func TestZeroWatermarkRejects(t *testing.T) {
+	if _, err := RegisterZero(testImage(512, 384), strings.Repeat("x", ZeroMaxMessageBytes+1), nil); !errors.Is(err, ErrMessageTooLong) {
+		t.Errorf("long message: %v", err)
+	}
+	if _, err := RegisterZero(testImage(48, 300), "x", nil); !errors.Is(err, ErrImageTooSmall) {
+		t.Errorf("48x300 image: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "zero.json")
+	for _, bad := range []string{
+		`{"version": 2, "bits": 40, "code": ""}`,
+		`{"version": 1, "bits": 36, "code": ""}`,
+		`{"version": 1, "bits": 40, "code": "AAAA"}`,
+		`not json`,
+	} {
+		os.WriteFile(path, []byte(bad), 0o600)
+		if _, err := ReadZeroKey(path); err == nil {
+			t.Errorf("%s: no error", bad)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"InvisibleWaterMarkingSystem/Batch"
+	"InvisibleWaterMarkingSystem/ImageIO"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+// listFlag collects a repeatable string flag
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func runBatch(args []string) error {
+	fs := flag.NewFlagSet("batch", flag.ContinueOnError)
+	var options optionFlags
+	options.register(fs, optKey|optPayload|optPixel|optPalette|optTemplate)
+
+	var cfg Batch.Config
+	var include, exclude listFlag
+	var messagesPath, manifestPath, formatName string
+	var memoryMB int64
+	var asJSON, verbose bool
+	fs.StringVar(&cfg.InputDir, "i", "", "input directory")
+	fs.StringVar(&cfg.InputDir, "input", "", "input directory (same as -i)")
+	fs.StringVar(&cfg.OutputDir, "o", "", "output directory; the input tree is mirrored into it")
+	fs.StringVar(&cfg.OutputDir, "output", "", "output directory (same as -o)")
+	fs.StringVar(&cfg.Message, "m", "", "message template, e.g. \"{filename}-{date}\"")
+	fs.StringVar(&cfg.Message, "message", "", "message template (same as -m)")
+	fs.StringVar(&messagesPath, "messages", "", "CSV (path,message) or JSON file of per-file messages, available as {message}")
+	fs.Var(&include, "include", "glob of files to process; repeatable (default: all supported images)")
+	fs.Var(&exclude, "exclude", "glob of files to skip; repeatable")
+	fs.BoolVar(&cfg.Recursive, "r", false, "descend into subdirectories")
+	fs.IntVar(&cfg.Workers, "workers", 0, "files processed concurrently (default: one per CPU)")
+	fs.Int64Var(&memoryMB, "memory", 1024, "MiB of estimated working memory in flight; 0 for no limit")
+	fs.BoolVar(&cfg.Overwrite, "overwrite", false, "re-process files whose output is already up to date")
+	fs.StringVar(&formatName, "format", "", "convert every output to this format")
+	fs.IntVar(&cfg.JPEGQuality, "quality", 100, "JPEG quality")
+	fs.StringVar(&manifestPath, "manifest", "", "write a manifest of results to this .csv or .json file")
+	fs.BoolVar(&asJSON, "json", false, "print the summary as JSON")
+	fs.BoolVar(&verbose, "v", false, "print one line per file on stderr")
+
+	fs.SetOutput(os.Stderr)
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return err
+		}
+		return &usageError{msg: err.Error()}
+	}
+	if fs.NArg() > 0 {
+		return usagef("unexpected arguments %q", fs.Args())
+	}
+	if err := options.validate(); err != nil {
+		return err
+	}
+	switch {
+	case cfg.InputDir == "" || cfg.OutputDir == "":
+		return usagef("both -i and -o directories are required")
+	case cfg.Message == "" && messagesPath == "":
+		return usagef("no message (use -m or --messages)")
+	case cfg.JPEGQuality < 1 || cfg.JPEGQuality > 100:
+		return usagef("--quality must be between 1 and 100")
+	}
+	if formatName != "" {
+		if cfg.Format = ImageIO.ParseFormat(formatName); cfg.Format == ImageIO.FormatUnknown {
+			return usagef("unknown --format %q", formatName)
+		}
+	}
+	if messagesPath != "" {
+		messages, err := Batch.LoadMessages(messagesPath)
+		if err != nil {
+			return err
+		}
+		cfg.Messages = messages
+	}
+
+	cfg.Include = include
+	cfg.Exclude = exclude
+	cfg.MemoryLimit = memoryMB << 20
+	cfg.Options = &options.opts
+	if verbose {
+		cfg.Progress = func(r Batch.Result) {
+			line := fmt.Sprintf("%-7s %s", r.Status, r.Input)
+			if r.Error != "" {
+				line += ": " + r.Error
+			}
+			fmt.Fprintln(os.Stderr, line)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	summary, runErr := Batch.Run(ctx, cfg)
+	if summary == nil {
+		return runErr
+	}
+	if manifestPath != "" {
+		if err := Batch.WriteManifest(manifestPath, summary); err != nil {
+			return err
+		}
+	}
+
+	if err := printResult(asJSON, summary, func(w io.Writer) {
+		fmt.Fprintf(w, "%d embedded, %d skipped, %d failed in %v\n",
+			summary.OK, summary.Skipped, summary.Failed, summary.Duration.Round(1e6))
+		for _, r := range summary.Results {
+			if r.Status == Batch.StatusFailed {
+				fmt.Fprintf(w, "  failed: %s: %s\n", r.Input, r.Error)
+			}
+		}
+	}); err != nil {
+		return err
+	}
+
+	if runErr != nil {
+		return runErr
+	}
+	if summary.Failed > 0 {
+		return fmt.Errorf("%d of %d files failed", summary.Failed, len(summary.Results))
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"InvisibleWaterMarkingSystem/ImageIO"
+	"InvisibleWaterMarkingSystem/Registry"
+	"InvisibleWaterMarkingSystem/Watermark"
+	"flag"
+	"fmt"
+	"image"
+	"image/gif"
+	"io"
+	"os"
+)
+
+type embedResult struct {
+	Input    string `json:"input"`
+	Output   string `json:"output"`
+	Kind     string `json:"kind"`
+	Format   string `json:"format,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Message  string `json:"message"`
+	Keyed    bool   `json:"keyed"`
+	Frames   int    `json:"frames,omitempty"`
+	Tiles    int    `json:"tiles,omitempty"`
+	Verified *bool  `json:"verified,omitempty"`
+
+	// Signature is the scheme the message was signed with, if any
+	Signature string `json:"signature,omitempty"`
+
+	Registered *Registry.Record `json:"registered,omitempty"`
+}
+
+func runEmbed(args []string) error {
+	fs := flag.NewFlagSet("embed", flag.ContinueOnError)
+	var common commonFlags
+	var options optionFlags
+	var signing signFlags
+	common.register(fs)
+	options.register(fs, optEmbed)
+	signing.register(fs)
+
+	var output, message, formatName, xmpNote string
+	var quality int
+	var verify bool
+	var registryPath, recipient, note string
+	fs.StringVar(&output, "o", "", "output file")
+	fs.StringVar(&output, "output", "", "output file (same as -o)")
+	fs.StringVar(&message, "m", "", "message to embed")
+	fs.StringVar(&message, "message", "", "message to embed (same as -m)")
+	fs.StringVar(&formatName, "format", "", "output image format (jpeg, png, gif, bmp, tiff); default from the output extension")
+	fs.IntVar(&quality, "quality", 100, "JPEG quality for pixel-domain output")
+	fs.StringVar(&xmpNote, "xmp-note", "Invisible watermark embedded", "note recorded in JPEG XMP metadata; empty to skip")
+	fs.BoolVar(&verify, "verify", false, "read the message back from the written file")
+	fs.StringVar(&registryPath, "registry", "", "record the embed in this registry file (needs --recipient)")
+	fs.StringVar(&recipient, "recipient", "", "who receives the output; -m defaults to a new payload ID")
+	fs.StringVar(&note, "note", "", "free text stored with the registry record")
+
+	if err := parseFlags(fs, args, &common); err != nil {
+		return err
+	}
+	if err := options.validate(); err != nil {
+		return err
+	}
+	if (registryPath == "") != (recipient == "") {
+		return usagef("--registry and --recipient go together")
+	}
+	if message == "" && recipient != "" {
+		message = Registry.NewPayloadID()
+	}
+	switch {
+	case output == "":
+		return usagef("no output file (use -o)")
+	case message == "":
+		return usagef("no message (use -m, or --registry with --recipient)")
+	case quality < 1 || quality > 100:
+		return usagef("--quality must be between 1 and 100")
+	}
+
+	signer, err := signing.signer()
+	if err != nil {
+		return err
+	}
+
+	kind, format, err := classify(common.input)
+	if err != nil {
+		return err
+	}
+	if signer != nil && (kind != kindImage || options.domain != "pixel") {
+		return usagef("signed messages are embedded in still images in the pixel domain only")
+	}
+	result := embedResult{
+		Input:   common.input,
+		Output:  output,
+		Kind:    kind.String(),
+		Message: message,
+		Keyed:   options.opts.Key != "",
+	}
+	if signer != nil {
+		result.Signature = signer.Scheme().String()
+	}
+
+	switch kind {
+	case kindVideo:
+		result.Frames, err = embedVideo(common.input, output, message, &options.opts)
+	case kindAnimation:
+		result.Frames, err = embedAnimation(common.input, output, message, &options.opts)
+		result.Format = ImageIO.FormatGIF.String()
+	default:
+		if options.domain == "coefficient" {
+			if format != ImageIO.FormatJPEG {
+				return usagef("--domain coefficient needs a JPEG input, got %s", format)
+			}
+			result.Domain = options.domain
+			result.Format = format.String()
+			err = embedCoefficients(common.input, output, message, &options.opts)
+		} else {
+			result.Domain = options.domain
+			var outFormat ImageIO.Format
+			outFormat, result.Tiles, err = embedImage(common.input, output, message, formatName, quality, xmpNote, format, &options.opts, signer)
+			result.Format = outFormat.String()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if verify {
+		ok, err := verifyEmbedded(options.domain, output, message, &options.opts, signer)
+		if err != nil {
+			return err
+		}
+		result.Verified = &ok
+		if !ok {
+			return fmt.Errorf("%s: %w after writing", output, Watermark.ErrNoWatermark)
+		}
+	}
+
+	if registryPath != "" {
+		if result.Registered, err = registerEmbed(registryPath, recipient, note, common.input, message, &options.opts); err != nil {
+			return fmt.Errorf("%s written but not registered: %w", output, err)
+		}
+	}
+
+	return printResult(common.json, result, func(w io.Writer) {
+		fmt.Fprintf(w, "Embedded %q into %s", message, output)
+		switch {
+		case result.Frames > 0:
+			fmt.Fprintf(w, " (%d frames)", result.Frames)
+		case result.Tiles > 0:
+			fmt.Fprintf(w, " (%d tiles)", result.Tiles)
+		}
+		fmt.Fprintln(w)
+		if result.Signature != "" {
+			fmt.Fprintf(w, "Signed: %s\n", result.Signature)
+		}
+		if result.Verified != nil {
+			fmt.Fprintln(w, "Verified: message reads back")
+		}
+		if result.Registered != nil {
+			fmt.Fprintf(w, "Registered for %s in %s\n", recipient, registryPath)
+		}
+	})
+}
+
+// checkMessageFits rejects messages that would be cut off at the tile edge
+func checkMessageFits(message string, capacity Watermark.CapacityInfo, opts *Watermark.Options) error {
+	return Watermark.CheckMessage(capacity.Width, capacity.Height, message, opts)
+}
+
+func embedImage(input, output, message, formatName string, quality int, xmpNote string, inFormat ImageIO.Format, opts *Watermark.Options, signer Watermark.Signer) (ImageIO.Format, int, error) {
+	outFormat := ImageIO.OutputFormat(output, inFormat)
+	if formatName != "" {
+		if outFormat = ImageIO.ParseFormat(formatName); outFormat == ImageIO.FormatUnknown {
+			return 0, 0, usagef("unknown --format %q", formatName)
+		}
+	}
+	if signer != nil && outFormat == ImageIO.FormatGIF {
+		return 0, 0, usagef("GIF palettes cannot hold a signed message; choose another format")
+	}
+
+	img, _, meta, err := ImageIO.ReadFileWithMetadata(input)
+	if err != nil {
+		return 0, 0, err
+	}
+	img = ImageIO.AutoOrient(img, meta)
+
+	b := img.Bounds()
+	capacity := Watermark.Capacity(b.Dx(), b.Dy())
+	if signer != nil {
+		marked, err := Watermark.EmbedSigned(img, message, signer, opts)
+		if err != nil {
+			return 0, 0, err
+		}
+		return outFormat, capacity.Tiles(), writeMarked(output, marked, outFormat, quality, xmpNote, meta)
+	}
+	if err := checkMessageFits(message, capacity, opts); err != nil {
+		return 0, 0, err
+	}
+
+	// A palette cannot hold pixel-domain marks; go through the GIF embedder,
+	// which re-checks the bits after quantization
+	if outFormat == ImageIO.FormatGIF {
+		frame := ImageIO.QuantizeToPalette(img, ImageIO.MedianCutPalette(img, nil, 256), nil, 0)
+		g, err := Watermark.Embed_Watermark_GIF(&gif.GIF{Image: []*image.Paletted{frame}, Delay: []int{0}}, message, opts)
+		if err != nil {
+			return 0, 0, err
+		}
+		return outFormat, capacity.Tiles(), ImageIO.WriteGIF(output, g)
+	}
+
+	marked := Watermark.EmbedWithOptions(img, message, opts)
+	return outFormat, capacity.Tiles(), writeMarked(output, marked, outFormat, quality, xmpNote, meta)
+}
+
+// writeMarked encodes a marked still image, carrying JPEG metadata over
+func writeMarked(output string, marked image.Image, outFormat ImageIO.Format, quality int, xmpNote string, meta *ImageIO.Metadata) error {
+	encodeOptions := ImageIO.DefaultEncodeOptions()
+	encodeOptions.JPEGQuality = quality
+	if outFormat == ImageIO.FormatJPEG {
+		encodeOptions.Metadata = meta
+		encodeOptions.XMPNote = xmpNote
+	}
+	return ImageIO.WriteFile(output, marked, outFormat, encodeOptions)
+}
+
+func embedCoefficients(input, output, message string, opts *Watermark.Options) error {
+	if err := Watermark.CheckMessageLength(message, opts); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(input)
+	if err != nil {
+		return err
+	}
+	marked, err := Watermark.Embed_Watermark_JPEG(data, message, opts)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(output, marked, 0o644)
+}
+
+func embedAnimation(input, output, message string, opts *Watermark.Options) (int, error) {
+	if err := Watermark.CheckMessageLength(message, opts); err != nil {
+		return 0, err
+	}
+	g, err := ImageIO.ReadGIF(input)
+	if err != nil {
+		return 0, err
+	}
+	marked, err := Watermark.Embed_Watermark_GIF(g, message, opts)
+	if err != nil {
+		return 0, err
+	}
+	return len(marked.Image), ImageIO.WriteGIF(output, marked)
+}
+
+func embedVideo(input, output, message string, opts *Watermark.Options) (int, error) {
+	in, err := os.Open(input)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	out, err := os.Create(output)
+	if err != nil {
+		return 0, err
+	}
+	frames, err := Watermark.Embed_Watermark_Y4M(in, out, message, opts)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(output)
+	}
+	return frames, err
+}
+
+func verifyEmbedded(domain, path, message string, opts *Watermark.Options, signer Watermark.Signer) (bool, error) {
+	kind, _, err := classify(path)
+	if err != nil {
+		return false, err
+	}
+	if signer != nil {
+		img, _, err := ImageIO.ReadFile(path)
+		if err != nil {
+			return false, err
+		}
+		v := Watermark.Verify(img, verifierFor(signer), opts)
+		return v.Status == Watermark.SignatureValid && v.Message == message, nil
+	}
+	got, err := extractMessage(kind, domain, path, opts)
+	if err != nil {
+		return false, err
+	}
+	return got.Found && got.Message == message, nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"InvisibleWaterMarkingSystem/ImageIO"
+	"InvisibleWaterMarkingSystem/Registry"
+	"InvisibleWaterMarkingSystem/Watermark"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+type extractResult struct {
+	Input         string   `json:"input"`
+	Kind          string   `json:"kind"`
+	Domain        string   `json:"domain,omitempty"`
+	Found         bool     `json:"found"`
+	Message       string   `json:"message"`
+	AuthFailed    bool     `json:"auth_failed,omitempty"`    // a payload was found but did not open with --payload-key
+	Tiles         int      `json:"tiles,omitempty"`          // tiles examined
+	TilesDecoded  int      `json:"tiles_decoded,omitempty"`  // tiles with a complete message
+	TilesAgreeing int      `json:"tiles_agreeing,omitempty"` // tiles whose message is the one reported
+	Frames        int      `json:"frames,omitempty"`
+	FrameMessages []string `json:"frame_messages,omitempty"`
+
+	// Alignment is the tile grid found in a cropped copy with --align
+	Alignment *Watermark.Alignment `json:"alignment,omitempty"`
+
+	// Recipient is the registry record of the message, when --registry is
+	// given and the message is registered
+	Recipient *Registry.Record `json:"recipient,omitempty"`
+}
+
+func runExtract(args []string) error {
+	fs := flag.NewFlagSet("extract", flag.ContinueOnError)
+	var common commonFlags
+	var options optionFlags
+	common.register(fs)
+	options.register(fs, optExtract)
+	var registryPath string
+	fs.StringVar(&registryPath, "registry", "", "look the message up in this registry file")
+
+	if err := parseFlags(fs, args, &common); err != nil {
+		return err
+	}
+	if err := options.validate(); err != nil {
+		return err
+	}
+
+	kind, _, err := classify(common.input)
+	if err != nil {
+		return err
+	}
+	result, err := extractMessage(kind, options.domain, common.input, &options.opts)
+	if err != nil {
+		return err
+	}
+	if result.Found && registryPath != "" {
+		if result.Recipient, err = lookupPayload(registryPath, result.Message); err != nil {
+			return err
+		}
+	}
+
+	if err := printResult(common.json, result, func(w io.Writer) {
+		if !result.Found {
+			if result.AuthFailed {
+				fmt.Fprintln(w, "Watermark found but its payload did not authenticate")
+			}
+			return
+		}
+		fmt.Fprintln(w, result.Message)
+		printAlignment(w, result.Alignment)
+		switch {
+		case result.Recipient != nil:
+			printRecord(w, result.Recipient)
+		case registryPath != "":
+			fmt.Fprintln(w, "Recipient: not in the registry")
+		}
+	}); err != nil {
+		return err
+	}
+	switch {
+	case result.AuthFailed:
+		return fmt.Errorf("%s: %w; check --payload-key", common.input, Watermark.ErrAuthFailed)
+	case !result.Found:
+		return fmt.Errorf("%s: %w", common.input, Watermark.ErrNoWatermark)
+	}
+	return nil
+}
+
+// extractMessage routes the file to the matching extractor
+func extractMessage(kind inputKind, domain, path string, opts *Watermark.Options) (*extractResult, error) {
+	result := &extractResult{Input: path, Kind: kind.String()}
+
+	switch kind {
+	case kindVideo:
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		seq, err := Watermark.Extract_Watermark_Y4M(f, opts)
+		if err != nil {
+			return nil, err
+		}
+		fillSequence(result, seq)
+
+	case kindAnimation:
+		g, err := ImageIO.ReadGIF(path)
+		if err != nil {
+			return nil, err
+		}
+		fillSequence(result, Watermark.Extract_Watermark_GIF(g, opts))
+
+	default:
+		result.Domain = domain
+		var messages []string
+		var authFailed int
+		if domain == "coefficient" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			if messages, authFailed, err = Watermark.ExtractJPEGMessages(data, opts); err != nil {
+				return nil, err
+			}
+		} else {
+			img, _, meta, err := ImageIO.ReadFileWithMetadata(path)
+			if err != nil {
+				return nil, err
+			}
+			img = ImageIO.AutoOrient(img, meta)
+			if opts.Align {
+				// Align here rather than in ExtractMessages to report the offset
+				o := *opts
+				o.Align = false
+				if aligned, a, err := Watermark.Align(img, opts); err == nil {
+					img, result.Alignment = aligned, a
+					o.Synchronize = false
+				}
+				opts = &o
+			}
+			b := img.Bounds()
+			result.Tiles = Watermark.Capacity(b.Dx(), b.Dy()).Tiles()
+			messages, authFailed = Watermark.ExtractMessages(img, opts)
+		}
+		result.TilesDecoded = len(messages)
+		result.Message, result.TilesAgreeing = Watermark.MostCommonMessage(messages)
+		result.Found = result.TilesAgreeing > 0
+		result.AuthFailed = !result.Found && authFailed > 0
+	}
+	return result, nil
+}
+
+// printAlignment reports where --align found the tile grid
+func printAlignment(w io.Writer, a *Watermark.Alignment) {
+	if a == nil {
+		return
+	}
+	fmt.Fprintf(w, "Tile grid at offset (%d, %d): cropped by %d pixels on the left and %d on the top, modulo 256\n",
+		a.X, a.Y, (256-a.X)%256, (256-a.Y)%256)
+}
+
+func fillSequence(result *extractResult, seq *Watermark.SequenceResult) {
+	result.Found = seq.Found
+	result.Message = seq.Message
+	result.AuthFailed = seq.AuthFailed
+	result.Tiles = seq.TileCount
+	result.Frames = seq.FrameCount
+	result.FrameMessages = seq.FrameResult
+}
+
+type detectResult struct {
+	Input     string `json:"input"`
+	Kind      string `json:"kind"`
+	Present   bool   `json:"present"`
+	Tiles     int    `json:"tiles"`
+	FlagTiles int    `json:"flag_tiles,omitempty"` // tiles whose start flag matched
+	Message   string `json:"message,omitempty"`
+
+	// PValue is the chance of the observed start-flag matches in an unmarked
+	// image; only the pixel-domain detector of still images computes it
+	PValue      *float64 `json:"p_value,omitempty"`
+	FlagBits    int      `json:"flag_bits,omitempty"`
+	FlagMatches int      `json:"flag_matches,omitempty"`
+	Threshold   float64  `json:"threshold,omitempty"`
+
+	Alignment *Watermark.Alignment `json:"alignment,omitempty"`
+
+	// Gain is the change of contrast found with --estimate-gain
+	Gain float64 `json:"gain,omitempty"`
+
+	// AuthFailed is set when a payload was decoded but did not open with
+	// --payload-key
+	AuthFailed bool `json:"auth_failed,omitempty"`
+}
+
+func runDetect(args []string) error {
+	fs := flag.NewFlagSet("detect", flag.ContinueOnError)
+	var common commonFlags
+	var options optionFlags
+	common.register(fs)
+	options.register(fs, optExtract)
+
+	if err := parseFlags(fs, args, &common); err != nil {
+		return err
+	}
+	if err := options.validate(); err != nil {
+		return err
+	}
+
+	kind, _, err := classify(common.input)
+	if err != nil {
+		return err
+	}
+	result := detectResult{Input: common.input, Kind: kind.String()}
+
+	if kind == kindImage && options.domain == "pixel" {
+		img, _, meta, err := ImageIO.ReadFileWithMetadata(common.input)
+		if err != nil {
+			return err
+		}
+		d := Watermark.Detect(ImageIO.AutoOrient(img, meta), &options.opts)
+		result.Present = d.Present
+		result.Tiles = d.TileCount
+		result.FlagTiles = d.FlagTiles
+		result.PValue = &d.PValue
+		result.FlagBits = d.FlagBits
+		result.FlagMatches = d.FlagMatches
+		result.Threshold = d.Threshold
+		result.Alignment = d.Alignment
+		result.Gain = d.Gain
+		result.Message = d.Message
+		result.AuthFailed = d.AuthFailed
+	} else {
+		// Sequences and coefficient marks are detected by decoding them
+		e, err := extractMessage(kind, options.domain, common.input, &options.opts)
+		if err != nil {
+			return err
+		}
+		result.Present = e.Found || e.AuthFailed
+		result.Tiles = e.Tiles
+		result.Message = e.Message
+		result.AuthFailed = e.AuthFailed
+	}
+
+	if err := printResult(common.json, result, func(w io.Writer) {
+		switch {
+		case result.Present && result.FlagTiles > 0:
+			fmt.Fprintf(w, "Watermark present (%d/%d tiles flagged)\n", result.FlagTiles, result.Tiles)
+		case result.Present:
+			fmt.Fprintln(w, "Watermark present")
+		default:
+			fmt.Fprintf(w, "No watermark detected in %d tiles\n", result.Tiles)
+		}
+		if result.PValue != nil {
+			fmt.Fprintf(w, "Start flag: %d/%d bits match, p-value %.3g (threshold %.3g)\n",
+				result.FlagMatches, result.FlagBits, *result.PValue, result.Threshold)
+		}
+		printAlignment(w, result.Alignment)
+		if result.Gain != 0 {
+			fmt.Fprintf(w, "Contrast changed by a factor of %.3f since embedding\n", result.Gain)
+		}
+		if result.AuthFailed {
+			fmt.Fprintln(w, "Payload did not authenticate")
+		}
+	}); err != nil {
+		return err
+	}
+	if !result.Present {
+		return fmt.Errorf("%s: %w", common.input, Watermark.ErrNoWatermark)
+	}
+	return nil
+}
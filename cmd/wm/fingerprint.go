@@ -0,0 +1,283 @@
+package main
+
+import (
+	"InvisibleWaterMarkingSystem/Fingerprint"
+	"InvisibleWaterMarkingSystem/ImageIO"
+	"InvisibleWaterMarkingSystem/Registry"
+	"InvisibleWaterMarkingSystem/Watermark"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// paramFlags map onto Fingerprint.Params
+type paramFlags struct {
+	params Fingerprint.Params
+}
+
+func (p *paramFlags) register(fs *flag.FlagSet) {
+	p.params = Fingerprint.DefaultParams()
+	fs.IntVar(&p.params.Colluders, "colluders", p.params.Colluders, "largest coalition the code can trace")
+	fs.Float64Var(&p.params.FalseAccusation, "false-accusation", p.params.FalseAccusation, "bound on the probability of accusing an innocent recipient")
+	fs.IntVar(&p.params.Recipients, "recipients", p.params.Recipients, "largest number of recipients the code is sized for")
+}
+
+type fingerprintResult struct {
+	Input     string `json:"input"`
+	Output    string `json:"output"`
+	Format    string `json:"format"`
+	Recipient string `json:"recipient"`
+	PayloadID string `json:"payload_id"`
+	CodeBits  int    `json:"code_bits"`
+	Copies    int    `json:"copies"` // times the codeword fits in the image
+}
+
+func runFingerprint(args []string) error {
+	fs := flag.NewFlagSet("fingerprint", flag.ContinueOnError)
+	var common commonFlags
+	var options optionFlags
+	var params paramFlags
+	common.register(fs)
+	options.register(fs, optKey|optPixel)
+	params.register(fs)
+
+	var output, formatName, registryPath, recipient, note string
+	var quality int
+	fs.StringVar(&output, "o", "", "output file")
+	fs.StringVar(&output, "output", "", "output file (same as -o)")
+	fs.StringVar(&formatName, "format", "", "output image format (jpeg, png, bmp, tiff); default from the output extension")
+	fs.IntVar(&quality, "quality", 100, "JPEG quality")
+	fs.StringVar(&registryPath, "registry", "", "registry file the codeword is recorded in")
+	fs.StringVar(&recipient, "recipient", "", "who receives the output")
+	fs.StringVar(&note, "note", "", "free text stored with the registry record")
+
+	if err := parseFlags(fs, args, &common); err != nil {
+		return err
+	}
+	if err := options.validate(); err != nil {
+		return err
+	}
+	switch {
+	case output == "":
+		return usagef("no output file (use -o)")
+	case registryPath == "" || recipient == "":
+		return usagef("--registry and --recipient are required")
+	case options.opts.Key == "":
+		return usagef("--key is required; it is the secret the code is derived from")
+	case quality < 1 || quality > 100:
+		return usagef("--quality must be between 1 and 100")
+	}
+
+	kind, inFormat, err := classify(common.input)
+	if err != nil {
+		return err
+	}
+	if kind != kindImage {
+		return usagef("fingerprints need a still image, got %s", kind)
+	}
+	outFormat := ImageIO.OutputFormat(output, inFormat)
+	if formatName != "" {
+		outFormat = ImageIO.ParseFormat(formatName)
+	}
+	switch outFormat {
+	case ImageIO.FormatUnknown:
+		return usagef("unknown --format %q", formatName)
+	case ImageIO.FormatGIF:
+		return usagef("GIF palettes cannot hold a fingerprint; choose another format")
+	}
+
+	code, err := Fingerprint.NewCode(options.opts.Key, params.params)
+	if err != nil {
+		return usagef("%v", err)
+	}
+	img, _, meta, err := ImageIO.ReadFileWithMetadata(common.input)
+	if err != nil {
+		return err
+	}
+	img = ImageIO.AutoOrient(img, meta)
+	b := img.Bounds()
+	slots := Watermark.RawCapacity(b.Dx(), b.Dy())
+	if slots < code.Length() {
+		return fmt.Errorf("%w: %dx%d holds %d bits but the code needs %d; lower --colluders or --recipients",
+			Watermark.ErrImageTooSmall, b.Dx(), b.Dy(), slots, code.Length())
+	}
+
+	payload := Registry.NewPayloadID()
+	marked, err := Watermark.EmbedBits(img, code.Codeword(payload), &options.opts)
+	if err != nil {
+		return err
+	}
+	encodeOptions := ImageIO.DefaultEncodeOptions()
+	encodeOptions.JPEGQuality = quality
+	if outFormat == ImageIO.FormatJPEG {
+		encodeOptions.Metadata = meta
+	}
+	if err := ImageIO.WriteFile(output, marked, outFormat, encodeOptions); err != nil {
+		return err
+	}
+
+	hash, err := Registry.HashFile(common.input)
+	if err != nil {
+		return err
+	}
+	reg, err := Registry.Open(registryPath)
+	if err != nil {
+		return err
+	}
+	defer reg.Close()
+	_, err = reg.Add(Registry.Record{
+		PayloadID:    payload,
+		Recipient:    recipient,
+		Note:         note,
+		SourceSHA256: hash,
+		SourceName:   filepath.Base(common.input),
+		Options:      &options.opts,
+		Fingerprint:  &params.params,
+	})
+	if err != nil {
+		return fmt.Errorf("%s written but not registered: %w", output, err)
+	}
+
+	result := fingerprintResult{
+		Input:     common.input,
+		Output:    output,
+		Format:    outFormat.String(),
+		Recipient: recipient,
+		PayloadID: payload,
+		CodeBits:  code.Length(),
+		Copies:    slots / code.Length(),
+	}
+	return printResult(common.json, result, func(w io.Writer) {
+		fmt.Fprintf(w, "Fingerprinted %s for %s (%d-bit codeword, %d copies)\n", output, recipient, result.CodeBits, result.Copies)
+	})
+}
+
+type traceEntry struct {
+	Recipient string  `json:"recipient"`
+	PayloadID string  `json:"payload_id"`
+	Score     float64 `json:"score"`
+	Accused   bool    `json:"accused"`
+}
+
+// traceCode is the outcome for the records sharing one set of parameters
+type traceCode struct {
+	Params    Fingerprint.Params `json:"params"`
+	CodeBits  int                `json:"code_bits"`
+	Threshold float64            `json:"threshold"`
+	Scores    []traceEntry       `json:"scores"`
+}
+
+type traceResult struct {
+	Input      string      `json:"input"`
+	Candidates int         `json:"candidates"`
+	Accused    []string    `json:"accused"`
+	Codes      []traceCode `json:"codes"`
+}
+
+func runTrace(args []string) error {
+	fs := flag.NewFlagSet("trace", flag.ContinueOnError)
+	var common commonFlags
+	var options optionFlags
+	common.register(fs)
+	options.register(fs, optKey|optPixel)
+	var registryPath string
+	var top int
+	fs.StringVar(&registryPath, "registry", "", "registry file holding the fingerprinted recipients")
+	fs.IntVar(&top, "top", 5, "scores shown per code in text output")
+
+	if err := parseFlags(fs, args, &common); err != nil {
+		return err
+	}
+	if err := options.validate(); err != nil {
+		return err
+	}
+	if registryPath == "" {
+		return usagef("--registry is required")
+	}
+
+	reg, err := Registry.Open(registryPath)
+	if err != nil {
+		return err
+	}
+	records := reg.Fingerprinted(options.opts.Key)
+	reg.Close()
+	if len(records) == 0 {
+		return fmt.Errorf("%s has no fingerprints embedded with this key", registryPath)
+	}
+
+	img, _, meta, err := ImageIO.ReadFileWithMetadata(common.input)
+	if err != nil {
+		return err
+	}
+	img = ImageIO.AutoOrient(img, meta)
+
+	// Records made with different parameters belong to different codes
+	groups := make(map[Fingerprint.Params][]Registry.Record)
+	var order []Fingerprint.Params
+	for _, rec := range records {
+		p := *rec.Fingerprint
+		if _, seen := groups[p]; !seen {
+			order = append(order, p)
+		}
+		groups[p] = append(groups[p], rec)
+	}
+
+	result := traceResult{Input: common.input, Candidates: len(records), Accused: []string{}}
+	for _, p := range order {
+		code, err := Fingerprint.NewCode(options.opts.Key, p)
+		if err != nil {
+			return err
+		}
+		soft, err := Watermark.ExtractSoftBits(img, code.Length(), &options.opts)
+		if err != nil {
+			return err
+		}
+		group := groups[p]
+		recipients := make(map[string]string, len(group))
+		ids := make([]string, len(group))
+		for i, rec := range group {
+			ids[i] = rec.PayloadID
+			recipients[rec.PayloadID] = rec.Recipient
+		}
+		accusations, err := code.Accuse(soft, ids)
+		if err != nil {
+			return err
+		}
+
+		tc := traceCode{Params: p, CodeBits: code.Length(), Threshold: code.Threshold(soft, len(ids))}
+		for _, a := range accusations {
+			tc.Scores = append(tc.Scores, traceEntry{Recipient: recipients[a.ID], PayloadID: a.ID, Score: a.Score, Accused: a.Accused})
+			if a.Accused {
+				result.Accused = append(result.Accused, recipients[a.ID])
+			}
+		}
+		result.Codes = append(result.Codes, tc)
+	}
+
+	if err := printResult(common.json, result, func(w io.Writer) {
+		for _, tc := range result.Codes {
+			fmt.Fprintf(w, "Code: %d colluders, %d recipients, ε=%g (%d bits), threshold %.1f\n",
+				tc.Params.Colluders, tc.Params.Recipients, tc.Params.FalseAccusation, tc.CodeBits, tc.Threshold)
+			for i, e := range tc.Scores {
+				if i >= top && !e.Accused {
+					break
+				}
+				mark := " "
+				if e.Accused {
+					mark = "!"
+				}
+				fmt.Fprintf(w, "  %s %-20s %8.1f  %s\n", mark, e.Recipient, e.Score, e.PayloadID)
+			}
+		}
+		if len(result.Accused) == 0 {
+			fmt.Fprintln(w, "No recipient accused")
+		}
+	}); err != nil {
+		return err
+	}
+	if len(result.Accused) == 0 {
+		return fmt.Errorf("%s: %w: no recipient accused", common.input, Watermark.ErrNoWatermark)
+	}
+	return nil
+}
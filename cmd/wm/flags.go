@@ -0,0 +1,235 @@
+package main
+
+import (
+	"InvisibleWaterMarkingSystem/ImageIO"
+	"InvisibleWaterMarkingSystem/Watermark"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// commonFlags are shared by every command that reads one file
+type commonFlags struct {
+	input   string
+	json    bool
+	verbose bool
+}
+
+func (c *commonFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.input, "i", "", "input file")
+	fs.StringVar(&c.input, "input", "", "input file (same as -i)")
+	c.registerOutput(fs)
+}
+
+// registerOutput registers only --json and -v, for commands whose file
+// argument is not an input
+func (c *commonFlags) registerOutput(fs *flag.FlagSet) {
+	fs.BoolVar(&c.json, "json", false, "print the result as JSON")
+	fs.BoolVar(&c.verbose, "v", false, "print library progress messages on stderr")
+}
+
+// payloadKeyEnv supplies --payload-key when the flag is not given, keeping
+// the key out of the process list and shell history. It is read in validate
+// rather than used as the flag default so -h does not print it.
+const payloadKeyEnv = "WM_PAYLOAD_KEY"
+
+// optionSet selects the groups of option flags a command registers, so a
+// flag the command would ignore is rejected instead
+type optionSet uint
+
+const (
+	optKey         optionSet = 1 << iota // --key
+	optPayload                           // --payload-key
+	optPixel                             // --strength, --modulation, --perceptual
+	optPalette                           // --palette-strength, --palette-passes
+	optVideo                             // --video-strength, --temporal-spread
+	optCoefficient                       // --domain, --coefficient-step
+	optTamper                            // --tamper-strength
+	optTemplate                          // --sync-strength
+	optRecovery                          // --sync, --align, --estimate-gain, --false-positive-rate
+
+	// optEmbed and optExtract are everything the embedder and the
+	// extractors of images, animations and video use
+	optEmbed   = optKey | optPayload | optPixel | optPalette | optVideo | optCoefficient | optTemplate
+	optExtract = optKey | optPayload | optPixel | optPalette | optVideo | optCoefficient | optRecovery
+)
+
+// optionFlags map one-to-one onto Watermark.Options
+type optionFlags struct {
+	opts       Watermark.Options
+	domain     string
+	modulation string
+}
+
+// register adds the flags of the groups in set; options outside them keep
+// their defaults
+func (o *optionFlags) register(fs *flag.FlagSet, set optionSet) {
+	o.opts = *Watermark.DefaultOptions()
+	o.domain, o.modulation = "pixel", "qim"
+	if set&optKey != 0 {
+		fs.StringVar(&o.opts.Key, "key", "", "secret key that scrambles the block layout; extraction needs the same key")
+	}
+	if set&optPayload != 0 {
+		fs.StringVar(&o.opts.PayloadKey, "payload-key", "", "encrypt and authenticate the message with this key (default $"+payloadKeyEnv+")")
+	}
+	if set&optPixel != 0 {
+		fs.Float64Var(&o.opts.Strength, "strength", o.opts.Strength, "QIM step for still images")
+		fs.StringVar(&o.modulation, "modulation", o.modulation, "how blocks carry bits: qim; dithered or stdm for keyed dithered QIM or spread-transform dither modulation; or spread for spread spectrum, which survives contrast changes; extraction needs the same")
+		fs.BoolVar(&o.opts.Perceptual, "perceptual", false, "scale the QIM step per block by brightness and texture masking; extraction needs it too")
+	}
+	if set&optPalette != 0 {
+		fs.Float64Var(&o.opts.PaletteStrength, "palette-strength", o.opts.PaletteStrength, "QIM step for GIF frames")
+		fs.IntVar(&o.opts.PalettePasses, "palette-passes", o.opts.PalettePasses, "embed-quantize-verify passes per GIF frame")
+	}
+	if set&optVideo != 0 {
+		fs.Float64Var(&o.opts.VideoStrength, "video-strength", o.opts.VideoStrength, "QIM step for Y4M video frames")
+		fs.IntVar(&o.opts.TemporalSpread, "temporal-spread", o.opts.TemporalSpread, "spread the payload over this many video frames")
+	}
+	if set&optCoefficient != 0 {
+		fs.StringVar(&o.domain, "domain", o.domain, "JPEG embedding domain: pixel or coefficient")
+		fs.IntVar(&o.opts.CoefficientStep, "coefficient-step", o.opts.CoefficientStep, "QIM step in quantization units for --domain coefficient")
+	}
+	if set&optTamper != 0 {
+		fs.Float64Var(&o.opts.TamperStrength, "tamper-strength", o.opts.TamperStrength, "QIM step of the tamper-detection bits")
+	}
+	if set&optTemplate != 0 {
+		fs.Float64Var(&o.opts.SyncStrength, "sync-strength", 0, "add a synchronization template with sinusoids of this amplitude (about 2) so rotated or scaled copies can be realigned")
+	}
+	if set&optRecovery != 0 {
+		fs.BoolVar(&o.opts.Synchronize, "sync", false, "realign rotated or scaled copies with the synchronization template before extracting")
+		fs.BoolVar(&o.opts.Align, "align", false, "search for the tile grid of a cropped copy before extracting")
+		fs.BoolVar(&o.opts.EstimateGain, "estimate-gain", false, "estimate a change of contrast since embedding and scale the QIM step to match before extracting")
+		fs.Float64Var(&o.opts.FalsePositiveRate, "false-positive-rate", o.opts.FalsePositiveRate, "p-value at or below which a watermark, tile offset or gain is accepted")
+	}
+}
+
+func (o *optionFlags) validate() error {
+	if o.opts.PayloadKey == "" {
+		o.opts.PayloadKey = os.Getenv(payloadKeyEnv)
+	}
+	modulation, err := Watermark.ParseModulation(o.modulation)
+	if err != nil {
+		return usagef("--modulation must be qim, dithered, stdm or spread, got %q", o.modulation)
+	}
+	o.opts.Modulation = modulation
+	if modulation.Keyed() && o.opts.Key == "" {
+		return usagef("--modulation %s needs --key", modulation)
+	}
+	switch {
+	case o.domain != "pixel" && o.domain != "coefficient":
+		return usagef("--domain must be pixel or coefficient, got %q", o.domain)
+	case o.opts.Strength <= 0 || o.opts.PaletteStrength <= 0 || o.opts.VideoStrength <= 0 || o.opts.TamperStrength <= 0:
+		return usagef("strengths must be positive")
+	case o.opts.SyncStrength < 0:
+		return usagef("--sync-strength must not be negative")
+	case o.opts.FalsePositiveRate <= 0 || o.opts.FalsePositiveRate >= 1:
+		return usagef("--false-positive-rate must be between 0 and 1")
+	case o.opts.PalettePasses < 1:
+		return usagef("--palette-passes must be at least 1")
+	case o.opts.TemporalSpread < 1:
+		return usagef("--temporal-spread must be at least 1")
+	case o.opts.CoefficientStep <= 0 || o.opts.CoefficientStep%4 != 0:
+		return usagef("--coefficient-step must be a positive multiple of 4")
+	}
+	return nil
+}
+
+// parseFlags parses args, allowing the input file to be given as a
+// positional argument before, between or after the flags
+func parseFlags(fs *flag.FlagSet, args []string, common *commonFlags) error {
+	fs.SetOutput(os.Stderr)
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return err
+			}
+			return &usageError{msg: err.Error()}
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	switch {
+	case len(positional) > 1:
+		return usagef("unexpected arguments %q", positional[1:])
+	case len(positional) == 1 && common.input != "":
+		return usagef("input given both as -i and as an argument")
+	case len(positional) == 1:
+		common.input = positional[0]
+	}
+	if common.input == "" {
+		if fs.Lookup("i") == nil {
+			return usagef("no output file (use -o)")
+		}
+		return usagef("no input file (use -i)")
+	}
+
+	if common.verbose {
+		Watermark.Output = os.Stderr
+	}
+	return nil
+}
+
+// inputKind is how a file is routed through the library
+type inputKind int
+
+const (
+	kindImage inputKind = iota
+	kindAnimation
+	kindVideo
+)
+
+func (k inputKind) String() string {
+	switch k {
+	case kindAnimation:
+		return "animation"
+	case kindVideo:
+		return "video"
+	}
+	return "image"
+}
+
+// classify sniffs the file header: Y4M streams go to the video path and
+// GIFs to the palette-aware path, everything else is a still image
+func classify(path string) (inputKind, ImageIO.Format, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, ImageIO.FormatUnknown, err
+	}
+	defer f.Close()
+
+	header := make([]byte, 16)
+	n, _ := io.ReadFull(f, header)
+	header = header[:n]
+
+	if bytes.HasPrefix(header, []byte("YUV4MPEG2")) {
+		return kindVideo, ImageIO.FormatUnknown, nil
+	}
+	format := ImageIO.DetectFormat(header)
+	switch format {
+	case ImageIO.FormatUnknown:
+		return 0, format, fmt.Errorf("%s: unrecognised file format", path)
+	case ImageIO.FormatGIF:
+		return kindAnimation, format, nil
+	}
+	return kindImage, format, nil
+}
+
+// printResult writes v as indented JSON, or calls text for the human form
+func printResult(asJSON bool, v any, text func(w io.Writer)) error {
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	text(os.Stdout)
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"InvisibleWaterMarkingSystem/RPC"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"google.golang.org/grpc"
+)
+
+func runGRPC(args []string) error {
+	fs := flag.NewFlagSet("grpc", flag.ContinueOnError)
+	cfg := RPC.DefaultConfig()
+	var addr string
+	var maxImageMB int64
+	fs.StringVar(&addr, "addr", ":9090", "listen address")
+	fs.Int64Var(&maxImageMB, "max-image", cfg.MaxImageBytes>>20, "largest uploaded image in MiB")
+	fs.IntVar(&cfg.MaxPixels, "max-pixels", cfg.MaxPixels, "largest image accepted, in pixels")
+
+	fs.SetOutput(os.Stderr)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return &usageError{msg: err.Error()}
+	}
+	if fs.NArg() > 0 {
+		return usagef("unexpected arguments %q", fs.Args())
+	}
+	if maxImageMB <= 0 || cfg.MaxPixels <= 0 {
+		return usagef("--max-image and --max-pixels must be positive")
+	}
+	cfg.MaxImageBytes = maxImageMB << 20
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := grpc.NewServer()
+	RPC.Register(srv, cfg)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(lis) }()
+	fmt.Fprintf(os.Stderr, "wm: gRPC listening on %s\n", lis.Addr())
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	fmt.Fprintln(os.Stderr, "wm: shutting down")
+	srv.GracefulStop()
+	return nil
+}
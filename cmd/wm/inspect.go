@@ -0,0 +1,246 @@
+package main
+
+import (
+	"InvisibleWaterMarkingSystem/ImageIO"
+	"InvisibleWaterMarkingSystem/Watermark"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+type capacityResult struct {
+	Input           string `json:"input"`
+	Kind            string `json:"kind"`
+	Width           int    `json:"width"`
+	Height          int    `json:"height"`
+	TilesX          int    `json:"tiles_x"`
+	TilesY          int    `json:"tiles_y"`
+	BitsPerTile     int    `json:"bits_per_tile"`
+	MaxMessageBytes int    `json:"max_message_bytes"`
+
+	Reversible *Watermark.ReversibleInfo `json:"reversible,omitempty"`
+}
+
+func runCapacity(args []string) error {
+	fs := flag.NewFlagSet("capacity", flag.ContinueOnError)
+	var common commonFlags
+	var options optionFlags
+	common.register(fs)
+	options.register(fs, optPayload|optVideo)
+	var reversible bool
+	fs.BoolVar(&reversible, "reversible", false, "also report the capacity of the reversible mode")
+
+	if err := parseFlags(fs, args, &common); err != nil {
+		return err
+	}
+	if err := options.validate(); err != nil {
+		return err
+	}
+
+	result, err := capacityOf(common.input, &options.opts)
+	if err != nil {
+		return err
+	}
+	if reversible {
+		if result.Kind != kindImage.String() {
+			return usagef("the reversible mode needs a still image, got %s", result.Kind)
+		}
+		img, _, err := ImageIO.ReadFile(common.input)
+		if err != nil {
+			return err
+		}
+		if result.Reversible, err = Watermark.ReversibleCapacity(img); err != nil {
+			return err
+		}
+	}
+	return printResult(common.json, result, func(w io.Writer) {
+		fmt.Fprintf(w, "%s: %dx%d %s\n", result.Input, result.Width, result.Height, result.Kind)
+		fmt.Fprintf(w, "Tiles: %d x %d = %d (%d bits each)\n", result.TilesX, result.TilesY, result.TilesX*result.TilesY, result.BitsPerTile)
+		fmt.Fprintf(w, "Max message: %d bytes\n", result.MaxMessageBytes)
+		if r := result.Reversible; r != nil {
+			fmt.Fprintf(w, "Reversible:  %d bits, %d message bytes (guard %d, empty bins %d and %d)\n",
+				r.PayloadBits, r.MaxMessageBytes, r.Guard, r.NegZero, r.Zero)
+		}
+	})
+}
+
+func capacityOf(path string, opts *Watermark.Options) (*capacityResult, error) {
+	kind, _, err := classify(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var width, height int
+	switch kind {
+	case kindVideo:
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r, err := ImageIO.NewY4MReader(f)
+		if err != nil {
+			return nil, err
+		}
+		width, height = r.Header.Width, r.Header.Height
+	default:
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		img, _, err := ImageIO.Decode(f)
+		if err != nil {
+			return nil, err
+		}
+		b := img.Bounds()
+		width, height = b.Dx(), b.Dy()
+	}
+
+	c := Watermark.Capacity(width, height)
+	result := &capacityResult{
+		Input:           path,
+		Kind:            kind.String(),
+		Width:           width,
+		Height:          height,
+		TilesX:          c.TilesX,
+		TilesY:          c.TilesY,
+		BitsPerTile:     c.BitsPerTile,
+		MaxMessageBytes: c.MaxMessageBytes,
+	}
+	// Spreading over K video frames gives each chunk a whole tile
+	if kind == kindVideo && opts.TemporalSpread > 1 && c.Tiles() > 0 {
+		result.MaxMessageBytes = (opts.TemporalSpread*c.BitsPerTile - 32) / 8
+	}
+	// Encryption spends part of that on the nonce and tag
+	if opts.PayloadKey != "" && result.MaxMessageBytes > 0 {
+		result.MaxMessageBytes -= Watermark.SealedOverhead
+	}
+	return result, nil
+}
+
+type inspectResult struct {
+	Input           string          `json:"input"`
+	Kind            string          `json:"kind"`
+	Format          string          `json:"format,omitempty"`
+	Width           int             `json:"width"`
+	Height          int             `json:"height"`
+	Frames          int             `json:"frames,omitempty"`
+	Orientation     int             `json:"orientation,omitempty"`
+	EXIF            bool            `json:"exif"`
+	ICCProfile      bool            `json:"icc_profile"`
+	XMP             bool            `json:"xmp"`
+	XMPWatermarked  bool            `json:"xmp_watermarked"`
+	XMPNote         string          `json:"xmp_note,omitempty"`
+	CoefficientMode bool            `json:"coefficient_mode_supported"`
+	Capacity        *capacityResult `json:"capacity"`
+	Watermark       *extractResult  `json:"watermark"`
+
+	// Geometry is the rotation and scale measured from a synchronization
+	// template, when the image carries one
+	Geometry *Watermark.Geometry `json:"geometry,omitempty"`
+}
+
+func runInspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	var common commonFlags
+	var options optionFlags
+	common.register(fs)
+	options.register(fs, optExtract)
+
+	if err := parseFlags(fs, args, &common); err != nil {
+		return err
+	}
+	if err := options.validate(); err != nil {
+		return err
+	}
+
+	kind, format, err := classify(common.input)
+	if err != nil {
+		return err
+	}
+	result := inspectResult{Input: common.input, Kind: kind.String()}
+	if format != ImageIO.FormatUnknown {
+		result.Format = format.String()
+	}
+
+	if result.Capacity, err = capacityOf(common.input, &options.opts); err != nil {
+		return err
+	}
+	result.Width, result.Height = result.Capacity.Width, result.Capacity.Height
+
+	switch {
+	case kind == kindAnimation:
+		g, err := ImageIO.ReadGIF(common.input)
+		if err != nil {
+			return err
+		}
+		result.Frames = len(g.Image)
+	case format == ImageIO.FormatJPEG:
+		data, err := os.ReadFile(common.input)
+		if err != nil {
+			return err
+		}
+		meta, err := ImageIO.ReadJPEGMetadata(data)
+		if err != nil {
+			return err
+		}
+		result.Orientation = meta.Orientation()
+		result.EXIF = meta.HasEXIF()
+		result.ICCProfile = meta.HasICCProfile()
+		result.XMP = meta.HasXMP()
+		result.XMPNote, result.XMPWatermarked = meta.WatermarkXMP()
+		_, err = ImageIO.ReadJPEGCoefficients(data)
+		result.CoefficientMode = err == nil
+	}
+
+	if result.Watermark, err = extractMessage(kind, options.domain, common.input, &options.opts); err != nil {
+		return err
+	}
+	if kind == kindImage {
+		img, _, meta, err := ImageIO.ReadFileWithMetadata(common.input)
+		if err != nil {
+			return err
+		}
+		// No template is the common case, not an error
+		result.Geometry, _ = Watermark.EstimateGeometry(ImageIO.AutoOrient(img, meta))
+	}
+
+	return printResult(common.json, result, func(w io.Writer) {
+		fmt.Fprintf(w, "File:        %s\n", result.Input)
+		fmt.Fprintf(w, "Kind:        %s", result.Kind)
+		if result.Format != "" {
+			fmt.Fprintf(w, " (%s)", result.Format)
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Size:        %dx%d\n", result.Width, result.Height)
+		if result.Frames > 0 {
+			fmt.Fprintf(w, "Frames:      %d\n", result.Frames)
+		}
+		if format == ImageIO.FormatJPEG {
+			fmt.Fprintf(w, "Orientation: %d\n", result.Orientation)
+			fmt.Fprintf(w, "Metadata:    EXIF=%t ICC=%t XMP=%t\n", result.EXIF, result.ICCProfile, result.XMP)
+			if result.XMPWatermarked {
+				fmt.Fprintf(w, "XMP note:    %q\n", result.XMPNote)
+			}
+			fmt.Fprintf(w, "Coefficient-domain embedding: %t\n", result.CoefficientMode)
+		}
+		c := result.Capacity
+		fmt.Fprintf(w, "Capacity:    %d tiles, %d message bytes\n", c.TilesX*c.TilesY, c.MaxMessageBytes)
+		if wm := result.Watermark; wm.Found {
+			fmt.Fprintf(w, "Watermark:   %q", wm.Message)
+			if wm.TilesDecoded > 0 {
+				fmt.Fprintf(w, " (%d/%d tiles agree)", wm.TilesAgreeing, wm.Tiles)
+			}
+			fmt.Fprintln(w)
+		} else if wm.AuthFailed {
+			fmt.Fprintln(w, "Watermark:   present, payload did not authenticate")
+		} else {
+			fmt.Fprintln(w, "Watermark:   none found")
+		}
+		if g := result.Geometry; g != nil {
+			fmt.Fprintf(w, "Geometry:    rotated %.2f°, scaled %.4f from %dx%d (sync template)\n", g.Rotation, g.Scale, g.Width, g.Height)
+		}
+	})
+}
@@ -0,0 +1,187 @@
+// Command wm embeds, extracts and inspects invisible watermarks.
+//
+//	wm embed    -i in.jpg -o out.jpg -m "message" [--key secret]
+//	wm extract  -i out.jpg [--key secret] [--json]
+//	wm detect   -i out.jpg [--key secret] [--json]
+//	wm capacity -i in.jpg [--json]
+//	wm inspect  -i out.jpg [--json]
+//	wm batch    -i in/ -o out/ -m "{filename}-{date}" [-r] [--workers N] [--manifest m.csv]
+//	wm serve    [--addr :8080] [--concurrency N] [--timeout 60s] [--jobs-dir jobs/ [--callback-hosts h1,h2]]
+//	wm grpc     [--addr :9090] [--max-image 64] [--max-pixels N]
+//	wm registry reg.jsonl [--recipient name] [--id payload]
+//	wm fingerprint -i in.jpg -o out.png --key secret --registry reg.jsonl --recipient name [--colluders 3]
+//	wm trace    -i leaked.jpg --key secret --registry reg.jsonl
+//	wm keygen   key.pem
+//	wm verify   -i out.png --public-key key.pem.pub
+//	wm protect  -i in.png -o out.png --key secret
+//	wm tamper   -i out.png --key secret [--map map.png]
+//	wm reversible -i in.png -o out.png -m "message"
+//	wm restore  -i out.png [-o original.png]
+//	wm enroll   -i in.jpg -m "owner" -o zero.json --key secret
+//	wm recover  -i suspect.jpg --zero-key zero.json --key secret
+//	wm logo     -i in.jpg -o out.png --logo logo.png [--key secret]
+//	wm showlogo -i out.png --reference logo.png [-o recovered.png]
+//
+// With --registry reg.jsonl --recipient name, embed generates a payload ID
+// (unless -m is given), records who received it, and extract reports the
+// recipient of the payload it finds.
+//
+// With --payload-key (or WM_PAYLOAD_KEY) the message is encrypted and
+// authenticated before embedding; extraction with a different key, or none,
+// reports the payload as failing authentication.
+//
+// With --sign key.pem (or --sign-hmac secret) embed signs the message, and
+// verify reports the signature as valid, invalid or absent.
+//
+// With --perceptual the QIM step follows the brightness and texture of each
+// block, weaker in flat areas and stronger in busy ones; extraction must be
+// given --perceptual as well.
+//
+// With --modulation spread each bit is spread over many coefficients of its
+// block by a keyed pseudo-noise sequence instead of quantized into one, so
+// that contrast and brightness changes leave it readable. --modulation
+// dithered shifts the QIM lattices by a dither drawn from --key, and
+// --modulation stdm quantizes a keyed projection of many coefficients, so
+// the marked coefficients show no lattice to anyone without the key. All
+// three are keyed and refused without --key.
+//
+// With --sync-strength embed adds a synchronization template to the image, and
+// extract, detect and verify with --sync use it to undo rotation and scaling
+// before reading the watermark; inspect reports the rotation and scale. The
+// resampling costs bits, and only a message embedded with --modulation spread
+// and a --strength of about 40 is still read after, say, a 1 degree rotation
+// and a 0.9 scaling.
+//
+// With --align, extract and detect search for the tile grid of a copy cropped
+// on the top or left and report the offset where it starts.
+//
+// With --estimate-gain, extract and detect first search for the change of
+// contrast a copy has been through, so that brightness, contrast and gamma
+// edits do not throw the coefficients off the QIM lattice.
+//
+// Exit codes: 0 success, 1 error, 2 usage error, 3 no watermark, registry
+// record or signature found, 4 watermark found but its payload failed
+// authentication, 5 signature invalid, 6 tampering detected.
+package main
+
+import (
+	"InvisibleWaterMarkingSystem/Registry"
+	"InvisibleWaterMarkingSystem/Watermark"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitUsage    = 2
+	exitNotFound = 3
+	exitAuth     = 4
+	exitInvalid  = 5
+	exitTampered = 6
+)
+
+// usageError marks errors caused by bad arguments rather than bad input
+type usageError struct{ msg string }
+
+func (e *usageError) Error() string { return e.msg }
+
+func usagef(format string, args ...any) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"embed", "embed a message into an image, animated GIF or Y4M video", runEmbed},
+	{"extract", "read the embedded message", runExtract},
+	{"detect", "report whether a watermark is present without decoding the message", runDetect},
+	{"capacity", "show how many tiles and message bytes an image holds", runCapacity},
+	{"inspect", "show format, metadata, capacity and watermark status", runInspect},
+	{"batch", "watermark every image in a directory tree", runBatch},
+	{"serve", "run the HTTP service", runServe},
+	{"grpc", "run the gRPC service", runGRPC},
+	{"registry", "list the payloads recorded with embed --registry", runRegistry},
+	{"fingerprint", "embed a collusion-resistant codeword for one recipient", runFingerprint},
+	{"trace", "score registered fingerprints against a leaked copy", runTrace},
+	{"keygen", "create an Ed25519 key pair for signing messages", runKeygen},
+	{"verify", "check the signature of a signed message", runVerify},
+	{"protect", "add a semi-fragile mark for locating later edits", runProtect},
+	{"tamper", "check a protected image and map the edited regions", runTamper},
+	{"reversible", "embed a message that can be removed again, restoring the original", runReversible},
+	{"restore", "read a reversible message and recover the original pixels", runRestore},
+	{"enroll", "register a zero-watermark key for an image without changing it", runEnroll},
+	{"recover", "recover a zero-watermark message with its registered key", runRecover},
+	{"logo", "embed a small binary logo image", runLogo},
+	{"showlogo", "recover an embedded logo and correlate it with the original", runShowLogo},
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: wm <command> [flags]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-11s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w, "\nRun 'wm <command> -h' for the flags of a command.")
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) == 0 {
+		usage(os.Stderr)
+		return exitUsage
+	}
+	if args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		usage(os.Stdout)
+		return exitOK
+	}
+
+	// The library reports progress on Output; keep stdout for results
+	Watermark.Output = io.Discard
+
+	for _, c := range commands {
+		if c.name != args[0] {
+			continue
+		}
+		err := c.run(args[1:])
+		var ue *usageError
+		switch {
+		case err == nil:
+			return exitOK
+		case errors.Is(err, flag.ErrHelp):
+			return exitOK
+		case errors.As(err, &ue):
+			fmt.Fprintf(os.Stderr, "wm %s: %v\n", c.name, err)
+			return exitUsage
+		case errors.Is(err, Watermark.ErrNoWatermark), errors.Is(err, Registry.ErrNotFound):
+			fmt.Fprintf(os.Stderr, "wm %s: %v\n", c.name, err)
+			return exitNotFound
+		case errors.Is(err, Watermark.ErrAuthFailed):
+			fmt.Fprintf(os.Stderr, "wm %s: %v\n", c.name, err)
+			return exitAuth
+		case errors.Is(err, Watermark.ErrSignatureInvalid):
+			fmt.Fprintf(os.Stderr, "wm %s: %v\n", c.name, err)
+			return exitInvalid
+		case errors.Is(err, Watermark.ErrTampered):
+			fmt.Fprintf(os.Stderr, "wm %s: %v\n", c.name, err)
+			return exitTampered
+		default:
+			fmt.Fprintf(os.Stderr, "wm %s: %v\n", c.name, err)
+			return exitError
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "wm: unknown command %q\n\n", args[0])
+	usage(os.Stderr)
+	return exitUsage
+}
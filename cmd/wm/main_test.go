@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// wm runs the command line with stdout and stderr captured
+func wm(t *testing.T, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+	dir := t.TempDir()
+	outFile, err := os.Create(filepath.Join(dir, "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errFile, err := os.Create(filepath.Join(dir, "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedOut, savedErr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = outFile, errFile
+	code = run(args)
+	os.Stdout, os.Stderr = savedOut, savedErr
+	outFile.Close()
+	errFile.Close()
+
+	out, _ := os.ReadFile(outFile.Name())
+	errOut, _ := os.ReadFile(errFile.Name())
+	return code, string(out), string(errOut)
+}
+
+// fixtures writes a textured 512x512 PNG and two marked copies of it, one
+// with an encrypted payload, and returns their paths
+func fixtures(t *testing.T) (cover, marked, sealed string) {
+	t.Helper()
+	t.Setenv(payloadKeyEnv, "")
+	dir := t.TempDir()
+	rng := rand.New(rand.NewPCG(1, 2))
+	img := image.NewRGBA(image.Rect(0, 0, 512, 512))
+	for y := 0; y < 512; y++ {
+		for x := 0; x < 512; x++ {
+			v := 128 + 40*math.Sin(float64(x)/23) + 30*math.Cos(float64(y)/17) + 12*rng.NormFloat64()
+			v = math.Max(30, math.Min(225, v))
+			img.SetRGBA(x, y, color.RGBA{R: uint8(v), G: uint8(v * 0.9), B: uint8(255 - v), A: 0xFF})
+		}
+	}
+	cover = filepath.Join(dir, "cover.png")
+	f, err := os.Create(cover)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	marked = filepath.Join(dir, "marked.png")
+	if code, _, stderr := wm(t, "embed", "-i", cover, "-o", marked, "-m", "Hello World"); code != exitOK {
+		t.Fatalf("embed: exit %d: %s", code, stderr)
+	}
+	sealed = filepath.Join(dir, "sealed.png")
+	if code, _, stderr := wm(t, "embed", "-i", cover, "-o", sealed, "-m", "Hello World", "--payload-key", "pk"); code != exitOK {
+		t.Fatalf("embed --payload-key: exit %d: %s", code, stderr)
+	}
+	return cover, marked, sealed
+}
+
+func TestExitCodes(t *testing.T) {
+	cover, marked, sealed := fixtures(t)
+	out := filepath.Join(t.TempDir(), "out.png")
+	for _, c := range []struct {
+		args []string
+		code int
+	}{
+		{nil, exitUsage},
+		{[]string{"help"}, exitOK},
+		{[]string{"nope"}, exitUsage},
+		{[]string{"extract", marked, "-h"}, exitOK},
+		{[]string{"extract", marked}, exitOK},
+		{[]string{"extract", cover}, exitNotFound},
+		{[]string{"extract", sealed}, exitAuth},
+		{[]string{"extract", sealed, "--payload-key", "pk"}, exitOK},
+		{[]string{"extract", sealed, "--payload-key", "not pk"}, exitAuth},
+		{[]string{"extract", marked, "--key", "k"}, exitNotFound},
+		{[]string{"extract", filepath.Join(t.TempDir(), "missing.png")}, exitError},
+		{[]string{"extract"}, exitUsage},
+		{[]string{"extract", "-i", marked, marked}, exitUsage},
+		{[]string{"extract", marked, "--domain", "dct"}, exitUsage},
+		{[]string{"extract", marked, "--modulation", "fm"}, exitUsage},
+		{[]string{"extract", marked, "--modulation", "dithered"}, exitUsage},
+		{[]string{"embed", "-i", cover, "-o", out}, exitUsage},
+		{[]string{"embed", "-i", cover, "-m", "x"}, exitUsage},
+		{[]string{"embed", "-i", cover, "-o", out, "-m", "x", "--quality", "0"}, exitUsage},
+		{[]string{"registry", filepath.Join(t.TempDir(), "reg.jsonl"), "--id", "wm-unknown"}, exitNotFound},
+	} {
+		if code, _, stderr := wm(t, c.args...); code != c.code {
+			t.Errorf("wm %s: exit %d, want %d: %s", strings.Join(c.args, " "), code, c.code, stderr)
+		}
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	_, marked, _ := fixtures(t)
+
+	code, stdout, stderr := wm(t, "extract", marked, "--json")
+	if code != exitOK {
+		t.Fatalf("extract: exit %d: %s", code, stderr)
+	}
+	var r extractResult
+	if err := json.Unmarshal([]byte(stdout), &r); err != nil {
+		t.Fatalf("%v: %s", err, stdout)
+	}
+	if !r.Found || r.Message != "Hello World" || r.Kind != "image" || r.Tiles != 4 || r.TilesAgreeing != r.TilesDecoded || r.TilesDecoded == 0 {
+		t.Errorf("extract --json: %+v", r)
+	}
+
+	code, stdout, stderr = wm(t, "detect", marked, "--json")
+	if code != exitOK {
+		t.Fatalf("detect: exit %d: %s", code, stderr)
+	}
+	var d detectResult
+	if err := json.Unmarshal([]byte(stdout), &d); err != nil {
+		t.Fatalf("%v: %s", err, stdout)
+	}
+	if !d.Present || d.PValue == nil || *d.PValue > 1e-6 {
+		t.Errorf("detect --json: %+v", d)
+	}
+
+	// Without --json the message is the first line
+	if _, stdout, _ := wm(t, "extract", marked); !strings.HasPrefix(stdout, "Hello World\n") {
+		t.Errorf("extract: %q", stdout)
+	}
+}
+
+func TestFlagGroups(t *testing.T) {
+	cover, marked, _ := fixtures(t)
+	out := filepath.Join(t.TempDir(), "out.png")
+	for _, args := range [][]string{
+		// Only the embedder adds a template, only the extractors search
+		{"extract", marked, "--sync-strength", "2"},
+		{"embed", "-i", cover, "-o", out, "-m", "x", "--align"},
+		// capacity reads only the payload and video options, tamper only the
+		// key and its step, enroll only the key
+		{"capacity", cover, "--strength", "40"},
+		{"capacity", cover, "--key", "k"},
+		{"tamper", cover, "--key", "k", "--modulation", "qim"},
+		{"enroll", cover, "--payload-key", "pk"},
+	} {
+		code, _, stderr := wm(t, args...)
+		if code != exitUsage || !strings.Contains(stderr, "flag provided but not defined") {
+			t.Errorf("wm %s: exit %d: %s", strings.Join(args, " "), code, stderr)
+		}
+	}
+
+	// Flags of a registered group are accepted
+	if code, _, stderr := wm(t, "extract", marked, "--align", "--estimate-gain", "--strength", "10", "--palette-passes", "2"); code != exitOK {
+		t.Errorf("extract with recovery, pixel and palette flags: exit %d: %s", code, stderr)
+	}
+}
+
+func TestEnrollAndRecover(t *testing.T) {
+	cover, _, _ := fixtures(t)
+	keyFile := filepath.Join(t.TempDir(), "zero.json")
+
+	if code, _, _ := wm(t, "enroll", cover, "-o", keyFile, "-m", "owner"); code != exitUsage {
+		t.Errorf("enroll without --key: exit %d", code)
+	}
+	if code, _, stderr := wm(t, "enroll", cover, "-o", keyFile, "-m", "owner", "--key", "k"); code != exitOK {
+		t.Fatalf("enroll: exit %d: %s", code, stderr)
+	}
+	if code, _, _ := wm(t, "enroll", cover, "-o", keyFile, "-m", "owner", "--key", "k"); code != exitError {
+		t.Errorf("enroll over an existing key file: exit %d", code)
+	}
+
+	code, stdout, stderr := wm(t, "recover", cover, "--zero-key", keyFile, "--key", "k", "--json")
+	if code != exitOK {
+		t.Fatalf("recover: exit %d: %s", code, stderr)
+	}
+	var r recoverResult
+	if err := json.Unmarshal([]byte(stdout), &r); err != nil {
+		t.Fatalf("%v: %s", err, stdout)
+	}
+	if !r.Found || r.Message != "owner" {
+		t.Errorf("recover --json: %s", stdout)
+	}
+	if code, _, _ := wm(t, "recover", cover, "--zero-key", keyFile, "--key", "not k"); code != exitNotFound {
+		t.Errorf("recover with the wrong key: exit %d", code)
+	}
+}
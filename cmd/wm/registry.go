@@ -0,0 +1,95 @@
+package main
+
+import (
+	"InvisibleWaterMarkingSystem/Registry"
+	"InvisibleWaterMarkingSystem/Watermark"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+)
+
+// registerEmbed records a successful embed. The registry is opened only now
+// so a failed embed leaves no trace in it.
+func registerEmbed(path, recipient, note, input, payload string, opts *Watermark.Options) (*Registry.Record, error) {
+	hash, err := Registry.HashFile(input)
+	if err != nil {
+		return nil, err
+	}
+	reg, err := Registry.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reg.Close()
+	return reg.Add(Registry.Record{
+		PayloadID:    payload,
+		Recipient:    recipient,
+		Note:         note,
+		SourceSHA256: hash,
+		SourceName:   filepath.Base(input),
+		Options:      opts,
+	})
+}
+
+// lookupPayload returns the record registered for an extracted message, or
+// nil when the message is not in the registry
+func lookupPayload(path, payload string) (*Registry.Record, error) {
+	reg, err := Registry.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reg.Close()
+	rec, err := reg.Get(payload)
+	if errors.Is(err, Registry.ErrNotFound) {
+		return nil, nil
+	}
+	return rec, err
+}
+
+func printRecord(w io.Writer, rec *Registry.Record) {
+	fmt.Fprintf(w, "Recipient: %s (payload %s, embedded %s from %s)\n",
+		rec.Recipient, rec.PayloadID, rec.Created.Local().Format(time.DateTime), rec.SourceName)
+	if rec.Note != "" {
+		fmt.Fprintf(w, "Note: %s\n", rec.Note)
+	}
+}
+
+func runRegistry(args []string) error {
+	fs := flag.NewFlagSet("registry", flag.ContinueOnError)
+	var common commonFlags
+	common.register(fs)
+	var recipient, payload string
+	fs.StringVar(&recipient, "recipient", "", "only records for this recipient")
+	fs.StringVar(&payload, "id", "", "only the record with this payload ID")
+
+	if err := parseFlags(fs, args, &common); err != nil {
+		return err
+	}
+	reg, err := Registry.Open(common.input)
+	if err != nil {
+		return err
+	}
+	defer reg.Close()
+
+	var records []Registry.Record
+	switch {
+	case payload != "":
+		rec, err := reg.Get(payload)
+		if err != nil {
+			return err
+		}
+		records = []Registry.Record{*rec}
+	case recipient != "":
+		records = reg.ByRecipient(recipient)
+	default:
+		records = reg.List()
+	}
+
+	return printResult(common.json, records, func(w io.Writer) {
+		for _, rec := range records {
+			fmt.Fprintf(w, "%s  %-20s  %s  %s\n", rec.PayloadID, rec.Recipient, rec.Created.Local().Format(time.DateTime), rec.SourceName)
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"InvisibleWaterMarkingSystem/Jobs"
+	"InvisibleWaterMarkingSystem/Registry"
+	"InvisibleWaterMarkingSystem/Server"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	cfg := Server.DefaultConfig()
+	var addr string
+	var maxUploadMB int64
+	fs.StringVar(&addr, "addr", ":8080", "listen address")
+	fs.Int64Var(&maxUploadMB, "max-upload", cfg.MaxUploadBytes>>20, "largest request body in MiB")
+	fs.IntVar(&cfg.MaxPixels, "max-pixels", cfg.MaxPixels, "largest image accepted, in pixels")
+	fs.IntVar(&cfg.MaxConcurrent, "concurrency", cfg.MaxConcurrent, "requests processed at once")
+	fs.DurationVar(&cfg.Timeout, "timeout", cfg.Timeout, "per-request time limit, including the wait for a slot")
+	jobCfg := Jobs.DefaultConfig()
+	fs.StringVar(&jobCfg.Dir, "jobs-dir", "", "enable background /jobs, persisted in this directory")
+	fs.IntVar(&jobCfg.Workers, "job-workers", jobCfg.Workers, "background jobs processed at once")
+	fs.IntVar(&jobCfg.MaxAttempts, "job-attempts", jobCfg.MaxAttempts, "attempts per background job")
+	var callbackHosts string
+	fs.StringVar(&callbackHosts, "callback-hosts", "", "comma-separated hosts job callbacks may go to; none disables callbacks")
+	var registryPath string
+	fs.StringVar(&registryPath, "registry", "", "record recipients of /embed and report them from /extract")
+
+	fs.SetOutput(os.Stderr)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return &usageError{msg: err.Error()}
+	}
+	if fs.NArg() > 0 {
+		return usagef("unexpected arguments %q", fs.Args())
+	}
+	if maxUploadMB <= 0 || cfg.MaxPixels <= 0 || cfg.MaxConcurrent <= 0 || cfg.Timeout <= 0 {
+		return usagef("--max-upload, --max-pixels, --concurrency and --timeout must be positive")
+	}
+	cfg.MaxUploadBytes = maxUploadMB << 20
+
+	if registryPath != "" {
+		reg, err := Registry.Open(registryPath)
+		if err != nil {
+			return err
+		}
+		defer reg.Close()
+		cfg.Registry = reg
+	}
+
+	if jobCfg.Dir != "" {
+		if jobCfg.Workers <= 0 || jobCfg.MaxAttempts <= 0 {
+			return usagef("--job-workers and --job-attempts must be positive")
+		}
+		for _, h := range strings.Split(callbackHosts, ",") {
+			if h = strings.TrimSpace(h); h != "" {
+				jobCfg.CallbackHosts = append(jobCfg.CallbackHosts, h)
+			}
+		}
+		queue, err := Jobs.Open(jobCfg)
+		if err != nil {
+			return err
+		}
+		defer queue.Close()
+		cfg.Jobs = queue
+	}
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           Server.New(cfg),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       cfg.Timeout,
+		WriteTimeout:      cfg.Timeout + 10*time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+	fmt.Fprintf(os.Stderr, "wm: listening on %s\n", addr)
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	fmt.Fprintln(os.Stderr, "wm: shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
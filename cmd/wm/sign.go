@@ -0,0 +1,234 @@
+package main
+
+import (
+	"InvisibleWaterMarkingSystem/ImageIO"
+	"InvisibleWaterMarkingSystem/Watermark"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// signFlags select how embed signs the message
+type signFlags struct {
+	keyFile string
+	hmacKey string
+}
+
+func (s *signFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&s.keyFile, "sign", "", "sign the message with this Ed25519 private key (PEM, from wm keygen)")
+	fs.StringVar(&s.hmacKey, "sign-hmac", "", "sign the message with a truncated HMAC under this secret; fits beside short messages in one tile")
+}
+
+// signer returns nil when no signing was asked for
+func (s *signFlags) signer() (Watermark.Signer, error) {
+	switch {
+	case s.keyFile != "" && s.hmacKey != "":
+		return nil, usagef("--sign and --sign-hmac are exclusive")
+	case s.hmacKey != "":
+		return Watermark.HMACKey(s.hmacKey), nil
+	case s.keyFile != "":
+		key, err := readKey(s.keyFile)
+		if err != nil {
+			return nil, err
+		}
+		private, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s: not an Ed25519 private key", s.keyFile)
+		}
+		return Watermark.Ed25519Signer{Key: private}, nil
+	}
+	return nil, nil
+}
+
+// verifierFor is the verifier matching a signer, for embed --verify
+func verifierFor(signer Watermark.Signer) Watermark.Verifier {
+	switch s := signer.(type) {
+	case Watermark.Ed25519Signer:
+		return Watermark.Ed25519Verifier{Key: s.Key.Public().(ed25519.PublicKey)}
+	case Watermark.HMACKey:
+		return s
+	}
+	return nil
+}
+
+// readKey reads a PEM Ed25519 key: PKCS#8 for private keys, PKIX for public
+func readKey(path string) (any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block", path)
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return key, nil
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("%s: unexpected PEM block %q", path, block.Type)
+}
+
+type keygenResult struct {
+	PrivateKey string `json:"private_key"`
+	PublicKey  string `json:"public_key"`
+}
+
+func runKeygen(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	var common commonFlags
+	common.registerOutput(fs)
+	fs.StringVar(&common.input, "o", "", "private key file; the public key is written next to it with .pub added")
+	fs.StringVar(&common.input, "output", "", "private key file (same as -o)")
+	var force bool
+	fs.BoolVar(&force, "force", false, "overwrite existing key files")
+
+	if err := parseFlags(fs, args, &common); err != nil {
+		return err
+	}
+	output := common.input
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	write := func(path string, mode os.FileMode, block *pem.Block) error {
+		f, err := os.OpenFile(path, flags, mode)
+		if err != nil {
+			return err
+		}
+		if err := pem.Encode(f, block); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	if err := write(output, 0o600, &pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}); err != nil {
+		return err
+	}
+	if err := write(output+".pub", 0o644, &pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}); err != nil {
+		return err
+	}
+	result := keygenResult{PrivateKey: output, PublicKey: output + ".pub"}
+	return printResult(common.json, result, func(w io.Writer) {
+		fmt.Fprintf(w, "Wrote %s and %s\n", result.PrivateKey, result.PublicKey)
+	})
+}
+
+type verifyResult struct {
+	Input string `json:"input"`
+	*Watermark.Verification
+}
+
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	var common commonFlags
+	var options optionFlags
+	common.register(fs)
+	options.register(fs, optKey|optPayload|optPixel|optRecovery)
+	var keyFile, hmacKey string
+	fs.StringVar(&keyFile, "public-key", "", "Ed25519 public key (PEM) the signature must verify under; a private key file also works")
+	fs.StringVar(&hmacKey, "hmac-key", "", "secret of a --sign-hmac signature")
+
+	if err := parseFlags(fs, args, &common); err != nil {
+		return err
+	}
+	if err := options.validate(); err != nil {
+		return err
+	}
+
+	var verifier Watermark.Verifier
+	switch {
+	case keyFile != "" && hmacKey != "":
+		return usagef("--public-key and --hmac-key are exclusive")
+	case hmacKey != "":
+		verifier = Watermark.HMACKey(hmacKey)
+	case keyFile != "":
+		key, err := readKey(keyFile)
+		if err != nil {
+			return err
+		}
+		switch k := key.(type) {
+		case ed25519.PublicKey:
+			verifier = Watermark.Ed25519Verifier{Key: k}
+		case ed25519.PrivateKey:
+			verifier = Watermark.Ed25519Verifier{Key: k.Public().(ed25519.PublicKey)}
+		default:
+			return fmt.Errorf("%s: not an Ed25519 key", keyFile)
+		}
+	default:
+		return usagef("--public-key or --hmac-key is required")
+	}
+
+	kind, _, err := classify(common.input)
+	if err != nil {
+		return err
+	}
+	if kind != kindImage {
+		return usagef("signatures are verified on still images, got %s", kind)
+	}
+	img, _, meta, err := ImageIO.ReadFileWithMetadata(common.input)
+	if err != nil {
+		return err
+	}
+	v := Watermark.Verify(ImageIO.AutoOrient(img, meta), verifier, &options.opts)
+
+	result := verifyResult{Input: common.input, Verification: v}
+	if err := printResult(common.json, result, func(w io.Writer) {
+		switch v.Status {
+		case Watermark.SignatureValid:
+			fmt.Fprintf(w, "Signature valid (%s): %q\n", v.Scheme, v.Message)
+		case Watermark.SignatureInvalid:
+			fmt.Fprintf(w, "Signature INVALID (%s): %q\n", v.Scheme, v.Message)
+		default:
+			switch {
+			case v.Message != "":
+				fmt.Fprintf(w, "No signature; message %q is unsigned\n", v.Message)
+			case v.AuthFailed:
+				fmt.Fprintln(w, "Watermark found but its payload did not authenticate")
+			default:
+				fmt.Fprintln(w, "No signed watermark found")
+			}
+		}
+	}); err != nil {
+		return err
+	}
+
+	switch v.Status {
+	case Watermark.SignatureInvalid:
+		return fmt.Errorf("%s: %w", common.input, Watermark.ErrSignatureInvalid)
+	case Watermark.SignatureAbsent:
+		if v.AuthFailed {
+			return fmt.Errorf("%s: %w; check --payload-key", common.input, Watermark.ErrAuthFailed)
+		}
+		return fmt.Errorf("%s: %w: no signature", common.input, Watermark.ErrNoWatermark)
+	}
+	return nil
+}
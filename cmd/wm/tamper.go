@@ -0,0 +1,156 @@
+package main
+
+import (
+	"InvisibleWaterMarkingSystem/ImageIO"
+	"InvisibleWaterMarkingSystem/Watermark"
+	"flag"
+	"fmt"
+	"io"
+)
+
+type protectResult struct {
+	Input   string `json:"input"`
+	Output  string `json:"output"`
+	Format  string `json:"format"`
+	Regions int    `json:"regions"`
+}
+
+func runProtect(args []string) error {
+	fs := flag.NewFlagSet("protect", flag.ContinueOnError)
+	var common commonFlags
+	var options optionFlags
+	common.register(fs)
+	options.register(fs, optKey|optTamper)
+	var output, formatName string
+	var quality int
+	fs.StringVar(&output, "o", "", "output file")
+	fs.StringVar(&output, "output", "", "output file (same as -o)")
+	fs.StringVar(&formatName, "format", "", "output image format (jpeg, png, bmp, tiff); default from the output extension")
+	fs.IntVar(&quality, "quality", 100, "JPEG quality")
+
+	if err := parseFlags(fs, args, &common); err != nil {
+		return err
+	}
+	if err := options.validate(); err != nil {
+		return err
+	}
+	switch {
+	case output == "":
+		return usagef("no output file (use -o)")
+	case options.opts.Key == "":
+		return usagef("--key is required; the tamper codes are keyed with it")
+	case quality < 1 || quality > 100:
+		return usagef("--quality must be between 1 and 100")
+	}
+
+	kind, inFormat, err := classify(common.input)
+	if err != nil {
+		return err
+	}
+	if kind != kindImage {
+		return usagef("tamper protection needs a still image, got %s", kind)
+	}
+	outFormat := ImageIO.OutputFormat(output, inFormat)
+	if formatName != "" {
+		outFormat = ImageIO.ParseFormat(formatName)
+	}
+	switch outFormat {
+	case ImageIO.FormatUnknown:
+		return usagef("unknown --format %q", formatName)
+	case ImageIO.FormatGIF:
+		return usagef("GIF palettes cannot hold the tamper codes; choose another format")
+	}
+
+	img, _, meta, err := ImageIO.ReadFileWithMetadata(common.input)
+	if err != nil {
+		return err
+	}
+	img = ImageIO.AutoOrient(img, meta)
+	marked, err := Watermark.EmbedTamper(img, &options.opts)
+	if err != nil {
+		return err
+	}
+	if err := writeMarked(output, marked, outFormat, quality, "", meta); err != nil {
+		return err
+	}
+
+	b := img.Bounds()
+	result := protectResult{
+		Input:   common.input,
+		Output:  output,
+		Format:  outFormat.String(),
+		Regions: (b.Dx() / Watermark.TamperRegion) * (b.Dy() / Watermark.TamperRegion),
+	}
+	return printResult(common.json, result, func(w io.Writer) {
+		fmt.Fprintf(w, "Protected %s (%d regions of %dx%d)\n", output, result.Regions, Watermark.TamperRegion, Watermark.TamperRegion)
+	})
+}
+
+type tamperResult struct {
+	Input string `json:"input"`
+	Map   string `json:"map,omitempty"`
+	*Watermark.TamperReport
+	Fraction float64 `json:"fraction"`
+}
+
+func runTamper(args []string) error {
+	fs := flag.NewFlagSet("tamper", flag.ContinueOnError)
+	var common commonFlags
+	var options optionFlags
+	common.register(fs)
+	options.register(fs, optKey|optTamper)
+	var mapPath string
+	fs.StringVar(&mapPath, "map", "", "write an image marking the tampered regions in red")
+
+	if err := parseFlags(fs, args, &common); err != nil {
+		return err
+	}
+	if err := options.validate(); err != nil {
+		return err
+	}
+	if options.opts.Key == "" {
+		return usagef("--key is required")
+	}
+
+	kind, _, err := classify(common.input)
+	if err != nil {
+		return err
+	}
+	if kind != kindImage {
+		return usagef("tamper checks need a still image, got %s", kind)
+	}
+	img, _, meta, err := ImageIO.ReadFileWithMetadata(common.input)
+	if err != nil {
+		return err
+	}
+	img = ImageIO.AutoOrient(img, meta)
+	report, err := Watermark.VerifyTamper(img, &options.opts)
+	if err != nil {
+		return err
+	}
+	if mapPath != "" {
+		format := ImageIO.OutputFormat(mapPath, ImageIO.FormatPNG)
+		if err := ImageIO.WriteFile(mapPath, Watermark.TamperMap(img, report), format, ImageIO.DefaultEncodeOptions()); err != nil {
+			return err
+		}
+	}
+
+	result := tamperResult{Input: common.input, Map: mapPath, TamperReport: report, Fraction: report.Fraction()}
+	if err := printResult(common.json, result, func(w io.Writer) {
+		total := report.RegionsX * report.RegionsY
+		if report.Tampered == 0 {
+			fmt.Fprintf(w, "No tampering found in %d regions\n", total)
+		} else {
+			fmt.Fprintf(w, "Tampered: %d of %d regions (%.1f%%)\n", report.Tampered, total, 100*result.Fraction)
+		}
+		if mapPath != "" {
+			fmt.Fprintf(w, "Map written to %s\n", mapPath)
+		}
+	}); err != nil {
+		return err
+	}
+	if report.Tampered > 0 {
+		return fmt.Errorf("%s: %w in %d regions", common.input, Watermark.ErrTampered, report.Tampered)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"InvisibleWaterMarkingSystem/ImageIO"
+	"InvisibleWaterMarkingSystem/Watermark"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+type enrollResult struct {
+	Input   string `json:"input"`
+	KeyFile string `json:"key_file"`
+	Message string `json:"message"`
+	Bits    int    `json:"bits"`
+}
+
+func runEnroll(args []string) error {
+	fs := flag.NewFlagSet("enroll", flag.ContinueOnError)
+	var common commonFlags
+	var options optionFlags
+	common.register(fs)
+	options.register(fs, optKey)
+	var keyFile, message string
+	var force bool
+	fs.StringVar(&keyFile, "o", "", "file to store the registered zero-watermark key in")
+	fs.StringVar(&keyFile, "output", "", "file to store the registered zero-watermark key in (same as -o)")
+	fs.StringVar(&message, "m", "", "message to bind to the image")
+	fs.StringVar(&message, "message", "", "message to bind to the image (same as -m)")
+	fs.BoolVar(&force, "force", false, "overwrite an existing key file")
+
+	if err := parseFlags(fs, args, &common); err != nil {
+		return err
+	}
+	if err := options.validate(); err != nil {
+		return err
+	}
+	if keyFile == "" {
+		return usagef("no key file (use -o)")
+	}
+	if options.opts.Key == "" {
+		return usagef("--key is required; without it the key file alone reveals the message")
+	}
+	if !force {
+		if _, err := os.Stat(keyFile); err == nil {
+			return fmt.Errorf("%s already exists; use --force to overwrite", keyFile)
+		}
+	}
+
+	kind, _, err := classify(common.input)
+	if err != nil {
+		return err
+	}
+	if kind != kindImage {
+		return usagef("zero-watermarks are registered on still images, got %s", kind)
+	}
+	img, _, meta, err := ImageIO.ReadFileWithMetadata(common.input)
+	if err != nil {
+		return err
+	}
+	key, err := Watermark.RegisterZero(ImageIO.AutoOrient(img, meta), message, &options.opts)
+	if err != nil {
+		return err
+	}
+	if err := Watermark.WriteZeroKey(keyFile, key); err != nil {
+		return err
+	}
+
+	result := enrollResult{Input: common.input, KeyFile: keyFile, Message: message, Bits: key.Bits}
+	return printResult(common.json, result, func(w io.Writer) {
+		fmt.Fprintf(w, "Registered %q for %s; key written to %s (image unchanged)\n", message, common.input, keyFile)
+	})
+}
+
+type recoverResult struct {
+	Input   string `json:"input"`
+	KeyFile string `json:"key_file"`
+	Found   bool   `json:"found"`
+	*Watermark.ZeroRecovery
+}
+
+func runRecover(args []string) error {
+	fs := flag.NewFlagSet("recover", flag.ContinueOnError)
+	var common commonFlags
+	var options optionFlags
+	common.register(fs)
+	options.register(fs, optKey)
+	var keyFile string
+	fs.StringVar(&keyFile, "zero-key", "", "key file written by wm enroll")
+
+	if err := parseFlags(fs, args, &common); err != nil {
+		return err
+	}
+	if err := options.validate(); err != nil {
+		return err
+	}
+	if keyFile == "" {
+		return usagef("--zero-key is required")
+	}
+	key, err := Watermark.ReadZeroKey(keyFile)
+	if err != nil {
+		return err
+	}
+
+	kind, _, err := classify(common.input)
+	if err != nil {
+		return err
+	}
+	if kind != kindImage {
+		return usagef("zero-watermarks are recovered from still images, got %s", kind)
+	}
+	img, _, meta, err := ImageIO.ReadFileWithMetadata(common.input)
+	if err != nil {
+		return err
+	}
+	r, err := Watermark.RecoverZero(ImageIO.AutoOrient(img, meta), key, &options.opts)
+	if err != nil {
+		return fmt.Errorf("%s: %w", common.input, err)
+	}
+
+	result := recoverResult{Input: common.input, KeyFile: keyFile, Found: true, ZeroRecovery: r}
+	return printResult(common.json, result, func(w io.Writer) {
+		fmt.Fprintf(w, "Message: %q (feature agreement %.1f%%)\n", r.Message, 100*r.Agreement)
+	})
+}
@@ -86,25 +86,30 @@
 package main
 
 import (
+	"InvisibleWaterMarkingSystem/ImageIO"
 	"InvisibleWaterMarkingSystem/Watermark"
 	"fmt"
-	"image"
-	"image/jpeg"
 	"os"
 )
 
 func main() {
-	// Load original image
-	file, err := os.Open("Car.jpg")
-	if err != nil {
-		panic(err)
+	// Load original image (JPEG, PNG, GIF, BMP or TIFF)
+	inputPath := "Car.jpg"
+	if len(os.Args) > 1 {
+		inputPath = os.Args[1]
 	}
-	defer file.Close()
 
-	img, _, err := image.Decode(file)
+	img, format, meta, err := ImageIO.ReadFileWithMetadata(inputPath)
 	if err != nil {
 		panic(err)
 	}
+	fmt.Printf("Loaded %s (%s)\n", inputPath, format)
+
+	// Embed into the upright image so tiles line up with what viewers display
+	img = ImageIO.AutoOrient(img, meta)
+
+	// The watermarked copy is written in the same format as the input
+	outputPath := "Watermarked_Image" + format.Extension()
 
 	message := "Hello World"
 
@@ -138,19 +143,15 @@ func main() {
 	ycb := Watermark.Embed_Watermark(img, message)
 
 	// Save watermarked image
-	outFile, err := os.Create("Watermarked_Image.jpg")
-	if err != nil {
-		panic(err)
-	}
-	defer outFile.Close()
-
-	options := &jpeg.Options{Quality: 100}
-	err = jpeg.Encode(outFile, ycb, options)
+	encodeOptions := ImageIO.DefaultEncodeOptions()
+	encodeOptions.Metadata = meta
+	encodeOptions.XMPNote = "Invisible watermark embedded"
+	err = ImageIO.WriteFile(outputPath, ycb, format, encodeOptions)
 	if err != nil {
 		panic(err)
 	}
 
-	fmt.Println("\n✓ Watermarked image saved")
+	fmt.Printf("\n✓ Watermarked image saved as '%s'\n", outputPath)
 
 	// ============================================
 	// TEST 3: Check Watermark in Y Matrix
@@ -160,13 +161,7 @@ func main() {
 	fmt.Println("╚════════════════════════════════════════════════════════════╝")
 
 	// Reconstruct Y matrix from watermarked image
-	wmFile, err := os.Open("Watermarked_Image.jpg")
-	if err != nil {
-		panic(err)
-	}
-	defer wmFile.Close()
-
-	wmImg, _, err := image.Decode(wmFile)
+	wmImg, _, err := ImageIO.ReadFile(outputPath)
 	if err != nil {
 		panic(err)
 	}
@@ -240,6 +235,36 @@ func main() {
 		}
 	}
 
+	// ============================================
+	// TEST 7: JPEG Coefficient-Domain Round Trip
+	// ============================================
+	if format == ImageIO.FormatJPEG {
+		fmt.Println("\n\n╔════════════════════════════════════════════════════════════╗")
+		fmt.Println("║  TEST 7: JPEG Coefficient-Domain Embedding                ║")
+		fmt.Println("╚════════════════════════════════════════════════════════════╝")
+
+		original, err := os.ReadFile(inputPath)
+		if err != nil {
+			panic(err)
+		}
+
+		marked, err := Watermark.Embed_Watermark_JPEG(original, message, nil)
+		if err != nil {
+			fmt.Printf("\n✗ Coefficient embedding failed: %v\n", err)
+		} else {
+			fmt.Printf("Rewrote %d bytes -> %d bytes without a pixel round trip\n", len(original), len(marked))
+
+			coeffMessage, err := Watermark.ExtractSingleMessageJPEG(marked, nil)
+			if err != nil {
+				fmt.Printf("\n✗ Coefficient extraction failed: %v\n", err)
+			} else if coeffMessage == message {
+				fmt.Println("✓ SUCCESS: Coefficient-domain message matches original!")
+			} else {
+				fmt.Printf("✗ MISMATCH: Expected \"%s\", got \"%s\"\n", message, coeffMessage)
+			}
+		}
+	}
+
 	// Summary
 	fmt.Println("\n\n╔════════════════════════════════════════════════════════════╗")
 	fmt.Println("║  DIAGNOSTIC SUMMARY                                        ║")
@@ -251,4 +276,5 @@ func main() {
 	fmt.Println("  - Test 4: Analyzes single tile bit-by-bit")
 	fmt.Println("  - Test 5: Checks single 8x8 block coefficients")
 	fmt.Println("  - Test 6: Standard extraction process")
+	fmt.Println("  - Test 7: JPEG coefficient-domain embed/extract (JPEG input only)")
 }